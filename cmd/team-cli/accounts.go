@@ -1,56 +1,497 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
+	"log/slog"
 	"maps"
+	"path"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/csnewman/team-cli/internal/color"
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/csnewman/team-cli/internal/progress"
 	"github.com/csnewman/team-cli/internal/team"
+	"github.com/csnewman/team-cli/internal/transport"
 	"github.com/spf13/cobra"
 )
 
-func listAccountsCmdRun(cmd *cobra.Command, args []string) error {
-	cfg, err := readConfigReAuth(cmd.Context())
+type accountView struct {
+	ID    string      `json:"id"`
+	Name  string      `json:"name"`
+	Roles []*roleView `json:"roles"`
+}
+
+type roleView struct {
+	ID                         string     `json:"id"`
+	Name                       string     `json:"name"`
+	MaxDurationWithApproval    int        `json:"maxDurationWithApproval"`
+	MaxDurationWithoutApproval int        `json:"maxDurationWithoutApproval"`
+	ActiveUntil                *time.Time `json:"activeUntil,omitempty"`
+}
+
+type accountList []*accountView
+
+func newAccountList(accounts map[string]*team.Account) accountList {
+	sortedAccs := slices.SortedFunc(maps.Values(accounts), func(a *team.Account, b *team.Account) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.ID, b.ID))
+	})
+
+	out := make(accountList, 0, len(sortedAccs))
+
+	for _, account := range sortedAccs {
+		roles := slices.SortedFunc(maps.Values(account.Roles), func(a *team.Role, b *team.Role) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+
+		view := &accountView{
+			ID:    account.ID,
+			Name:  account.Name,
+			Roles: make([]*roleView, 0, len(roles)),
+		}
+
+		for _, role := range roles {
+			view.Roles = append(view.Roles, &roleView{
+				ID:                         role.ID,
+				Name:                       role.Name,
+				MaxDurationWithApproval:    role.MaxDurApproval,
+				MaxDurationWithoutApproval: role.MaxDurNoApproval,
+			})
+		}
+
+		out = append(out, view)
+	}
+
+	return out
+}
+
+func (l accountList) IDs() []string {
+	ids := make([]string, 0, len(l))
+
+	for _, account := range l {
+		ids = append(ids, account.ID)
+	}
+
+	return ids
+}
+
+// markActive annotates the roles held through the given active sessions with when that access ends.
+func (l accountList) markActive(sessions []*team.PermissionRequest) {
+	for _, session := range sessions {
+		end := session.End().UTC()
+
+		for _, account := range l {
+			if account.ID != session.AccountID {
+				continue
+			}
+
+			for _, role := range account.Roles {
+				if role.ID == session.RoleID || (session.RoleID == "" && strings.EqualFold(role.Name, session.Role)) {
+					role.ActiveUntil = &end
+				}
+			}
+		}
+	}
+}
+
+// onlyActive returns the accounts with at least one active role, keeping only their active roles.
+func (l accountList) onlyActive() accountList {
+	out := make(accountList, 0, len(l))
+
+	for _, account := range l {
+		roles := slices.DeleteFunc(slices.Clone(account.Roles), func(r *roleView) bool {
+			return r.ActiveUntil == nil
+		})
+
+		if len(roles) == 0 {
+			continue
+		}
+
+		out = append(out, &accountView{ID: account.ID, Name: account.Name, Roles: roles})
+	}
+
+	return out
+}
+
+// accountSortKeys are the keys accepted by list-accounts --sort.
+var accountSortKeys = []string{"name", "id", "roles"}
+
+// sort orders the list by the given key. The sort is stable, so accounts with equal keys keep their existing
+// (name-ordered) relative order.
+func (l accountList) sort(key string, reverse bool) error {
+	var compare func(a, b *accountView) int
+
+	switch strings.ToLower(key) {
+	case "name":
+		compare = func(a, b *accountView) int {
+			return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+	case "id":
+		compare = func(a, b *accountView) int {
+			return strings.Compare(a.ID, b.ID)
+		}
+	case "roles":
+		compare = func(a, b *accountView) int {
+			return cmp.Compare(len(a.Roles), len(b.Roles))
+		}
+	default:
+		return fmt.Errorf(
+			"%w: unknown sort key %q, expected one of: %s",
+			ErrUsage,
+			key,
+			strings.Join(accountSortKeys, ", "),
+		)
+	}
+
+	if reverse {
+		forward := compare
+		compare = func(a, b *accountView) int {
+			return forward(b, a)
+		}
+	}
+
+	slices.SortStableFunc(l, compare)
+
+	return nil
+}
+
+// accountCSVHeaders is the stable column order of the csv output, documented in the list-accounts help text.
+var accountCSVHeaders = []string{
+	"account_id",
+	"account_name",
+	"role_id",
+	"role_name",
+	"max_duration_with_approval",
+	"max_duration_without_approval",
+	"active_until",
+}
+
+func (l accountList) Table() *output.Table {
+	table := &output.Table{
+		Headers: accountCSVHeaders,
+	}
+
+	for _, account := range l {
+		if len(account.Roles) == 0 {
+			table.Rows = append(table.Rows, []string{account.ID, account.Name, "", "", "", "", ""})
+
+			continue
+		}
+
+		for _, role := range account.Roles {
+			activeUntil := ""
+
+			if role.ActiveUntil != nil {
+				activeUntil = role.ActiveUntil.Format(time.RFC3339)
+			}
+
+			table.Rows = append(table.Rows, []string{
+				account.ID,
+				account.Name,
+				role.ID,
+				role.Name,
+				strconv.Itoa(role.MaxDurationWithApproval),
+				strconv.Itoa(role.MaxDurationWithoutApproval),
+				activeUntil,
+			})
+		}
+	}
+
+	return table
+}
+
+// accountColumns are the column names accepted by list-accounts --columns.
+var accountColumns = []string{"index", "id", "name", "role", "max_duration", "approval_required", "active"}
+
+func (l accountList) TextTable() *output.Table {
+	table := &output.Table{
+		Keys:    accountColumns,
+		Headers: []string{"#", "ID", "NAME", "ROLE", "MAX DURATION", "APPROVAL REQUIRED", "ACTIVE"},
+	}
+
+	for i, account := range l {
+		index := "[" + strconv.Itoa(i+1) + "]"
+
+		if len(account.Roles) == 0 {
+			table.Rows = append(table.Rows, []string{index, account.ID, account.Name, "", "", "", ""})
+
+			continue
+		}
+
+		for j, role := range account.Roles {
+			row := []string{
+				"",
+				"",
+				"",
+				role.Name,
+				team.FormatDuration(team.Hours(role.MaxDurationWithApproval)),
+				approvalRequired(role),
+				activeMarker(role),
+			}
+
+			// Only the first role of each account repeats the account details, to keep the table scannable.
+			if j == 0 {
+				row[0], row[1], row[2] = index, account.ID, account.Name
+			}
+
+			table.Rows = append(table.Rows, row)
+		}
+	}
+
+	return table
+}
+
+func (l accountList) Summary() string {
+	roles, needApproval := 0, 0
+
+	for _, account := range l {
+		roles += len(account.Roles)
+
+		for _, role := range account.Roles {
+			if role.MaxDurationWithoutApproval < role.MaxDurationWithApproval {
+				needApproval++
+			}
+		}
+	}
+
+	return fmt.Sprintf(
+		"%s, %s (%d require approval)",
+		plural(len(l), "account", "accounts"),
+		plural(roles, "role", "roles"),
+		needApproval,
+	)
+}
+
+func plural(n int, singular string, pluralForm string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+
+	return strconv.Itoa(n) + " " + pluralForm
+}
+
+func activeMarker(role *roleView) string {
+	if role.ActiveUntil == nil {
+		return ""
+	}
+
+	left := time.Until(*role.ActiveUntil)
+	if left <= 0 {
+		return color.Status("ended")
+	}
+
+	return color.Apply(color.Green, "ACTIVE") + " (" + team.FormatDuration(left.Truncate(time.Minute)) + " left)"
+}
+
+func approvalRequired(role *roleView) string {
+	switch {
+	case role.MaxDurationWithoutApproval == 0:
+		return "yes"
+	case role.MaxDurationWithoutApproval >= role.MaxDurationWithApproval:
+		return "no"
+	default:
+		return "above " + team.FormatDuration(team.Hours(role.MaxDurationWithoutApproval))
+	}
+}
+
+// accountFilter narrows a set of accounts by a case-insensitive glob on the account name and by eligible role.
+// Empty fields do not filter.
+type accountFilter struct {
+	NamePattern string
+	Role        string
+}
+
+func accountFilterFromFlags(cmd *cobra.Command) (*accountFilter, error) {
+	pattern, err := cmd.Flags().GetString("filter")
+	if err != nil {
+		return nil, fmt.Errorf("filter flag: %w", err)
+	}
+
+	role, err := cmd.Flags().GetString("role")
 	if err != nil {
-		return fmt.Errorf("could not read config and authenticate: %w", err)
+		return nil, fmt.Errorf("role flag: %w", err)
 	}
 
-	fmt.Println()
-	fmt.Println("Fetching AWS accounts")
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("%w: invalid filter pattern %q: %w", ErrUsage, pattern, err)
+	}
+
+	return &accountFilter{
+		NamePattern: pattern,
+		Role:        role,
+	}, nil
+}
 
-	accounts, err := team.FetchAccounts(cmd.Context(), cfg.ServerConfig, cfg.AuthToken)
+func (f *accountFilter) IsEmpty() bool {
+	return f.NamePattern == "" && f.Role == ""
+}
+
+func (f *accountFilter) Matches(acc *team.Account) bool {
+	if f.NamePattern != "" {
+		if ok, _ := path.Match(strings.ToLower(f.NamePattern), strings.ToLower(acc.Name)); !ok {
+			return false
+		}
+	}
+
+	if f.Role != "" {
+		return slices.ContainsFunc(slices.Collect(maps.Values(acc.Roles)), func(r *team.Role) bool {
+			return strings.EqualFold(r.ID, f.Role) || strings.EqualFold(r.Name, f.Role)
+		})
+	}
+
+	return true
+}
+
+// Apply returns the accounts matching the filter.
+func (f *accountFilter) Apply(accounts map[string]*team.Account) map[string]*team.Account {
+	out := make(map[string]*team.Account, len(accounts))
+
+	for id, acc := range accounts {
+		if f.Matches(acc) {
+			out[id] = acc
+		}
+	}
+
+	return out
+}
+
+// fetchAccounts fetches the accounts of the selected profile, caching them, along with the active sessions. Failing
+// to fetch the sessions is only reported, unless they are needed for --only-active.
+func fetchAccounts(cmd *cobra.Command, quiet bool, onlyActive bool) (
+	map[string]*team.Account,
+	[]*team.PermissionRequest,
+	error,
+) {
+	cfg, err := resolveConfig(cmd)
 	if err != nil {
-		return fmt.Errorf("could not fetch accounts: %w", err)
+		return nil, nil, fmt.Errorf("could not read config and authenticate: %w", err)
 	}
 
-	if err := cacheAccounts(accounts); err != nil {
-		return fmt.Errorf("could not cache accounts: %w", err)
+	if !quiet {
+		fmt.Fprintln(cmd.ErrOrStderr())
+		fmt.Fprintln(cmd.ErrOrStderr(), "Fetching AWS accounts")
 	}
 
-	sortedAccs := slices.SortedFunc(maps.Values(accounts), func(a *team.Account, b *team.Account) int {
-		return strings.Compare(a.Name, b.Name)
+	ctx, stopSpinner := startSpinner(cmd, "fetching accounts")
+	accounts, err := retryUnauthorized(cmd, cfg, func() (map[string]*team.Account, error) {
+		return team.FetchAccounts(ctx, cfg.ServerConfig, cfg.AuthToken)
 	})
 
-	fmt.Println()
-	fmt.Println("Accounts:")
+	var (
+		sessions    []*team.PermissionRequest
+		sessionsErr error
+	)
 
-	for i, account := range sortedAccs {
-		fmt.Printf("  [%d] id=%q name=%q\n", i+1, account.ID, account.Name)
+	if err == nil {
+		progress.Report(ctx, "fetching active sessions")
+		sessions, sessionsErr = team.ListRequests(ctx, cfg.ServerConfig, cfg.AuthToken, team.ListRequestsFilterMyActive)
+	}
 
-		roles := slices.SortedFunc(maps.Values(account.Roles), func(a *team.Role, b *team.Role) int {
-			return strings.Compare(a.Name, b.Name)
-		})
+	stopSpinner()
 
-		for _, role := range roles {
-			fmt.Printf(
-				"    - role=%q max_duration_with_approval=%d max_duration_without_approval=%d\n",
-				role.Name,
-				role.MaxDurApproval,
-				role.MaxDurNoApproval,
-			)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not fetch accounts: %w", err)
+	}
+
+	if sessionsErr != nil {
+		// Active markers are a convenience, so the listing is still shown without them unless they were the point.
+		if onlyActive {
+			return nil, nil, fmt.Errorf("could not fetch active sessions: %w", sessionsErr)
 		}
+
+		slog.Debug("Could not fetch active sessions", "err", sessionsErr)
+		fmt.Fprintln(cmd.ErrOrStderr(), "Note: could not fetch active sessions, active roles are not marked")
 	}
 
-	return nil
+	if cfg.persistent() {
+		if err := cacheAccounts(cfg.ProfileName, accounts); err != nil {
+			return nil, nil, fmt.Errorf("could not cache accounts: %w", err)
+		}
+	}
+
+	if !quiet {
+		fmt.Fprintln(cmd.ErrOrStderr())
+	}
+
+	return accounts, sessions, nil
+}
+
+func listAccountsCmdRun(cmd *cobra.Command, args []string) error {
+	if _, err := outputFormat(cmd); err != nil {
+		return err
+	}
+
+	sortKey, err := cmd.Flags().GetString("sort")
+	if err != nil {
+		return fmt.Errorf("sort flag: %w", err)
+	}
+
+	reverse, err := cmd.Flags().GetBool("reverse")
+	if err != nil {
+		return fmt.Errorf("reverse flag: %w", err)
+	}
+
+	// Validate the sort key before doing any network work.
+	if err := (accountList{}).sort(sortKey, reverse); err != nil {
+		return err
+	}
+
+	filter, err := accountFilterFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	onlyActive, err := cmd.Flags().GetBool("only-active")
+	if err != nil {
+		return fmt.Errorf("only-active flag: %w", err)
+	}
+
+	quiet, err := quietMode(cmd)
+	if err != nil {
+		return err
+	}
+
+	var (
+		accounts map[string]*team.Account
+		sessions []*team.PermissionRequest
+	)
+
+	if offlineMode {
+		if onlyActive {
+			return fmt.Errorf("%w: --only-active needs the current sessions from the server", transport.ErrOffline)
+		}
+
+		accounts, err = offlineAccounts(cmd)
+	} else {
+		accounts, sessions, err = fetchAccounts(cmd, quiet, onlyActive)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	list := newAccountList(filter.Apply(accounts))
+	list.markActive(sessions)
+
+	if onlyActive {
+		list = list.onlyActive()
+	}
+
+	if err := list.sort(sortKey, reverse); err != nil {
+		return err
+	}
+
+	if len(list) == 0 && (!filter.IsEmpty() || onlyActive) {
+		fmt.Fprintln(cmd.ErrOrStderr(), "No accounts match the given filters")
+
+		// Structured consumers still get a well-formed empty result.
+		if format, _ := outputFormat(cmd); format == output.FormatTable && !cmd.Flags().Changed("format") {
+			return nil
+		}
+	}
+
+	return render(cmd, list)
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+func testAccounts() map[string]*team.Account {
+	role := func(name string) map[string]*team.Role {
+		return map[string]*team.Role{name: {ID: name, Name: name, MaxDurApproval: 8, MaxDurNoApproval: 4}}
+	}
+
+	return map[string]*team.Account{
+		"3": {ID: "3", Name: "bravo", Roles: role("Admin")},
+		"1": {ID: "1", Name: "charlie", Roles: map[string]*team.Role{}},
+		"2": {ID: "2", Name: "alpha", Roles: role("ReadOnly")},
+		"4": {ID: "4", Name: "Delta", Roles: role("Admin")},
+	}
+}
+
+func TestAccountListSort(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		key     string
+		reverse bool
+		ids     []string
+	}{
+		{"name", false, []string{"2", "3", "1", "4"}},
+		{"name", true, []string{"4", "1", "3", "2"}},
+		{"id", false, []string{"1", "2", "3", "4"}},
+		// Equal role counts keep their name order.
+		{"roles", false, []string{"1", "4", "2", "3"}},
+		{"roles", true, []string{"4", "2", "3", "1"}},
+	} {
+		list := newAccountList(testAccounts())
+
+		require.NoError(t, list.sort(tc.key, tc.reverse))
+		require.Equal(t, tc.ids, list.IDs(), "%s reverse=%v", tc.key, tc.reverse)
+	}
+
+	err := newAccountList(testAccounts()).sort("created", false)
+	require.ErrorIs(t, err, ErrUsage)
+	require.ErrorContains(t, err, "expected one of: name, id, roles")
+}
+
+func TestAccountFilter(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		filter accountFilter
+		ids    []string
+	}{
+		{accountFilter{}, []string{"4", "2", "3", "1"}},
+		{accountFilter{NamePattern: "d*"}, []string{"4"}},
+		{accountFilter{NamePattern: "*A"}, []string{"4", "2"}},
+		{accountFilter{Role: "admin"}, []string{"4", "3"}},
+		{accountFilter{NamePattern: "*a*", Role: "Admin"}, []string{"4", "3"}},
+		{accountFilter{NamePattern: "alpha", Role: "Admin"}, []string{}},
+	} {
+		list := newAccountList(tc.filter.Apply(testAccounts()))
+
+		require.Equal(t, tc.ids, list.IDs(), "%+v", tc.filter)
+	}
+}
+
+func TestAccountListActive(t *testing.T) {
+	t.Parallel()
+
+	list := newAccountList(testAccounts())
+	list.markActive([]*team.PermissionRequest{
+		{AccountID: "3", RoleID: "Admin", StartTime: time.Now(), Duration: "2"},
+		{AccountID: "4", Role: "admin", EndTime: time.Now().Add(-time.Hour)},
+	})
+
+	active := list.onlyActive()
+	require.Equal(t, []string{"4", "3"}, active.IDs())
+	require.Contains(t, activeMarker(active[1].Roles[0]), "ACTIVE (1h59m left)")
+	require.Equal(t, "ended", activeMarker(active[0].Roles[0]))
+	require.Empty(t, activeMarker(list[1].Roles[0]))
+}
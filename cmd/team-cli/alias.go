@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/spf13/cobra"
+)
+
+func aliasSetCmdRun(cmd *cobra.Command, args []string) error {
+	name, target := args[0], args[1]
+
+	_, err := updateConfig(cmd.Context(), func(cfg *Config) (bool, error) {
+		if cfg.Aliases == nil {
+			cfg.Aliases = make(map[string]string)
+		}
+
+		cfg.Aliases[name] = target
+
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not update config: %w", err)
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Alias %q now refers to %q\n", name, target)
+
+	return nil
+}
+
+type aliasView struct {
+	Alias   string `json:"alias"`
+	Account string `json:"account"`
+}
+
+type aliasList []*aliasView
+
+func (l aliasList) Table() *output.Table {
+	table := &output.Table{
+		Headers: []string{"alias", "account"},
+	}
+
+	for _, alias := range l {
+		table.Rows = append(table.Rows, []string{alias.Alias, alias.Account})
+	}
+
+	return table
+}
+
+func (l aliasList) Summary() string {
+	return plural(len(l), "alias", "aliases")
+}
+
+func (l aliasList) TextTable() *output.Table {
+	table := l.Table()
+	table.Keys = table.Headers
+	table.Headers = []string{"ALIAS", "ACCOUNT"}
+
+	return table
+}
+
+func aliasListCmdRun(cmd *cobra.Command, args []string) error {
+	cfg, err := readConfigOrEmpty()
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+
+	out := make(aliasList, 0, len(cfg.Aliases))
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Aliases)) {
+		out = append(out, &aliasView{
+			Alias:   name,
+			Account: cfg.Aliases[name],
+		})
+	}
+
+	return render(cmd, out)
+}
+
+func aliasRmCmdRun(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	_, err := updateConfig(cmd.Context(), func(cfg *Config) (bool, error) {
+		if _, ok := cfg.Aliases[name]; !ok {
+			return false, fmt.Errorf("%w: alias %q not found", ErrInvalid, name)
+		}
+
+		delete(cfg.Aliases, name)
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Alias %q removed\n", name)
+
+	return nil
+}
+
+// resolveAccountAlias returns the account the given alias refers to, or the input unchanged if it is not an alias.
+func resolveAccountAlias(cfg *Config, account string) (string, bool) {
+	if target, ok := cfg.Aliases[account]; ok {
+		slog.Debug("Resolved account alias", "alias", account, "account", target)
+
+		return target, true
+	}
+
+	// Aliases differing only in case could all match, so they are tried in sorted order for the same one to win
+	// every time.
+	for _, name := range slices.Sorted(maps.Keys(cfg.Aliases)) {
+		if strings.EqualFold(name, account) {
+			target := cfg.Aliases[name]
+			slog.Debug("Resolved account alias", "alias", name, "account", target)
+
+			return target, true
+		}
+	}
+
+	return account, false
+}
+
+// findAccount looks up an account by ID or name, resolving aliases first. When an alias shadows a real account
+// name, the alias wins and a warning is logged.
+func findAccount(cfg *Config, accounts map[string]*team.Account, account string) *team.Account {
+	resolved, aliased := resolveAccountAlias(cfg, account)
+
+	if aliased {
+		for _, acc := range accounts {
+			if matchesAccount(acc, account) && !matchesAccount(acc, resolved) {
+				slog.Warn(
+					"Alias conflicts with an account name, using the alias",
+					"alias", account,
+					"alias_account", resolved,
+					"shadowed_account", acc.Name,
+				)
+
+				break
+			}
+		}
+	}
+
+	for _, acc := range accounts {
+		if matchesAccount(acc, resolved) {
+			return acc
+		}
+	}
+
+	return nil
+}
+
+func matchesAccount(acc *team.Account, account string) bool {
+	return strings.EqualFold(acc.ID, account) || strings.EqualFold(acc.Name, account)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveAccountAlias(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{Profile: &Profile{Aliases: map[string]string{
+		"pay": "payments-prod",
+		"PAY": "payments-dev",
+		"Pay": "payments-test",
+		"ops": "operations",
+	}}}
+
+	target, ok := resolveAccountAlias(cfg, "pay")
+	require.True(t, ok)
+	require.Equal(t, "payments-prod", target, "an exact match wins")
+
+	// Aliases that only match ignoring case resolve the same way every time, to the first in sorted order.
+	for range 20 {
+		target, ok = resolveAccountAlias(cfg, "pAy")
+		require.True(t, ok)
+		require.Equal(t, "payments-dev", target)
+	}
+
+	target, ok = resolveAccountAlias(cfg, "OPS")
+	require.True(t, ok)
+	require.Equal(t, "operations", target)
+
+	target, ok = resolveAccountAlias(cfg, "payments")
+	require.False(t, ok)
+	require.Equal(t, "payments", target)
+}
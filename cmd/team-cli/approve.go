@@ -3,68 +3,93 @@ package main
 import (
 	"fmt"
 	"time"
+	"unicode/utf8"
 
+	"github.com/csnewman/team-cli/internal/color"
+	"github.com/csnewman/team-cli/internal/output"
 	"github.com/csnewman/team-cli/internal/team"
 	"github.com/spf13/cobra"
 )
 
 func approveCmdRun(cmd *cobra.Command, args []string) error {
-	cfg, err := readConfigReAuth(cmd.Context())
+	full, err := cmd.Flags().GetBool("full")
+	if err != nil {
+		return fmt.Errorf("full flag: %w", err)
+	}
+
+	cfg, err := resolveConfig(cmd)
 	if err != nil {
 		return fmt.Errorf("could not read config and authenticate: %w", err)
 	}
 
-	requests, err := team.ListRequests(cmd.Context(), cfg.ServerConfig, cfg.AuthToken, team.ListRequestsFilterRequiresMyApproval)
+	// approve has no data output, so everything is informational and shown on stderr.
+	info := cmd.ErrOrStderr()
+
+	requests, err := retryUnauthorized(cmd, cfg, func() ([]*team.PermissionRequest, error) {
+		return team.ListRequests(cmd.Context(), cfg.ServerConfig, cfg.AuthToken, team.ListRequestsFilterRequiresMyApproval)
+	})
 	if err != nil {
 		return fmt.Errorf("could not fetch requests: %w", err)
 	}
 
-	fmt.Println()
+	fmt.Fprintln(info)
 
 	if len(requests) == 0 {
-		fmt.Println("There are no requests to approve")
+		fmt.Fprintln(info, "There are no requests to approve")
 
 		return nil
 	}
 
-	fmt.Println("Please select the request:")
+	width := output.TerminalWidth(info)
+
+	fmt.Fprintln(info, "Please select the request:")
 	for i, req := range requests {
-		fmt.Printf(
-			"  [%d] requester=%q account=%q role=%q\n",
+		fmt.Fprintf(
+			info,
+			"  [%d] requester=%q account=%q role=%q status=%s\n",
 			i+1,
 			req.Email,
 			req.AccountName,
 			req.Role,
+			color.Status(req.Status),
 		)
-		fmt.Printf(
+		fmt.Fprintf(
+			info,
 			"\taccount_id=%q requested=%q start_time=%q duration=%q \n",
-			req.AccountID, fmtDate(req.CreatedAt), fmtDate(req.StartTime), req.Duration+" hours",
+			req.AccountID, fmtDate(req.CreatedAt), fmtDate(req.StartTime), fmtHours(req.Duration),
 		)
-		fmt.Printf(
+		justification := req.Justification
+
+		if !full {
+			justification = truncateJustification(req.TicketNo, justification, width)
+		}
+
+		fmt.Fprintf(
+			info,
 			"\tticket=%q justification=%q\n",
 			req.TicketNo,
-			req.Justification,
+			justification,
 		)
 	}
 
-	fmt.Println()
+	fmt.Fprintln(info)
 
-	idx, err := promptSelection("Request option? ", 1, len(requests))
+	idx, err := promptSelection("Request option? ", 1, len(requests), input{name: "request selection"})
 	if err != nil {
 		return fmt.Errorf("could not select request: %w", err)
 	}
 
 	selectedRequest := requests[idx-1]
 
-	fmt.Println()
-	fmt.Println("Please select the response:")
-	fmt.Println("  [1] Approve")
-	fmt.Println("  [2] Approve without comment")
-	fmt.Println("  [3] Reject")
-	fmt.Println("  [4] Reject without comment")
-	fmt.Println()
+	fmt.Fprintln(info)
+	fmt.Fprintln(info, "Please select the response:")
+	fmt.Fprintln(info, "  [1] Approve")
+	fmt.Fprintln(info, "  [2] Approve without comment")
+	fmt.Fprintln(info, "  [3] Reject")
+	fmt.Fprintln(info, "  [4] Reject without comment")
+	fmt.Fprintln(info)
 
-	idx, err = promptSelection("Response option? ", 1, 4)
+	idx, err = promptSelection("Response option? ", 1, 4, input{name: "response"})
 	if err != nil {
 		return fmt.Errorf("could not select request: %w", err)
 	}
@@ -73,7 +98,7 @@ func approveCmdRun(cmd *cobra.Command, args []string) error {
 	approve := idx < 3
 
 	if idx == 1 || idx == 3 {
-		comment, err = promptString("Comment? ")
+		comment, err = promptString("Comment? ", input{name: "comment"})
 		if err != nil {
 			return fmt.Errorf("could not read comment: %w", err)
 		}
@@ -84,31 +109,32 @@ func approveCmdRun(cmd *cobra.Command, args []string) error {
 		Comment: comment,
 	}
 
-	fmt.Println("")
-	fmt.Println("Details:")
-	fmt.Printf("  ID: %q\n", selectedRequest.ID)
-	fmt.Printf("  Requester: email=%q\n", selectedRequest.Email)
-	fmt.Printf("  Account: id=%q name=%q\n", selectedRequest.AccountID, selectedRequest.AccountName)
-	fmt.Printf("  Role: name=%q\n", selectedRequest.Role)
-	fmt.Printf("  Created: %q\n", fmtDate(selectedRequest.CreatedAt))
-	fmt.Printf("  Start: %q\n", fmtDate(selectedRequest.StartTime))
-	fmt.Printf("  Duration: %q\n", selectedRequest.Duration+" Hours")
-	fmt.Printf("  Ticket: %q\n", selectedRequest.TicketNo)
-	fmt.Printf("  Justification: %q\n", selectedRequest.Justification)
+	fmt.Fprintln(info, "")
+	fmt.Fprintln(info, "Details:")
+	fmt.Fprintf(info, "  ID: %q\n", selectedRequest.ID)
+	fmt.Fprintf(info, "  Requester: email=%q\n", selectedRequest.Email)
+	fmt.Fprintf(info, "  Account: id=%q name=%q\n", selectedRequest.AccountID, selectedRequest.AccountName)
+	fmt.Fprintf(info, "  Role: name=%q\n", selectedRequest.Role)
+	fmt.Fprintf(info, "  Status: %s\n", color.Status(selectedRequest.Status))
+	fmt.Fprintf(info, "  Created: %q\n", fmtDate(selectedRequest.CreatedAt))
+	fmt.Fprintf(info, "  Start: %q\n", fmtDate(selectedRequest.StartTime))
+	fmt.Fprintf(info, "  Duration: %q\n", fmtHours(selectedRequest.Duration))
+	fmt.Fprintf(info, "  Ticket: %q\n", selectedRequest.TicketNo)
+	fmt.Fprintf(info, "  Justification: %q\n", selectedRequest.Justification)
 
 	if approve {
-		fmt.Print("  Response Action: Approve\n")
+		fmt.Fprintf(info, "  Response Action: %s\n", color.Apply(color.Green, "Approve"))
 		accResp.Status = "approved"
 	} else {
-		fmt.Print("  Response Action: Reject\n")
+		fmt.Fprintf(info, "  Response Action: %s\n", color.Apply(color.Red, "Reject"))
 		accResp.Status = "rejected"
 	}
 
-	fmt.Printf("  Response Comment: %q\n", comment)
+	fmt.Fprintf(info, "  Response Comment: %q\n", comment)
 
-	fmt.Println()
+	fmt.Fprintln(info)
 
-	cont, err := promptBool("Confirm (y/n)? ")
+	cont, err := promptBool("Confirm (y/n)? ", input{name: "confirmation"})
 	if err != nil {
 		return fmt.Errorf("could not select confirmation: %w", err)
 	}
@@ -117,15 +143,61 @@ func approveCmdRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("%w: confirmation rejected", ErrInvalid)
 	}
 
-	if err := team.Respond(cmd.Context(), cfg.ServerConfig, cfg.AuthToken, accResp); err != nil {
+	if _, err := retryUnauthorized(cmd, cfg, func() (struct{}, error) {
+		return struct{}{}, team.Respond(cmd.Context(), cfg.ServerConfig, cfg.AuthToken, accResp)
+	}); err != nil {
 		return fmt.Errorf("could not respond to request: %w", err)
 	}
 
-	fmt.Println("Responded")
+	fmt.Fprintln(info, "Responded")
+
+	action := historyApprove
+	if !approve {
+		action = historyReject
+	}
+
+	recordHistory(cfg, &historyEntry{
+		Action:    action,
+		Server:    cfg.ServerConfig.Server,
+		RequestID: selectedRequest.ID,
+		AccountID: selectedRequest.AccountID,
+		Role:      selectedRequest.Role,
+	})
 
 	return nil
 }
 
+// minJustificationWidth is the narrowest a truncated justification is shown, so very narrow terminals still give
+// some context.
+const minJustificationWidth = 16
+
+// truncateJustification shortens a justification so its picker line fits within width. A width of 0 disables
+// truncation.
+func truncateJustification(ticket string, justification string, width int) string {
+	if width <= 0 {
+		return justification
+	}
+
+	// The line is rendered as a tab (counted as 8 columns), the quoted ticket and the quoted justification.
+	used := 8 + utf8.RuneCountInString(fmt.Sprintf("ticket=%q justification=\"\"", ticket))
+
+	return output.Truncate(justification, max(minJustificationWidth, width-used))
+}
+
+// displayLocation is the time zone timestamps are shown in, selected by --utc or the utc config option.
+var displayLocation = time.Local
+
+// fmtDate renders a timestamp for display, including the zone abbreviation so the zone is never ambiguous.
 func fmtDate(t time.Time) string {
-	return t.Local().Format(time.UnixDate)
+	return t.In(displayLocation).Format(time.UnixDate)
+}
+
+// fmtHours renders a TEAM duration string for display, falling back to the raw value if it cannot be parsed.
+func fmtHours(raw string) string {
+	d, err := team.ParseHours(raw)
+	if err != nil {
+		return raw + " hours"
+	}
+
+	return team.FormatDuration(d)
 }
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateJustification(t *testing.T) {
+	t.Parallel()
+
+	long := "Investigating the überlange incident in production — see runbook"
+
+	require.Equal(t, long, truncateJustification("INC-1", long, 0))
+	require.Equal(t, long, truncateJustification("INC-1", long, 200))
+
+	got := truncateJustification("INC-1", long, 60)
+	require.Equal(t, "Investigating the üb…", got)
+
+	// Narrow terminals still show a minimum amount of context.
+	require.Equal(t, "Investigating t…", truncateJustification("INC-1", long, 10))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// backupSuffix names the copy of the previous config file, and of its credentials file, kept on every change the user
+// makes.
+const backupSuffix = ".bak"
+
+var ErrNoBackup = errors.New("no config backup")
+
+// backupConfig keeps the config file at path and its credentials as they are before they are rewritten, so that a
+// bad change, such as configuring the wrong server, can be undone with config restore. The two files are backed up
+// together: a config without credentials leaves no credentials backup, so a restore never mixes generations.
+func backupConfig(path string) error {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read config file for backup: %w", err)
+	}
+
+	store, err := credentialStoreFor(path)
+	if err != nil {
+		return err
+	}
+
+	creds, ok, err := store.load()
+	if err != nil {
+		return fmt.Errorf("failed to read credentials for backup: %w", err)
+	}
+
+	if err := replaceCredentials(store.backup(), creds, ok); err != nil {
+		return fmt.Errorf("failed to back up credentials: %w", err)
+	}
+
+	if err := writeFileAtomic(path+backupSuffix, raw, 0600); err != nil {
+		return fmt.Errorf("failed to back up config file: %w", err)
+	}
+
+	return nil
+}
+
+// swapFiles exchanges the files at a and b, either of which may be missing.
+func swapFiles(a string, b string) error {
+	tmp := a + ".swap"
+
+	if err := renameIfExists(a, tmp); err != nil {
+		return err
+	}
+
+	if err := renameIfExists(b, a); err != nil {
+		return err
+	}
+
+	return renameIfExists(tmp, b)
+}
+
+func renameIfExists(from string, to string) error {
+	if _, err := os.Stat(from); errors.Is(err, os.ErrNotExist) {
+		if err := os.Remove(to); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", to, err)
+		}
+
+		return nil
+	}
+
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to move %s: %w", from, err)
+	}
+
+	return nil
+}
+
+func configRestoreCmdRun(cmd *cobra.Command, _ []string) error {
+	autoConfirm, err := cmd.Flags().GetBool("confirm")
+	if err != nil {
+		return fmt.Errorf("confirm flag: %w", err)
+	}
+
+	path, err := configFilePath()
+	if err != nil {
+		return fmt.Errorf("failed to get config path: %w", err)
+	}
+
+	unlock, err := lockConfig(cmd.Context(), path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	info, err := os.Stat(path + backupSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s does not exist", ErrNoBackup, path+backupSuffix)
+	} else if err != nil {
+		return fmt.Errorf("failed to read config backup: %w", err)
+	}
+
+	if !autoConfirm {
+		ok, err := promptBool(
+			fmt.Sprintf("Restore the config from %s (y/n)? ", fmtDate(info.ModTime())),
+			input{name: "confirmation", flag: "--confirm"},
+		)
+		if err != nil {
+			return fmt.Errorf("could not select confirmation: %w", err)
+		}
+
+		if !ok {
+			return fmt.Errorf("%w: confirmation rejected", ErrInvalid)
+		}
+	}
+
+	store, err := credentialStoreFor(path)
+	if err != nil {
+		return err
+	}
+
+	// The current files become the backup, so a restore can itself be undone by restoring again.
+	if err := swapCredentials(store, store.backup()); err != nil {
+		return fmt.Errorf("could not restore credentials: %w", err)
+	}
+
+	if err := swapFiles(path, path+backupSuffix); err != nil {
+		return fmt.Errorf("could not restore config: %w", err)
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Restored %s; the replaced config is now the backup\n", path)
+
+	return nil
+}
+
+func configRepairCmdRun(cmd *cobra.Command, _ []string) error {
+	autoConfirm, err := cmd.Flags().GetBool("confirm")
+	if err != nil {
+		return fmt.Errorf("confirm flag: %w", err)
+	}
+
+	path, err := configFilePath()
+	if err != nil {
+		return fmt.Errorf("failed to get config path: %w", err)
+	}
+
+	unlock, err := lockConfig(cmd.Context(), path)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	// A config file that is missing was interrupted on its first write.
+	raw, err := os.ReadFile(path)
+	if err == nil {
+		_, _, err = parseConfig(path, raw)
+		if err == nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Config file %s is valid, nothing to repair\n", path)
+
+			return nil
+		} else if errors.Is(err, ErrConfigTooNew) {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	candidate := findConfigCandidate(path)
+	if candidate == "" {
+		return fmt.Errorf("%w: no interrupted write of %s to restore", ErrNoBackup, path)
+	}
+
+	if !autoConfirm {
+		ok, err := promptBool(
+			fmt.Sprintf("Config file %s is corrupt. Restore it from %s (y/n)? ", path, candidate),
+			input{name: "confirmation", flag: "--confirm"},
+		)
+		if err != nil {
+			return fmt.Errorf("could not select confirmation: %w", err)
+		}
+
+		if !ok {
+			return fmt.Errorf("%w: confirmation rejected", ErrInvalid)
+		}
+	}
+
+	if err := os.Rename(candidate, path); err != nil {
+		return fmt.Errorf("failed to restore config file: %w", err)
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Restored %s from %s\n", path, candidate)
+
+	return nil
+}
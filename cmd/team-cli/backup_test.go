@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigRestore(t *testing.T) {
+	path := writeProfiles(t)
+
+	_, _, err := executeCmd(t, "config", "restore", "--confirm")
+	require.ErrorIs(t, err, ErrNoBackup, "the first write has nothing to back up")
+
+	_, _, err = executeCmd(t, "profile", "delete", "default", "--confirm")
+	require.NoError(t, err)
+
+	requirePrivate(t, path+backupSuffix)
+	requirePrivate(t, credentialsPath(path)+backupSuffix)
+
+	// Tests have no terminal to confirm on, so the flag is required.
+	_, _, err = executeCmd(t, "config", "restore")
+	require.ErrorIs(t, err, ErrUsage)
+
+	_, stderr, err := executeCmd(t, "config", "restore", "-y")
+	require.NoError(t, err)
+	require.Contains(t, stderr, "Restored "+path)
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.True(t, cfg.hasProfile(defaultProfileName))
+	require.NotNil(t, cfg.AuthToken, "the credentials are restored with the config")
+
+	// Restoring again undoes the restore.
+	_, _, err = executeCmd(t, "config", "restore", "-y")
+	require.NoError(t, err)
+
+	cfg, err = readConfig()
+	require.NoError(t, err)
+	require.False(t, cfg.hasProfile(defaultProfileName))
+}
+
+func TestConfigBackupKeptOnTokenRefresh(t *testing.T) {
+	path := writeProfiles(t)
+
+	_, _, err := executeCmd(t, "alias", "set", "pay", "payments")
+	require.NoError(t, err)
+
+	backup, err := os.ReadFile(path + backupSuffix)
+	require.NoError(t, err)
+
+	_, err = updateTokens(context.Background(), func(cfg *Config) (bool, error) {
+		cfg.AuthToken.AccessToken = "refreshed"
+
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	after, err := os.ReadFile(path + backupSuffix)
+	require.NoError(t, err)
+	require.Equal(t, string(backup), string(after), "a refreshed token does not replace the backup")
+
+	_, _, err = executeCmd(t, "config", "restore", "-y")
+	require.NoError(t, err)
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.Empty(t, cfg.Aliases, "restoring undoes the last change the user made")
+}
+
+func TestBackupConfigWithoutCredentials(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{}`), 0600))
+	require.NoError(t, os.WriteFile(credentialsPath(path)+backupSuffix, []byte(`{}`), 0600))
+
+	require.NoError(t, backupConfig(path))
+
+	_, err := os.Stat(credentialsPath(path) + backupSuffix)
+	require.ErrorIs(t, err, os.ErrNotExist, "a stale credentials backup is not paired with a newer config")
+}
@@ -1,60 +1,193 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/csnewman/team-cli/internal/cache"
 	"github.com/csnewman/team-cli/internal/team"
+	"github.com/spf13/cobra"
 )
 
+// cacheDirOverride is the cache directory selected with --cache-dir.
+var cacheDirOverride string
+
+const (
+	accountsCacheName = "accounts.json"
+	keyCacheName      = team.KeyCacheName
+)
+
+// accountsCacheMaxAge bounds how old cached accounts may be to skip fetching them when requesting access. Listing
+// the accounts offline accepts any age, since there is nothing newer to show.
+const accountsCacheMaxAge = 24 * time.Hour
+
 type AccountCache struct {
-	Version  int
-	Accounts map[string]*team.Account
+	// FetchedAt is when the accounts were fetched.
+	FetchedAt time.Time
+	Accounts  map[string]*team.Account
+}
+
+// cacheDir returns the team-cli directory under $XDG_CACHE_HOME, or otherwise in the user cache directory of the
+// platform: ~/.cache, ~/Library/Caches on macOS, or %LocalAppData% on Windows. --cache-dir takes precedence.
+func cacheDir() (string, error) {
+	if cacheDirOverride != "" {
+		return cacheDirOverride, nil
+	}
+
+	if xdg := os.Getenv("XDG_CACHE_HOME"); filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, "team-cli"), nil
+	}
+
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "team-cli"), nil
+	}
+
+	// As with the config, a relative XDG_CACHE_HOME is ignored.
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user dir: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".cache", "team-cli"), nil
 }
 
-func cacheAccounts(acc map[string]*team.Account) error {
-	enc, err := json.MarshalIndent(&AccountCache{
-		Version:  1,
-		Accounts: acc,
-	}, "", "    ")
+// sharedCache returns the cache of data that does not depend on the profile, such as signing keys.
+func sharedCache() (*cache.Store, error) {
+	dir, err := cacheDir()
 	if err != nil {
-		return fmt.Errorf("could not marshal: %w", err)
+		return nil, err
 	}
 
-	path, err := configPath("accounts.json")
+	return cache.Open(dir), nil
+}
+
+// profileCache returns the cache of the named profile. Profiles may hold different identities on the same server,
+// which see different accounts, so each has its own cache.
+func profileCache(profile string) (*cache.Store, error) {
+	shared, err := sharedCache()
 	if err != nil {
-		return fmt.Errorf("could not determine path: %w", err)
+		return nil, err
 	}
 
-	if err := os.WriteFile(path, enc, 0644); err != nil {
-		return fmt.Errorf("could not write: %w", err)
+	name := url.PathEscape(profile)
+
+	// Escaping leaves dots alone, which would make names such as ".." refer to other directories.
+	if strings.Trim(name, ".") == "" {
+		name = strings.ReplaceAll(name, ".", "%2E")
 	}
 
-	return nil
+	return shared.Sub(name), nil
 }
 
-func getAccountsCache() (*AccountCache, bool, error) {
-	path, err := configPath("accounts.json")
+func cacheAccounts(profile string, acc map[string]*team.Account) error {
+	store, err := profileCache(profile)
 	if err != nil {
-		return nil, false, fmt.Errorf("could not determine path: %w", err)
+		return fmt.Errorf("could not determine cache dir: %w", err)
+	}
+
+	if err := store.Put(accountsCacheName, acc); err != nil {
+		return err
 	}
 
-	raw, err := os.ReadFile(path)
+	if profile == defaultProfileName {
+		removeLegacyCache(accountsCacheName)
+	}
+
+	return nil
+}
+
+// getAccountsCache returns the accounts cached for the named profile, unless they are older than maxAge. A maxAge of
+// zero accepts any age.
+func getAccountsCache(profile string, maxAge time.Duration) (*AccountCache, bool, error) {
+	store, err := profileCache(profile)
 	if err != nil {
-		slog.Debug("Could not read account cache", "err", err)
+		return nil, false, fmt.Errorf("could not determine cache dir: %w", err)
+	}
+
+	var accounts map[string]*team.Account
 
+	fetchedAt, ok := store.Get(accountsCacheName, maxAge, &accounts)
+	if !ok {
 		return nil, false, nil
 	}
 
-	var cache *AccountCache
+	return &AccountCache{FetchedAt: fetchedAt, Accounts: accounts}, true, nil
+}
 
-	if err := json.Unmarshal(raw, &cache); err != nil {
-		slog.Warn("Could not parse account cache", "err", err)
+// dropProfileCache removes the cache of a profile that no longer exists under that name. The cache is only an
+// optimisation, so failing to remove it is logged rather than returned.
+func dropProfileCache(profile string) {
+	store, err := profileCache(profile)
+	if err != nil {
+		slog.Debug("Could not determine cache dir", "err", err)
 
-		return nil, false, nil
+		return
+	}
+
+	if err := store.Remove(accountsCacheName); err != nil {
+		slog.Warn("Could not remove profile cache", "dir", store.Dir(), "err", err)
+	}
+}
+
+// removeLegacyCache removes a cache file kept in the config directory by older versions, once its replacement has
+// been written to the cache directory.
+func removeLegacyCache(file string) {
+	dir, err := configDir()
+	if err != nil {
+		return
+	}
+
+	path := filepath.Join(dir, file)
+
+	if err := os.Remove(path); err == nil {
+		slog.Info("Removed cache file from the config directory", "path", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		slog.Debug("Could not remove legacy cache file", "path", path, "err", err)
+	}
+}
+
+func cacheClearCmdRun(cmd *cobra.Command, _ []string) error {
+	store, err := sharedCache()
+	if err != nil {
+		return fmt.Errorf("could not determine cache dir: %w", err)
+	}
+
+	configFile, err := configFilePath()
+	if err != nil {
+		return fmt.Errorf("could not determine config path: %w", err)
+	}
+
+	// A --cache-dir pointing at a directory holding the config must not take the config with it.
+	if rel, err := filepath.Rel(store.Dir(), configFile); err == nil && !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%w: cache dir %s holds the config file %s", ErrInvalid, store.Dir(), configFile)
 	}
 
-	return cache, true, nil
+	// Caches written by older versions are not marked as the cache's own, so their known files are named, for the
+	// profiles in the config as well as the shared cache.
+	if cfg, err := readConfig(); err == nil {
+		for name := range cfg.Profiles {
+			profileStore, err := profileCache(name)
+			if err != nil {
+				return fmt.Errorf("could not determine cache dir: %w", err)
+			}
+
+			if err := profileStore.Remove(accountsCacheName); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := store.Clear(keyCacheName); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Cleared %s\n", store.Dir())
+
+	return nil
 }
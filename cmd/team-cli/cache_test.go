@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheDir(t *testing.T) {
+	home := isolateConfig(t)
+
+	dir, err := cacheDir()
+	require.NoError(t, err)
+
+	switch runtime.GOOS {
+	case "windows":
+		require.Equal(t, filepath.Join(home, "AppData", "Local", "team-cli"), dir)
+	case "darwin":
+		require.Equal(t, filepath.Join(home, "Library", "Caches", "team-cli"), dir)
+	default:
+		require.Equal(t, filepath.Join(home, ".cache", "team-cli"), dir)
+	}
+
+	xdg := filepath.Join(home, "xdg")
+	t.Setenv("XDG_CACHE_HOME", xdg)
+
+	dir, err = cacheDir()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(xdg, "team-cli"), dir)
+
+	store, err := profileCache("..")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(xdg, "team-cli", "%2E%2E"), store.Dir())
+}
+
+func TestCacheClear(t *testing.T) {
+	path := writeProfiles(t)
+
+	// Accounts cached by older versions next to the config are removed once cached in the cache dir.
+	dir, err := configDir()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(dir, 0700))
+
+	legacy := filepath.Join(dir, accountsCacheName)
+	require.NoError(t, os.WriteFile(legacy, []byte(`{}`), 0600))
+
+	require.NoError(t, cacheAccounts(defaultProfileName, testAccounts()))
+	require.NoError(t, cacheAccounts("work", testAccounts()))
+
+	_, err = os.Stat(legacy)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	cached, ok, err := getAccountsCache("work", accountsCacheMaxAge)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, cached.Accounts, 4)
+
+	_, stderr, err := executeCmd(t, "cache", "clear")
+	require.NoError(t, err)
+	require.Contains(t, stderr, "Cleared ")
+
+	_, ok, err = getAccountsCache(defaultProfileName, 0)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// The config is left alone.
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.NotNil(t, cfg.AuthToken)
+
+	// Only what the cache created is removed from a cache dir that held other files.
+	other := t.TempDir()
+	notes := filepath.Join(other, "notes.txt")
+	require.NoError(t, os.WriteFile(notes, []byte("mine"), 0600))
+
+	cacheDirOverride = other
+
+	t.Cleanup(func() { cacheDirOverride = "" })
+
+	require.NoError(t, cacheAccounts("work", testAccounts()))
+
+	_, stderr, err = executeCmd(t, "cache", "clear", "--cache-dir", other)
+	require.NoError(t, err)
+	require.Contains(t, stderr, "Cleared ")
+
+	entries, err := os.ReadDir(other)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "notes.txt", entries[0].Name())
+
+	cacheDirOverride = ""
+
+	// A cache dir holding the config is refused rather than wiped.
+	_, _, err = executeCmd(t, "cache", "clear", "--cache-dir", filepath.Dir(path))
+	require.ErrorIs(t, err, ErrInvalid)
+
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+}
@@ -1,142 +1,1043 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"time"
 
+	"github.com/csnewman/team-cli/internal/filelock"
+	"github.com/csnewman/team-cli/internal/output"
 	"github.com/csnewman/team-cli/internal/team"
+	"github.com/csnewman/team-cli/internal/transport"
 )
 
-var ErrInvalidConfig = errors.New("invalid config")
+var (
+	ErrInvalidConfig  = errors.New("invalid config")
+	ErrConfigNotFound = errors.New("config not found")
+)
 
+// Config is the config file. Settings that belong to a TEAM deployment live in its profiles, and the profile selected
+// for this invocation is embedded so that its settings can be used as if they were top-level ones.
 type Config struct {
+	Version        int                 `json:"version"`
+	DefaultProfile string              `json:"default_profile,omitempty"`
+	Profiles       map[string]*Profile `json:"profiles,omitempty"`
+	BrowserCommand string              `json:"browser_command,omitempty"`
+	NoPager        bool                `json:"no_pager,omitempty"`
+	LogFile        string              `json:"log_file,omitempty"`
+	LogFileMaxSize int64               `json:"log_file_max_size,omitempty"`
+	UTC            bool                `json:"utc,omitempty"`
+	Proxy          string              `json:"proxy,omitempty"`
+	CABundle       string              `json:"ca_bundle,omitempty"`
+	ExpiryWarning  string              `json:"expiry_warning,omitempty"`
+	EncryptSecrets bool                `json:"encrypt_secrets,omitempty"`
+	Timeouts       *TimeoutsConfig     `json:"timeouts,omitempty"`
+	NoHistory      bool                `json:"no_history,omitempty"`
+	// WSReadLimit caps the size in bytes of the websocket messages received from the server.
+	WSReadLimit int64 `json:"ws_read_limit,omitempty"`
+	// BodyLimit caps the size in bytes of the HTTP response bodies received from the server.
+	BodyLimit int64 `json:"body_limit,omitempty"`
+	// RateLimit bounds the rate of GraphQL requests, for bulk operations that would otherwise be throttled.
+	RateLimit *RateLimitConfig `json:"rate_limit,omitempty"`
+
+	// Profile is the selected profile. It is one of Profiles, except for a config built from the environment.
+	*Profile `json:"-"`
+	// ProfileName is the name of the selected profile.
+	ProfileName string `json:"-"`
+
+	// templates are the settings that referenced environment variables, which are written back unexpanded.
+	templates map[string]envTemplate
+}
+
+// Profile holds the settings of a single TEAM deployment and the login used with it.
+type Profile struct {
 	ServerConfig  *team.RemoteConfig `json:"server_config"`
-	AuthToken     *team.AuthToken    `json:"auth_token"`
+	AuthToken     *team.AuthToken    `json:"auth_token,omitempty" expand:"-"`
 	UseDeviceCode bool               `json:"use_device_code"`
 	NoBrowser     bool               `json:"no_browser"`
+	CallbackPort  int                `json:"callback_port,omitempty"`
+	Aliases       map[string]string  `json:"aliases,omitempty"`
+	Insecure      bool               `json:"insecure,omitempty"`
+	Defaults      *ProfileDefaults   `json:"defaults,omitempty"`
+	// CredentialCommand obtains tokens in place of the login flows, and again whenever they expire.
+	CredentialCommand string `json:"credential_command,omitempty"`
+	// AuthMode is how requests to the API are authorized: "token", the default, with the token of the login, "iam",
+	// signed with AWS credentials, or "api_key", with APIKey. The latter two need no login.
+	AuthMode string `json:"auth_mode,omitempty"`
+	// APIKey authorizes requests in the api_key mode, unless TEAM_CLI_API_KEY is set.
+	APIKey string `json:"api_key,omitempty" expand:"-"`
 }
 
-func configPath(file string) (string, error) {
+const (
+	authModeToken  = "token"
+	authModeIAM    = "iam"
+	authModeAPIKey = "api_key"
+)
+
+// withoutLogin reports whether the API is authorized by other means than the token of a login.
+func (p *Profile) withoutLogin() bool {
+	return p != nil && (p.AuthMode == authModeIAM || p.AuthMode == authModeAPIKey)
+}
+
+// ProfileDefaults are used in place of flags that were not given. Interactive prompts offer them as the answer.
+type ProfileDefaults struct {
+	Output   string `json:"output,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+	// Start is "now" or a time in the form 2006-01-02 15:04:05.
+	Start string `json:"start,omitempty"`
+	// JustificationPrefix is prepended, followed by a space, to every justification that does not already start with
+	// it.
+	JustificationPrefix string `json:"justification_prefix,omitempty"`
+}
+
+// defaults returns the defaults of the selected profile, which are empty when none are configured.
+func (c *Config) defaults() ProfileDefaults {
+	if c.Profile == nil || c.Profile.Defaults == nil {
+		return ProfileDefaults{}
+	}
+
+	return *c.Profile.Defaults
+}
+
+// isEmpty reports whether p holds no settings at all, as for a selected profile that was never configured.
+func (p *Profile) isEmpty() bool {
+	return reflect.ValueOf(*p).IsZero()
+}
+
+const (
+	defaultProfileName = "default"
+	// profileEnvVar names the environment variable that selects the profile, like --profile.
+	profileEnvVar = "TEAM_CLI_PROFILE"
+)
+
+// profileOverride is the profile selected with --profile, which takes precedence over profileEnvVar.
+var profileOverride string
+
+// selectedProfile returns the name of the profile to use: --profile, then TEAM_CLI_PROFILE, then the default
+// profile of the config.
+func (c *Config) selectedProfile() string {
+	return cmp.Or(profileOverride, os.Getenv(profileEnvVar), c.DefaultProfile, defaultProfileName)
+}
+
+// profileSelectedExplicitly reports whether name was chosen with --profile or TEAM_CLI_PROFILE for this invocation.
+func profileSelectedExplicitly(name string) bool {
+	return cmp.Or(profileOverride, os.Getenv(profileEnvVar)) == name
+}
+
+// useProfile selects the named profile. A profile that does not exist yet starts empty, and is only written to the
+// config file once something is stored in it.
+func (c *Config) useProfile(name string) {
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]*Profile)
+	}
+
+	if c.Profiles[name] == nil {
+		c.Profiles[name] = new(Profile)
+	}
+
+	c.ProfileName = name
+	c.Profile = c.Profiles[name]
+}
+
+// hasProfile reports whether the named profile has been configured.
+func (c *Config) hasProfile(name string) bool {
+	profile := c.Profiles[name]
+
+	return profile != nil && !profile.isEmpty()
+}
+
+// TimeoutsConfig overrides the network timeouts with durations such as "90s". Unset ones keep their defaults.
+type TimeoutsConfig struct {
+	// HTTP bounds each HTTP request.
+	HTTP string `json:"http,omitempty"`
+	// WSRead bounds the wait for the next websocket message.
+	WSRead string `json:"ws_read,omitempty"`
+	// WSWrite bounds sending each websocket message.
+	WSWrite string `json:"ws_write,omitempty"`
+	// Subscribe bounds a whole subscription, such as the one fetching the accounts.
+	Subscribe string `json:"subscribe,omitempty"`
+	// Handshake bounds the wait for the server to acknowledge a websocket connection, and then a subscription.
+	Handshake string `json:"handshake,omitempty"`
+}
+
+// RateLimitConfig overrides the rate limit of GraphQL requests. Unset fields keep their defaults.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the rate that can be sustained.
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+	// Burst is the number of requests that can be sent at once.
+	Burst int `json:"burst,omitempty"`
+}
+
+// transportRateLimit returns the configured rate limit, leaving the unset or invalid fields zero so they keep their
+// defaults.
+func (c *Config) transportRateLimit() transport.RateLimit {
+	if c.RateLimit == nil {
+		return transport.RateLimit{}
+	}
+
+	return transport.RateLimit{Rate: max(c.RateLimit.RequestsPerSecond, 0), Burst: max(c.RateLimit.Burst, 0)}
+}
+
+// transportTimeouts returns the configured timeouts, leaving the unset ones zero so they keep their defaults.
+func (c *Config) transportTimeouts() (transport.Timeouts, error) {
+	var timeouts transport.Timeouts
+
+	if c.Timeouts == nil {
+		return timeouts, nil
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"http", c.Timeouts.HTTP, &timeouts.HTTP},
+		{"ws_read", c.Timeouts.WSRead, &timeouts.WSRead},
+		{"ws_write", c.Timeouts.WSWrite, &timeouts.WSWrite},
+		{"subscribe", c.Timeouts.Subscribe, &timeouts.Subscribe},
+		{"handshake", c.Timeouts.Handshake, &timeouts.Handshake},
+	} {
+		if setting.value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(setting.value)
+		if err != nil || d <= 0 {
+			return timeouts, fmt.Errorf("timeouts.%s: %q is not a positive duration", setting.name, setting.value)
+		}
+
+		*setting.dst = d
+	}
+
+	return timeouts, nil
+}
+
+// persistent reports whether the selected profile is stored in the config file, rather than built for this
+// invocation from --server or the environment.
+func (c *Config) persistent() bool {
+	return c.Profile != nil && c.Profiles[c.ProfileName] == c.Profile
+}
+
+// browserLogin returns the settings of the browser based login flows.
+func (c *Config) browserLogin() team.BrowserLogin {
+	return withPastedRedirect(team.BrowserLogin{
+		NoBrowser:      c.NoBrowser,
+		CallbackPort:   c.CallbackPort,
+		BrowserCommand: c.BrowserCommand,
+	})
+}
+
+// validate returns a description of every setting that is not valid, beyond what reading the config already checks.
+func (c *Config) validate() []string {
+	var problems []string
+
+	if c.ExpiryWarning != "" {
+		if window, err := time.ParseDuration(c.ExpiryWarning); err != nil || window < 0 {
+			problems = append(problems, fmt.Sprintf("expiry_warning: %q is not a valid duration", c.ExpiryWarning))
+		}
+	}
+
+	if _, err := c.transportTimeouts(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if c.LogFileMaxSize < 0 {
+		problems = append(problems, "log_file_max_size: must not be negative")
+	}
+
+	if c.WSReadLimit < 0 {
+		problems = append(problems, "ws_read_limit: must not be negative")
+	}
+
+	if c.BodyLimit < 0 {
+		problems = append(problems, "body_limit: must not be negative")
+	}
+
+	if c.RateLimit != nil && c.RateLimit.RequestsPerSecond < 0 {
+		problems = append(problems, "rate_limit.requests_per_second: must not be negative")
+	}
+
+	if c.RateLimit != nil && c.RateLimit.Burst < 0 {
+		problems = append(problems, "rate_limit.burst: must not be negative")
+	}
+
+	if c.DefaultProfile != "" && !c.hasProfile(c.DefaultProfile) {
+		problems = append(problems, fmt.Sprintf("default_profile: profile %q does not exist", c.DefaultProfile))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Profiles)) {
+		profile := c.Profiles[name]
+		if profile == nil {
+			continue
+		}
+
+		if profile.CallbackPort < 0 || profile.CallbackPort > 65535 {
+			problems = append(problems, fmt.Sprintf("profiles.%s.callback_port: %d is not a port", name, profile.CallbackPort))
+		}
+
+		switch profile.AuthMode {
+		case "", authModeToken, authModeIAM, authModeAPIKey:
+		default:
+			problems = append(problems, fmt.Sprintf(
+				"profiles.%s.auth_mode: %q is not one of %q, %q or %q",
+				name, profile.AuthMode, authModeToken, authModeIAM, authModeAPIKey,
+			))
+		}
+
+		if server := profile.ServerConfig; server != nil && server.RealtimeEndpoint != "" {
+			if u, err := url.Parse(server.RealtimeEndpoint); err != nil || u.Host == "" ||
+				!slices.Contains([]string{"http", "https", "ws", "wss"}, u.Scheme) {
+				problems = append(problems, fmt.Sprintf(
+					"profiles.%s.server_config.realtime_endpoint: %q is not a websocket or HTTP URL",
+					name, server.RealtimeEndpoint,
+				))
+			}
+		}
+
+		if profile.Defaults == nil {
+			continue
+		}
+
+		if profile.Defaults.Output != "" {
+			if _, err := output.ParseFormat(profile.Defaults.Output); err != nil {
+				problems = append(problems, fmt.Sprintf("profiles.%s.defaults.output: %v", name, err))
+			}
+		}
+
+		if profile.Defaults.Duration < 0 {
+			problems = append(problems, fmt.Sprintf("profiles.%s.defaults.duration: must not be negative", name))
+		}
+
+		if profile.Defaults.Start != "" {
+			if _, err := parseStart(profile.Defaults.Start); err != nil {
+				problems = append(problems, fmt.Sprintf(
+					"profiles.%s.defaults.start: %q is neither \"now\" nor a time like 2006-01-02 15:04:05",
+					name, profile.Defaults.Start,
+				))
+			}
+		}
+	}
+
+	return problems
+}
+
+// configEnvVar names the environment variable that selects the config file, like --config.
+const configEnvVar = "TEAM_CLI_CONFIG"
+
+// configFileOverride is the config file selected with --config, which takes precedence over configEnvVar.
+var configFileOverride string
+
+// startupConfig is the config as loaded when the command started, which the settings that apply to every command are
+// taken from. It is nil when the config could not be loaded.
+var startupConfig *Config
+
+// configDir returns the team-cli directory under $XDG_CONFIG_HOME, or otherwise in the user config directory of the
+// platform: ~/.config, ~/Library/Application Support on macOS, or %AppData% on Windows.
+func configDir() (string, error) {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, "team-cli"), nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		// A relative XDG_CONFIG_HOME is ignored, as the XDG spec asks, rather than failing.
+		return legacyConfigDir()
+	}
+
+	return filepath.Join(dir, "team-cli"), nil
+}
+
+// legacyConfigDir is where files were kept before XDG_CONFIG_HOME and the platform's config directory were honoured.
+func legacyConfigDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("failed to get user dir: %w", err)
 	}
 
-	teamPath := filepath.Join(homeDir, ".config", "team-cli")
+	return filepath.Join(homeDir, ".config", "team-cli"), nil
+}
 
-	if err := os.MkdirAll(teamPath, 0755); err != nil {
+// configPath returns the path of a config file in the config directory, moving it and its credentials file over from
+// the legacy directory first if it only exists there.
+func configPath(file string) (string, error) {
+	teamPath, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(teamPath, 0700); err != nil {
 		return "", fmt.Errorf("failed to create team config dir: %w", err)
 	}
 
-	return filepath.Join(teamPath, file), nil
+	path := filepath.Join(teamPath, file)
+
+	legacyPath, err := legacyConfigDir()
+	if err != nil || legacyPath == teamPath {
+		return path, nil
+	}
+
+	legacyPath = filepath.Join(legacyPath, file)
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return path, nil
+	}
+
+	if _, err := os.Stat(legacyPath); err != nil {
+		return path, nil
+	}
+
+	slog.Info("Migrating file to XDG config directory", "from", legacyPath, "to", path)
+
+	if err := os.Rename(legacyPath, path); err != nil {
+		slog.Warn("Could not migrate file, using legacy location", "path", legacyPath, "err", err)
+
+		return legacyPath, nil
+	}
+
+	// The tokens would otherwise be left behind, and a new login needed.
+	legacyCreds := credentialsPath(legacyPath)
+
+	if err := os.Rename(legacyCreds, credentialsPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Could not migrate credentials file", "path", legacyCreds, "err", err)
+	}
+
+	return path, nil
 }
 
+// configFilePath returns the path of the config file: --config, then TEAM_CLI_CONFIG, then config.toml in the
+// config directory.
+func configFilePath() (string, error) {
+	if configFileOverride != "" {
+		return configFileOverride, nil
+	}
+
+	if path := os.Getenv(configEnvVar); path != "" {
+		return path, nil
+	}
+
+	return configPath("config.toml")
+}
+
+// readConfigOrEmpty is readConfig for callers that work without a config file, such as those creating it. A missing
+// file reads as an empty config.
+func readConfigOrEmpty() (*Config, error) {
+	cfg, err := readConfig()
+	if errors.Is(err, ErrConfigNotFound) {
+		return emptyConfig(), nil
+	}
+
+	return cfg, err
+}
+
+// emptyConfig returns the config used in place of a missing config file.
+func emptyConfig() *Config {
+	cfg := new(Config)
+	cfg.useProfile(cfg.selectedProfile())
+
+	return cfg
+}
+
+// readConfig reads the config file and the credentials belonging to it, returning ErrConfigNotFound when there is no
+// config file yet. A config file written by an older version is converted and upgraded under the config lock.
 func readConfig() (*Config, error) {
-	path, err := configPath("config.json")
+	path, err := configFilePath()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get config path: %w", err)
 	}
 
+	if legacyConfigFile(path) == "" {
+		config, changed, err := loadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !changed {
+			config.useProfile(config.selectedProfile())
+
+			return config, nil
+		}
+	}
+
+	unlock, err := lockConfig(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	// Another process may have upgraded the file while the lock was waited for, so it is read again.
+	return readConfigLocked(path)
+}
+
+// readConfigLocked is readConfig for callers holding the config lock, which write any upgrade back themselves.
+func readConfigLocked(path string) (*Config, error) {
+	if jsonPath := legacyConfigFile(path); jsonPath != "" {
+		migrateConfigFormat(path, jsonPath)
+	}
+
+	config, changed, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		slog.Info("Upgraded config file", "path", path, "version", configVersion)
+
+		if err := writeConfigFile(path, config); err != nil {
+			return nil, fmt.Errorf("failed to write upgraded config file: %w", err)
+		}
+	}
+
+	config.useProfile(config.selectedProfile())
+
+	return config, nil
+}
+
+// loadConfig reads the config file at path and the credentials belonging to it. It reports whether the files need to
+// be written back in the current layout.
+func loadConfig(path string) (*Config, bool, error) {
 	raw, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return new(Config), nil
+			return nil, false, fmt.Errorf("%w: %s", ErrConfigNotFound, path)
 		}
 
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, false, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config, changed, err := parseConfig(path, raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	store, err := credentialStoreFor(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	creds, err := readCredentials(store)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if creds.hasTokens() {
+		if err := store.checkPermissions(); err != nil {
+			return nil, false, err
+		}
+	}
+
+	for name, profile := range config.Profiles {
+		if profile == nil {
+			continue
+		}
+
+		if token := creds.token(name); token != nil {
+			profile.AuthToken = token
+		} else if profile.AuthToken != nil {
+			// Tokens stored inline by older versions are moved to the credentials file.
+			changed = true
+		}
+
+		if key := creds.apiKey(name); key != "" {
+			profile.APIKey = key
+		} else if profile.APIKey != "" {
+			// Keys written into the config file by hand are moved to the credentials file.
+			changed = true
+		}
+	}
+
+	// Credentials written before profiles existed are rewritten in the per-profile layout.
+	if creds.AuthToken != nil {
+		changed = true
+	}
+
+	return config, changed, nil
+}
+
+// parseConfig decodes a config file, migrating it to the current version. It reports whether the file needs to be
+// written back.
+func parseConfig(path string, raw []byte) (*Config, bool, error) {
+	raw, err := formatFor(path).decode(raw)
+	if err != nil {
+		return nil, false, corruptConfigError(path, err)
+	}
+
+	migrated, changed, err := migrateConfig(raw)
+	if errors.Is(err, ErrConfigTooNew) {
+		return nil, false, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, path, err)
+	} else if err != nil {
+		return nil, false, corruptConfigError(path, err)
 	}
 
 	var config *Config
 
-	if err := json.Unmarshal(raw, &config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config file: %w", err)
+	if err := json.Unmarshal(migrated, &config); err != nil {
+		return nil, false, corruptConfigError(path, err)
 	}
 
-	return config, nil
+	if config == nil {
+		config = &Config{}
+	}
+
+	config.templates, err = expandConfig(config)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, path, err)
+	}
+
+	return config, changed, nil
+}
+
+// corruptConfigError describes a config file that could not be parsed. A write interrupted before its final rename
+// leaves the complete new config in a temporary file next to it, which config repair puts back in place.
+func corruptConfigError(path string, parseErr error) error {
+	candidate := findConfigCandidate(path)
+	if candidate == "" {
+		return fmt.Errorf("%w: failed to unmarshal config file %s: %w", ErrInvalidConfig, path, parseErr)
+	}
+
+	return fmt.Errorf(
+		"%w: config file %s is corrupt (%w), but %s holds an interrupted write; run team-cli config repair to "+
+			"restore it",
+		ErrInvalidConfig,
+		path,
+		parseErr,
+		candidate,
+	)
+}
+
+// findConfigCandidate returns the newest leftover temporary file for path that holds a valid config.
+func findConfigCandidate(path string) string {
+	matches, err := filepath.Glob(path + ".tmp-*")
+	if err != nil {
+		return ""
+	}
+
+	var (
+		newest     string
+		newestTime time.Time
+	)
+
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || !info.ModTime().After(newestTime) {
+			continue
+		}
+
+		raw, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+
+		raw, err = formatFor(path).decode(raw)
+		if err != nil {
+			continue
+		}
+
+		var config *Config
+
+		if err := json.Unmarshal(raw, &config); err != nil || config == nil {
+			continue
+		}
+
+		newest, newestTime = match, info.ModTime()
+	}
+
+	return newest
 }
 
 func writeConfig(cfg *Config) error {
-	path, err := configPath("config.json")
+	path, err := configFilePath()
 	if err != nil {
 		return fmt.Errorf("failed to get config path: %w", err)
 	}
 
-	enc, err := json.MarshalIndent(cfg, "", "    ")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+
+	return writeConfigFile(path, cfg)
+}
+
+func writeConfigFile(path string, cfg *Config) error {
+	// Secrets go to the credentials file, so that the config file itself can be shared.
+	settings := *cfg
+	settings.Version = configVersion
+	settings.Profiles = make(map[string]*Profile, len(cfg.Profiles))
+
+	creds := &credentials{Profiles: make(map[string]*profileCredentials)}
+
+	for name, profile := range cfg.Profiles {
+		if profile == nil || profile.isEmpty() {
+			continue
+		}
+
+		stripped := *profile
+		stripped.AuthToken = nil
+		stripped.APIKey = ""
+		settings.Profiles[name] = &stripped
+
+		if profile.AuthToken != nil || profile.APIKey != "" {
+			creds.Profiles[name] = &profileCredentials{AuthToken: profile.AuthToken, APIKey: profile.APIKey}
+		}
+	}
+
+	store, err := credentialStoreFor(path)
+	if err != nil {
+		return err
+	}
+
+	if err := writeCredentials(store, creds, cfg.EncryptSecrets); err != nil {
+		return err
+	}
+
+	enc, err := json.MarshalIndent(&settings, "", "    ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config file: %w", err)
 	}
 
-	if err := os.WriteFile(path, enc, 0644); err != nil {
+	if len(cfg.templates) > 0 {
+		enc, err = unexpandedJSON(enc, cfg.templates)
+		if err != nil {
+			return fmt.Errorf("failed to marshal config file: %w", err)
+		}
+	}
+
+	previous, _ := os.ReadFile(path)
+
+	enc, err = formatFor(path).encode(enc, previous)
+	if err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+
+	if err := writeFileAtomic(path, enc, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
+	cfg.Version = configVersion
+
 	return nil
 }
 
+// writeFileAtomic replaces the file at path with data, so that it is never left partially written. The data is
+// written and synced to a temporary file in the same directory, which is then renamed over path. An existing file
+// keeps its mode, otherwise perm is used.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	renamed := false
+
+	defer func() {
+		if !renamed {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+
+	renamed = true
+
+	return nil
+}
+
+// configLockTimeout bounds how long a command waits for another team-cli process to finish updating the config.
+var configLockTimeout = 10 * time.Second
+
+var ErrConfigLocked = errors.New("another team-cli process holds the config lock")
+
+// lockConfig takes the lock of the config file at path, creating its directory if needed. The returned function
+// releases it.
+func lockConfig(ctx context.Context, path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create config dir: %w", err)
+	}
+
+	lock, err := filelock.Acquire(ctx, path+".lock", configLockTimeout)
+	if errors.Is(err, filelock.ErrTimeout) {
+		return nil, fmt.Errorf("%w (waited %s)", ErrConfigLocked, configLockTimeout)
+	} else if err != nil {
+		return nil, fmt.Errorf("could not lock config: %w", err)
+	}
+
+	return func() {
+		if err := lock.Release(); err != nil {
+			slog.Warn("Could not release config lock", "err", err)
+		}
+	}, nil
+}
+
+// updateConfig applies fn to the current config while holding the config lock, so concurrent invocations cannot
+// overwrite each other's changes. The config is only written back when fn reports a change, after backing up the
+// previous one.
+func updateConfig(ctx context.Context, fn func(cfg *Config) (bool, error)) (*Config, error) {
+	return modifyConfig(ctx, fn, true)
+}
+
+// updateTokens is updateConfig for storing new tokens. Tokens are refreshed without the user asking, so the backup of
+// the last change the user made is kept.
+func updateTokens(ctx context.Context, fn func(cfg *Config) (bool, error)) (*Config, error) {
+	return modifyConfig(ctx, fn, false)
+}
+
+func modifyConfig(ctx context.Context, fn func(cfg *Config) (bool, error), backup bool) (*Config, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config path: %w", err)
+	}
+
+	unlock, err := lockConfig(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	cfg, err := readConfigLocked(path)
+	if errors.Is(err, ErrConfigNotFound) {
+		cfg = emptyConfig()
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+
+	changed, err := fn(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed {
+		return cfg, nil
+	}
+
+	if backup {
+		if err := backupConfig(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeConfigFile(path, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// tokenExpirySlack is how long before its expiry a token is refreshed, so it does not expire mid-command.
+const tokenExpirySlack = 5 * time.Minute
+
+// tokenValid reports whether token can still be used for a while. The ID token may expire before the access token, in
+// which case it has to be refreshed all the same.
+func tokenValid(token *team.AuthToken) bool {
+	if token == nil || !time.Now().Add(tokenExpirySlack).Before(token.ExpiresAt) {
+		return false
+	}
+
+	idExpiresAt, err := team.JWTExpiry(token.IdToken)
+
+	return err != nil || time.Now().Add(tokenExpirySlack).Before(idExpiresAt)
+}
+
+// readConfigReAuth reads the config and ensures the selected profile holds a usable token, silently refreshing an
+// expired token and only falling back to interactive authentication when that is not possible. A server and token
+// supplied by the environment take precedence over the config file. Profiles authorized without a login need no token.
 func readConfigReAuth(ctx context.Context) (*Config, error) {
+	if cfg, err := configFromEnv(); err != nil || cfg != nil {
+		return cfg, err
+	}
+
 	cfg, err := readConfig()
 	if err != nil {
 		return nil, fmt.Errorf("could not read config: %w", err)
 	}
 
-	if cfg.ServerConfig == nil || cfg.ServerConfig.OAuthDomain == "" {
-		slog.Error("No server config found!")
+	if cfg.withoutLogin() && cfg.ServerConfig != nil {
+		return cfg, nil
+	}
 
-		return nil, ErrInvalidConfig
+	if cfg.ServerConfig == nil || cfg.ServerConfig.OAuthDomain == "" {
+		return nil, fmt.Errorf("%w: profile %q has no server", ErrConfigNotFound, cfg.ProfileName)
 	}
 
-	if cfg.AuthToken != nil && time.Now().Add(time.Minute*5).Before(cfg.AuthToken.ExpiresAt) {
+	if tokenValid(cfg.AuthToken) {
 		slog.Info("Existing auth token is valid")
 
 		return cfg, nil
 	}
 
-	if cfg.AuthToken != nil && cfg.AuthToken.RefreshToken != "" {
+	if cfg.CredentialCommand != "" {
+		return reAuthViaCommand(ctx)
+	}
+
+	var refreshErr error
+
+	// The refresh happens under the config lock, so that concurrent invocations refresh only once rather than
+	// racing to store tokens the server may already have revoked.
+	cfg, err = updateTokens(ctx, func(cfg *Config) (bool, error) {
+		if tokenValid(cfg.AuthToken) {
+			slog.Info("Auth token was refreshed by another process")
+
+			return false, nil
+		}
+
+		if cfg.AuthToken == nil || cfg.AuthToken.RefreshToken == "" || cfg.ServerConfig == nil {
+			return false, nil
+		}
+
+		if err := checkTokenFetch(); err != nil {
+			return false, err
+		}
+
 		slog.Info("Existing auth token has expired, attempting to refresh")
 
 		newToken, err := team.RefreshToken(ctx, cfg.ServerConfig, cfg.AuthToken)
-		if err == nil {
-			slog.Info("Refreshed token")
+		if err != nil {
+			slog.Warn("Failed to refresh token", "err", err)
+			refreshErr = err
 
-			cfg.AuthToken = newToken
+			return false, nil
+		}
 
-			if err := writeConfig(cfg); err != nil {
-				return nil, fmt.Errorf("failed to write new token: %w", err)
-			}
+		slog.Info("Refreshed token")
 
-			return cfg, nil
-		}
+		cfg.AuthToken = newToken
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
 
-		slog.Warn("Failed to refresh token", "err", err)
+	if tokenValid(cfg.AuthToken) {
+		return cfg, nil
 	}
 
-	slog.Info("Reauthentication required")
+	var oauthErr *team.OAuthError
 
-	var newToken *team.AuthToken
+	switch {
+	case refreshErr == nil:
+		slog.Info("Reauthentication required")
+	case errors.As(refreshErr, &oauthErr) && oauthErr.Code == "invalid_grant":
+		slog.Info("Refresh token was rejected, reauthentication required")
+	default:
+		return nil, fmt.Errorf("failed to refresh token: %w", refreshErr)
+	}
 
-	if cfg.UseDeviceCode {
-		newToken, err = team.FetchTokenViaDeviceCode(ctx, cfg.ServerConfig, func(_ context.Context) (string, error) {
-			return promptString("Device code? ")
-		})
-	} else {
-		newToken, err = team.FetchToken(ctx, cfg.ServerConfig, cfg.NoBrowser)
+	if !stdinIsTerminal() {
+		return nil, fmt.Errorf("%w: the stored login has expired, run `team-cli login` to sign in again", ErrLoginRequired)
 	}
 
+	return login(ctx, cfg)
+}
+
+// reAuthViaCommand replaces an expired token with one from the credential command of the selected profile. Like a
+// refresh, this happens under the config lock, and needs no one at the terminal.
+func reAuthViaCommand(ctx context.Context) (*Config, error) {
+	cfg, err := updateTokens(ctx, func(cfg *Config) (bool, error) {
+		if tokenValid(cfg.AuthToken) {
+			slog.Info("Auth token was refreshed by another process")
+
+			return false, nil
+		}
+
+		slog.Info("Existing auth token has expired, running the credential command")
+
+		newToken, err := team.FetchTokenViaCommand(ctx, cfg.CredentialCommand)
+		if err != nil {
+			return false, err
+		}
+
+		cfg.AuthToken = newToken
+
+		return true, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch new token: %w", err)
+		return nil, fmt.Errorf("%w: failed to fetch new token: %w", ErrAuth, err)
 	}
 
-	cfg.AuthToken = newToken
+	return cfg, nil
+}
 
-	if err := writeConfig(cfg); err != nil {
+// login runs the login flow stored in cfg and persists the new token. Interactive authentication can take minutes,
+// so the config is only locked again to store the result.
+func login(ctx context.Context, cfg *Config) (*Config, error) {
+	newToken, err := fetchToken(ctx, cfg, cfg.ServerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err = updateTokens(ctx, func(cfg *Config) (bool, error) {
+		cfg.AuthToken = newToken
+
+		return true, nil
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to write new token: %w", err)
 	}
 
 	return cfg, nil
 }
+
+// fetchToken logs in to remote using the login flow chosen in cfg, without storing the result.
+func fetchToken(ctx context.Context, cfg *Config, remote *team.RemoteConfig) (*team.AuthToken, error) {
+	var (
+		newToken *team.AuthToken
+		err      error
+	)
+
+	// Credential commands fetch tokens themselves, outside the transport whose verification is disabled.
+	if cfg.CredentialCommand == "" {
+		if err := checkTokenFetch(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case cfg.CredentialCommand != "":
+		newToken, err = team.FetchTokenViaCommand(ctx, cfg.CredentialCommand)
+	case cfg.UseDeviceCode:
+		login := withDeviceCodePrompt(cfg.browserLogin())
+		newToken, err = team.FetchTokenViaDeviceCode(ctx, remote, login, pauseBeforeBrowser)
+	default:
+		newToken, err = team.FetchToken(ctx, remote, cfg.browserLogin())
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to fetch new token: %w", ErrAuth, err)
+	}
+
+	return newToken, nil
+}
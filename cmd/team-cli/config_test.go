@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/filelock"
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+
+	require.NoError(t, writeFileAtomic(path, []byte("first"), 0600))
+	require.NoError(t, os.Chmod(path, 0640))
+	require.NoError(t, writeFileAtomic(path, []byte("second"), 0600))
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(raw))
+
+	// Windows only keeps a read-only bit, so there is no mode to carry over.
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "no temporary files are left behind")
+}
+
+func TestReadConfigCorrupt(t *testing.T) {
+	home := isolateConfig(t)
+	path := filepath.Join(home, "config.json")
+	t.Setenv(configEnvVar, path)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"aliases":`), 0644))
+
+	_, err := readConfig()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.NotContains(t, err.Error(), "interrupted write")
+
+	_, _, err = executeCmd(t, "config", "repair", "--confirm")
+	require.ErrorIs(t, err, ErrNoBackup)
+
+	// Reading the config only reports the interrupted write, config repair restores it.
+	candidate := path + ".tmp-123"
+	require.NoError(t, os.WriteFile(candidate, []byte(`{"aliases":{"pay":"payments"}}`), 0644))
+
+	_, err = readConfig()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.ErrorContains(t, err, candidate+" holds an interrupted write; run team-cli config repair")
+	require.FileExists(t, candidate)
+
+	_, stderr, err := executeCmd(t, "config", "repair", "--confirm")
+	require.NoError(t, err)
+	require.Contains(t, stderr, "Restored "+path)
+	require.NoFileExists(t, candidate)
+
+	_, err = readConfig()
+	require.NoError(t, err)
+
+	_, stderr, err = executeCmd(t, "config", "repair", "--confirm")
+	require.NoError(t, err)
+	require.Contains(t, stderr, "nothing to repair")
+}
+
+func TestUpdateConfigLocked(t *testing.T) {
+	home := isolateConfig(t)
+	path := filepath.Join(home, "config.json")
+	t.Setenv(configEnvVar, path)
+
+	oldTimeout := configLockTimeout
+	configLockTimeout = 100 * time.Millisecond
+
+	t.Cleanup(func() {
+		configLockTimeout = oldTimeout
+	})
+
+	lock, err := filelock.Acquire(context.Background(), path+".lock", time.Second)
+	require.NoError(t, err)
+
+	_, _, err = executeCmd(t, "alias", "set", "pay", "payments")
+	require.ErrorIs(t, err, ErrConfigLocked)
+	require.NoFileExists(t, path)
+
+	require.NoError(t, lock.Release())
+
+	_, _, err = executeCmd(t, "alias", "set", "pay", "payments")
+	require.NoError(t, err)
+	require.FileExists(t, path)
+}
+
+func TestReadConfigUpgradeLocked(t *testing.T) {
+	home := isolateConfig(t)
+	path := filepath.Join(home, "config.json")
+	t.Setenv(configEnvVar, path)
+
+	oldTimeout := configLockTimeout
+	configLockTimeout = 100 * time.Millisecond
+
+	t.Cleanup(func() {
+		configLockTimeout = oldTimeout
+	})
+
+	// A key written into the config file by hand is moved to the credentials file, which needs the lock.
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":3,"profiles":{"default":{"api_key":"key"}}}`), 0600))
+
+	lock, err := filelock.Acquire(context.Background(), path+".lock", time.Second)
+	require.NoError(t, err)
+
+	_, err = readConfig()
+	require.ErrorIs(t, err, ErrConfigLocked)
+	require.NoFileExists(t, credentialsPath(path))
+
+	require.NoError(t, lock.Release())
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.Equal(t, "key", cfg.APIKey)
+	require.FileExists(t, credentialsPath(path))
+}
+
+func TestConfigPathMigratesLegacyDir(t *testing.T) {
+	home := isolateConfig(t)
+
+	legacy, err := legacyConfigDir()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(legacy, 0700))
+
+	legacyPath := filepath.Join(legacy, "config.toml")
+	require.NoError(t, os.WriteFile(legacyPath, []byte("version = 3\n"), 0600))
+	require.NoError(t, os.WriteFile(credentialsPath(legacyPath), []byte("{}"), 0600))
+
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+
+	// The credentials move with the config file, so the login carries over.
+	path, err := configFilePath()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, "xdg", "team-cli", "config.toml"), path)
+
+	for _, file := range []string{path, credentialsPath(path)} {
+		require.FileExists(t, file)
+	}
+
+	for _, file := range []string{legacyPath, credentialsPath(legacyPath)} {
+		require.NoFileExists(t, file)
+	}
+}
+
+func TestReadConfigInsecureCredentials(t *testing.T) {
+	home := isolateConfig(t)
+	path := filepath.Join(home, "config.json")
+	t.Setenv(configEnvVar, path)
+
+	cfg := fixtureConfig()
+	require.NoError(t, writeConfig(cfg))
+
+	for _, file := range []string{path, credentialsPath(path)} {
+		requirePrivate(t, file)
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("exposing the file takes an ACL change on Windows, which fileperm tests cover")
+	}
+
+	require.NoError(t, os.Chmod(credentialsPath(path), 0644))
+
+	_, _, err := executeCmd(t, "config", "show")
+	require.ErrorIs(t, err, ErrInsecurePermissions)
+	require.Equal(t, ExitAuth, exitCode(err))
+
+	_, _, err = executeCmd(t, "config", "show", "--insecure-permissions")
+	require.NoError(t, err)
+}
+
+func TestReadConfigReAuthRefreshRejected(t *testing.T) {
+	home := isolateConfig(t)
+	t.Setenv(configEnvVar, filepath.Join(home, "config.json"))
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"Refresh Token has expired"}`))
+	}))
+	defer srv.Close()
+
+	trustServer(t, srv)
+
+	cfg := fixtureConfig()
+	cfg.ServerConfig.OAuthDomain = strings.TrimPrefix(srv.URL, "https://")
+	require.NoError(t, writeConfig(cfg))
+
+	oldIsTerminal := stdinIsTerminal
+	stdinIsTerminal = func() bool { return false }
+
+	t.Cleanup(func() {
+		stdinIsTerminal = oldIsTerminal
+	})
+
+	_, err := readConfigReAuth(context.Background())
+	require.ErrorIs(t, err, ErrLoginRequired)
+	require.ErrorContains(t, err, "team-cli login")
+	require.Equal(t, ExitLoginRequired, exitCode(err))
+}
+
+// trustServer makes all outbound connections trust the certificate of srv for the duration of the test.
+func trustServer(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, cert, 0600))
+	require.NoError(t, transport.Configure(transport.Settings{CABundle: bundle}))
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+}
+
+func TestFirstRunError(t *testing.T) {
+	isolateConfig(t)
+
+	_, stderr, err := executeCmd(t, "list-accounts")
+	require.ErrorIs(t, err, ErrConfigNotFound)
+	require.Equal(t, ExitAuth, exitCode(err))
+	require.Contains(t, stderr, "team-cli is not configured yet — run `team-cli configure <server-url>`\n")
+	require.NotContains(t, stderr, "config not found")
+
+	// Commands that create the config, or only read settings, work without one.
+	_, _, err = executeCmd(t, "alias", "list")
+	require.NoError(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	home := isolateConfig(t)
+	path := filepath.Join(home, "config.json")
+	t.Setenv(configEnvVar, path)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"aliases":`), 0600))
+
+	_, stderr, err := executeCmd(t, "list-accounts")
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.Contains(t, stderr, "run `team-cli config validate` for details")
+
+	_, stderr, err = executeCmd(t, "config", "validate")
+	require.ErrorIs(t, err, ErrInvalid)
+	require.NotContains(t, stderr, "config validate")
+
+	cfg := fixtureConfig()
+	cfg.ExpiryWarning = "soon"
+	cfg.Timeouts = &TimeoutsConfig{HTTP: "-1s"}
+	cfg.Defaults = &ProfileDefaults{Output: "xml"}
+	cfg.ServerConfig.RealtimeEndpoint = "api.example.com/graphql/realtime"
+	cfg.RateLimit = &RateLimitConfig{RequestsPerSecond: -1}
+	cfg.BodyLimit = -1
+	require.NoError(t, writeConfig(cfg))
+
+	_, stderr, err = executeCmd(t, "config", "validate")
+	require.ErrorIs(t, err, ErrInvalid)
+	require.Contains(t, stderr, "expiry_warning")
+	require.Contains(t, stderr, "timeouts.http")
+	require.Contains(t, stderr, "profiles.default.defaults.output")
+	require.Contains(t, stderr, "profiles.default.server_config.realtime_endpoint")
+	require.Contains(t, stderr, "rate_limit.requests_per_second")
+	require.Contains(t, stderr, "body_limit")
+
+	cfg.ExpiryWarning = ""
+	cfg.Timeouts = nil
+	cfg.Defaults = nil
+	cfg.ServerConfig.RealtimeEndpoint = "wss://api.example.com/graphql/realtime"
+	cfg.RateLimit = &RateLimitConfig{RequestsPerSecond: 2.5}
+	cfg.BodyLimit = 1 << 20
+	require.NoError(t, writeConfig(cfg))
+
+	_, stderr, err = executeCmd(t, "config", "validate")
+	require.NoError(t, err)
+	require.Contains(t, stderr, "is valid")
+}
+
+func TestTransportRateLimit(t *testing.T) {
+	t.Parallel()
+
+	require.Zero(t, (&Config{}).transportRateLimit())
+
+	cfg := &Config{RateLimit: &RateLimitConfig{RequestsPerSecond: 2.5, Burst: -1}}
+	require.Equal(t, transport.RateLimit{Rate: 2.5}, cfg.transportRateLimit())
+}
+
+func TestTransportTimeouts(t *testing.T) {
+	t.Parallel()
+
+	timeouts, err := (&Config{}).transportTimeouts()
+	require.NoError(t, err)
+	require.Zero(t, timeouts)
+
+	cfg := &Config{Timeouts: &TimeoutsConfig{HTTP: "2m", WSWrite: "30s", Subscribe: "10m"}}
+
+	timeouts, err = cfg.transportTimeouts()
+	require.NoError(t, err)
+	require.Equal(t, transport.Timeouts{HTTP: 2 * time.Minute, WSWrite: 30 * time.Second, Subscribe: 10 * time.Minute}, timeouts)
+
+	cfg.Timeouts.WSRead = "0s"
+
+	_, err = cfg.transportTimeouts()
+	require.ErrorContains(t, err, "timeouts.ws_read")
+}
+
+const credentialHelperEnvVar = "TEAM_CLI_TEST_CREDENTIALS"
+
+// TestCredentialHelperProcess is not a real test: it is the credential command run by TestCredentialCommand, and
+// prints the tokens it is given.
+func TestCredentialHelperProcess(t *testing.T) {
+	output, ok := os.LookupEnv(credentialHelperEnvVar)
+	if !ok {
+		t.Skip("only run as a credential command")
+	}
+
+	fmt.Print(output)
+	os.Exit(0)
+}
+
+func TestCredentialCommand(t *testing.T) {
+	writeProfiles(t)
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+
+	cfg.CredentialCommand = os.Args[0] + " -test.run=^TestCredentialHelperProcess$"
+	cfg.AuthToken.ExpiresAt = time.Now().Add(-time.Hour)
+	require.NoError(t, writeConfig(cfg))
+
+	tokens, err := json.Marshal(map[string]any{
+		"access_token": "brokered-access",
+		"id_token":     unsignedIDToken(t, map[string]any{"userId": "brokered", "email": "brokered@example.com"}),
+		"expires_in":   3600,
+	})
+	require.NoError(t, err)
+	t.Setenv(credentialHelperEnvVar, string(tokens))
+
+	// The expired token is replaced by running the command, even without a terminal to log in on.
+	stdout, _, err := executeCmd(t, "whoami", "--no-verify", "-o", "json")
+	require.NoError(t, err)
+	require.Contains(t, stdout, "brokered@example.com")
+
+	cfg, err = readConfig()
+	require.NoError(t, err)
+	require.Equal(t, "brokered-access", cfg.AuthToken.AccessToken)
+	require.True(t, tokenValid(cfg.AuthToken))
+}
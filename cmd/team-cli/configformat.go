@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configFormat converts between the file format of a config file and its JSON document, which is all the rest of
+// the config code works with.
+type configFormat interface {
+	// decode returns the JSON document held by a config file.
+	decode(raw []byte) ([]byte, error)
+	// encode returns the config file holding the JSON document doc. previous is the file being replaced, if any, so
+	// that what the JSON document cannot hold, such as comments, can be carried over.
+	encode(doc []byte, previous []byte) ([]byte, error)
+}
+
+// formatFor returns the format of the config file at path: TOML for .toml files, and JSON for everything else.
+func formatFor(path string) configFormat {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return tomlFormat{}
+	}
+
+	return jsonFormat{}
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) decode(raw []byte) ([]byte, error) {
+	return raw, nil
+}
+
+func (jsonFormat) encode(doc []byte, _ []byte) ([]byte, error) {
+	return doc, nil
+}
+
+type tomlFormat struct{}
+
+func (tomlFormat) decode(raw []byte) ([]byte, error) {
+	var doc map[string]any
+
+	if err := toml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+// encode writes the document as TOML. Comments cannot be kept in general, as the document does not record where they
+// were, but the comment block at the top of the previous file is kept.
+func (tomlFormat) encode(doc []byte, previous []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+
+	var values map[string]any
+
+	if err := dec.Decode(&values); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString(leadingComments(previous))
+
+	if err := toml.NewEncoder(&buf).Encode(tomlValue(values)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// tomlValue converts a decoded JSON value into one the TOML encoder accepts: numbers become integers where possible,
+// and nulls, which TOML cannot represent, are dropped.
+func tomlValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+
+		return f
+	case map[string]any:
+		out := make(map[string]any, len(v))
+
+		for key, value := range v {
+			if value != nil {
+				out[key] = tomlValue(value)
+			}
+		}
+
+		return out
+	case []any:
+		out := make([]any, 0, len(v))
+
+		for _, value := range v {
+			if value != nil {
+				out = append(out, tomlValue(value))
+			}
+		}
+
+		return out
+	default:
+		return v
+	}
+}
+
+// leadingComments returns the comment lines, and blank lines between them, at the top of a TOML file.
+func leadingComments(raw []byte) string {
+	var (
+		out     strings.Builder
+		pending strings.Builder
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			if out.Len() > 0 {
+				pending.WriteString("\n")
+			}
+		case strings.HasPrefix(line, "#"):
+			out.WriteString(pending.String())
+			pending.Reset()
+			out.WriteString(scanner.Text() + "\n")
+		default:
+			if out.Len() > 0 {
+				out.WriteString("\n")
+			}
+
+			return out.String()
+		}
+	}
+
+	if out.Len() > 0 {
+		out.WriteString("\n")
+	}
+
+	return out.String()
+}
+
+// legacyConfigFile returns the config.json written by older versions that the config file at path is still to be
+// converted from, or "" if there is none. Only the default config file is converted, not one chosen with --config or
+// TEAM_CLI_CONFIG.
+func legacyConfigFile(path string) string {
+	if configFileOverride != "" || os.Getenv(configEnvVar) != "" {
+		return ""
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return ""
+	}
+
+	jsonPath, err := configPath("config.json")
+	if err != nil {
+		return ""
+	}
+
+	if _, err := os.Stat(jsonPath); err != nil {
+		return ""
+	}
+
+	return jsonPath
+}
+
+// migrateConfigFormat converts the JSON config file in the config directory to TOML, unless the TOML file exists
+// already. The caller holds the config lock. The JSON file is kept, renamed, in case anything needs to be recovered
+// from it.
+func migrateConfigFormat(tomlPath string, jsonPath string) {
+	if _, err := os.Stat(tomlPath); !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	raw, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return
+	}
+
+	if !json.Valid(raw) {
+		slog.Warn("Config file is not valid JSON, not converting it to TOML", "path", jsonPath)
+
+		return
+	}
+
+	enc, err := tomlFormat{}.encode(raw, nil)
+	if err == nil {
+		err = writeFileAtomic(tomlPath, enc, 0600)
+	}
+
+	if err != nil {
+		slog.Warn("Could not convert config file to TOML, continuing with JSON", "path", jsonPath, "err", err)
+
+		return
+	}
+
+	if err := os.Rename(jsonPath, jsonPath+".migrated"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Could not rename the migrated JSON config file", "path", jsonPath, "err", err)
+	}
+
+	slog.Info("Converted config file to TOML", "from", jsonPath, "to", tomlPath)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/filelock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOMLConfig(t *testing.T) {
+	home := isolateConfig(t)
+	path := filepath.Join(home, "config.toml")
+	t.Setenv(configEnvVar, path)
+
+	require.NoError(t, os.WriteFile(path, []byte(`# Managed by hand.
+# Keep the aliases sorted.
+
+version = 3
+default_profile = "work"
+expiry_warning = "30m"
+
+[profiles.work.aliases]
+pay = "payments"
+`), 0600))
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.Equal(t, "work", cfg.ProfileName)
+	require.Equal(t, "30m", cfg.ExpiryWarning)
+	require.Equal(t, map[string]string{"pay": "payments"}, cfg.Aliases)
+
+	_, _, err = executeCmd(t, "alias", "set", "db", "database")
+	require.NoError(t, err)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Regexp(t, `^# Managed by hand.\n# Keep the aliases sorted.\n\n`, string(raw))
+
+	cfg, err = readConfig()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"db": "database", "pay": "payments"}, cfg.Aliases)
+}
+
+func TestMigrateConfigFormat(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tomlPath := filepath.Join(dir, "config.toml")
+	jsonPath := filepath.Join(dir, "config.json")
+
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"version":3,"log_file_max_size":1048576,"proxy":null}`), 0600))
+
+	migrateConfigFormat(tomlPath, jsonPath)
+
+	require.NoFileExists(t, jsonPath)
+	require.FileExists(t, jsonPath+".migrated")
+
+	raw, err := os.ReadFile(tomlPath)
+	require.NoError(t, err)
+
+	doc, err := tomlFormat{}.decode(raw)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"version":3,"log_file_max_size":1048576}`, string(doc))
+
+	// Once the TOML file exists, a JSON file appearing again is left alone.
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"version":3}`), 0600))
+
+	migrateConfigFormat(tomlPath, jsonPath)
+
+	require.FileExists(t, jsonPath)
+}
+
+func TestReadConfigMigratesFormatLocked(t *testing.T) {
+	isolateConfig(t)
+
+	oldTimeout := configLockTimeout
+	configLockTimeout = 100 * time.Millisecond
+
+	t.Cleanup(func() {
+		configLockTimeout = oldTimeout
+	})
+
+	tomlPath, err := configFilePath()
+	require.NoError(t, err)
+
+	jsonPath := filepath.Join(filepath.Dir(tomlPath), "config.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"version":3,"profiles":{"default":{"aliases":{"pay":"payments"}}}}`), 0600))
+
+	lock, err := filelock.Acquire(context.Background(), tomlPath+".lock", time.Second)
+	require.NoError(t, err)
+
+	_, err = readConfig()
+	require.ErrorIs(t, err, ErrConfigLocked)
+	require.NoFileExists(t, tomlPath)
+	require.FileExists(t, jsonPath)
+
+	require.NoError(t, lock.Release())
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"pay": "payments"}, cfg.Aliases)
+	require.FileExists(t, tomlPath)
+	require.FileExists(t, jsonPath+".migrated")
+}
+
+func TestLeadingComments(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, leadingComments(nil))
+	require.Empty(t, leadingComments([]byte("version = 3\n# not leading\n")))
+	require.Equal(t, "# a\n\n# b\n\n", leadingComments([]byte("\n# a\n\n# b\nversion = 3\n")))
+}
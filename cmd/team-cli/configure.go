@@ -1,10 +1,18 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/csnewman/team-cli/internal/output"
 	"github.com/csnewman/team-cli/internal/team"
 	"github.com/spf13/cobra"
 )
@@ -20,44 +28,411 @@ func configureCmdRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("no-browser flag: %w", err)
 	}
 
-	remoteCfg, err := team.ExtractConfig(cmd.Context(), args[0])
+	callbackPort, err := cmd.Flags().GetInt("callback-port")
+	if err != nil {
+		return fmt.Errorf("callback-port flag: %w", err)
+	}
+
+	if callbackPort < 0 || callbackPort > 65535 {
+		return fmt.Errorf("%w: --callback-port must be between 1 and 65535", ErrUsage)
+	}
+
+	forceLogin, err := cmd.Flags().GetBool("force-login")
+	if err != nil {
+		return fmt.Errorf("force-login flag: %w", err)
+	}
+
+	skipVerify, err := cmd.Flags().GetBool("skip-verify")
+	if err != nil {
+		return fmt.Errorf("skip-verify flag: %w", err)
+	}
+
+	bundle, err := cmd.Flags().GetString("bundle")
+	if err != nil {
+		return fmt.Errorf("bundle flag: %w", err)
+	}
+
+	credentialCommand, err := cmd.Flags().GetString("credential-command")
+	if err != nil {
+		return fmt.Errorf("credential-command flag: %w", err)
+	}
+
+	login := team.BrowserLogin{NoBrowser: noBrowser, CallbackPort: callbackPort}
+
+	// Without the flags, the port and credential command chosen by an earlier configure are kept, as is the browser
+	// command.
+	existing, err := readConfigOrEmpty()
+	if err == nil {
+		if !cmd.Flags().Changed("callback-port") {
+			login.CallbackPort = existing.CallbackPort
+		}
+
+		if !cmd.Flags().Changed("credential-command") {
+			credentialCommand = existing.CredentialCommand
+		}
+
+		login.BrowserCommand = existing.BrowserCommand
+	} else {
+		existing = nil
+	}
+
+	// Without a credential command, configure may log in or refresh the stored token, which is refused up front.
+	if credentialCommand == "" {
+		if err := checkTokenFetch(); err != nil {
+			return err
+		}
+	}
+
+	ctx, stopSpinner := startSpinner(cmd, "fetching server configuration")
+
+	var remoteCfg *team.RemoteConfig
+
+	if bundle != "" {
+		remoteCfg, err = team.ExtractConfigFromBundle(ctx, nil, args[0], bundle)
+	} else {
+		remoteCfg, err = team.ExtractConfig(ctx, nil, args[0])
+	}
+
+	stopSpinner()
+
 	if err != nil {
 		return err
 	}
 
 	slog.Info("Extracted remote configuration", "cfg", remoteCfg)
 
+	if !useDeviceCode && cmd.Flags().Changed("callback-port") && !remoteCfg.AllowsCallbackPort(cmp.Or(callbackPort, team.DefaultCallbackPort)) {
+		return fmt.Errorf(
+			"%w: --callback-port %d is not an allowed login redirect, the app allows: %s",
+			ErrUsage, callbackPort, strings.Join(remoteCfg.LocalRedirectURIs(), ", "),
+		)
+	}
+
+	// The browser is likely still signed in as the identity of another profile on the same server, so the login
+	// page is shown anyway to let a different identity be chosen.
+	sharing := otherProfilesOnServer(existing, remoteCfg)
+	login.PromptLogin = len(sharing) > 0
+
 	var token *team.AuthToken
 
-	if useDeviceCode {
-		token, err = team.FetchTokenViaDeviceCode(cmd.Context(), remoteCfg, func(_ context.Context) (string, error) {
-			return promptString("Device code? ")
-		})
-	} else {
-		token, err = team.FetchToken(cmd.Context(), remoteCfg, noBrowser)
+	if !forceLogin {
+		token = reusableToken(cmd.Context(), existing, remoteCfg)
+	}
+
+	switch {
+	case token != nil:
+		fmt.Fprintln(cmd.ErrOrStderr(), "Reusing existing authentication")
+	case credentialCommand != "":
+		token, err = team.FetchTokenViaCommand(cmd.Context(), credentialCommand)
+	case useDeviceCode:
+		token, err = team.FetchTokenViaDeviceCode(
+			cmd.Context(), remoteCfg, withDeviceCodePrompt(login), pauseBeforeBrowser,
+		)
+	default:
+		token, err = team.FetchToken(cmd.Context(), remoteCfg, withPastedRedirect(login))
 	}
 
 	if err != nil {
 		return err
 	}
 
-	slog.Info("Fetched initial token")
+	slog.Info("Obtained token")
 
-	existingCfg, err := readConfig()
-	if err != nil {
-		return fmt.Errorf("failed to read existing config: %w", err)
+	if identity := token.Identity(); identity != "" {
+		for _, name := range sharing {
+			if existing.Profiles[name].AuthToken.Identity() == identity {
+				fmt.Fprintf(
+					cmd.ErrOrStderr(),
+					"Note: profile %q is also logged in as %s; to use another identity, sign out in the browser and "+
+						"run configure again with --force-login\n",
+					name, identity,
+				)
+			}
+		}
 	}
 
-	existingCfg.UseDeviceCode = useDeviceCode
-	existingCfg.NoBrowser = noBrowser
-	existingCfg.ServerConfig = remoteCfg
-	existingCfg.AuthToken = token
+	var verifyErr error
 
-	if err := writeConfig(existingCfg); err != nil {
-		return fmt.Errorf("failed to write existing config: %w", err)
+	if !skipVerify {
+		verifyErr = verifyConfig(cmd, remoteCfg, token)
+		if verifyErr != nil && !saveUnverified() {
+			return verifyErr
+		}
+	}
+
+	cfg, err := updateConfig(cmd.Context(), func(existingCfg *Config) (bool, error) {
+		existingCfg.UseDeviceCode = useDeviceCode
+		existingCfg.NoBrowser = noBrowser
+		existingCfg.CallbackPort = login.CallbackPort
+		existingCfg.CredentialCommand = credentialCommand
+		existingCfg.ServerConfig = remoteCfg
+		existingCfg.AuthToken = token
+
+		// The first profile configured becomes the default, even when it is not called default.
+		if existingCfg.DefaultProfile == "" && !existingCfg.hasProfile(defaultProfileName) {
+			existingCfg.DefaultProfile = existingCfg.ProfileName
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update config: %w", err)
 	}
 
 	slog.Info("TEAM CLI config updated")
 
+	recordHistory(cfg, &historyEntry{Action: historyConfigure, Server: remoteCfg.Server})
+
+	return verifyErr
+}
+
+// verifyConfig runs a cheap query with the new token, so a config that cannot actually be used is caught before it
+// is relied upon.
+func verifyConfig(cmd *cobra.Command, remote *team.RemoteConfig, token *team.AuthToken) error {
+	info := cmd.ErrOrStderr()
+
+	ctx, stopSpinner := startSpinner(cmd, "verifying access")
+	err := team.VerifyAccess(ctx, remote, token)
+	stopSpinner()
+
+	if err != nil {
+		fmt.Fprintf(info, "Verification failed: %v\n", err)
+
+		return fmt.Errorf("could not verify the configuration: %w", err)
+	}
+
+	fmt.Fprintln(info, "Verified access to the TEAM API")
+
+	return nil
+}
+
+// saveUnverified asks whether a config that failed verification should be saved anyway, for debugging. The command
+// still fails either way.
+func saveUnverified() bool {
+	if !stdinIsTerminal() {
+		return false
+	}
+
+	save, err := promptBool(
+		"Save the configuration anyway so it can be debugged (y/n)? ",
+		input{name: "confirmation"},
+	)
+	if err != nil {
+		slog.Warn("Failed to read answer", "err", err)
+
+		return false
+	}
+
+	return save
+}
+
+// reusableToken returns the token stored in existing when it was issued for the same server and is still valid,
+// refreshing it if needed, or nil when a new login is required.
+func reusableToken(ctx context.Context, existing *Config, remote *team.RemoteConfig) *team.AuthToken {
+	if existing == nil || existing.AuthToken == nil || !sameServer(existing.ServerConfig, remote) {
+		return nil
+	}
+
+	if tokenValid(existing.AuthToken) {
+		return existing.AuthToken
+	}
+
+	if existing.AuthToken.RefreshToken == "" {
+		return nil
+	}
+
+	token, err := team.RefreshToken(ctx, remote, existing.AuthToken)
+	if err != nil {
+		slog.Info("Could not refresh the existing token", "err", err)
+
+		return nil
+	}
+
+	return token
+}
+
+// otherProfilesOnServer returns the names of the profiles other than the selected one that hold a token for remote.
+// Each profile keeps its own token, so these are left untouched by configuring the selected one.
+func otherProfilesOnServer(cfg *Config, remote *team.RemoteConfig) []string {
+	if cfg == nil {
+		return nil
+	}
+
+	var names []string
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		profile := cfg.Profiles[name]
+
+		if name != cfg.ProfileName && cfg.hasProfile(name) && profile.AuthToken != nil &&
+			sameServer(profile.ServerConfig, remote) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// sameServer reports whether tokens issued for a are accepted by b, which requires the same server and app client.
+func sameServer(a *team.RemoteConfig, b *team.RemoteConfig) bool {
+	return a != nil && b != nil &&
+		strings.TrimSuffix(a.Server, "/") == strings.TrimSuffix(b.Server, "/") &&
+		a.OAuthDomain == b.OAuthDomain &&
+		a.UserPoolClientID == b.UserPoolClientID
+}
+
+// pauseBeforeBrowser waits for confirmation before the device login page is opened in the local browser, since the
+// login may be completed on another device instead. Without a terminal there is no one to confirm, so it does not wait.
+func pauseBeforeBrowser(context.Context) error {
+	if !stdinIsTerminal() {
+		return nil
+	}
+
+	_, err := prompt(
+		"Press Enter to open the login page in this browser, or complete it on another device... ",
+		input{name: "confirmation"},
+	)
+
+	return err
+}
+
+// configView describes the config in use. Secrets are never included.
+type configView struct {
+	Path           string            `json:"path"`
+	Profile        string            `json:"profile"`
+	Server         string            `json:"server"`
+	Authenticated  bool              `json:"authenticated"`
+	TokenExpiresAt *time.Time        `json:"tokenExpiresAt,omitempty"`
+	UseDeviceCode  bool              `json:"useDeviceCode"`
+	NoBrowser      bool              `json:"noBrowser"`
+	NoPager        bool              `json:"noPager"`
+	UTC            bool              `json:"utc"`
+	LogFile        string            `json:"logFile,omitempty"`
+	LogFileMaxSize int64             `json:"logFileMaxSize,omitempty"`
+	Aliases        map[string]string `json:"aliases,omitempty"`
+	Defaults       defaultsView      `json:"defaults"`
+}
+
+// defaultsView holds the defaults in effect for the profile: the configured ones, and the built-in ones otherwise.
+type defaultsView struct {
+	Output string `json:"output"`
+	// Duration is in hours. It is omitted when the duration is always asked for.
+	Duration            int    `json:"duration,omitempty"`
+	Start               string `json:"start"`
+	JustificationPrefix string `json:"justificationPrefix,omitempty"`
+}
+
+func (v *configView) WriteText(w io.Writer) error {
+	server := v.Server
+	if server == "" {
+		server = "(not configured)"
+	}
+
+	fmt.Fprintf(w, "Config file: %s\n", v.Path)
+	fmt.Fprintf(w, "Profile: %s\n", v.Profile)
+	fmt.Fprintf(w, "Server: %s\n", server)
+
+	if v.TokenExpiresAt != nil {
+		fmt.Fprintf(w, "Token expires: %s\n", fmtDate(*v.TokenExpiresAt))
+	} else {
+		fmt.Fprintln(w, "Token expires: (not authenticated)")
+	}
+
+	fmt.Fprintf(w, "Use device code: %v\n", v.UseDeviceCode)
+	fmt.Fprintf(w, "No browser: %v\n", v.NoBrowser)
+	fmt.Fprintf(w, "No pager: %v\n", v.NoPager)
+	fmt.Fprintf(w, "UTC: %v\n", v.UTC)
+
+	if v.LogFile != "" {
+		fmt.Fprintf(w, "Log file: %s\n", v.LogFile)
+	}
+
+	fmt.Fprintf(w, "Aliases: %d\n", len(v.Aliases))
+	fmt.Fprintf(w, "Default output: %s\n", v.Defaults.Output)
+
+	if v.Defaults.Duration != 0 {
+		fmt.Fprintf(w, "Default duration: %s\n", team.FormatDuration(team.Hours(v.Defaults.Duration)))
+	} else {
+		fmt.Fprintln(w, "Default duration: (ask)")
+	}
+
+	fmt.Fprintf(w, "Default start: %s\n", v.Defaults.Start)
+
+	if v.Defaults.JustificationPrefix != "" {
+		fmt.Fprintf(w, "Justification prefix: %s\n", v.Defaults.JustificationPrefix)
+	}
+
+	return nil
+}
+
+func configShowCmdRun(cmd *cobra.Command, args []string) error {
+	path, err := configFilePath()
+	if err != nil {
+		return fmt.Errorf("could not determine config path: %w", err)
+	}
+
+	cfg, err := readConfigOrEmpty()
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+
+	defaults := cfg.defaults()
+
+	view := &configView{
+		Path:           path,
+		Profile:        cfg.ProfileName,
+		UseDeviceCode:  cfg.UseDeviceCode,
+		NoBrowser:      cfg.NoBrowser,
+		NoPager:        cfg.NoPager,
+		UTC:            cfg.UTC,
+		LogFile:        cfg.LogFile,
+		LogFileMaxSize: cfg.LogFileMaxSize,
+		Aliases:        cfg.Aliases,
+		Defaults: defaultsView{
+			Output:              cmp.Or(defaults.Output, string(output.FormatTable)),
+			Duration:            defaults.Duration,
+			Start:               cmp.Or(defaults.Start, "now"),
+			JustificationPrefix: defaults.JustificationPrefix,
+		},
+	}
+
+	if cfg.ServerConfig != nil {
+		view.Server = cfg.ServerConfig.Server
+	}
+
+	if cfg.AuthToken != nil {
+		expiresAt := cfg.AuthToken.ExpiresAt.UTC()
+		view.Authenticated = cfg.AuthToken.AccessToken != ""
+		view.TokenExpiresAt = &expiresAt
+	}
+
+	return render(cmd, view)
+}
+
+func configValidateCmdRun(cmd *cobra.Command, _ []string) error {
+	path, err := configFilePath()
+	if err != nil {
+		return fmt.Errorf("could not determine config path: %w", err)
+	}
+
+	cfg, err := readConfig()
+	if errors.Is(err, ErrConfigNotFound) {
+		return err
+	} else if err != nil {
+		// The problem is reported as found rather than wrapped, which would point back at this command.
+		return fmt.Errorf("%w: %s", ErrInvalid, err.Error())
+	}
+
+	problems := cfg.validate()
+
+	for _, problem := range problems {
+		fmt.Fprintf(cmd.ErrOrStderr(), "  %s\n", problem)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s has %d problem(s)", ErrInvalid, path, len(problems))
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "%s is valid\n", path)
+
 	return nil
 }
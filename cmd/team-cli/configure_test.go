@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReusableToken(t *testing.T) {
+	t.Parallel()
+
+	valid := fixtureConfig()
+	valid.AuthToken.ExpiresAt = time.Now().Add(time.Hour)
+
+	remote := *valid.ServerConfig
+	remote.Server += "/"
+
+	require.Same(t, valid.AuthToken, reusableToken(context.Background(), valid, &remote))
+	require.Nil(t, reusableToken(context.Background(), nil, &remote))
+
+	// Tokens from another app client are not accepted.
+	otherClient := remote
+	otherClient.UserPoolClientID = "other"
+
+	require.Nil(t, reusableToken(context.Background(), valid, &otherClient))
+
+	// An expired token without a refresh token needs a new login.
+	expired := fixtureConfig()
+	expired.AuthToken.RefreshToken = ""
+
+	require.Nil(t, reusableToken(context.Background(), expired, &remote))
+}
+
+func TestOtherProfilesOnServer(t *testing.T) {
+	t.Parallel()
+
+	cfg := fixtureConfig()
+	admin := *cfg.Profile
+	cfg.Profiles["admin"] = &admin
+	cfg.Profiles["work"] = &Profile{ServerConfig: &team.RemoteConfig{Server: "https://work.example.com"}}
+
+	require.Equal(t, []string{"admin"}, otherProfilesOnServer(cfg, cfg.ServerConfig))
+
+	cfg.useProfile("admin")
+	require.Equal(t, []string{defaultProfileName}, otherProfilesOnServer(cfg, cfg.ServerConfig))
+
+	require.Empty(t, otherProfilesOnServer(cfg, cfg.Profiles["work"].ServerConfig))
+	require.Empty(t, otherProfilesOnServer(nil, cfg.ServerConfig))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/csnewman/team-cli/internal/fileperm"
+	"github.com/csnewman/team-cli/internal/team"
+)
+
+var ErrInsecurePermissions = errors.New("insecure permissions")
+
+// allowInsecurePermissions is set by --insecure-permissions to only warn about exposed credential files.
+var allowInsecurePermissions bool
+
+// checkCredentialsPermissions refuses to use a credentials file that other users can read, as ssh does for private
+// keys, unless --insecure-permissions was given.
+func checkCredentialsPermissions(path string) error {
+	exposure, err := fileperm.Exposure(path)
+	if err != nil {
+		return fmt.Errorf("could not check credentials file permissions: %w", err)
+	}
+
+	if exposure == "" {
+		return nil
+	}
+
+	if allowInsecurePermissions {
+		slog.Warn("Credentials file is not private", "path", path, "exposure", exposure)
+
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%w: credentials file %s is %s; restrict it to your user (e.g. chmod 600) or pass --insecure-permissions",
+		ErrInsecurePermissions,
+		path,
+		exposure,
+	)
+}
+
+// credentials holds the secrets kept apart from the settings in Config, so the config file can be shared (e.g. in a
+// dotfiles repository) without leaking tokens.
+type credentials struct {
+	// AuthToken is the token of the default profile, as stored before profiles were introduced.
+	AuthToken *team.AuthToken                `json:"auth_token,omitempty"`
+	Profiles  map[string]*profileCredentials `json:"profiles,omitempty"`
+	// Encrypted holds all of the above when encrypt_secrets is set.
+	Encrypted *sealedSecrets `json:"encrypted,omitempty"`
+}
+
+type profileCredentials struct {
+	AuthToken *team.AuthToken `json:"auth_token"`
+	APIKey    string          `json:"api_key,omitempty"`
+}
+
+// token returns the stored token of the named profile.
+func (c *credentials) token(profile string) *team.AuthToken {
+	if creds := c.Profiles[profile]; creds != nil {
+		return creds.AuthToken
+	}
+
+	if profile == defaultProfileName {
+		return c.AuthToken
+	}
+
+	return nil
+}
+
+// apiKey returns the stored API key of the named profile.
+func (c *credentials) apiKey(profile string) string {
+	if creds := c.Profiles[profile]; creds != nil {
+		return creds.APIKey
+	}
+
+	return ""
+}
+
+func (c *credentials) hasTokens() bool {
+	if c.AuthToken != nil {
+		return true
+	}
+
+	for _, creds := range c.Profiles {
+		if creds != nil && (creds.AuthToken != nil || creds.APIKey != "") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// credentialsPath returns the credentials file belonging to the config file at configPath: credentials.json next to
+// config.toml or config.json, or <name>.credentials.json next to any other config file. Secrets are always stored as
+// JSON, whatever the format of the config file.
+func credentialsPath(configPath string) string {
+	dir, base := filepath.Split(configPath)
+
+	if base == "config.toml" || base == "config.json" {
+		return filepath.Join(dir, "credentials.json")
+	}
+
+	return filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base))+".credentials.json")
+}
+
+func readCredentials(store credentialStore) (*credentials, error) {
+	raw, ok, err := store.load()
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return new(credentials), nil
+	}
+
+	var creds *credentials
+
+	if err := json.Unmarshal(raw, &creds); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal credentials in %s: %w", ErrInvalidConfig, store, err)
+	}
+
+	if creds == nil {
+		return new(credentials), nil
+	}
+
+	if creds.Encrypted == nil {
+		return creds, nil
+	}
+
+	raw, err = creds.Encrypted.open(store.String())
+	if err != nil {
+		return nil, err
+	}
+
+	creds = nil
+
+	if err := json.Unmarshal(raw, &creds); err != nil || creds == nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal decrypted credentials in %s: %w", ErrInvalidConfig, store, err)
+	}
+
+	return creds, nil
+}
+
+// writeCredentials writes creds to store, encrypted when encrypt is set. There is nothing to protect without tokens,
+// so no passphrase is asked for then.
+func writeCredentials(store credentialStore, creds *credentials, encrypt bool) error {
+	enc, err := json.MarshalIndent(creds, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials file: %w", err)
+	}
+
+	if encrypt && creds.hasTokens() {
+		sealed, err := sealSecrets(enc)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt credentials file: %w", err)
+		}
+
+		enc, err = json.MarshalIndent(&credentials{Encrypted: sealed}, "", "    ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal credentials file: %w", err)
+		}
+	}
+
+	return store.save(enc)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// credentialStoreEnvVar selects where secrets are kept: credentialStoreFile or credentialStoreWincred. Without it,
+// the Windows Credential Manager is used on Windows and the credentials file elsewhere.
+const credentialStoreEnvVar = "TEAM_CLI_CREDENTIAL_STORE"
+
+const (
+	// credentialStoreFile keeps secrets in the credentials file next to the config file, see credentialsPath.
+	credentialStoreFile = "file"
+	// credentialStoreWincred keeps secrets in the Windows Credential Manager.
+	credentialStoreWincred = "wincred"
+)
+
+// credentialStore keeps the encoded credentials belonging to a config file.
+type credentialStore interface {
+	// load returns the stored credentials, reporting false when none are stored.
+	load() ([]byte, bool, error)
+	// save replaces the stored credentials with raw.
+	save(raw []byte) error
+	// remove deletes the stored credentials, if any.
+	remove() error
+	// checkPermissions returns an error when other users can read the stored credentials.
+	checkPermissions() error
+	// backup returns the store that the credentials are backed up to alongside the config file.
+	backup() credentialStore
+	// String describes where the credentials are kept, for messages.
+	String() string
+}
+
+// credentialStoreFor returns the store of the credentials belonging to the config file at configPath.
+func credentialStoreFor(configPath string) (credentialStore, error) {
+	file := fileCredentialStore(credentialsPath(configPath))
+
+	switch name := cmp.Or(os.Getenv(credentialStoreEnvVar), defaultCredentialStore); name {
+	case credentialStoreFile:
+		return file, nil
+	case credentialStoreWincred:
+		return newWincredStore(file)
+	default:
+		return nil, fmt.Errorf(
+			"%w: %s is %q, expected %q or %q",
+			ErrInvalidConfig, credentialStoreEnvVar, name, credentialStoreFile, credentialStoreWincred,
+		)
+	}
+}
+
+// replaceCredentials stores raw in s, or empties s when there is nothing to store.
+func replaceCredentials(s credentialStore, raw []byte, ok bool) error {
+	if !ok {
+		return s.remove()
+	}
+
+	return s.save(raw)
+}
+
+// swapCredentials exchanges the credentials kept in a and b, either of which may be empty.
+func swapCredentials(a credentialStore, b credentialStore) error {
+	rawA, okA, err := a.load()
+	if err != nil {
+		return err
+	}
+
+	rawB, okB, err := b.load()
+	if err != nil {
+		return err
+	}
+
+	if err := replaceCredentials(a, rawB, okB); err != nil {
+		return err
+	}
+
+	return replaceCredentials(b, rawA, okA)
+}
+
+// fileCredentialStore keeps the credentials in the file at its path, which only the user may read.
+type fileCredentialStore string
+
+func (s fileCredentialStore) load() ([]byte, bool, error) {
+	raw, err := os.ReadFile(string(s))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	return raw, true, nil
+}
+
+func (s fileCredentialStore) save(raw []byte) error {
+	if err := writeFileAtomic(string(s), raw, 0600); err != nil {
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+
+	return nil
+}
+
+func (s fileCredentialStore) remove() error {
+	if err := os.Remove(string(s)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove credentials file: %w", err)
+	}
+
+	return nil
+}
+
+func (s fileCredentialStore) checkPermissions() error {
+	return checkCredentialsPermissions(string(s))
+}
+
+func (s fileCredentialStore) backup() credentialStore {
+	return s + backupSuffix
+}
+
+func (s fileCredentialStore) String() string {
+	return string(s)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+const defaultCredentialStore = credentialStoreFile
+
+func newWincredStore(fileCredentialStore) (credentialStore, error) {
+	return nil, fmt.Errorf(
+		"%w: the %s credential store is only available on Windows", ErrInvalidConfig, credentialStoreWincred,
+	)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialStoreFor(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+
+	t.Setenv(credentialStoreEnvVar, credentialStoreFile)
+
+	store, err := credentialStoreFor(path)
+	require.NoError(t, err)
+	require.Equal(t, fileCredentialStore(filepath.Join(dir, "credentials.json")), store)
+
+	_, ok, err := store.load()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// The backup is kept next to the file, and swapping exchanges the two.
+	require.NoError(t, store.save([]byte(`{"current":true}`)))
+	require.NoError(t, swapCredentials(store, store.backup()))
+
+	_, ok, err = store.load()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	raw, ok, err := store.backup().load()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.JSONEq(t, `{"current":true}`, string(raw))
+
+	t.Setenv(credentialStoreEnvVar, "keychain")
+
+	_, err = credentialStoreFor(path)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+
+	t.Setenv(credentialStoreEnvVar, credentialStoreWincred)
+
+	_, err = credentialStoreFor(path)
+	if runtime.GOOS == "windows" {
+		require.NoError(t, err)
+	} else {
+		require.ErrorIs(t, err, ErrInvalidConfig)
+	}
+}
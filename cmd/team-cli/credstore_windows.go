@@ -0,0 +1,190 @@
+//go:build windows
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/danieljoos/wincred"
+)
+
+const defaultCredentialStore = credentialStoreWincred
+
+// wincredBlobSize is the most a single credential can hold (CRED_MAX_CREDENTIAL_BLOB_SIZE). A login's tokens take
+// more than that, so the credentials are split over several credentials.
+const wincredBlobSize = 5 * 512
+
+// wincredStore keeps the credentials in the Windows Credential Manager. The credential named target holds a manifest
+// of the parts the credentials are split into, which are written under a new generation on every save, so that a
+// reader never mixes parts of two saves. Credentials still in legacy, the file used before, are read from there
+// until the next save moves them over.
+type wincredStore struct {
+	target string
+	legacy fileCredentialStore
+}
+
+// wincredManifest lists the parts of the stored credentials.
+type wincredManifest struct {
+	Generation string `json:"generation"`
+	Parts      int    `json:"parts"`
+}
+
+func newWincredStore(file fileCredentialStore) (credentialStore, error) {
+	return &wincredStore{target: "team-cli:" + string(file), legacy: file}, nil
+}
+
+func (s *wincredStore) part(generation string, i int) string {
+	return fmt.Sprintf("%s#%s#%d", s.target, generation, i)
+}
+
+// manifest returns the manifest of the stored credentials, or nil when none are stored.
+func (s *wincredStore) manifest() (*wincredManifest, error) {
+	cred, err := wincred.GetGenericCredential(s.target)
+	if errors.Is(err, wincred.ErrElementNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read credentials from the Windows Credential Manager: %w", err)
+	}
+
+	var manifest *wincredManifest
+
+	if err := json.Unmarshal(cred.CredentialBlob, &manifest); err != nil || manifest == nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal credentials manifest %s: %w", ErrInvalidConfig, s.target, err)
+	}
+
+	return manifest, nil
+}
+
+func (s *wincredStore) load() ([]byte, bool, error) {
+	manifest, err := s.manifest()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if manifest == nil {
+		return s.legacy.load()
+	}
+
+	var raw []byte
+
+	for i := range manifest.Parts {
+		cred, err := wincred.GetGenericCredential(s.part(manifest.Generation, i))
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read credentials from the Windows Credential Manager: %w", err)
+		}
+
+		raw = append(raw, cred.CredentialBlob...)
+	}
+
+	return raw, true, nil
+}
+
+func (s *wincredStore) save(raw []byte) error {
+	previous, err := s.manifest()
+	if err != nil {
+		return err
+	}
+
+	id := make([]byte, 8)
+
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("failed to generate credentials generation: %w", err)
+	}
+
+	manifest := &wincredManifest{Generation: hex.EncodeToString(id)}
+
+	for start := 0; start < len(raw); start += wincredBlobSize {
+		cred := wincred.NewGenericCredential(s.part(manifest.Generation, manifest.Parts))
+		cred.CredentialBlob = raw[start:min(start+wincredBlobSize, len(raw))]
+
+		if err := cred.Write(); err != nil {
+			return fmt.Errorf("failed to write credentials to the Windows Credential Manager: %w", err)
+		}
+
+		manifest.Parts++
+	}
+
+	enc, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials manifest: %w", err)
+	}
+
+	cred := wincred.NewGenericCredential(s.target)
+	cred.CredentialBlob = enc
+
+	if err := cred.Write(); err != nil {
+		return fmt.Errorf("failed to write credentials to the Windows Credential Manager: %w", err)
+	}
+
+	s.removeParts(previous)
+
+	if _, err := os.Stat(string(s.legacy)); err == nil {
+		slog.Info("Moving credentials to the Windows Credential Manager", "from", s.legacy)
+
+		return s.legacy.remove()
+	}
+
+	return nil
+}
+
+// removeParts deletes the parts listed in manifest. Parts left behind take up space but are never read, so failing
+// to delete them is only logged.
+func (s *wincredStore) removeParts(manifest *wincredManifest) {
+	if manifest == nil {
+		return
+	}
+
+	for i := range manifest.Parts {
+		cred := wincred.NewGenericCredential(s.part(manifest.Generation, i))
+
+		if err := cred.Delete(); err != nil && !errors.Is(err, wincred.ErrElementNotFound) {
+			slog.Debug("Could not delete credentials part", "target", cred.TargetName, "err", err)
+		}
+	}
+}
+
+func (s *wincredStore) remove() error {
+	manifest, err := s.manifest()
+	if err != nil {
+		return err
+	}
+
+	if manifest != nil {
+		err := wincred.NewGenericCredential(s.target).Delete()
+		if err != nil && !errors.Is(err, wincred.ErrElementNotFound) {
+			return fmt.Errorf("failed to remove credentials from the Windows Credential Manager: %w", err)
+		}
+
+		s.removeParts(manifest)
+	}
+
+	return s.legacy.remove()
+}
+
+// checkPermissions checks the legacy file while credentials are still read from it. The Credential Manager itself
+// only gives the user access to their credentials.
+func (s *wincredStore) checkPermissions() error {
+	if manifest, err := s.manifest(); err != nil || manifest != nil {
+		return err
+	}
+
+	if _, err := os.Stat(string(s.legacy)); err != nil {
+		return nil
+	}
+
+	return s.legacy.checkPermissions()
+}
+
+func (s *wincredStore) backup() credentialStore {
+	return &wincredStore{target: s.target + backupSuffix, legacy: s.legacy + backupSuffix}
+}
+
+func (s *wincredStore) String() string {
+	return "the Windows Credential Manager (" + s.target + ")"
+}
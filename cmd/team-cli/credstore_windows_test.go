@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danieljoos/wincred"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWincredStore(t *testing.T) {
+	t.Parallel()
+
+	legacy := fileCredentialStore(filepath.Join(t.TempDir(), "credentials.json"))
+	store := &wincredStore{target: "team-cli-test:" + string(legacy), legacy: legacy}
+
+	t.Cleanup(func() {
+		require.NoError(t, store.remove())
+	})
+
+	// Credentials in the file used before are read until they are saved.
+	require.NoError(t, os.WriteFile(string(legacy), []byte(`{"legacy":true}`), 0600))
+
+	raw, ok, err := store.load()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, `{"legacy":true}`, string(raw))
+
+	// Credentials too large for a single credential are split, and the file is removed once they are saved.
+	large := bytes.Repeat([]byte("x"), 3*wincredBlobSize+17)
+	require.NoError(t, store.save(large))
+	require.NoFileExists(t, string(legacy))
+
+	raw, ok, err = store.load()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, large, raw)
+
+	// The parts of the previous save are deleted.
+	require.NoError(t, store.save([]byte(`{"small":true}`)))
+
+	parts, err := wincred.FilteredList(store.target + "#*")
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+
+	raw, _, err = store.load()
+	require.NoError(t, err)
+	require.Equal(t, `{"small":true}`, string(raw))
+
+	require.NoError(t, store.remove())
+
+	_, ok, err = store.load()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
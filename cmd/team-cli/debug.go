@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/spf13/cobra"
+)
+
+func debugSchemaCmdRun(cmd *cobra.Command, args []string) error {
+	asJSON, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return fmt.Errorf("json flag: %w", err)
+	}
+
+	check, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return fmt.Errorf("check flag: %w", err)
+	}
+
+	cfg, err := resolveConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("could not read config and authenticate: %w", err)
+	}
+
+	schema, err := retryUnauthorized(cmd, cfg, func() (*gql.Schema, error) {
+		return team.FetchSchema(cmd.Context(), cfg.ServerConfig, cfg.AuthToken)
+	})
+	if err != nil {
+		return fmt.Errorf("could not fetch schema: %w", err)
+	}
+
+	// With --check, the schema is only written when a file is given.
+	if len(args) == 1 || !check {
+		data, err := encodeSchema(schema, asJSON)
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 || args[0] == "-" {
+			if _, err := cmd.OutOrStdout().Write(data); err != nil {
+				return fmt.Errorf("could not write schema: %w", err)
+			}
+		} else if err := writeFileAtomic(args[0], data, 0644); err != nil {
+			return fmt.Errorf("could not write schema: %w", err)
+		}
+	}
+
+	if !check {
+		return nil
+	}
+
+	return checkOperations(cmd, schema)
+}
+
+// encodeSchema returns schema as SDL, or as the introspection result when asJSON is set.
+func encodeSchema(schema *gql.Schema, asJSON bool) ([]byte, error) {
+	if !asJSON {
+		return []byte(schema.SDL()), nil
+	}
+
+	data, err := json.MarshalIndent(map[string]any{"__schema": schema}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not encode schema: %w", err)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// checkOperations reports the problems of the operations team-cli sends against schema on stderr, failing if there
+// are any.
+func checkOperations(cmd *cobra.Command, schema *gql.Schema) error {
+	operations := team.Operations()
+
+	var problems []string
+
+	for _, op := range operations {
+		found, err := schema.Check(op)
+		if err != nil {
+			return fmt.Errorf("could not check operation: %w", err)
+		}
+
+		problems = append(problems, found...)
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintf(cmd.ErrOrStderr(), "  %s\n", problem)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: the operations of team-cli have %d problem(s) against the schema", ErrInvalid, len(problems))
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "All %d operations of team-cli match the schema\n", len(operations))
+
+	return nil
+}
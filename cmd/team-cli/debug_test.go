@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testIntrospection is the introspection result of a schema serving only the ID of a request.
+const testIntrospection = `{"data": {"__schema": {
+  "queryType": {"name": "Query"}, "mutationType": null, "subscriptionType": null, "directives": [],
+  "types": [
+    {"kind": "OBJECT", "name": "Query", "interfaces": [], "fields": [{"name": "getRequests",
+      "args": [{"name": "id", "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "ID"}}}],
+      "type": {"kind": "OBJECT", "name": "Requests"}}]},
+    {"kind": "OBJECT", "name": "Requests", "interfaces": [], "fields": [
+      {"name": "id", "args": [], "type": {"kind": "SCALAR", "name": "ID"}}]},
+    {"kind": "SCALAR", "name": "ID"}
+  ]
+}}}`
+
+func TestDebugSchema(t *testing.T) {
+	home := isolateConfig(t)
+	t.Setenv(configEnvVar, filepath.Join(home, "config.json"))
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(testIntrospection))
+	}))
+	t.Cleanup(api.Close)
+
+	cfg := fixtureConfig()
+	cfg.AuthToken = nil
+	cfg.AuthMode = authModeAPIKey
+	cfg.APIKey = "da2-stored"
+	cfg.ServerConfig.GraphQLEndpoint = api.URL + "/graphql"
+	require.NoError(t, writeConfig(cfg))
+
+	stdout, _, err := executeCmd(t, "debug", "schema")
+	require.NoError(t, err)
+	require.Equal(t, "type Query {\n  getRequests(id: ID!): Requests\n}\n\ntype Requests {\n  id: ID\n}\n", stdout)
+
+	stdout, _, err = executeCmd(t, "debug", "schema", "--json")
+	require.NoError(t, err)
+
+	var introspection map[string]any
+	require.NoError(t, json.Unmarshal([]byte(stdout), &introspection))
+	require.Contains(t, introspection, "__schema")
+
+	// The operations of team-cli select far more than this schema has.
+	path := filepath.Join(home, "schema.graphql")
+
+	stdout, stderr, err := executeCmd(t, "debug", "schema", "--check", path)
+	require.ErrorIs(t, err, ErrInvalid)
+	require.Empty(t, stdout)
+	require.Contains(t, stderr, "query GetRequests: getRequests.email: unknown field on type Requests")
+	require.Contains(t, stderr, "mutation UpdateRequests: the schema has no mutation type")
+
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(written), "type Requests {")
+}
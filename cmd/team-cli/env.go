@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/team"
+)
+
+// Environment variables that supply the server and token directly, for non-interactive use such as CI pipelines.
+const (
+	envServerConfig    = "TEAM_CLI_SERVER_CONFIG"
+	envGraphQLEndpoint = "TEAM_CLI_GRAPHQL_ENDPOINT"
+	envAccessToken     = "TEAM_CLI_ACCESS_TOKEN"
+	envIDToken         = "TEAM_CLI_ID_TOKEN"
+	// envAPIKey authorizes with an API key instead of a token, with the server from the environment or any profile.
+	envAPIKey = "TEAM_CLI_API_KEY"
+)
+
+// configFromEnv builds a config entirely from the environment, bypassing the config file. It returns nil when none
+// of the variables are set.
+func configFromEnv() (*Config, error) {
+	rawServer := os.Getenv(envServerConfig)
+	endpoint := os.Getenv(envGraphQLEndpoint)
+	accessToken := os.Getenv(envAccessToken)
+
+	if rawServer == "" && endpoint == "" && accessToken == "" {
+		return nil, nil
+	}
+
+	remote := new(team.RemoteConfig)
+
+	if rawServer != "" {
+		if err := json.Unmarshal([]byte(rawServer), remote); err != nil {
+			return nil, fmt.Errorf("%w: could not parse %s: %w", ErrInvalidConfig, envServerConfig, err)
+		}
+	}
+
+	if endpoint != "" {
+		remote.GraphQLEndpoint = endpoint
+	}
+
+	if remote.GraphQLEndpoint == "" {
+		return nil, fmt.Errorf(
+			"%w: %s is set, but no GraphQL endpoint was given in %s or %s",
+			ErrInvalidConfig,
+			envAccessToken,
+			envGraphQLEndpoint,
+			envServerConfig,
+		)
+	}
+
+	if accessToken == "" && os.Getenv(envAPIKey) != "" {
+		slog.Info("Using server and API key from the environment")
+
+		return &Config{
+			Version: configVersion,
+			Profile: &Profile{ServerConfig: remote, AuthMode: authModeAPIKey},
+		}, nil
+	}
+
+	if accessToken == "" {
+		return nil, fmt.Errorf(
+			"%w: %s or %s must be set when the server is given by the environment", ErrAuth, envAccessToken, envAPIKey,
+		)
+	}
+
+	// The ID token identifies the user to most commands. It is used without verification, since the server config
+	// from the environment may not name the user pool, and the server checks the access token on every request.
+	idToken := os.Getenv(envIDToken)
+	if idToken == "" {
+		return nil, fmt.Errorf(
+			"%w: %s must be set along with %s, to identify the user", ErrAuth, envIDToken, envAccessToken,
+		)
+	}
+
+	token := &team.AuthToken{
+		AccessToken: accessToken,
+		IdToken:     idToken,
+		TokenType:   "Bearer",
+		Unverified:  true,
+	}
+
+	// Tokens from the environment cannot be refreshed or replaced interactively, so an expired one fails fast.
+	if expiresAt, err := team.JWTExpiry(accessToken); err == nil {
+		if !time.Now().Before(expiresAt) {
+			return nil, fmt.Errorf(
+				"%w: %s expired at %s, and tokens provided by the environment cannot be refreshed",
+				ErrAuth,
+				envAccessToken,
+				fmtDate(expiresAt),
+			)
+		}
+
+		token.ExpiresAt = expiresAt
+	} else {
+		slog.Debug("Could not determine expiry of access token from the environment", "err", err)
+	}
+
+	slog.Info("Using server and token from the environment")
+
+	return &Config{
+		Version: configVersion,
+		Profile: &Profile{
+			ServerConfig: remote,
+			AuthToken:    token,
+		},
+	}, nil
+}
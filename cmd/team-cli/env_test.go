@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testJWT(exp time.Time) string {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+
+	return "e30." + claims + ".sig"
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	isolateConfig(t)
+
+	cfg, err := configFromEnv()
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+
+	t.Setenv(envServerConfig, `{"server":"https://team.example.com","graphql_endpoint":"https://a.example.com/graphql"}`)
+	t.Setenv(envGraphQLEndpoint, "https://b.example.com/graphql")
+
+	_, err = configFromEnv()
+	require.ErrorIs(t, err, ErrAuth)
+
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	t.Setenv(envAccessToken, testJWT(exp))
+
+	_, err = configFromEnv()
+	require.ErrorIs(t, err, ErrAuth)
+	require.ErrorContains(t, err, envIDToken+" must be set")
+
+	t.Setenv(envIDToken, testJWT(exp))
+
+	cfg, err = readConfigReAuth(t.Context())
+	require.NoError(t, err)
+	require.True(t, cfg.AuthToken.Unverified)
+
+	// The server config from the environment names no user pool, so the ID token could not be verified against it.
+	_, err = cfg.AuthToken.ParseIDToken(t.Context(), cfg.ServerConfig)
+	require.NoError(t, err)
+	require.Equal(t, "https://team.example.com", cfg.ServerConfig.Server)
+	require.Equal(t, "https://b.example.com/graphql", cfg.ServerConfig.GraphQLEndpoint)
+	require.True(t, exp.Equal(cfg.AuthToken.ExpiresAt))
+
+	t.Setenv(envAccessToken, testJWT(time.Now().Add(-time.Minute)))
+
+	_, err = readConfigReAuth(t.Context())
+	require.ErrorIs(t, err, ErrAuth)
+	require.ErrorContains(t, err, "cannot be refreshed")
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrAuth  = errors.New("authentication failed")
+	ErrUsage = errors.New("usage error")
+	// ErrLoginRequired is returned when the stored login can no longer be refreshed and no one is there to log in.
+	ErrLoginRequired = errors.New("login required")
+)
+
+// Exit codes are part of the CLI's stable interface, so scripts can branch on the failure without parsing output.
+const (
+	ExitOK         = 0
+	ExitFailure    = 1
+	ExitUsage      = 2
+	ExitAuth       = 3
+	ExitValidation = 4
+	ExitServer     = 5
+	// ExitRejected is reserved for commands that wait on the outcome of a request which is then rejected.
+	ExitRejected = 6
+	// ExitLoginRequired means the stored login has expired and `team-cli login` must be run interactively.
+	ExitLoginRequired = 7
+)
+
+type ErrorKind string
+
+const (
+	ErrorKindUsage      ErrorKind = "usage"
+	ErrorKindAuth       ErrorKind = "auth"
+	ErrorKindLogin      ErrorKind = "login_required"
+	ErrorKindNetwork    ErrorKind = "network"
+	ErrorKindValidation ErrorKind = "validation"
+	ErrorKindServer     ErrorKind = "server"
+	ErrorKindUnknown    ErrorKind = "unknown"
+)
+
+// classifyError maps an error returned by a command onto a coarse kind, for automation consuming failures.
+func classifyError(err error) ErrorKind {
+	var (
+		netErr net.Error
+		urlErr *url.Error
+	)
+
+	switch {
+	case errors.Is(err, ErrUsage), isCobraUsageError(err):
+		return ErrorKindUsage
+	case errors.Is(err, ErrLoginRequired):
+		return ErrorKindLogin
+	case errors.Is(err, ErrAuth),
+		errors.Is(err, ErrInvalidConfig),
+		errors.Is(err, ErrConfigNotFound),
+		errors.Is(err, ErrInsecurePermissions),
+		errors.Is(err, ErrWrongPassphrase),
+		errors.Is(err, team.ErrInvalidIDToken),
+		errors.Is(err, team.ErrCredentialCommand),
+		errors.Is(err, gql.ErrUnauthorized):
+		return ErrorKindAuth
+	case errors.Is(err, ErrInvalid),
+		errors.Is(err, ErrNoBackup),
+		errors.Is(err, team.ErrNotFound),
+		errors.Is(err, output.ErrUnsupported),
+		errors.Is(err, output.ErrTemplate):
+		return ErrorKindValidation
+	case errors.As(err, &netErr),
+		errors.As(err, &urlErr),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, transport.ErrOffline):
+		return ErrorKindNetwork
+	case errors.Is(err, gql.ErrUnexpected), errors.Is(err, team.ErrUnexpected):
+		return ErrorKindServer
+	default:
+		return ErrorKindUnknown
+	}
+}
+
+// isCobraUsageError detects the unknown command errors cobra generates internally, which cannot be wrapped.
+func isCobraUsageError(err error) bool {
+	return strings.HasPrefix(err.Error(), "unknown command ")
+}
+
+// exitCode maps an error returned by a command onto the process exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	switch classifyError(err) {
+	case ErrorKindUsage:
+		return ExitUsage
+	case ErrorKindAuth:
+		return ExitAuth
+	case ErrorKindLogin:
+		return ExitLoginRequired
+	case ErrorKindValidation:
+		return ExitValidation
+	case ErrorKindServer:
+		return ExitServer
+	default:
+		return ExitFailure
+	}
+}
+
+// usageArgs wraps a cobra argument validator so its failures are reported as usage errors.
+func usageArgs(validator cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := validator(cmd, args); err != nil {
+			return fmt.Errorf("%w: %w", ErrUsage, err)
+		}
+
+		return nil
+	}
+}
+
+func usageFlagError(_ *cobra.Command, err error) error {
+	return fmt.Errorf("%w: %w", ErrUsage, err)
+}
+
+// explainedError gives an error with a well known cause a message telling the user what to do about it.
+type explainedError struct {
+	msg string
+	err error
+}
+
+func (e *explainedError) Error() string {
+	return e.msg
+}
+
+func (e *explainedError) Unwrap() error {
+	return e.err
+}
+
+// explainError returns err with a message suited to the user when its cause is a well known one, such as a missing
+// config file.
+func explainError(err error) error {
+	switch {
+	case errors.Is(err, ErrConfigNotFound):
+		return &explainedError{msg: "team-cli is not configured yet — run `team-cli configure <server-url>`", err: err}
+	case errors.Is(err, ErrInvalidConfig):
+		return &explainedError{msg: err.Error() + " — run `team-cli config validate` for details", err: err}
+	case errors.Is(err, transport.ErrOffline):
+		return &explainedError{msg: err.Error() + " — run the command again without --offline", err: err}
+	case errors.Is(err, gql.ErrMessageTooLarge):
+		return &explainedError{msg: err.Error() + " — raise `ws_read_limit` in the config for larger payloads", err: err}
+	case errors.Is(err, gql.ErrBodyTooLarge):
+		return &explainedError{msg: err.Error() + " — raise `body_limit` in the config for larger responses", err: err}
+	default:
+		return err
+	}
+}
+
+type errorView struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Error         string    `json:"error"`
+	Kind          ErrorKind `json:"kind"`
+	Detail        string    `json:"detail"`
+}
+
+// writeJSONError writes err as a single JSON object, with the innermost cause as the detail.
+func writeJSONError(w io.Writer, err error) {
+	var parent error
+
+	cause := err
+
+	for {
+		next := errors.Unwrap(cause)
+		if next == nil {
+			break
+		}
+
+		parent, cause = cause, next
+	}
+
+	// Errors are conventionally built as fmt.Errorf("%w: detail", ErrSentinel), in which case the sentinel alone
+	// carries no detail and the wrapping error is more useful.
+	if parent != nil && strings.HasPrefix(parent.Error(), cause.Error()+": ") {
+		cause = parent
+	}
+
+	enc, marshalErr := json.Marshal(&errorView{
+		SchemaVersion: output.SchemaVersion,
+		Error:         err.Error(),
+		Kind:          classifyError(err),
+		Detail:        cause.Error(),
+	})
+	if marshalErr != nil {
+		fmt.Fprintln(w, err)
+
+		return
+	}
+
+	fmt.Fprintln(w, string(enc))
+}
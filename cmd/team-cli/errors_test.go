@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{fmt.Errorf("wrapped: %w", ErrInvalidConfig), ErrorKindAuth},
+		{fmt.Errorf("%w: the stored login has expired", ErrLoginRequired), ErrorKindLogin},
+		{fmt.Errorf("%w: failed to fetch new token: %w", ErrAuth, &net.OpError{Op: "dial", Err: errors.New("x")}), ErrorKindAuth},
+		{fmt.Errorf("%w: ticket format is no valid", ErrInvalid), ErrorKindValidation},
+		{fmt.Errorf("send: %w", &net.OpError{Op: "dial", Err: errors.New("refused")}), ErrorKindNetwork},
+		{fmt.Errorf("send: %w", context.DeadlineExceeded), ErrorKindNetwork},
+		{fmt.Errorf("%w: unexpected status code", gql.ErrUnexpected), ErrorKindServer},
+		{&gql.WebsocketError{MessageType: "error", Errors: []*gql.Error{{ErrorType: "UnauthorizedException"}}}, ErrorKindAuth},
+		{&gql.WebsocketError{MessageType: "error", Errors: []*gql.Error{{ErrorType: "MaxSubscriptionsReachedError"}}}, ErrorKindServer},
+		{errors.New("other"), ErrorKindUnknown},
+	} {
+		require.Equal(t, tc.kind, classifyError(tc.err), tc.err.Error())
+	}
+}
+
+func TestExplainMessageTooLarge(t *testing.T) {
+	t.Parallel()
+
+	err := explainError(fmt.Errorf("failed to subscribe: %w", &gql.MessageTooLargeError{Limit: 1024}))
+	require.ErrorIs(t, err, gql.ErrMessageTooLarge)
+	require.Equal(t,
+		"failed to subscribe: websocket message too large: over the limit of 1024 bytes — raise `ws_read_limit` in the "+
+			"config for larger payloads",
+		err.Error(),
+	)
+}
+
+func TestWriteJSONError(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	writeJSONError(&buf, fmt.Errorf("could not select: %w", fmt.Errorf("%w: role %q not found", ErrInvalid, "x")))
+
+	require.JSONEq(
+		t,
+		`{"schemaVersion":7,"error":"could not select: invalid: role \"x\" not found","kind":"validation","detail":"invalid: role \"x\" not found"}`,
+		buf.String(),
+	)
+}
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{nil, ExitOK},
+		{errors.New("unknown command \"foo\" for \"team-cli\""), ExitUsage},
+		{usageFlagError(nil, errors.New("unknown flag: --bogus")), ExitUsage},
+		{fmt.Errorf("could not read config and authenticate: %w", ErrInvalidConfig), ExitAuth},
+		{fmt.Errorf("could not read config and authenticate: %w", ErrLoginRequired), ExitLoginRequired},
+		{fmt.Errorf("%w: duration must be between 1 and 8", ErrInvalid), ExitValidation},
+		{fmt.Errorf("failed to execute: %w", fmt.Errorf("%w: server returned an error", team.ErrUnexpected)), ExitServer},
+		{fmt.Errorf("send: %w", &net.OpError{Op: "dial", Err: errors.New("refused")}), ExitFailure},
+		{errors.New("other"), ExitFailure},
+	} {
+		require.Equal(t, tc.code, exitCode(tc.err), fmt.Sprint(tc.err))
+	}
+}
+
+func TestUsageArgs(t *testing.T) {
+	t.Parallel()
+
+	validator := usageArgs(cobra.ExactArgs(1))
+
+	require.NoError(t, validator(&cobra.Command{}, []string{"a"}))
+	require.ErrorIs(t, validator(&cobra.Command{}, nil), ErrUsage)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// envTemplate is a config value that referenced environment variables, with the value it expanded to.
+type envTemplate struct {
+	raw      string
+	expanded string
+}
+
+// expandEnv replaces ${VAR} in s with the value of the environment variable VAR, and ${VAR:-default} with default
+// when VAR is unset or empty. $$ is a literal $, and a $ not followed by { or $ is kept as is. An unset variable
+// without a default is an error, so that a missing variable is not silently turned into an empty setting.
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var out strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			out.WriteByte(s[i])
+
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			out.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+
+			ref := s[i+2 : i+2+end]
+			name, def, hasDefault := strings.Cut(ref, ":-")
+
+			if name == "" {
+				return "", fmt.Errorf("empty variable name in %q", s)
+			}
+
+			value, ok := os.LookupEnv(name)
+
+			switch {
+			case hasDefault && value == "":
+				value = def
+			case !ok:
+				return "", fmt.Errorf("environment variable %s is not set, use ${%s:-default} to allow that", name, name)
+			}
+
+			out.WriteString(value)
+
+			i += 2 + end
+		default:
+			out.WriteByte('$')
+		}
+	}
+
+	return out.String(), nil
+}
+
+// expandConfig expands the environment variables referenced by the string settings of cfg in place, and returns the
+// templates of the values that changed by their path, so they can be written back unexpanded.
+func expandConfig(cfg *Config) (map[string]envTemplate, error) {
+	templates := make(map[string]envTemplate)
+
+	err := rewriteStrings(reflect.ValueOf(cfg), "", func(path string, s string) (string, error) {
+		expanded, err := expandEnv(s)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+
+		if expanded != s {
+			templates[path] = envTemplate{raw: s, expanded: expanded}
+		}
+
+		return expanded, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(templates) == 0 {
+		return nil, nil
+	}
+
+	return templates, nil
+}
+
+// unexpandConfig puts the templates back in place of the values they expanded to. Values changed since they were
+// expanded, such as a newly configured server, are kept.
+func unexpandConfig(cfg *Config, templates map[string]envTemplate) {
+	_ = rewriteStrings(reflect.ValueOf(cfg), "", func(path string, s string) (string, error) {
+		if t, ok := templates[path]; ok && t.expanded == s {
+			return t.raw, nil
+		}
+
+		return s, nil
+	})
+}
+
+// unexpandedJSON returns the config document doc with the templates put back. The document is decoded into a copy of
+// the config first, so the config in use keeps its expanded values.
+func unexpandedJSON(doc []byte, templates map[string]envTemplate) ([]byte, error) {
+	var cfg Config
+
+	if err := json.Unmarshal(doc, &cfg); err != nil {
+		return nil, err
+	}
+
+	unexpandConfig(&cfg, templates)
+
+	return json.MarshalIndent(&cfg, "", "    ")
+}
+
+// rewriteStrings replaces every string reachable from v through exported fields, map values and slice elements with
+// what fn returns for it. Paths are built from the JSON names. Fields that are not serialised, such as the embedded
+// selected profile which aliases one of the profiles, and fields tagged expand:"-", which hold secrets, are skipped.
+func rewriteStrings(v reflect.Value, path string, fn func(path string, s string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		return rewriteStrings(v.Elem(), path, fn)
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" || field.Tag.Get("expand") == "-" {
+				continue
+			}
+
+			if err := rewriteStrings(v.Field(i), joinPath(path, cmp.Or(name, field.Name)), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+
+			if iter.Value().Kind() != reflect.String {
+				if err := rewriteStrings(iter.Value(), joinPath(path, key), fn); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// Map values cannot be set in place.
+			s, err := fn(joinPath(path, key), iter.Value().String())
+			if err != nil {
+				return err
+			}
+
+			v.SetMapIndex(iter.Key(), reflect.ValueOf(s).Convert(v.Type().Elem()))
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			if err := rewriteStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+
+		s, err := fn(path, v.String())
+		if err != nil {
+			return err
+		}
+
+		v.SetString(s)
+	default:
+	}
+
+	return nil
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("TEAM_TEST_SERVER", "https://team.example.com")
+	t.Setenv("TEAM_TEST_EMPTY", "")
+
+	for _, tc := range []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{"plain", "plain", ""},
+		{"${TEAM_TEST_SERVER}", "https://team.example.com", ""},
+		{"${TEAM_TEST_SERVER}/path", "https://team.example.com/path", ""},
+		{"[${TEAM_TEST_UNSET:-ops}]", "[ops]", ""},
+		{"${TEAM_TEST_EMPTY:-fallback}", "fallback", ""},
+		{"${TEAM_TEST_EMPTY}", "", ""},
+		{"${TEAM_TEST_SERVER:-unused}", "https://team.example.com", ""},
+		{"cost $$5", "cost $5", ""},
+		{"$${TEAM_TEST_SERVER}", "${TEAM_TEST_SERVER}", ""},
+		{"$HOME and $", "$HOME and $", ""},
+		{"${TEAM_TEST_UNSET}", "", "TEAM_TEST_UNSET is not set"},
+		{"${TEAM_TEST_SERVER", "", "unterminated"},
+		{"${}", "", "empty variable name"},
+	} {
+		got, err := expandEnv(tc.in)
+
+		if tc.err != "" {
+			require.ErrorContains(t, err, tc.err, tc.in)
+
+			continue
+		}
+
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.want, got, tc.in)
+	}
+}
+
+func TestExpandConfigSkipsSecrets(t *testing.T) {
+	t.Setenv("TEAM_TEST_SECRET", "leaked")
+
+	cfg := fixtureConfig()
+	cfg.AuthToken = &team.AuthToken{AccessToken: "${TEAM_TEST_SECRET}"}
+	cfg.Aliases = map[string]string{"pay": "${TEAM_TEST_SECRET}"}
+
+	templates, err := expandConfig(cfg)
+	require.NoError(t, err)
+	require.Equal(t, "${TEAM_TEST_SECRET}", cfg.AuthToken.AccessToken)
+	require.Equal(t, "leaked", cfg.Aliases["pay"])
+	require.Equal(t, map[string]envTemplate{
+		"profiles.default.aliases.pay": {raw: "${TEAM_TEST_SECRET}", expanded: "leaked"},
+	}, templates)
+}
+
+func TestConfigEnvExpansion(t *testing.T) {
+	home := isolateConfig(t)
+	path := filepath.Join(home, "config.toml")
+	t.Setenv(configEnvVar, path)
+	t.Setenv("TEAM_TEST_SERVER", "https://team.example.com")
+	t.Setenv("USER", "alice")
+
+	require.NoError(t, os.WriteFile(path, []byte(`version = 3
+
+[profiles.default.server_config]
+server = "${TEAM_TEST_SERVER}"
+oauth_domain = "auth.example.com"
+
+[profiles.default.defaults]
+justification_prefix = "[${USER}] $$"
+`), 0600))
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.Equal(t, "https://team.example.com", cfg.ServerConfig.Server)
+	require.Equal(t, "[alice] $", cfg.defaults().JustificationPrefix)
+
+	// Rewriting the config keeps the references rather than their values.
+	_, _, err = executeCmd(t, "alias", "set", "pay", "123456789012")
+	require.NoError(t, err)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(raw), `server = "${TEAM_TEST_SERVER}"`)
+	require.Contains(t, string(raw), `justification_prefix = "[${USER}] $$"`)
+	require.Contains(t, string(raw), `pay = "123456789012"`)
+
+	t.Setenv("TEAM_TEST_SERVER", "")
+	require.NoError(t, os.Unsetenv("TEAM_TEST_SERVER"))
+
+	_, err = readConfig()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.ErrorContains(t, err, "profiles.default.server_config.server: environment variable TEAM_TEST_SERVER is not set")
+}
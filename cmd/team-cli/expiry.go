@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/color"
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/spf13/cobra"
+)
+
+// defaultExpiryWarning is how close to its expiry a token that cannot be refreshed is reported, unless the
+// expiry_warning option says otherwise.
+const defaultExpiryWarning = 15 * time.Minute
+
+// expiryWarningWindow returns the expiry_warning option of the config file, or the default when it is unset or
+// cannot be read.
+func expiryWarningWindow() time.Duration {
+	cfg, err := readConfig()
+	if err != nil || cfg.ExpiryWarning == "" {
+		return defaultExpiryWarning
+	}
+
+	window, err := time.ParseDuration(cfg.ExpiryWarning)
+	if err != nil || window < 0 {
+		slog.Warn("Ignoring invalid expiry_warning option", "value", cfg.ExpiryWarning, "err", err)
+
+		return defaultExpiryWarning
+	}
+
+	return window
+}
+
+// expiryWarning returns the warning to show for a token that expires within window and cannot be refreshed, or ""
+// when there is nothing to warn about.
+func expiryWarning(token *team.AuthToken, window time.Duration, now time.Time) string {
+	if token == nil || token.RefreshToken != "" {
+		return ""
+	}
+
+	remaining := token.ExpiresAt.Sub(now)
+	if remaining >= window || remaining <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"Warning: authentication expires in %s — long-running operations may fail",
+		remaining.Round(time.Second),
+	)
+}
+
+// warnTokenExpiry prints the expiry warning for the token in cfg to stderr, if there is one.
+func warnTokenExpiry(cmd *cobra.Command, cfg *Config) {
+	if msg := expiryWarning(cfg.AuthToken, expiryWarningWindow(), time.Now()); msg != "" {
+		fmt.Fprintln(cmd.ErrOrStderr(), color.Apply(color.Yellow, msg))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiryWarning(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name  string
+		token *team.AuthToken
+		want  string
+	}{
+		{"no token", nil, ""},
+		{"refreshable", &team.AuthToken{ExpiresAt: now.Add(time.Minute), RefreshToken: "refresh"}, ""},
+		{"far from expiry", &team.AuthToken{ExpiresAt: now.Add(time.Hour)}, ""},
+		{"already expired", &team.AuthToken{ExpiresAt: now.Add(-time.Minute)}, ""},
+		{
+			"close to expiry",
+			&team.AuthToken{ExpiresAt: now.Add(4 * time.Minute)},
+			"Warning: authentication expires in 4m0s — long-running operations may fail",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tc.want, expiryWarning(tc.token, 15*time.Minute, now))
+		})
+	}
+}
+
+func TestExpiryWarningWindow(t *testing.T) {
+	home := isolateConfig(t)
+	t.Setenv(configEnvVar, filepath.Join(home, "config.json"))
+
+	require.Equal(t, defaultExpiryWarning, expiryWarningWindow())
+
+	cfg := fixtureConfig()
+	cfg.ExpiryWarning = "1h"
+	require.NoError(t, writeConfig(cfg))
+	require.Equal(t, time.Hour, expiryWarningWindow())
+
+	cfg.ExpiryWarning = "soon"
+	require.NoError(t, writeConfig(cfg))
+	require.Equal(t, defaultExpiryWarning, expiryWarningWindow())
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/spf13/cobra"
+)
+
+func getCmdRun(cmd *cobra.Command, args []string) error {
+	id := args[0]
+	field := strings.TrimPrefix(args[1], ".")
+
+	if _, err := outputFormat(cmd); err != nil {
+		return err
+	}
+
+	cfg, err := resolveConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("could not read config and authenticate: %w", err)
+	}
+
+	req, err := retryUnauthorized(cmd, cfg, func() (*team.PermissionRequest, error) {
+		return team.GetRequest(cmd.Context(), cfg.ServerConfig, cfg.AuthToken, id)
+	})
+	if err != nil {
+		return fmt.Errorf("could not fetch request: %w", err)
+	}
+
+	value, err := requestField(req, field)
+	if err != nil {
+		return err
+	}
+
+	return render(cmd, value)
+}
+
+// fieldValue is a single decoded JSON value, printed without quoting when it is a string.
+type fieldValue struct {
+	value any
+}
+
+func (v fieldValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.value)
+}
+
+func (v fieldValue) WriteText(w io.Writer) error {
+	if str, ok := v.value.(string); ok {
+		_, err := fmt.Fprintln(w, str)
+
+		return err
+	}
+
+	enc, err := json.Marshal(v.value)
+	if err != nil {
+		return fmt.Errorf("could not marshal value: %w", err)
+	}
+
+	_, err = fmt.Fprintln(w, string(enc))
+
+	return err
+}
+
+// requestField returns the value of the named field of req, using the same names as the JSON representation.
+func requestField(req *team.PermissionRequest, field string) (fieldValue, error) {
+	// Machine-readable timestamps are always RFC3339 UTC, whatever zone they are displayed in.
+	utc := *req
+	utc.StartTime = req.StartTime.UTC()
+	utc.EndTime = req.EndTime.UTC()
+	utc.CreatedAt = req.CreatedAt.UTC()
+	utc.UpdatedAt = req.UpdatedAt.UTC()
+
+	enc, err := json.Marshal(&utc)
+	if err != nil {
+		return fieldValue{}, fmt.Errorf("could not marshal request: %w", err)
+	}
+
+	var fields map[string]any
+
+	if err := json.Unmarshal(enc, &fields); err != nil {
+		return fieldValue{}, fmt.Errorf("could not unmarshal request: %w", err)
+	}
+
+	for name, value := range fields {
+		if strings.EqualFold(name, field) {
+			return fieldValue{value: value}, nil
+		}
+	}
+
+	return fieldValue{}, fmt.Errorf(
+		"%w: unknown field %q, available fields: %s",
+		ErrInvalid,
+		field,
+		strings.Join(slices.Sorted(maps.Keys(fields)), ", "),
+	)
+}
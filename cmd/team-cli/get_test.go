@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestFieldTimestampsAreUTC(t *testing.T) {
+	t.Parallel()
+
+	zone := time.FixedZone("AEST", 10*60*60)
+	req := &team.PermissionRequest{
+		ID:        "abc",
+		StartTime: time.Date(2024, 3, 1, 9, 0, 0, 0, zone),
+	}
+
+	value, err := requestField(req, "startTime")
+	require.NoError(t, err)
+	require.Equal(t, "2024-02-29T23:00:00Z", value.value)
+
+	_, err = requestField(req, "nope")
+	require.ErrorIs(t, err, ErrInvalid)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// noHistory is set by --no-history, which stops this invocation from recording its actions.
+var noHistory bool
+
+const historyFileName = "history.jsonl"
+
+// historyMaxSize bounds the history file. Once it grows beyond this, the oldest entries are dropped so that it
+// shrinks to half the size, which keeps rewrites rare.
+const historyMaxSize = 256 << 10
+
+// Actions recorded in the history.
+const (
+	historyConfigure = "configure"
+	historyRequest   = "request"
+	historyApprove   = "approve"
+	historyReject    = "reject"
+)
+
+// historyEntry is an action taken through the CLI. The history is a JSON document per line, so entries can be
+// appended without reading the file.
+type historyEntry struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Profile   string    `json:"profile,omitempty"`
+	Server    string    `json:"server,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+	AccountID string    `json:"accountId,omitempty"`
+	Role      string    `json:"role,omitempty"`
+}
+
+type historyList []*historyEntry
+
+func (l historyList) Table() *output.Table {
+	table := &output.Table{
+		Headers: []string{"time", "action", "profile", "request_id", "account_id", "role", "server"},
+	}
+
+	for _, e := range l {
+		table.Rows = append(table.Rows, []string{
+			e.Time.Format(time.RFC3339), e.Action, e.Profile, e.RequestID, e.AccountID, e.Role, e.Server,
+		})
+	}
+
+	return table
+}
+
+func (l historyList) Summary() string {
+	return plural(len(l), "action", "actions")
+}
+
+func (l historyList) TextTable() *output.Table {
+	table := &output.Table{
+		Headers: []string{"TIME", "ACTION", "PROFILE", "REQUEST ID", "ACCOUNT", "ROLE", "SERVER"},
+		Keys:    []string{"time", "action", "profile", "request_id", "account_id", "role", "server"},
+	}
+
+	for _, e := range l {
+		table.Rows = append(table.Rows, []string{
+			fmtDate(e.Time), e.Action, e.Profile, dashIfEmpty(e.RequestID), dashIfEmpty(e.AccountID),
+			dashIfEmpty(e.Role), dashIfEmpty(e.Server),
+		})
+	}
+
+	return table
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// stateDir returns the team-cli directory under $XDG_STATE_HOME, which defaults to ~/.local/state, or a state
+// directory next to the cache in %LocalAppData% on Windows.
+func stateDir() (string, error) {
+	if xdg := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, "team-cli"), nil
+	}
+
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get user cache dir: %w", err)
+		}
+
+		return filepath.Join(dir, "team-cli", "state"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user dir: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".local", "state", "team-cli"), nil
+}
+
+func historyPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, historyFileName), nil
+}
+
+// recordHistory appends an action to the local history, unless disabled by --no-history or the no_history option.
+// The history is a convenience, so failing to record it is logged rather than failing the command.
+func recordHistory(cfg *Config, entry *historyEntry) {
+	if noHistory || cfg.NoHistory {
+		return
+	}
+
+	entry.Time = time.Now().UTC()
+	entry.Profile = cfg.ProfileName
+
+	if err := appendHistory(entry); err != nil {
+		slog.Warn("Could not record the action in the local history", "err", err)
+	}
+}
+
+func appendHistory(entry *historyEntry) error {
+	path, err := historyPath()
+	if err != nil {
+		return fmt.Errorf("could not determine state dir: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create state dir: %w", err)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("could not marshal entry: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open history: %w", err)
+	}
+
+	_, writeErr := f.Write(append(line, '\n'))
+	closeErr := f.Close()
+
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		return fmt.Errorf("could not write history: %w", err)
+	}
+
+	return trimHistory(path)
+}
+
+// trimHistory drops the oldest entries of the history at path once it exceeds historyMaxSize.
+func trimHistory(path string) error {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() <= historyMaxSize {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read history: %w", err)
+	}
+
+	// Keep whole lines only, starting from the first one that begins in the newer half.
+	data = data[len(data)-historyMaxSize/2:]
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+
+	return writeFileAtomic(path, data, 0600)
+}
+
+// readHistory returns the recorded actions, oldest first. Lines that cannot be parsed, such as one cut short by a
+// crash, are skipped.
+func readHistory() (historyList, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine state dir: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return historyList{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not open history: %w", err)
+	}
+
+	defer f.Close()
+
+	entries := historyList{}
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		var entry historyEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			slog.Debug("Skipping malformed history entry", "err", err)
+
+			continue
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read history: %w", err)
+	}
+
+	return entries, nil
+}
+
+func historyCmdRun(cmd *cobra.Command, _ []string) error {
+	local, err := cmd.Flags().GetBool("local")
+	if err != nil {
+		return fmt.Errorf("local flag: %w", err)
+	}
+
+	if !local {
+		return fmt.Errorf("%w: only the local history is available, pass --local", ErrUsage)
+	}
+
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+
+	return render(cmd, entries)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	isolateConfig(t)
+
+	stdout, _, err := executeCmd(t, "history", "--local", "-o", "json")
+	require.NoError(t, err)
+	require.Contains(t, stdout, `"items": []`)
+
+	cfg := fixtureConfig()
+	cfg.ProfileName = "work"
+
+	recordHistory(cfg, &historyEntry{Action: historyRequest, RequestID: "req-1", AccountID: "123", Role: "Admin"})
+
+	noHistory = true
+	recordHistory(cfg, &historyEntry{Action: historyRequest, RequestID: "private"})
+
+	noHistory = false
+	cfg.NoHistory = true
+	recordHistory(cfg, &historyEntry{Action: historyRequest, RequestID: "private"})
+
+	cfg.NoHistory = false
+	recordHistory(cfg, &historyEntry{Action: historyApprove, RequestID: "req-2"})
+
+	path, err := historyPath()
+	require.NoError(t, err)
+	requirePrivate(t, path)
+
+	stdout, _, err = executeCmd(t, "history", "--local", "-o", "json")
+	require.NoError(t, err)
+
+	var got struct {
+		Items []historyEntry `json:"items"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &got))
+	require.Len(t, got.Items, 2)
+	require.Equal(t, "req-1", got.Items[0].RequestID)
+	require.Equal(t, "work", got.Items[0].Profile)
+	require.Equal(t, "Admin", got.Items[0].Role)
+	require.Equal(t, historyApprove, got.Items[1].Action)
+
+	_, _, err = executeCmd(t, "history")
+	require.ErrorIs(t, err, ErrUsage)
+}
+
+func TestHistoryIsCapped(t *testing.T) {
+	isolateConfig(t)
+
+	path, err := historyPath()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+
+	old, err := json.Marshal(&historyEntry{Action: historyRequest, RequestID: "old"})
+	require.NoError(t, err)
+
+	lines := bytes.Repeat(append(old, '\n'), historyMaxSize/len(old)+1)
+	require.NoError(t, os.WriteFile(path, lines, 0600))
+
+	require.NoError(t, appendHistory(&historyEntry{Action: historyRequest, RequestID: "new"}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(data), historyMaxSize/2)
+	require.True(t, strings.HasPrefix(string(data), string(old)), "history must start on an entry")
+
+	entries, err := readHistory()
+	require.NoError(t, err)
+	require.Equal(t, "new", entries[len(entries)-1].RequestID)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/spf13/cobra"
+)
+
+func loginCmdRun(cmd *cobra.Command, _ []string) error {
+	cfg, err := readConfig()
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+
+	if cfg.ServerConfig == nil || cfg.ServerConfig.OAuthDomain == "" {
+		return fmt.Errorf("%w: profile %q has no server", ErrConfigNotFound, cfg.ProfileName)
+	}
+
+	if _, err := login(cmd.Context(), cfg); err != nil {
+		return err
+	}
+
+	slog.Info("Stored new token")
+	fmt.Fprintln(cmd.ErrOrStderr(), "Logged in")
+
+	return nil
+}
+
+// withPastedRedirect has a login without a browser on this machine ask for the redirect to be pasted, since the
+// browser it is completed in, such as one outside an SSH session, cannot reach the redirect listener. Without a
+// terminal there is no one to paste it, so the listener is kept.
+func withPastedRedirect(login team.BrowserLogin) team.BrowserLogin {
+	if login.NoBrowser && stdinIsTerminal() {
+		login.ReadRedirect = readRedirect
+	}
+
+	return login
+}
+
+func readRedirect(context.Context) (string, error) {
+	return promptString("Redirect URL or code: ", input{name: "login redirect"})
+}
+
+// withDeviceCodePrompt has the device code flow ask for the code shown by the device_code page of the deployment,
+// which is only used when no device authorization endpoint is configured.
+func withDeviceCodePrompt(login team.BrowserLogin) team.BrowserLogin {
+	login.ReadRedirect = readDeviceCode
+
+	return login
+}
+
+func readDeviceCode(context.Context) (string, error) {
+	return promptString("Device code: ", input{name: "device code"})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,11 +10,21 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"runtime"
 	"runtime/debug"
 	"strings"
 	"time"
 
+	"github.com/csnewman/team-cli/internal/color"
+	"github.com/csnewman/team-cli/internal/logging"
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/csnewman/team-cli/internal/redact"
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/csnewman/team-cli/internal/transport"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/mod/semver"
 )
 
@@ -26,52 +37,169 @@ func init() {
 }
 
 func main() {
+	shutdownTracing := setupTracing()
+
+	// The span is named after the command once it is known, in rootCmdPersistentPre.
+	ctx, span := otel.Tracer("github.com/csnewman/team-cli").Start(context.Background(), "team-cli")
+
+	rootCmd := newRootCmd()
+	err := rootCmd.ExecuteContext(ctx)
+
+	if err != nil {
+		span.SetStatus(codes.Error, redact.Text(err.Error()))
+	}
+
+	span.End()
+	shutdownTracing()
+
+	if err != nil {
+		reportError(rootCmd, err)
+		os.Exit(exitCode(err))
+	}
+}
+
+func newRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
-		Use:               "team-cli",
-		Short:             "AWS TEAM CLI interface",
-		Long:              "Team-CLI - " + Version + "\n\nteam-cli is a CLI wrapper for accessing AWS TEAM.",
+		Use:   "team-cli",
+		Short: "AWS TEAM CLI interface",
+		Long: "Team-CLI - " + Version + `
+
+team-cli is a CLI wrapper for accessing AWS TEAM.
+
+Exit codes:
+  0  success
+  1  general failure (including network errors)
+  2  usage error (unknown command, invalid flags or arguments)
+  3  authentication required or failed
+  4  validation failure (e.g. not eligible, invalid input)
+  5  server-side error
+  6  request rejected`,
 		Version:           Version,
 		PersistentPreRunE: rootCmdPersistentPre,
 	}
 
-	rootCmd.PersistentFlags().CountP("verbose", "v", "increase verbosity")
+	rootCmd.PersistentFlags().CountP("verbose", "v", "increase verbosity (-v info, -vv debug, -vvv trace)")
+	rootCmd.PersistentFlags().String("log-level", "", "log level: trace, debug, info, warn or error (overrides -v)")
+	rootCmd.PersistentFlags().String("log-file", "", "also write logs to this file, at the selected log level")
+	rootCmd.PersistentFlags().StringP("output", "o", string(output.FormatTable), "output format: table, json, yaml or csv")
+	rootCmd.PersistentFlags().Bool("no-pager", false, "do not pipe long output through $PAGER")
+	rootCmd.PersistentFlags().Bool("no-color", false, "disable coloured output (also honours NO_COLOR)")
+	rootCmd.PersistentFlags().String("format", "", "format output using a Go template, e.g. '{{.ID}}\\t{{.Name}}'")
+	rootCmd.PersistentFlags().Bool("utc", false, "show timestamps in UTC instead of local time")
+	rootCmd.PersistentFlags().String("profile", "", "profile to use (default $TEAM_CLI_PROFILE, then the default profile)")
+	rootCmd.PersistentFlags().String("server", "", "use this TEAM server for one command, logging in without storing the token")
+	rootCmd.PersistentFlags().Bool("save", false, "with --server, store the server and token in the selected profile")
+	rootCmd.PersistentFlags().String("config", "", "config file to use (default $XDG_CONFIG_HOME/team-cli/config.toml)")
+	rootCmd.PersistentFlags().Bool("insecure-permissions", false, "only warn when the credentials file is readable by others")
+	rootCmd.PersistentFlags().String("ca-bundle", "", "PEM file of extra CA certificates to trust, e.g. for a private CA")
+	rootCmd.PersistentFlags().Bool("insecure-skip-verify", false, "disable TLS certificate verification (test deployments only)")
+	rootCmd.PersistentFlags().Bool("i-know-what-im-doing", false, "allow logging in and refreshing tokens with --insecure-skip-verify")
+	rootCmd.PersistentFlags().Bool("no-verify", false, "do not verify the ID token (debugging without access to the signing keys)")
+	rootCmd.PersistentFlags().String("proxy", "", "proxy URL for all traffic (default from HTTP_PROXY, HTTPS_PROXY and NO_PROXY)")
+	rootCmd.PersistentFlags().Bool("offline", false, "forbid network access, serving cached data where a command can")
+	rootCmd.PersistentFlags().String("cache-dir", "", "cache directory to use (default $XDG_CACHE_HOME/team-cli)")
+	rootCmd.PersistentFlags().Bool("no-history", false, "do not record this command's actions in the local history")
 
 	configureCmd := &cobra.Command{
 		Use:   "configure [server]",
 		Short: "Configure AWS TEAM",
 		Long:  `Configure the AWS TEAM server to connect to`,
-		Args:  cobra.ExactArgs(1),
+		Args:  usageArgs(cobra.ExactArgs(1)),
 		RunE:  configureCmdRun,
 	}
 
 	configureCmd.Flags().BoolP("no-browser", "b", false, "Do not open the browser automatically")
-	configureCmd.Flags().BoolP("device-code", "d", false, "Use the device code flow. Implies --no-browser")
+	configureCmd.Flags().Int("callback-port", 0, fmt.Sprintf(
+		"Preferred port for the login redirect, the next few are tried when busy (default %d)", team.DefaultCallbackPort,
+	))
+	configureCmd.Flags().Bool("skip-verify", false, "Do not check the configuration with a test query before saving it")
+	configureCmd.Flags().Bool("force-login", false, "Log in again even if the stored token is still valid")
+	configureCmd.Flags().BoolP("device-code", "d", false, "Use the device code flow, which can be completed on another device")
+	configureCmd.Flags().String("bundle", "",
+		"Extract the server configuration from this main JS file, a URL or local path, instead of the homepage")
+	configureCmd.Flags().String("credential-command", "",
+		"Obtain tokens by running this command, which prints them as JSON, instead of logging in")
+
+	loginCmd := &cobra.Command{
+		Use:   "login",
+		Short: "Log in again",
+		Long: `Log in to the configured AWS TEAM server again, using the login flow chosen by configure.
+
+Run this when a command fails because the stored login has expired.`,
+		Args: usageArgs(cobra.ExactArgs(0)),
+		RunE: loginCmdRun,
+	}
+
+	whoamiCmd := &cobra.Command{
+		Use:   "whoami",
+		Short: "Show who the profile is logged in as",
+		Long: `Show the identity the selected profile is logged in as, from its verified ID token.
+
+Use this to check which account a profile holds when several profiles log in to the same server.`,
+		Args: usageArgs(cobra.ExactArgs(0)),
+		RunE: whoamiCmdRun,
+	}
+
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the actions taken through the CLI",
+		Long: `Show the actions taken through this CLI, oldest first: configures, requests submitted, and approvals or
+rejections given, with the request IDs involved.
+
+The history is kept in $XDG_STATE_HOME/team-cli/history.jsonl. Pass --no-history, or set "no_history" in the config,
+to stop recording it.`,
+		Args: usageArgs(cobra.ExactArgs(0)),
+		RunE: historyCmdRun,
+	}
+
+	historyCmd.Flags().Bool("local", false, "show the history recorded on this machine")
 
 	listAccountsCmd := &cobra.Command{
 		Use:   "list-accounts",
 		Short: "List all accounts",
-		Long:  `List all AWS accounts you can use to access via AWS TEAM`,
-		Args:  cobra.ExactArgs(0),
-		RunE:  listAccountsCmdRun,
+		Long: `List all AWS accounts you can use to access via AWS TEAM.
+
+With --output csv, one row is emitted per account and role, with the columns:
+  account_id, account_name, role_id, role_name, max_duration_with_approval, max_duration_without_approval,
+  active_until
+
+Roles you currently hold an active session for are marked as ACTIVE, with the time left.`,
+		Args: usageArgs(cobra.ExactArgs(0)),
+		RunE: listAccountsCmdRun,
 	}
 
+	listAccountsCmd.Flags().BoolP("quiet", "q", false, "Only print account IDs")
+	listAccountsCmd.Flags().String("sort", "name", "Sort accounts by: "+strings.Join(accountSortKeys, ", "))
+	listAccountsCmd.Flags().Bool("reverse", false, "Reverse the sort order")
+	listAccountsCmd.Flags().String("filter", "", "Only show accounts whose name matches this glob (case-insensitive)")
+	listAccountsCmd.Flags().String("role", "", "Only show accounts where you are eligible for this role")
+	listAccountsCmd.Flags().Bool("only-active", false, "Only show roles you currently hold an active session for")
+	listAccountsCmd.Flags().StringSlice(
+		"columns",
+		nil,
+		"Table columns to show, in order: "+strings.Join(accountColumns, ", "),
+	)
+
 	requestCmd := &cobra.Command{
 		Use:   "request",
 		Short: "Request elevated access",
 		Long: `Request temporary elevated access to a AWS account.
 
 Exclude flags to perform interactive selection.`,
-		Args: cobra.ExactArgs(0),
+		Args: usageArgs(cobra.ExactArgs(0)),
 		RunE: requestCmdRun,
 	}
 
-	requestCmd.Flags().StringP("account", "a", "", "AWS account ID or name")
+	requestCmd.Flags().StringP("account", "a", "", "AWS account ID, name or alias")
 	requestCmd.Flags().StringP("role", "r", "", "AWS role ID or name")
+	requestCmd.Flags().String("filter", "", "Only offer accounts whose name matches this glob (case-insensitive)")
 	requestCmd.Flags().StringP("start", "s", "", "Start date and time")
 	requestCmd.Flags().IntP("duration", "d", 0, "Duration of elevation")
 	requestCmd.Flags().StringP("ticket", "t", "", "Ticket ID")
 	requestCmd.Flags().StringP("reason", "j", "", "Justification reason")
 	requestCmd.Flags().BoolP("confirm", "y", false, "Automatically confirm")
+	requestCmd.Flags().BoolP("quiet", "q", false, "Only print the new request ID")
+	requestCmd.Flags().String("summary", "", "Print a summary of the submitted request in the given format (markdown)")
 
 	approveCmd := &cobra.Command{
 		Use:   "approve",
@@ -79,23 +207,325 @@ Exclude flags to perform interactive selection.`,
 		Long: `Approve temporary elevated access to a AWS account.
 
 Exclude flags to perform interactive selection.`,
-		Args: cobra.ExactArgs(0),
+		Args: usageArgs(cobra.ExactArgs(0)),
 		RunE: approveCmdRun,
 	}
 
+	approveCmd.Flags().Bool("full", false, "Show justifications in full instead of truncating them to the terminal width")
+
+	schemaCmd := &cobra.Command{
+		Use:   "schema [command]",
+		Short: "Print the JSON Schema of a command's structured output",
+		Long: `Print the JSON Schema describing the json and yaml output of a command, e.g. "schema list-accounts".
+
+Every structured output carries a schemaVersion field, which changes whenever the shape of any output changes.
+"schema error" describes the errors printed to stderr with --output json.`,
+		Args: usageArgs(cobra.MinimumNArgs(1)),
+		RunE: schemaCmdRun,
+	}
+
+	getCmd := &cobra.Command{
+		Use:   "get [request-id] [field]",
+		Short: "Print a single field of a request",
+		Long: `Print the value of a single field of an access request, without any decoration.
+
+Field names match the JSON representation of the request (e.g. status, endTime, accountId) and may be prefixed
+with a dot.`,
+		Args: usageArgs(cobra.ExactArgs(2)),
+		RunE: getCmdRun,
+	}
+
+	debugCmd := &cobra.Command{
+		Use:   "debug",
+		Short: "Diagnose problems with a TEAM deployment",
+	}
+
+	debugSchemaCmd := &cobra.Command{
+		Use:   "schema [file]",
+		Short: "Write the GraphQL schema of the TEAM API",
+		Long: `Fetch the schema of the TEAM API by introspection and write it to file, or to stdout when no file is
+given, as SDL with the types sorted by name so that schemas can be compared with diff.
+
+With --check, the GraphQL operations sent by team-cli are validated against the schema, reporting unknown fields and
+arguments, missing required arguments and mismatched variable types on stderr. This is a quick compatibility check
+after upgrading TEAM. The schema is then only written when a file is given.`,
+		Args: usageArgs(cobra.MaximumNArgs(1)),
+		RunE: debugSchemaCmdRun,
+	}
+
+	debugSchemaCmd.Flags().Bool("json", false, "Write the introspection result as JSON instead of SDL")
+	debugSchemaCmd.Flags().Bool("check", false, "Check the operations of team-cli against the schema")
+	debugCmd.AddCommand(debugSchemaCmd)
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect and manage the team-cli config",
+		Long: `Inspect and manage the team-cli config.
+
+The config file is chosen by --config, then the TEAM_CLI_CONFIG environment variable, and otherwise is
+$XDG_CONFIG_HOME/team-cli/config.toml. Without XDG_CONFIG_HOME it is config.toml in the team-cli directory of the
+platform's config directory: ~/.config on Linux, ~/Library/Application Support on macOS and %AppData% on Windows.`,
+	}
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Show the config in use",
+		Long:  `Show the path of the config file in use and its settings. Tokens are never shown.`,
+		Args:  usageArgs(cobra.ExactArgs(0)),
+		RunE:  configShowCmdRun,
+	})
+
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Check the config for problems",
+		Long:  `Read the config file and its credentials, and report every setting that is not valid.`,
+		Args:  usageArgs(cobra.ExactArgs(0)),
+		RunE:  configValidateCmdRun,
+	})
+
+	configRestoreCmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore the previous config",
+		Long: `Restore the config file and its credentials as they were before the last change.
+
+The previous config is kept as a backup (config.toml.bak, with credentials.json.bak) on every change made with a
+command. Refreshed tokens and format upgrades leave the backup alone. Restoring swaps the backup with the current files,
+so running restore again undoes it.`,
+		Args: usageArgs(cobra.ExactArgs(0)),
+		RunE: configRestoreCmdRun,
+	}
+
+	configRestoreCmd.Flags().BoolP("confirm", "y", false, "Automatically confirm")
+
+	configCmd.AddCommand(configRestoreCmd)
+
+	configRepairCmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Restore a config file corrupted by an interrupted write",
+		Long: `Restore a config file that can no longer be parsed from the write that was interrupted while replacing it.
+
+Config files are written to a temporary file next to them, which is then renamed over the config file. A write
+interrupted in between leaves the complete new config in the temporary file, which repair renames into place after
+confirmation.`,
+		Args: usageArgs(cobra.ExactArgs(0)),
+		RunE: configRepairCmdRun,
+	}
+
+	configRepairCmd.Flags().BoolP("confirm", "y", false, "Automatically confirm")
+
+	configCmd.AddCommand(configRepairCmd)
+
+	configMigrateSecretsCmd := &cobra.Command{
+		Use:   "migrate-secrets",
+		Short: "Encrypt or decrypt the stored secrets",
+		Long: `Encrypt the credentials file with a passphrase, and set encrypt_secrets so it stays encrypted.
+
+The passphrase is asked for once per invocation, or taken from the TEAM_CLI_PASSPHRASE environment variable. With
+--decrypt, the credentials file is stored in plain text again and encrypt_secrets is cleared.`,
+		Args: usageArgs(cobra.ExactArgs(0)),
+		RunE: configMigrateSecretsCmdRun,
+	}
+
+	configMigrateSecretsCmd.Flags().Bool("decrypt", false, "Store the secrets in plain text again")
+
+	configCmd.AddCommand(configMigrateSecretsCmd)
+
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage cached data",
+		Long: `Manage the data cached from the server, such as accounts and signing keys.
+
+The cache is kept in $XDG_CACHE_HOME/team-cli (~/.cache/team-cli by default), with a directory per profile. Everything
+in it is fetched again when needed.`,
+	}
+
+	cacheCmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Remove all cached data",
+		Long:  "Remove all cached data of every profile. The config and credentials are left untouched.",
+		Args:  usageArgs(cobra.ExactArgs(0)),
+		RunE:  cacheClearCmdRun,
+	})
+
+	aliasCmd := &cobra.Command{
+		Use:   "alias",
+		Short: "Manage account aliases",
+		Long: `Manage short aliases for AWS accounts.
+
+Aliases can be used anywhere an account ID or name is accepted. If an alias matches the name of a real account,
+the alias takes precedence.`,
+	}
+
+	aliasCmd.AddCommand(&cobra.Command{
+		Use:   "set [alias] [account]",
+		Short: "Create or update an alias",
+		Long:  `Create or update an alias referring to an AWS account ID or name`,
+		Args:  usageArgs(cobra.ExactArgs(2)),
+		RunE:  aliasSetCmdRun,
+	})
+
+	aliasListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all aliases",
+		Long: `List all configured account aliases.
+
+With --output csv, the columns are: alias, account`,
+		Args: usageArgs(cobra.ExactArgs(0)),
+		RunE: aliasListCmdRun,
+	}
+
+	aliasListCmd.Flags().StringSlice("columns", nil, "Table columns to show, in order: alias, account")
+
+	aliasCmd.AddCommand(aliasListCmd)
+
+	aliasCmd.AddCommand(&cobra.Command{
+		Use:     "rm [alias]",
+		Aliases: []string{"remove", "delete"},
+		Short:   "Remove an alias",
+		Long:    `Remove an account alias`,
+		Args:    usageArgs(cobra.ExactArgs(1)),
+		RunE:    aliasRmCmdRun,
+	})
+
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage configuration profiles",
+		Long: `Manage configuration profiles.
+
+Each profile holds its own server, token and aliases. The profile in use is selected with --profile, then
+TEAM_CLI_PROFILE, then the default profile.`,
+	}
+
+	profileListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all profiles",
+		Long: `List all configured profiles with their server, token expiry and whether they are the default.
+
+With --output csv, the columns are: name, server, token_expires_at, default`,
+		Args: usageArgs(cobra.ExactArgs(0)),
+		RunE: profileListCmdRun,
+	}
+
+	profileListCmd.Flags().StringSlice(
+		"columns", nil, "Table columns to show, in order: name, server, token_expires_at, default",
+	)
+
+	profileCmd.AddCommand(profileListCmd)
+
+	profileDeleteCmd := &cobra.Command{
+		Use:     "delete [name]",
+		Aliases: []string{"rm", "remove"},
+		Short:   "Delete a profile",
+		Long:    `Delete a profile along with its stored credentials`,
+		Args:    usageArgs(cobra.ExactArgs(1)),
+		RunE:    profileDeleteCmdRun,
+	}
+
+	profileDeleteCmd.Flags().BoolP("confirm", "y", false, "Automatically confirm")
+
+	profileCmd.AddCommand(profileDeleteCmd)
+
+	profileCmd.AddCommand(&cobra.Command{
+		Use:   "rename [old] [new]",
+		Short: "Rename a profile",
+		Long:  `Rename a profile, keeping its settings and credentials`,
+		Args:  usageArgs(cobra.ExactArgs(2)),
+		RunE:  profileRenameCmdRun,
+	})
+
+	profileCmd.AddCommand(&cobra.Command{
+		Use:   "set-default [name]",
+		Short: "Set the default profile",
+		Long:  `Set the profile used when neither --profile nor TEAM_CLI_PROFILE is given`,
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE:  profileSetDefaultCmdRun,
+	})
+
 	rootCmd.AddCommand(configureCmd)
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(whoamiCmd)
+	rootCmd.AddCommand(historyCmd)
 	rootCmd.AddCommand(listAccountsCmd)
 	rootCmd.AddCommand(requestCmd)
 	rootCmd.AddCommand(approveCmd)
+	rootCmd.AddCommand(getCmd)
+	rootCmd.AddCommand(schemaCmd)
+	rootCmd.AddCommand(aliasCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(profileCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(debugCmd)
 	rootCmd.SilenceUsage = true
+	// Errors are printed by reportError, explained where possible.
+	rootCmd.SilenceErrors = true
+	rootCmd.SetFlagErrorFunc(usageFlagError)
+
+	return rootCmd
+}
+
+// reportError writes a failed command's error to stderr, as JSON when JSON output was requested.
+func reportError(rootCmd *cobra.Command, err error) {
+	err = explainError(err)
+
+	format, _ := rootCmd.PersistentFlags().GetString("output")
+	if !rootCmd.PersistentFlags().Changed("output") {
+		format = cmp.Or(configuredOutput(), format)
+	}
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	// Any spelling the output flag accepts, such as JSON, selects JSON errors too.
+	if f, parseErr := output.ParseFormat(format); parseErr == nil && f == output.FormatJSON {
+		writeJSONError(rootCmd.ErrOrStderr(), err)
+	} else {
+		fmt.Fprintln(rootCmd.ErrOrStderr(), err)
 	}
 }
 
 func rootCmdPersistentPre(cmd *cobra.Command, _ []string) error {
+	trace.SpanFromContext(cmd.Context()).SetName(cmd.CommandPath())
+
+	// The config file and profile are needed by the rest of the setup, so they are selected first.
+	configFile, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return fmt.Errorf("could not get config flag: %w", err)
+	}
+
+	configFileOverride = configFile
+
+	profileOverride, err = cmd.Flags().GetString("profile")
+	if err != nil {
+		return fmt.Errorf("could not get profile flag: %w", err)
+	}
+
+	if cmd.Flags().Changed("save") && !cmd.Flags().Changed("server") {
+		return fmt.Errorf("%w: --save can only be used with --server", ErrUsage)
+	}
+
+	allowInsecurePermissions, err = cmd.Flags().GetBool("insecure-permissions")
+	if err != nil {
+		return fmt.Errorf("could not get insecure-permissions flag: %w", err)
+	}
+
+	offlineMode, err = cmd.Flags().GetBool("offline")
+	if err != nil {
+		return fmt.Errorf("could not get offline flag: %w", err)
+	}
+
+	cacheDirOverride, err = cmd.Flags().GetString("cache-dir")
+	if err != nil {
+		return fmt.Errorf("could not get cache-dir flag: %w", err)
+	}
+
+	noHistory, err = cmd.Flags().GetBool("no-history")
+	if err != nil {
+		return fmt.Errorf("could not get no-history flag: %w", err)
+	}
+
+	// The settings below are taken from one load of the config. Commands such as configure work without a usable
+	// config, so a config that cannot be loaded is left for the command itself to report.
+	var startupConfigErr error
+
+	startupConfig, startupConfigErr = readConfig()
+
 	verbose, err := cmd.Flags().GetCount("verbose")
 	if err != nil {
 		return fmt.Errorf("could not get verbose flag: %w", err)
@@ -103,39 +533,258 @@ func rootCmdPersistentPre(cmd *cobra.Command, _ []string) error {
 
 	level := slog.LevelWarn
 
-	if verbose > 1 {
+	if verbose > 2 {
+		level = logging.LevelTrace
+	} else if verbose > 1 {
 		level = slog.LevelDebug
 	} else if verbose > 0 {
 		level = slog.LevelInfo
 	}
 
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+	if cmd.Flags().Changed("log-level") {
+		rawLevel, err := cmd.Flags().GetString("log-level")
+		if err != nil {
+			return fmt.Errorf("could not get log-level flag: %w", err)
+		}
+
+		level, err = logging.ParseLevel(rawLevel)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrUsage, err)
+		}
+	}
+
+	handlerOpts := &slog.HandlerOptions{
 		AddSource:   false,
 		Level:       level,
-		ReplaceAttr: nil,
-	})))
+		ReplaceAttr: logging.ReplaceLevelName,
+	}
+
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, handlerOpts)
+
+	logFile, logFileMaxSize, err := logFileSettings(cmd, startupConfig)
+	if err != nil {
+		return err
+	}
+
+	if logFile != "" {
+		f, err := logging.OpenFile(logFile, logFileMaxSize)
+		if err != nil {
+			return fmt.Errorf("could not open log file: %w", err)
+		}
+
+		handler = logging.TeeHandler{handler, slog.NewTextHandler(f, handlerOpts)}
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	if startupConfigErr != nil && !errors.Is(startupConfigErr, ErrConfigNotFound) {
+		slog.Debug("Could not load the config, using the default settings", "err", startupConfigErr)
+	}
+
+	noColor, err := cmd.Flags().GetBool("no-color")
+	if err != nil {
+		return fmt.Errorf("could not get no-color flag: %w", err)
+	}
 
-	fmt.Println("# Team-CLI - " + Version)
+	color.Configure(noColor, os.Stdout)
+
+	displayLocation, err = timeLocation(cmd, startupConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := configureTransport(cmd, startupConfig); err != nil {
+		return err
+	}
+
+	if err := configureTokenVerification(cmd); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cmd.ErrOrStderr(), "# Team-CLI - "+Version)
 
 	call := strings.Fields(cmd.UseLine())
 	isCompletion := len(call) >= 3 && call[1] == "completion"
 
-	if !isCompletion && strings.HasPrefix(Version, "v") {
+	if !isCompletion && !offlineMode && strings.HasPrefix(Version, "v") {
 		latestVersion, err := getLatestVersion(cmd.Context())
 		if err != nil {
 			slog.Warn("Failed to check for updates", "err", err)
 		} else if !strings.HasPrefix(latestVersion, "v") {
 			slog.Warn("Failed to check for updates", "version", latestVersion, "err", "unknown format")
 		} else if semver.Compare(latestVersion, Version) > 0 {
-			fmt.Println()
-			fmt.Println("---- Update available! ----")
-			fmt.Println("A new release is available. Please install with: go install github.com/csnewman/team-cli/cmd/team-cli@" + latestVersion)
+			fmt.Fprintln(cmd.ErrOrStderr())
+			fmt.Fprintln(cmd.ErrOrStderr(), "---- Update available! ----")
+			fmt.Fprintln(cmd.ErrOrStderr(), "A new release is available. Please install with: go install github.com/csnewman/team-cli/cmd/team-cli@"+latestVersion)
 		}
 	}
 
 	return nil
 }
 
+// logFileSettings returns the log file path and maximum size, with the flag taking precedence over cfg, which is nil
+// when the config could not be loaded.
+func logFileSettings(cmd *cobra.Command, cfg *Config) (string, int64, error) {
+	path, err := cmd.Flags().GetString("log-file")
+	if err != nil {
+		return "", 0, fmt.Errorf("could not get log-file flag: %w", err)
+	}
+
+	if cfg == nil {
+		return path, 0, nil
+	}
+
+	if path == "" {
+		path = cfg.LogFile
+	}
+
+	return path, cfg.LogFileMaxSize, nil
+}
+
+// refuseTokenFetch is set when certificate verification is disabled without --i-know-what-im-doing. Logging in or
+// refreshing a token would then hand long-lived credentials to anyone intercepting the connection.
+var refuseTokenFetch bool
+
+// checkTokenFetch returns an error when tokens must not be obtained from the server, see refuseTokenFetch.
+func checkTokenFetch() error {
+	if !refuseTokenFetch {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%w: tokens are not obtained with certificate verification disabled unless --i-know-what-im-doing is also given",
+		ErrUsage,
+	)
+}
+
+// userAgent identifies the CLI to servers, so its traffic can be told apart in their logs.
+func userAgent() string {
+	version := Version
+
+	// Development builds have versions such as "(devel)", which are not valid in a User-Agent.
+	if strings.ContainsAny(version, " ()/") {
+		version = "unknown"
+	}
+
+	return fmt.Sprintf("team-cli/%s (%s/%s)", version, runtime.GOOS, runtime.GOARCH)
+}
+
+// configureTransport applies the network settings to all outbound connections. Flags take precedence over the
+// options of cfg, which is nil when the config could not be loaded, and --proxy or the proxy option over the proxy
+// environment variables.
+func configureTransport(cmd *cobra.Command, cfg *Config) error {
+	proxy, err := cmd.Flags().GetString("proxy")
+	if err != nil {
+		return fmt.Errorf("could not get proxy flag: %w", err)
+	}
+
+	caBundle, err := cmd.Flags().GetString("ca-bundle")
+	if err != nil {
+		return fmt.Errorf("could not get ca-bundle flag: %w", err)
+	}
+
+	insecure, err := cmd.Flags().GetBool("insecure-skip-verify")
+	if err != nil {
+		return fmt.Errorf("could not get insecure-skip-verify flag: %w", err)
+	}
+
+	override, err := cmd.Flags().GetBool("i-know-what-im-doing")
+	if err != nil {
+		return fmt.Errorf("could not get i-know-what-im-doing flag: %w", err)
+	}
+
+	settings := transport.Settings{
+		Proxy:              proxy,
+		CABundle:           caBundle,
+		InsecureSkipVerify: insecure,
+		Offline:            offlineMode,
+		UserAgent:          userAgent(),
+	}
+
+	if cfg != nil {
+		settings.Proxy = cmp.Or(settings.Proxy, cfg.Proxy)
+		settings.CABundle = cmp.Or(settings.CABundle, cfg.CABundle)
+		settings.InsecureSkipVerify = settings.InsecureSkipVerify || cfg.Insecure
+		settings.WSReadLimit = max(cfg.WSReadLimit, 0)
+		settings.BodyLimit = max(cfg.BodyLimit, 0)
+		settings.RateLimit = cfg.transportRateLimit()
+
+		// As with expiry_warning, invalid timeouts are left to `config validate` rather than failing every command.
+		if settings.Timeouts, err = cfg.transportTimeouts(); err != nil {
+			slog.Warn("Ignoring invalid timeouts option", "err", err)
+
+			settings.Timeouts = transport.Timeouts{}
+		}
+	}
+
+	if settings.InsecureSkipVerify {
+		fmt.Fprintln(cmd.ErrOrStderr(), color.Apply(
+			color.Red,
+			"WARNING: TLS certificate verification is disabled. Anyone on the network path can read and alter traffic, "+
+				"including your tokens.",
+		))
+	}
+
+	refuseTokenFetch = settings.InsecureSkipVerify && !override
+
+	err = transport.Configure(settings)
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, transport.ErrInvalidProxy) && proxy != "",
+		errors.Is(err, transport.ErrInvalidCABundle) && caBundle != "":
+		return fmt.Errorf("%w: %w", ErrUsage, err)
+	default:
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+}
+
+// configureTokenVerification sets up the verification of ID tokens, whose signing keys are cached in the cache dir.
+func configureTokenVerification(cmd *cobra.Command) error {
+	noVerify, err := cmd.Flags().GetBool("no-verify")
+	if err != nil {
+		return fmt.Errorf("could not get no-verify flag: %w", err)
+	}
+
+	if noVerify {
+		slog.Warn("ID token verification is disabled")
+	}
+
+	keyCache, err := sharedCache()
+	if err != nil {
+		slog.Debug("Not caching signing keys", "err", err)
+
+		keyCache = nil
+	} else {
+		removeLegacyCache(keyCacheName)
+	}
+
+	team.ConfigureTokenVerification(team.TokenVerification{KeyCache: keyCache, Disabled: noVerify})
+
+	return nil
+}
+
+// timeLocation returns the zone timestamps are displayed in. --utc takes precedence over the utc option of cfg, which
+// is nil when the config could not be loaded, and structured output is unaffected since it always carries the
+// server's RFC3339 UTC timestamps.
+func timeLocation(cmd *cobra.Command, cfg *Config) (*time.Location, error) {
+	utc, err := cmd.Flags().GetBool("utc")
+	if err != nil {
+		return nil, fmt.Errorf("could not get utc flag: %w", err)
+	}
+
+	if !utc && !cmd.Flags().Changed("utc") && cfg != nil {
+		utc = cfg.UTC
+	}
+
+	if utc {
+		return time.UTC, nil
+	}
+
+	return time.Local, nil
+}
+
 const latestURL = "https://api.github.com/repos/csnewman/team-cli/releases/latest"
 
 var ErrUnexpected = errors.New("unexpected error")
@@ -149,7 +798,7 @@ func getLatestVersion(ctx context.Context) (string, error) {
 		return "", fmt.Errorf("could not create request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := transport.Client().Do(req)
 	if err != nil {
 		return "", fmt.Errorf("could not send request: %w", err)
 	}
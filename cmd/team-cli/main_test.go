@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/fileperm"
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// isolateConfig points all config and cache files at a fresh temporary home directory.
+func isolateConfig(t *testing.T) string {
+	t.Helper()
+
+	home := t.TempDir()
+
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("APPDATA", filepath.Join(home, "AppData", "Roaming"))
+	t.Setenv("LOCALAPPDATA", filepath.Join(home, "AppData", "Local"))
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv(configEnvVar, "")
+	t.Setenv(profileEnvVar, "")
+	t.Setenv(passphraseEnvVar, "")
+	t.Setenv(credentialStoreEnvVar, credentialStoreFile)
+
+	for _, env := range []string{envServerConfig, envGraphQLEndpoint, envAccessToken, envIDToken, envAPIKey} {
+		t.Setenv(env, "")
+	}
+
+	// A previous command may have selected a file with --config or a profile, relaxed the permission checks, gone
+	// offline or disabled the history.
+	configFileOverride = ""
+	profileOverride = ""
+	allowInsecurePermissions = false
+	offlineMode = false
+	cacheDirOverride = ""
+	noHistory = false
+
+	forgetPassphrase()
+
+	return home
+}
+
+// requirePrivate asserts that only the owner can access the file at path: by its mode on Unix, and by its ACL on
+// Windows, where modes are not used.
+func requirePrivate(t *testing.T, path string) {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		exposure, err := fileperm.Exposure(path)
+		require.NoError(t, err)
+		require.Empty(t, exposure, path)
+
+		return
+	}
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm(), path)
+}
+
+func TestConfigDir(t *testing.T) {
+	home := isolateConfig(t)
+
+	dir, err := configDir()
+	require.NoError(t, err)
+
+	switch runtime.GOOS {
+	case "windows":
+		require.Equal(t, filepath.Join(home, "AppData", "Roaming", "team-cli"), dir)
+	case "darwin":
+		require.Equal(t, filepath.Join(home, "Library", "Application Support", "team-cli"), dir)
+	default:
+		require.Equal(t, filepath.Join(home, ".config", "team-cli"), dir)
+	}
+}
+
+// executeCmd runs the CLI with the given arguments, capturing stdout and stderr separately.
+func executeCmd(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := newRootCmd()
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	cmd.SetArgs(args)
+
+	err := cmd.Execute()
+	if err != nil {
+		reportError(cmd, err)
+	}
+
+	return stdout.String(), stderr.String(), err
+}
+
+func TestStdoutCarriesOnlyData(t *testing.T) {
+	isolateConfig(t)
+
+	stdout, stderr, err := executeCmd(t, "alias", "set", "pay", "corp-prod-payments-eu-west-1")
+	require.NoError(t, err)
+	require.Empty(t, stdout)
+	require.Contains(t, stderr, "# Team-CLI")
+	require.Contains(t, stderr, `Alias "pay" now refers to "corp-prod-payments-eu-west-1"`)
+
+	stdout, stderr, err = executeCmd(t, "alias", "list")
+	require.NoError(t, err)
+	require.Contains(t, stdout, "pay")
+	require.Contains(t, stdout, "corp-prod-payments-eu-west-1")
+	require.NotContains(t, stdout, "Team-CLI")
+	require.NotContains(t, stderr, "corp-prod-payments-eu-west-1")
+
+	stdout, _, err = executeCmd(t, "alias", "list", "-o", "json")
+	require.NoError(t, err)
+
+	var aliases struct {
+		SchemaVersion int          `json:"schemaVersion"`
+		Items         []*aliasView `json:"items"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &aliases))
+	require.Equal(t, output.SchemaVersion, aliases.SchemaVersion)
+	require.Equal(t, []*aliasView{{Alias: "pay", Account: "corp-prod-payments-eu-west-1"}}, aliases.Items)
+
+	stdout, _, err = executeCmd(t, "alias", "list", "-q")
+	require.Error(t, err, "alias list has no quiet flag")
+	require.Empty(t, stdout)
+}
+
+func TestErrorsGoToStderr(t *testing.T) {
+	isolateConfig(t)
+
+	stdout, stderr, err := executeCmd(t, "alias", "rm", "missing")
+	require.ErrorIs(t, err, ErrInvalid)
+	require.Equal(t, ExitValidation, exitCode(err))
+	require.Empty(t, stdout)
+	require.Contains(t, stderr, `alias "missing" not found`)
+
+	stdout, stderr, err = executeCmd(t, "alias", "rm", "missing", "-o", "json")
+	require.Error(t, err)
+	require.Empty(t, stdout)
+
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+
+	var errView errorView
+
+	require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &errView))
+	require.Equal(t, ErrorKindValidation, errView.Kind)
+
+	// The format is matched as the output flag matches it, regardless of case.
+	_, stderr, err = executeCmd(t, "alias", "rm", "missing", "-o", "JSON")
+	require.Error(t, err)
+
+	lines = strings.Split(strings.TrimSpace(stderr), "\n")
+	require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &errView))
+	require.Equal(t, ErrorKindValidation, errView.Kind)
+}
+
+func TestPromptWritesToStderr(t *testing.T) {
+	var out bytes.Buffer
+
+	oldReader, oldOutput, oldIsTerminal := ioReader, promptOutput, stdinIsTerminal
+	ioReader, promptOutput = bufio.NewReader(strings.NewReader("\nvalue\n")), &out
+	stdinIsTerminal = func() bool { return true }
+
+	t.Cleanup(func() {
+		ioReader, promptOutput, stdinIsTerminal = oldReader, oldOutput, oldIsTerminal
+	})
+
+	value, err := promptString("Justification: ", input{name: "justification", flag: "--reason"})
+	require.NoError(t, err)
+	require.Equal(t, "value", value)
+	require.Equal(t, "Justification: Justification: ", out.String())
+}
+
+func TestConfigLocation(t *testing.T) {
+	home := isolateConfig(t)
+
+	// A config in the legacy location is moved into XDG_CONFIG_HOME.
+	legacy := filepath.Join(home, ".config", "team-cli", "config.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(legacy), 0755))
+	require.NoError(t, os.WriteFile(legacy, []byte(`{"aliases":{"pay":"payments"}}`), 0644))
+
+	xdg := filepath.Join(home, "xdg")
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+
+	stdout, _, err := executeCmd(t, "config", "show", "-o", "json")
+	require.NoError(t, err)
+
+	var view configView
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &view))
+	require.Equal(t, filepath.Join(xdg, "team-cli", "config.toml"), view.Path)
+	require.Equal(t, map[string]string{"pay": "payments"}, view.Aliases)
+	require.NoFileExists(t, legacy)
+
+	// The JSON config is converted to TOML, and kept aside.
+	require.FileExists(t, filepath.Join(xdg, "team-cli", "config.json.migrated"))
+
+	// TEAM_CLI_CONFIG, and --config above it, select a different file for every command.
+	envPath := filepath.Join(home, "env.json")
+	t.Setenv(configEnvVar, envPath)
+
+	_, _, err = executeCmd(t, "alias", "set", "db", "database")
+	require.NoError(t, err)
+	require.FileExists(t, envPath)
+
+	flagPath := filepath.Join(home, "flag", "config.json")
+
+	_, _, err = executeCmd(t, "--config", flagPath, "alias", "set", "web", "frontend")
+	require.NoError(t, err)
+
+	stdout, _, err = executeCmd(t, "--config", flagPath, "config", "show", "-o", "json")
+	require.NoError(t, err)
+
+	var flagView configView
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &flagView))
+	require.Equal(t, flagPath, flagView.Path)
+	require.Equal(t, map[string]string{"web": "frontend"}, flagView.Aliases)
+}
+
+func TestTransportSettings(t *testing.T) {
+	home := isolateConfig(t)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	_, _, err := executeCmd(t, "--proxy", "ftp://proxy:21", "alias", "list")
+	require.ErrorIs(t, err, ErrUsage)
+
+	path := filepath.Join(home, "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":2,"proxy":"http://config-proxy:3128"}`), 0600))
+
+	_, _, err = executeCmd(t, "--config", path, "alias", "list")
+	require.NoError(t, err)
+
+	u, err := transport.ProxyFor("https://team.example.com")
+	require.NoError(t, err)
+	require.Equal(t, "http://config-proxy:3128", u.String())
+	require.Regexp(t, `^team-cli/\S+ \(\w+/\w+\)$`, transport.UserAgent())
+
+	// The flag takes precedence over the config.
+	_, _, err = executeCmd(t, "--config", path, "--proxy", "http://flag-proxy:8080", "alias", "list")
+	require.NoError(t, err)
+
+	u, err = transport.ProxyFor("https://team.example.com")
+	require.NoError(t, err)
+	require.Equal(t, "http://flag-proxy:8080", u.String())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":2,"proxy":"socks4://config-proxy"}`), 0600))
+
+	_, _, err = executeCmd(t, "--config", path, "alias", "list")
+	require.ErrorIs(t, err, ErrInvalidConfig)
+
+	bundle := filepath.Join(home, "ca.pem")
+	require.NoError(t, os.WriteFile(bundle, []byte("not a certificate"), 0600))
+
+	_, _, err = executeCmd(t, "--ca-bundle", bundle, "alias", "list")
+	require.ErrorIs(t, err, ErrUsage)
+	require.ErrorContains(t, err, bundle)
+}
+
+func TestTimeLocation(t *testing.T) {
+	t.Parallel()
+
+	location := func(cfg *Config, args ...string) *time.Location {
+		cmd := newRootCmd()
+		require.NoError(t, cmd.ParseFlags(args))
+
+		loc, err := timeLocation(cmd, cfg)
+		require.NoError(t, err)
+
+		return loc
+	}
+
+	require.Equal(t, time.Local, location(nil))
+	require.Equal(t, time.UTC, location(nil, "--utc"))
+	require.Equal(t, time.UTC, location(&Config{UTC: true}))
+
+	// The flag takes precedence over the config.
+	require.Equal(t, time.Local, location(&Config{UTC: true}, "--utc=false"))
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	isolateConfig(t)
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	_, stderr, err := executeCmd(t, "--insecure-skip-verify", "alias", "list")
+	require.NoError(t, err)
+	require.Contains(t, stderr, "WARNING: TLS certificate verification is disabled")
+
+	// Logging in and refreshing tokens need an explicit second opt-in, whichever command does it.
+	_, stderr, err = executeCmd(t, "--insecure-skip-verify", "configure", "https://team.example.com")
+	require.ErrorIs(t, err, ErrUsage)
+	require.ErrorContains(t, err, "--i-know-what-im-doing")
+	require.Contains(t, stderr, "WARNING: TLS certificate verification is disabled")
+
+	// The stored token has expired, so it is refreshed before use.
+	require.NoError(t, writeConfig(fixtureConfig()))
+
+	for _, args := range [][]string{{"login"}, {"whoami"}} {
+		_, _, err = executeCmd(t, append([]string{"--insecure-skip-verify"}, args...)...)
+		require.ErrorIs(t, err, ErrUsage, args)
+		require.ErrorContains(t, err, "--i-know-what-im-doing", args)
+	}
+}
+
+func TestPromptRequiresTerminal(t *testing.T) {
+	oldIsTerminal := stdinIsTerminal
+	stdinIsTerminal = func() bool { return false }
+
+	t.Cleanup(func() {
+		stdinIsTerminal = oldIsTerminal
+	})
+
+	_, err := promptString("Justification: ", input{name: "justification", flag: "--reason"})
+
+	var inputErr *InputRequiredError
+
+	require.ErrorAs(t, err, &inputErr)
+	require.ErrorIs(t, err, ErrUsage)
+	require.EqualError(t, err, "justification required: pass --reason or run interactively")
+
+	_, err = promptBool("Confirm (y/n)? ", input{name: "confirmation"})
+	require.EqualError(t, err, "confirmation required: run interactively")
+}
+
+func TestPromptDefault(t *testing.T) {
+	var out bytes.Buffer
+
+	oldReader, oldOutput, oldIsTerminal := ioReader, promptOutput, stdinIsTerminal
+	ioReader, promptOutput = bufio.NewReader(strings.NewReader("\n7\n")), &out
+	stdinIsTerminal = func() bool { return true }
+
+	t.Cleanup(func() {
+		ioReader, promptOutput, stdinIsTerminal = oldReader, oldOutput, oldIsTerminal
+	})
+
+	in := input{name: "duration", flag: "--duration", def: "4"}
+
+	value, err := promptSelection("Duration? ", 1, 8, in)
+	require.NoError(t, err)
+	require.Equal(t, 4, value)
+	require.Equal(t, "Duration? [4] ", out.String())
+
+	value, err = promptSelection("Duration? ", 1, 8, in)
+	require.NoError(t, err)
+	require.Equal(t, 7, value)
+
+	// Without a terminal, the default is taken instead of failing.
+	stdinIsTerminal = func() bool { return false }
+
+	value, err = promptSelection("Duration? ", 1, 8, in)
+	require.NoError(t, err)
+	require.Equal(t, 4, value)
+}
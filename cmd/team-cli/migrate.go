@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// configVersion is the version of the config file format written by this build.
+const configVersion = 3
+
+var ErrConfigTooNew = errors.New("config file is from a newer team-cli")
+
+// configMigrations upgrade the raw config document one version at a time: configMigrations[i] upgrades version i to
+// version i+1. Migrations work on the decoded JSON rather than Config, so they can still read fields that have since
+// been renamed or removed from the struct.
+var configMigrations = []func(doc map[string]any) error{
+	// Version 0 is the unversioned format used before versioning was introduced, which is otherwise identical.
+	func(map[string]any) error { return nil },
+	// Version 2 keeps auth_token in the credentials file. readConfig moves an inline token there when writing back,
+	// so the document itself is unchanged.
+	func(map[string]any) error { return nil },
+	// Version 3 moves the settings of the configured server into the default profile.
+	func(doc map[string]any) error {
+		profile := make(map[string]any)
+
+		for _, key := range []string{
+			"server_config", "auth_token", "use_device_code", "no_browser", "callback_port", "aliases", "insecure",
+		} {
+			if v, ok := doc[key]; ok {
+				profile[key] = v
+				delete(doc, key)
+			}
+		}
+
+		if len(profile) > 0 {
+			doc["profiles"] = map[string]any{defaultProfileName: profile}
+		}
+
+		return nil
+	},
+}
+
+// migrateConfig upgrades a raw config file to configVersion, reporting whether anything changed.
+func migrateConfig(raw []byte) ([]byte, bool, error) {
+	var doc map[string]any
+
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, false, err
+	}
+
+	if doc == nil {
+		doc = map[string]any{}
+	}
+
+	version := 0
+
+	if v, ok := doc["version"]; ok {
+		f, ok := v.(float64)
+		if !ok || f < 0 || f != float64(int(f)) {
+			return nil, false, fmt.Errorf("invalid config version %v", v)
+		}
+
+		version = int(f)
+	}
+
+	if version > configVersion {
+		return nil, false, fmt.Errorf(
+			"%w: it has version %d but this build only supports up to version %d, please upgrade team-cli",
+			ErrConfigTooNew,
+			version,
+			configVersion,
+		)
+	}
+
+	if version == configVersion {
+		return raw, false, nil
+	}
+
+	for ; version < configVersion; version++ {
+		if err := configMigrations[version](doc); err != nil {
+			return nil, false, fmt.Errorf("could not migrate config from version %d: %w", version, err)
+		}
+	}
+
+	doc["version"] = configVersion
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not encode migrated config: %w", err)
+	}
+
+	return out, true, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+func fixtureConfig() *Config {
+	cfg := &Config{
+		Version: configVersion,
+		Profiles: map[string]*Profile{defaultProfileName: {
+			ServerConfig: &team.RemoteConfig{
+				Server:            "https://team.example.com",
+				GraphQLEndpoint:   "https://api.example.com/graphql",
+				UserPoolClientID:  "client",
+				OAuthDomain:       "auth.example.com",
+				OAuthResponseType: "code",
+				OAuthScopes:       []string{"openid", "email"},
+				RedirectSignIn:    "https://team.example.com/",
+			},
+			AuthToken: &team.AuthToken{
+				IdToken:      "id",
+				AccessToken:  "access",
+				RefreshToken: "refresh",
+				ExpiresAt:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				TokenType:    "Bearer",
+			},
+			NoBrowser: true,
+		}},
+	}
+
+	cfg.useProfile(defaultProfileName)
+
+	return cfg
+}
+
+func TestMigrateConfig(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		fixture string
+		changed bool
+		want    func(cfg *Config)
+	}{
+		{"v0.json", true, func(*Config) {}},
+		{"v1.json", true, func(cfg *Config) {
+			cfg.Aliases = map[string]string{"pay": "payments"}
+			cfg.UTC = true
+		}},
+		// From version 2 the token lives in the credentials file.
+		{"v2.json", true, func(cfg *Config) {
+			cfg.AuthToken = nil
+			cfg.Aliases = map[string]string{"pay": "payments"}
+			cfg.UTC = true
+		}},
+		// From version 3 the server settings live in a profile.
+		{"v3.json", false, func(cfg *Config) {
+			cfg.AuthToken = nil
+			cfg.Aliases = map[string]string{"pay": "payments"}
+			cfg.UTC = true
+		}},
+	} {
+		t.Run(tc.fixture, func(t *testing.T) {
+			t.Parallel()
+
+			raw, err := os.ReadFile(filepath.Join("testdata", "config", tc.fixture))
+			require.NoError(t, err)
+
+			migrated, changed, err := migrateConfig(raw)
+			require.NoError(t, err)
+			require.Equal(t, tc.changed, changed)
+
+			var got *Config
+
+			require.NoError(t, json.Unmarshal(migrated, &got))
+			got.useProfile(defaultProfileName)
+
+			want := fixtureConfig()
+			tc.want(want)
+
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestMigrateConfigTooNew(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := migrateConfig([]byte(`{"version": 999}`))
+	require.ErrorIs(t, err, ErrConfigTooNew)
+	require.ErrorContains(t, err, "please upgrade team-cli")
+}
+
+func TestReadConfigWritesBackMigration(t *testing.T) {
+	home := isolateConfig(t)
+	path := filepath.Join(home, "config.json")
+	t.Setenv(configEnvVar, path)
+
+	raw, err := os.ReadFile(filepath.Join("testdata", "config", "v0.json"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, raw, 0644))
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.Equal(t, fixtureConfig(), cfg)
+
+	raw, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(raw), `"version": 3`)
+	require.NotContains(t, string(raw), "refresh")
+
+	// The token is moved to the credentials file, and read back from there.
+	credsPath := filepath.Join(home, "credentials.json")
+
+	requirePrivate(t, credsPath)
+
+	cfg, err = readConfig()
+	require.NoError(t, err)
+	require.Equal(t, fixtureConfig(), cfg)
+}
+
+func TestCredentialsPath(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, filepath.Join("a", "credentials.json"), credentialsPath(filepath.Join("a", "config.json")))
+	require.Equal(t, filepath.Join("a", "credentials.json"), credentialsPath(filepath.Join("a", "config.toml")))
+	require.Equal(t, filepath.Join("a", "work.credentials.json"), credentialsPath(filepath.Join("a", "work.toml")))
+	require.Equal(t, filepath.Join("a", "work.credentials.json"), credentialsPath(filepath.Join("a", "work.json")))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/spf13/cobra"
+)
+
+// offlineMode is set by --offline, which forbids network access. Commands that can serve cached data do so, and all
+// others fail on their first connection attempt.
+var offlineMode bool
+
+// offlineAccounts returns the accounts cached by the last listing of the selected profile, announcing when they were
+// fetched.
+func offlineAccounts(cmd *cobra.Command) (map[string]*team.Account, error) {
+	cfg, err := readConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+
+	cache, ok, err := getAccountsCache(cfg.ProfileName, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not get accounts cache: %w", err)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf(
+			"%w: no accounts are cached for profile %q, list them once while online", transport.ErrOffline, cfg.ProfileName,
+		)
+	}
+
+	asOf := "an unknown time"
+	if !cache.FetchedAt.IsZero() {
+		asOf = fmtDate(cache.FetchedAt)
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Offline: showing cached accounts as of %s\n", asOf)
+
+	return cache.Accounts, nil
+}
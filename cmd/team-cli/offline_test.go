@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfflineListAccounts(t *testing.T) {
+	writeProfiles(t)
+
+	t.Cleanup(func() {
+		offlineMode = false
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	_, _, err := executeCmd(t, "list-accounts", "--offline")
+	require.ErrorIs(t, err, transport.ErrOffline)
+	require.ErrorContains(t, err, "list them once while online")
+
+	require.NoError(t, cacheAccounts(defaultProfileName, testAccounts()))
+
+	stdout, stderr, err := executeCmd(t, "list-accounts", "--offline", "--filter", "a*", "-o", "json")
+	require.NoError(t, err)
+	require.Contains(t, stderr, "Offline: showing cached accounts as of ")
+
+	var got struct {
+		Items accountList `json:"items"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &got))
+	require.Equal(t, []string{"2"}, got.Items.IDs())
+
+	// The cache belongs to the profile, so another profile has none.
+	_, _, err = executeCmd(t, "list-accounts", "--offline", "--profile", "work")
+	require.ErrorIs(t, err, transport.ErrOffline)
+
+	// Commands that need the network fail on their first connection rather than waiting for a timeout.
+	_, stderr, err = executeCmd(t, "configure", "team.example.com", "--offline")
+	require.ErrorIs(t, err, transport.ErrOffline)
+	require.Contains(t, stderr, "without --offline")
+	require.Equal(t, ExitFailure, exitCode(err))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/csnewman/team-cli/internal/progress"
+	"github.com/spf13/cobra"
+)
+
+func outputFormat(cmd *cobra.Command) (output.Format, error) {
+	raw, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return "", fmt.Errorf("output flag: %w", err)
+	}
+
+	tmpl, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return "", fmt.Errorf("format flag: %w", err)
+	}
+
+	if tmpl != "" && cmd.Flags().Changed("output") {
+		return "", fmt.Errorf("%w: --format cannot be combined with --output", ErrInvalid)
+	}
+
+	if _, err := quietMode(cmd); err != nil {
+		return "", err
+	}
+
+	if configured := configuredOutput(); configured != "" && tmpl == "" && !cmd.Flags().Changed("output") {
+		format, err := output.ParseFormat(configured)
+		if err != nil {
+			return "", fmt.Errorf("%w: default output of profile: %w", ErrInvalidConfig, err)
+		}
+
+		return format, nil
+	}
+
+	format, err := output.ParseFormat(raw)
+	if err != nil {
+		return "", fmt.Errorf("output flag: %w", err)
+	}
+
+	return format, nil
+}
+
+// configuredOutput returns the default output format of the selected profile, or "" when there is none.
+func configuredOutput() string {
+	if startupConfig == nil {
+		return ""
+	}
+
+	return startupConfig.defaults().Output
+}
+
+// quietMode reports whether the command was asked to print only identifiers. Commands without a quiet flag are
+// never quiet.
+func quietMode(cmd *cobra.Command) (bool, error) {
+	if cmd.Flags().Lookup("quiet") == nil {
+		return false, nil
+	}
+
+	quiet, err := cmd.Flags().GetBool("quiet")
+	if err != nil {
+		return false, fmt.Errorf("quiet flag: %w", err)
+	}
+
+	if quiet && (cmd.Flags().Changed("output") || cmd.Flags().Changed("format")) {
+		return false, fmt.Errorf("%w: --quiet cannot be combined with --output or --format", ErrInvalid)
+	}
+
+	return quiet, nil
+}
+
+func render(cmd *cobra.Command, v any) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	quiet, err := quietMode(cmd)
+	if err != nil {
+		return err
+	}
+
+	if quiet {
+		return output.RenderIDs(cmd.OutOrStdout(), v)
+	}
+
+	tmpl, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("format flag: %w", err)
+	}
+
+	if tmpl != "" {
+		return output.RenderTemplate(cmd.OutOrStdout(), tmpl, v)
+	}
+
+	columns, err := selectedColumns(cmd)
+	if err != nil {
+		return err
+	}
+
+	if columns != nil {
+		if format != output.FormatTable {
+			return fmt.Errorf("%w: --columns can only be used with table output", ErrInvalid)
+		}
+
+		tt, ok := v.(output.TextTabular)
+		if !ok {
+			return fmt.Errorf("%w: --columns is not supported by this command", ErrInvalid)
+		}
+
+		table, err := tt.TextTable().Select(columns)
+		if err != nil {
+			return fmt.Errorf("columns flag: %w", err)
+		}
+
+		v = output.WithSummary(table, v)
+	}
+
+	// Only human-readable tables are paged; structured output must reach its consumer untouched.
+	if format != output.FormatTable || !usePager(cmd) {
+		if err := output.Render(cmd.OutOrStdout(), format, v); err != nil {
+			return fmt.Errorf("could not render output: %w", err)
+		}
+
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	if err := output.Render(&buf, format, v); err != nil {
+		return fmt.Errorf("could not render output: %w", err)
+	}
+
+	return output.WriteWithPager(cmd.OutOrStdout(), buf.Bytes(), os.Getenv("PAGER"))
+}
+
+func usePager(cmd *cobra.Command) bool {
+	if noPager, err := cmd.Flags().GetBool("no-pager"); err != nil || noPager {
+		return false
+	}
+
+	return startupConfig == nil || !startupConfig.NoPager
+}
+
+// selectedColumns returns the columns requested via --columns, or nil when the command has no such flag or the
+// default column set should be used.
+func selectedColumns(cmd *cobra.Command) ([]string, error) {
+	if cmd.Flags().Lookup("columns") == nil || !cmd.Flags().Changed("columns") {
+		return nil, nil
+	}
+
+	columns, err := cmd.Flags().GetStringSlice("columns")
+	if err != nil {
+		return nil, fmt.Errorf("columns flag: %w", err)
+	}
+
+	return columns, nil
+}
+
+// startSpinner shows a progress spinner on stderr until the returned function is called. The spinner is only shown
+// for human-readable output on a terminal, and not while informational logging would interleave with it.
+func startSpinner(cmd *cobra.Command, msg string) (context.Context, func()) {
+	enabled := !slog.Default().Enabled(cmd.Context(), slog.LevelInfo)
+
+	if format, err := outputFormat(cmd); err != nil || format != output.FormatTable {
+		enabled = false
+	}
+
+	if tmpl, _ := cmd.Flags().GetString("format"); tmpl != "" {
+		enabled = false
+	}
+
+	if quiet, _ := quietMode(cmd); quiet {
+		enabled = false
+	}
+
+	spinner := progress.NewSpinner(os.Stderr, enabled)
+	spinner.Start(msg)
+
+	return progress.WithReporter(cmd.Context(), spinner), spinner.Stop
+}
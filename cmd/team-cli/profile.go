@@ -0,0 +1,225 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/spf13/cobra"
+)
+
+type profileView struct {
+	Name   string `json:"name"`
+	Server string `json:"server"`
+	// Identity is who the stored token was issued to, telling apart profiles that log in to the same server.
+	Identity       string     `json:"identity,omitempty"`
+	TokenExpiresAt *time.Time `json:"tokenExpiresAt,omitempty"`
+	Default        bool       `json:"default"`
+}
+
+type profileList []*profileView
+
+func (l profileList) Table() *output.Table {
+	table := &output.Table{
+		Headers: []string{"name", "server", "identity", "token_expires_at", "default"},
+	}
+
+	for _, p := range l {
+		expires := ""
+		if p.TokenExpiresAt != nil {
+			expires = p.TokenExpiresAt.Format(time.RFC3339)
+		}
+
+		table.Rows = append(table.Rows, []string{p.Name, p.Server, p.Identity, expires, fmt.Sprint(p.Default)})
+	}
+
+	return table
+}
+
+func (l profileList) Summary() string {
+	return plural(len(l), "profile", "profiles")
+}
+
+func (l profileList) TextTable() *output.Table {
+	table := &output.Table{
+		Headers: []string{"NAME", "SERVER", "IDENTITY", "TOKEN EXPIRES", "DEFAULT"},
+		Keys:    []string{"name", "server", "identity", "token_expires_at", "default"},
+	}
+
+	for _, p := range l {
+		expires := "-"
+		if p.TokenExpiresAt != nil {
+			expires = fmtDate(*p.TokenExpiresAt)
+		}
+
+		marker := ""
+		if p.Default {
+			marker = "*"
+		}
+
+		identity := p.Identity
+		if identity == "" {
+			identity = "-"
+		}
+
+		table.Rows = append(table.Rows, []string{p.Name, p.Server, identity, expires, marker})
+	}
+
+	return table
+}
+
+func profileListCmdRun(cmd *cobra.Command, _ []string) error {
+	cfg, err := readConfigOrEmpty()
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+
+	defaultName := cmp.Or(cfg.DefaultProfile, defaultProfileName)
+	out := make(profileList, 0, len(cfg.Profiles))
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		if !cfg.hasProfile(name) {
+			continue
+		}
+
+		profile := cfg.Profiles[name]
+		view := &profileView{Name: name, Default: name == defaultName}
+
+		if profile.ServerConfig != nil {
+			view.Server = profile.ServerConfig.Server
+		}
+
+		if profile.AuthToken != nil {
+			expiresAt := profile.AuthToken.ExpiresAt.UTC()
+			view.Identity = profile.AuthToken.Identity()
+			view.TokenExpiresAt = &expiresAt
+		}
+
+		out = append(out, view)
+	}
+
+	return render(cmd, out)
+}
+
+func profileDeleteCmdRun(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	autoConfirm, err := cmd.Flags().GetBool("confirm")
+	if err != nil {
+		return fmt.Errorf("confirm flag: %w", err)
+	}
+
+	if profileSelectedExplicitly(name) {
+		return fmt.Errorf(
+			"%w: profile %q is selected by --profile or %s; select a different profile to delete it",
+			ErrInvalid, name, profileEnvVar,
+		)
+	}
+
+	cfg, err := readConfigOrEmpty()
+	if err != nil {
+		return fmt.Errorf("could not read config: %w", err)
+	}
+
+	if !cfg.hasProfile(name) {
+		return fmt.Errorf("%w: profile %q not found", ErrInvalid, name)
+	}
+
+	if !autoConfirm {
+		ok, err := promptBool(
+			fmt.Sprintf("Delete profile %q and its stored credentials (y/n)? ", name),
+			input{name: "confirmation", flag: "--confirm"},
+		)
+		if err != nil {
+			return fmt.Errorf("could not select confirmation: %w", err)
+		}
+
+		if !ok {
+			return fmt.Errorf("%w: confirmation rejected", ErrInvalid)
+		}
+	}
+
+	_, err = updateConfig(cmd.Context(), func(cfg *Config) (bool, error) {
+		if !cfg.hasProfile(name) {
+			return false, fmt.Errorf("%w: profile %q not found", ErrInvalid, name)
+		}
+
+		// The token is stored with the profile, so it is removed from the credentials file too.
+		delete(cfg.Profiles, name)
+
+		if cfg.DefaultProfile == name {
+			cfg.DefaultProfile = ""
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dropProfileCache(name)
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Profile %q deleted\n", name)
+
+	return nil
+}
+
+func profileRenameCmdRun(cmd *cobra.Command, args []string) error {
+	oldName, newName := args[0], args[1]
+
+	if newName == "" {
+		return fmt.Errorf("%w: profile name must not be empty", ErrUsage)
+	}
+
+	_, err := updateConfig(cmd.Context(), func(cfg *Config) (bool, error) {
+		if !cfg.hasProfile(oldName) {
+			return false, fmt.Errorf("%w: profile %q not found", ErrInvalid, oldName)
+		}
+
+		if cfg.hasProfile(newName) {
+			return false, fmt.Errorf("%w: profile %q already exists", ErrInvalid, newName)
+		}
+
+		cfg.Profiles[newName] = cfg.Profiles[oldName]
+		delete(cfg.Profiles, oldName)
+
+		if cfg.DefaultProfile == oldName || (cfg.DefaultProfile == "" && oldName == defaultProfileName) {
+			cfg.DefaultProfile = newName
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dropProfileCache(oldName)
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Profile %q renamed to %q\n", oldName, newName)
+
+	return nil
+}
+
+func profileSetDefaultCmdRun(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	_, err := updateConfig(cmd.Context(), func(cfg *Config) (bool, error) {
+		if !cfg.hasProfile(name) {
+			return false, fmt.Errorf("%w: profile %q not found", ErrInvalid, name)
+		}
+
+		cfg.DefaultProfile = name
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Profile %q is now the default\n", name)
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+// writeProfiles stores the fixture config as the default profile, alongside a "work" profile without a token.
+func writeProfiles(t *testing.T) string {
+	t.Helper()
+
+	home := isolateConfig(t)
+	path := filepath.Join(home, "config.json")
+	t.Setenv(configEnvVar, path)
+
+	cfg := fixtureConfig()
+	cfg.Profiles["work"] = &Profile{ServerConfig: &team.RemoteConfig{Server: "https://work.example.com"}}
+	require.NoError(t, writeConfig(cfg))
+
+	return path
+}
+
+func TestProfileList(t *testing.T) {
+	writeProfiles(t)
+
+	stdout, _, err := executeCmd(t, "profile", "list", "-o", "json")
+	require.NoError(t, err)
+
+	var got struct {
+		Items []profileView `json:"items"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &got))
+	require.Len(t, got.Items, 2)
+
+	require.Equal(t, "default", got.Items[0].Name)
+	require.Equal(t, "https://team.example.com", got.Items[0].Server)
+	require.True(t, got.Items[0].Default)
+	require.NotNil(t, got.Items[0].TokenExpiresAt)
+
+	require.Equal(t, "work", got.Items[1].Name)
+	require.False(t, got.Items[1].Default)
+	require.Nil(t, got.Items[1].TokenExpiresAt)
+}
+
+func TestProfileSelect(t *testing.T) {
+	writeProfiles(t)
+
+	stdout, _, err := executeCmd(t, "config", "show", "-o", "json", "--profile", "work")
+	require.NoError(t, err)
+
+	var view configView
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &view))
+	require.Equal(t, "https://work.example.com", view.Server)
+
+	_, _, err = executeCmd(t, "profile", "set-default", "work")
+	require.NoError(t, err)
+
+	stdout, _, err = executeCmd(t, "config", "show", "-o", "json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(stdout), &view))
+	require.Equal(t, "work", view.Profile)
+
+	_, _, err = executeCmd(t, "profile", "set-default", "missing")
+	require.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestProfileRename(t *testing.T) {
+	writeProfiles(t)
+
+	_, _, err := executeCmd(t, "profile", "rename", "default", "work")
+	require.ErrorIs(t, err, ErrInvalid)
+	require.ErrorContains(t, err, "already exists")
+
+	_, _, err = executeCmd(t, "profile", "rename", "default", "home")
+	require.NoError(t, err)
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.Equal(t, "home", cfg.ProfileName)
+	require.False(t, cfg.hasProfile(defaultProfileName))
+	require.NotNil(t, cfg.AuthToken, "the token moves with the profile")
+}
+
+func TestProfileDelete(t *testing.T) {
+	path := writeProfiles(t)
+
+	_, _, err := executeCmd(t, "profile", "delete", "work", "--profile", "work")
+	require.ErrorIs(t, err, ErrInvalid)
+	require.ErrorContains(t, err, "select a different profile")
+
+	t.Setenv(profileEnvVar, "work")
+
+	_, _, err = executeCmd(t, "profile", "delete", "work", "--confirm")
+	require.ErrorIs(t, err, ErrInvalid)
+
+	t.Setenv(profileEnvVar, "")
+
+	// Tests have no terminal to confirm on, so the flag is required.
+	_, _, err = executeCmd(t, "profile", "delete", "default")
+	require.ErrorIs(t, err, ErrUsage)
+	require.ErrorContains(t, err, "pass --confirm")
+
+	_, _, err = executeCmd(t, "profile", "delete", "default", "--confirm")
+	require.NoError(t, err)
+
+	raw, err := os.ReadFile(credentialsPath(path))
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "refresh", "the token of the deleted profile is removed")
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.False(t, cfg.hasProfile(defaultProfileName))
+	require.True(t, cfg.hasProfile("work"))
+}
+
+func TestProfileDefaults(t *testing.T) {
+	isolateConfig(t)
+	t.Setenv(configEnvVar, filepath.Join(t.TempDir(), "config.json"))
+
+	cfg := fixtureConfig()
+	cfg.Defaults = &ProfileDefaults{Output: "json", Duration: 4, JustificationPrefix: "[OPS]"}
+	require.NoError(t, writeConfig(cfg))
+
+	stdout, _, err := executeCmd(t, "config", "show")
+	require.NoError(t, err)
+
+	var view configView
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &view), "the default output is JSON")
+	require.Equal(t, defaultsView{Output: "json", Duration: 4, Start: "now", JustificationPrefix: "[OPS]"}, view.Defaults)
+
+	// Flags always win over the defaults.
+	stdout, _, err = executeCmd(t, "config", "show", "-o", "table")
+	require.NoError(t, err)
+	require.Contains(t, stdout, "Default duration: 4h")
+
+	stdout, _, err = executeCmd(t, "config", "show", "--format", "{{.Profile}}")
+	require.NoError(t, err)
+	require.Equal(t, "default\n", stdout)
+}
+
+func TestPrefixJustification(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "deploy", prefixJustification("", "deploy"))
+	require.Equal(t, "[OPS] deploy", prefixJustification("[OPS]", "deploy"))
+	require.Equal(t, "[OPS] deploy", prefixJustification("[OPS] ", "[OPS] deploy"))
+}
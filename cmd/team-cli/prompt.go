@@ -3,15 +3,58 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/term"
 )
 
-func promptBool(msg string) (bool, error) {
+// stdinIsTerminal reports whether prompts can be answered. It is a variable so tests can simulate a terminal.
+var stdinIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// input names the value a prompt asks for and the flag that supplies it instead, for when no one can answer.
+type input struct {
+	name string
+	flag string
+	// env names an environment variable that supplies the value, for values too sensitive for a flag.
+	env string
+	// def is the answer used for an empty line, and without a terminal. It must be a valid answer.
+	def string
+}
+
+// InputRequiredError is returned when a value has to be prompted for but stdin is not a terminal, as under cron or
+// in CI, where reading it would block forever.
+type InputRequiredError struct {
+	Value string
+	// Flag supplies the value without prompting. It is empty when the value can only be given interactively.
+	Flag string
+	// Env is the environment variable supplying the value instead of a flag, if any.
+	Env string
+}
+
+func (e *InputRequiredError) Error() string {
+	switch {
+	case e.Flag != "":
+		return fmt.Sprintf("%s required: pass %s or run interactively", e.Value, e.Flag)
+	case e.Env != "":
+		return fmt.Sprintf("%s required: set %s or run interactively", e.Value, e.Env)
+	default:
+		return fmt.Sprintf("%s required: run interactively", e.Value)
+	}
+}
+
+func (e *InputRequiredError) Unwrap() error {
+	return ErrUsage
+}
+
+func promptBool(msg string, in input) (bool, error) {
 	for {
-		line, err := prompt(msg)
+		line, err := prompt(msg, in)
 		if err != nil {
 			return false, err
 		}
@@ -25,9 +68,9 @@ func promptBool(msg string) (bool, error) {
 	}
 }
 
-func promptSelection(msg string, min int, max int) (int, error) {
+func promptSelection(msg string, min int, max int, in input) (int, error) {
 	for {
-		line, err := prompt(msg)
+		line, err := prompt(msg, in)
 		if err != nil {
 			return 0, err
 		}
@@ -45,9 +88,9 @@ func promptSelection(msg string, min int, max int) (int, error) {
 	}
 }
 
-func promptTime(msg string) (time.Time, error) {
+func promptTime(msg string, in input) (time.Time, error) {
 	for {
-		line, err := prompt(msg)
+		line, err := prompt(msg, in)
 		if err != nil {
 			return time.Time{}, err
 		}
@@ -65,9 +108,9 @@ func promptTime(msg string) (time.Time, error) {
 	}
 }
 
-func promptString(msg string) (string, error) {
+func promptString(msg string, in input) (string, error) {
 	for {
-		line, err := prompt(msg)
+		line, err := prompt(msg, in)
 		if err != nil {
 			return "", err
 		}
@@ -82,8 +125,23 @@ func promptString(msg string) (string, error) {
 
 var ioReader *bufio.Reader
 
-func prompt(msg string) (string, error) {
-	fmt.Print(msg)
+// promptOutput receives prompt messages. Prompts are never written to stdout, which carries only command output.
+var promptOutput io.Writer = os.Stderr
+
+func prompt(msg string, in input) (string, error) {
+	if !stdinIsTerminal() {
+		if in.def != "" {
+			return in.def, nil
+		}
+
+		return "", &InputRequiredError{Value: in.name, Flag: in.flag, Env: in.env}
+	}
+
+	if in.def != "" {
+		msg += "[" + in.def + "] "
+	}
+
+	fmt.Fprint(promptOutput, msg)
 
 	if ioReader == nil {
 		ioReader = bufio.NewReader(os.Stdin)
@@ -96,5 +154,28 @@ func prompt(msg string) (string, error) {
 
 	input = strings.TrimSpace(input)
 
+	if input == "" {
+		return in.def, nil
+	}
+
 	return input, nil
 }
+
+// promptSecret is prompt without echoing the answer.
+func promptSecret(msg string, in input) (string, error) {
+	if !stdinIsTerminal() {
+		return "", &InputRequiredError{Value: in.name, Flag: in.flag, Env: in.env}
+	}
+
+	fmt.Fprint(promptOutput, msg)
+
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+
+	fmt.Fprintln(promptOutput)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
@@ -3,17 +3,25 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"maps"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/csnewman/team-cli/internal/output"
 	"github.com/csnewman/team-cli/internal/team"
+	"github.com/csnewman/team-cli/internal/transport"
 	"github.com/spf13/cobra"
 )
 
 var ErrInvalid = errors.New("invalid")
 
+// maxClockSkew is how far the local clock may be off the server's before the user is told to fix it.
+const maxClockSkew = 5 * time.Minute
+
 func requestCmdRun(cmd *cobra.Command, args []string) error {
 	account, err := cmd.Flags().GetString("account")
 	if err != nil {
@@ -50,7 +58,24 @@ func requestCmdRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("confirm flag: %w", err)
 	}
 
-	cfg, err := readConfigReAuth(cmd.Context())
+	filter, err := accountFilterFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	summary, err := cmd.Flags().GetString("summary")
+	if err != nil {
+		return fmt.Errorf("summary flag: %w", err)
+	}
+
+	if err := checkSummary(cmd, summary); err != nil {
+		return err
+	}
+
+	// stdout carries only the new request ID, so everything else is shown on stderr.
+	info := cmd.ErrOrStderr()
+
+	cfg, err := resolveConfig(cmd)
 	if err != nil {
 		return fmt.Errorf("could not read config and authenticate: %w", err)
 	}
@@ -60,22 +85,19 @@ func requestCmdRun(cmd *cobra.Command, args []string) error {
 		selectedRole    *team.Role
 	)
 
-	// If account & role are pre-provided, try the cache first
-	if account != "" && role != "" {
-		cache, ok, err := getAccountsCache()
+	// If account & role are pre-provided, try the cache first. The cache belongs to the stored config, so it is not
+	// used for a server given with --server or the environment.
+	if account != "" && role != "" && cfg.persistent() {
+		cache, ok, err := getAccountsCache(cfg.ProfileName, accountsCacheMaxAge)
 		if err != nil {
 			return fmt.Errorf("could not get accounts cache: %w", err)
 		}
 
 		if ok {
-			for _, acc := range cache.Accounts {
-				if !strings.EqualFold(acc.ID, account) && !strings.EqualFold(acc.Name, account) {
-					continue
-				}
-
-				selectedAccount = acc
+			selectedAccount = findAccount(cfg, cache.Accounts, account)
 
-				for _, perm := range acc.Roles {
+			if selectedAccount != nil {
+				for _, perm := range selectedAccount.Roles {
 					if !strings.EqualFold(perm.ID, role) && !strings.EqualFold(perm.Name, role) {
 						continue
 					}
@@ -84,60 +106,70 @@ func requestCmdRun(cmd *cobra.Command, args []string) error {
 
 					break
 				}
-
-				break
 			}
 		}
 	}
 
 	if selectedAccount != nil && selectedRole != nil {
-		fmt.Println()
-		fmt.Println("AWS account & role found in cache")
-		fmt.Println()
+		fmt.Fprintln(info)
+		fmt.Fprintln(info, "AWS account & role found in cache")
+		fmt.Fprintln(info)
 	} else {
-		fmt.Println()
-		fmt.Println("Fetching AWS accounts")
-		accounts, err := team.FetchAccounts(cmd.Context(), cfg.ServerConfig, cfg.AuthToken)
+		fmt.Fprintln(info)
+		fmt.Fprintln(info, "Fetching AWS accounts")
+		ctx, stopSpinner := startSpinner(cmd, "fetching accounts")
+		accounts, err := retryUnauthorized(cmd, cfg, func() (map[string]*team.Account, error) {
+			return team.FetchAccounts(ctx, cfg.ServerConfig, cfg.AuthToken)
+		})
+		stopSpinner()
+
 		if err != nil {
 			return fmt.Errorf("could not fetch accounts: %w", err)
 		}
 
-		if err := cacheAccounts(accounts); err != nil {
-			return fmt.Errorf("could not cache accounts: %w", err)
+		if cfg.persistent() {
+			if err := cacheAccounts(cfg.ProfileName, accounts); err != nil {
+				return fmt.Errorf("could not cache accounts: %w", err)
+			}
+		}
+
+		// Filters only narrow the interactive picker; an explicit --account is always honoured.
+		pickable := accounts
+
+		if account == "" {
+			pickable = filter.Apply(accounts)
 		}
 
-		sorted := slices.SortedFunc(maps.Values(accounts), func(a *team.Account, b *team.Account) int {
+		sorted := slices.SortedFunc(maps.Values(pickable), func(a *team.Account, b *team.Account) int {
 			return strings.Compare(a.Name, b.Name)
 		})
 
 		// Select account
 		if len(sorted) == 0 {
+			if len(accounts) > 0 {
+				return fmt.Errorf("%w: no accounts match the given filters", ErrInvalid)
+			}
+
 			return fmt.Errorf("%w: no accounts found", ErrInvalid)
 		}
 
 		if account == "" {
-			fmt.Println()
-			fmt.Println("Please select the account:")
+			fmt.Fprintln(info)
+			fmt.Fprintln(info, "Please select the account:")
 			for i, acc := range sorted {
-				fmt.Printf("  [%d] id=%q name=%q\n", i+1, acc.ID, acc.Name)
+				fmt.Fprintf(info, "  [%d] id=%q name=%q\n", i+1, acc.ID, acc.Name)
 			}
 
-			fmt.Println()
+			fmt.Fprintln(info)
 
-			idx, err := promptSelection("Account option? ", 1, len(sorted))
+			idx, err := promptSelection("Account option? ", 1, len(sorted), input{name: "account", flag: "--account"})
 			if err != nil {
 				return fmt.Errorf("could not select account: %w", err)
 			}
 
 			selectedAccount = sorted[idx-1]
 		} else {
-			for _, acc := range accounts {
-				if strings.EqualFold(acc.ID, account) || strings.EqualFold(acc.Name, account) {
-					selectedAccount = acc
-
-					break
-				}
-			}
+			selectedAccount = findAccount(cfg, accounts, account)
 
 			if selectedAccount == nil {
 				return fmt.Errorf("%w: account %q not found", ErrInvalid, account)
@@ -150,21 +182,22 @@ func requestCmdRun(cmd *cobra.Command, args []string) error {
 		})
 
 		if role == "" {
-			fmt.Println()
-			fmt.Println("Please select the role:")
+			fmt.Fprintln(info)
+			fmt.Fprintln(info, "Please select the role:")
 			for i, r := range allowedRoles {
-				fmt.Printf(
-					"  [%d] name=%q max_duration_with_approval=%d max_duration_without_approval=%d\n",
+				fmt.Fprintf(
+					info,
+					"  [%d] name=%q max_duration_with_approval=%s max_duration_without_approval=%s\n",
 					i+1,
 					r.Name,
-					r.MaxDurApproval,
-					r.MaxDurNoApproval,
+					team.FormatDuration(team.Hours(r.MaxDurApproval)),
+					team.FormatDuration(team.Hours(r.MaxDurNoApproval)),
 				)
 			}
 
-			fmt.Println()
+			fmt.Fprintln(info)
 
-			idx, err := promptSelection("Role option? ", 1, len(sorted))
+			idx, err := promptSelection("Role option? ", 1, len(allowedRoles), input{name: "role", flag: "--role"})
 			if err != nil {
 				return fmt.Errorf("could not select role: %w", err)
 			}
@@ -185,24 +218,45 @@ func requestCmdRun(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	defaults := cfg.defaults()
+
 	var startTime time.Time
 
 	if start == "" {
-		startTime, err = promptTime("Start time (e.g. 2006-01-02 15:04:05)? [now] ")
+		startInput := input{name: "start time", flag: "--start", def: defaults.Start}
+		startMsg := "Start time (e.g. 2006-01-02 15:04:05)? "
+
+		if defaults.Start == "" {
+			startMsg += "[now] "
+		} else if _, err := parseStart(defaults.Start); err != nil {
+			return fmt.Errorf("%w: default start of profile: %w", ErrInvalidConfig, err)
+		}
+
+		startTime, err = promptTime(startMsg, startInput)
 		if err != nil {
 			return fmt.Errorf("could not select time: %w", err)
 		}
-	} else if !strings.EqualFold(start, "now") {
-		startTime, err = time.ParseInLocation(time.DateTime, start, time.Local)
+	} else {
+		startTime, err = parseStart(start)
 		if err != nil {
 			return fmt.Errorf("could not parse start time: %w", err)
 		}
 	}
 
 	if duration == 0 {
+		durationInput := input{name: "duration", flag: "--duration"}
+
+		if defaults.Duration >= 1 && defaults.Duration <= selectedRole.MaxDurApproval {
+			durationInput.def = strconv.Itoa(defaults.Duration)
+		} else if defaults.Duration != 0 {
+			slog.Warn("Ignoring default duration beyond the maximum of the role",
+				"duration", defaults.Duration, "max", selectedRole.MaxDurApproval)
+		}
+
 		duration, err = promptSelection(
 			fmt.Sprintf("Duration (1-%d hours)? ", selectedRole.MaxDurApproval),
 			1, selectedRole.MaxDurApproval,
+			durationInput,
 		)
 		if err != nil {
 			return fmt.Errorf("could not select duration: %w", err)
@@ -213,7 +267,7 @@ func requestCmdRun(cmd *cobra.Command, args []string) error {
 
 	if ticket == "" {
 		for {
-			ticket, err = promptString("Ticket: ")
+			ticket, err = promptString("Ticket: ", input{name: "ticket", flag: "--ticket"})
 			if err != nil {
 				return fmt.Errorf("could not select ticket: %w", err)
 			}
@@ -222,40 +276,54 @@ func requestCmdRun(cmd *cobra.Command, args []string) error {
 				break
 			}
 
-			fmt.Println("Ticket format is not valid")
+			fmt.Fprintln(info, "Ticket format is not valid")
 		}
 	} else if !team.TicketRegex.MatchString(ticket) {
 		return fmt.Errorf("%w: ticket format is no valid", ErrInvalid)
 	}
 
 	if reason == "" {
-		reason, err = promptString("Justification: ")
+		reasonMsg := "Justification: "
+
+		if defaults.JustificationPrefix != "" {
+			reasonMsg = fmt.Sprintf("Justification (prefixed with %q): ", defaults.JustificationPrefix)
+		}
+
+		reason, err = promptString(reasonMsg, input{name: "justification", flag: "--reason"})
 		if err != nil {
 			return fmt.Errorf("could not select justification: %w", err)
 		}
 	}
 
-	fmt.Println("")
-	fmt.Println("Details:")
-	fmt.Printf("  Account: id=%q name=%q\n", selectedAccount.ID, selectedAccount.Name)
-	fmt.Printf("  Role: name=%q\n", selectedRole.Name)
+	reason = prefixJustification(defaults.JustificationPrefix, reason)
+
+	if skew, ok := transport.ClockSkew(); ok {
+		if warning := clockSkewWarning(skew); warning != "" {
+			fmt.Fprintln(info, warning)
+		}
+	}
+
+	fmt.Fprintln(info, "")
+	fmt.Fprintln(info, "Details:")
+	fmt.Fprintf(info, "  Account: id=%q name=%q\n", selectedAccount.ID, selectedAccount.Name)
+	fmt.Fprintf(info, "  Role: name=%q\n", selectedRole.Name)
 
 	if startTime.IsZero() {
-		fmt.Println("  Start: now")
+		fmt.Fprintln(info, "  Start: now")
 	} else {
-		fmt.Printf("  Start: %q\n", startTime)
+		fmt.Fprintf(info, "  Start: %q\n", fmtDate(startTime))
 	}
 
-	fmt.Printf("  Duration: %v\n", duration)
-	fmt.Printf("  Requires approval: %v\n", duration > selectedRole.MaxDurNoApproval)
+	fmt.Fprintf(info, "  Duration: %s\n", team.FormatDuration(team.Hours(duration)))
+	fmt.Fprintf(info, "  Requires approval: %v\n", duration > selectedRole.MaxDurNoApproval)
 
-	fmt.Printf("  Ticket: %q\n", ticket)
-	fmt.Printf("  Justification: %q\n", reason)
+	fmt.Fprintf(info, "  Ticket: %q\n", ticket)
+	fmt.Fprintf(info, "  Justification: %q\n", reason)
 
-	fmt.Println()
+	fmt.Fprintln(info)
 
 	if !autoConfirm {
-		cont, err := promptBool("Confirm (y/n)? ")
+		cont, err := promptBool("Confirm (y/n)? ", input{name: "confirmation", flag: "--confirm"})
 		if err != nil {
 			return fmt.Errorf("could not select confirmation: %w", err)
 		}
@@ -265,7 +333,7 @@ func requestCmdRun(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	id, err := team.Request(cmd.Context(), cfg.ServerConfig, cfg.AuthToken, &team.AccessRequest{
+	accReq := &team.AccessRequest{
 		AccountID:     selectedAccount.ID,
 		AccountName:   selectedAccount.Name,
 		Role:          selectedRole.Name,
@@ -274,13 +342,148 @@ func requestCmdRun(cmd *cobra.Command, args []string) error {
 		StartTime:     startTime,
 		Justification: reason,
 		Ticket:        ticket,
+	}
+
+	id, err := retryUnauthorized(cmd, cfg, func() (string, error) {
+		return team.Request(cmd.Context(), cfg.ServerConfig, cfg.AuthToken, accReq)
 	})
 	if err != nil {
 		return fmt.Errorf("could not request role: %w", err)
 	}
 
-	fmt.Println("Request submitted")
-	fmt.Printf("Request ID: %s\n", id)
+	fmt.Fprintln(info, "Request submitted")
+
+	recordHistory(cfg, &historyEntry{
+		Action:    historyRequest,
+		Server:    cfg.ServerConfig.Server,
+		RequestID: id,
+		AccountID: accReq.AccountID,
+		Role:      accReq.Role,
+	})
+
+	if err := render(cmd, &requestResult{ID: id}); err != nil {
+		return err
+	}
+
+	if summary == "markdown" {
+		writeMarkdownSummary(cmd.OutOrStdout(), cfg.ServerConfig, id, accReq)
+	}
 
 	return nil
 }
+
+// checkSummary rejects a --summary that cannot be printed alongside the requested output. The summary follows the
+// table output, so a structured output the profile defaults to is overridden, as flags win over config defaults.
+func checkSummary(cmd *cobra.Command, summary string) error {
+	if summary == "" {
+		return nil
+	}
+
+	if summary != "markdown" {
+		return fmt.Errorf("%w: unknown summary format %q, expected: markdown", ErrUsage, summary)
+	}
+
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	quiet, err := quietMode(cmd)
+	if err != nil {
+		return err
+	}
+
+	if quiet || (cmd.Flags().Changed("output") && format.IsStructured()) || cmd.Flags().Changed("format") {
+		return fmt.Errorf("%w: --summary cannot be combined with --quiet, --output or --format", ErrUsage)
+	}
+
+	if err := cmd.Flags().Set("output", string(output.FormatTable)); err != nil {
+		return fmt.Errorf("output flag: %w", err)
+	}
+
+	return nil
+}
+
+// parseStart parses a start time given as "now", which is returned as the zero time, or as 2006-01-02 15:04:05.
+func parseStart(start string) (time.Time, error) {
+	if strings.EqualFold(start, "now") {
+		return time.Time{}, nil
+	}
+
+	return time.ParseInLocation(time.DateTime, start, time.Local)
+}
+
+// prefixJustification prepends the justification prefix of the profile, unless reason already starts with it.
+func prefixJustification(prefix string, reason string) string {
+	prefix = strings.TrimSpace(prefix)
+
+	if prefix == "" || strings.HasPrefix(reason, prefix) {
+		return reason
+	}
+
+	return prefix + " " + reason
+}
+
+// writeMarkdownSummary prints a block suitable for pasting into a change ticket as evidence of the request.
+func writeMarkdownSummary(w io.Writer, remote *team.RemoteConfig, id string, req *team.AccessRequest) {
+	start := "immediately"
+
+	if !req.StartTime.IsZero() {
+		start = fmtDate(req.StartTime)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "### AWS TEAM access request")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Field | Value |")
+	fmt.Fprintln(w, "|---|---|")
+	fmt.Fprintf(w, "| Request ID | `%s` |\n", id)
+	fmt.Fprintf(w, "| Account | %s (`%s`) |\n", markdownCell(req.AccountName), req.AccountID)
+	fmt.Fprintf(w, "| Role | %s |\n", markdownCell(req.Role))
+	fmt.Fprintf(w, "| Duration | %s |\n", team.FormatDuration(team.Hours(req.Duration)))
+	fmt.Fprintf(w, "| Start | %s |\n", start)
+	fmt.Fprintf(w, "| Ticket | %s |\n", markdownCell(req.Ticket))
+	fmt.Fprintf(w, "| Justification | %s |\n", markdownCell(req.Justification))
+
+	if remote != nil {
+		if app := remote.AppURL(); app != "" {
+			fmt.Fprintf(w, "| TEAM | %s |\n", app)
+		}
+	}
+}
+
+// markdownCell escapes text for use inside a markdown table cell.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\r\n", " ", "\n", " ").Replace(s)
+}
+
+type requestResult struct {
+	ID string `json:"id"`
+}
+
+func (r *requestResult) IDs() []string {
+	return []string{r.ID}
+}
+
+func (r *requestResult) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Request ID: %s\n", r.ID)
+
+	return nil
+}
+
+// clockSkewWarning returns a warning for a local clock that is further than maxClockSkew off the server's, given how
+// far the server is ahead, or nothing when the clock is close enough.
+func clockSkewWarning(skew time.Duration) string {
+	if skew.Abs() <= maxClockSkew {
+		return ""
+	}
+
+	direction := "behind"
+	if skew < 0 {
+		direction = "ahead of"
+	}
+
+	return fmt.Sprintf("Warning: the local clock is %s %s the server's. Requests starting now use the server's "+
+		"time, but explicit start times are taken as given, so fix the system clock.",
+		skew.Abs().Round(time.Second), direction)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockSkewWarning(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, clockSkewWarning(0))
+	require.Empty(t, clockSkewWarning(-maxClockSkew))
+	require.Contains(t, clockSkewWarning(10*time.Minute+300*time.Millisecond), "10m0s behind the server's")
+	require.Contains(t, clockSkewWarning(-6*time.Minute), "6m0s ahead of the server's")
+}
+
+func TestWriteMarkdownSummary(t *testing.T) {
+	t.Parallel()
+
+	req := &team.AccessRequest{
+		AccountID:     "123456789012",
+		AccountName:   "payments",
+		Role:          "Admin",
+		Duration:      2,
+		Justification: "fix | prod\nincident",
+		Ticket:        "INC-1",
+	}
+
+	remote := &team.RemoteConfig{
+		Server:       "http://team.example.com",
+		RedirectURIs: []string{"http://localhost:43672/", "https://team.example.com/"},
+	}
+
+	var buf bytes.Buffer
+
+	writeMarkdownSummary(&buf, remote, "req-1", req)
+	require.Contains(t, buf.String(), "| Request ID | `req-1` |\n")
+	require.Contains(t, buf.String(), "| Account | payments (`123456789012`) |\n")
+	require.Contains(t, buf.String(), "| Start | immediately |\n")
+	require.Contains(t, buf.String(), "| Justification | fix \\| prod incident |\n")
+	require.Contains(t, buf.String(), "| TEAM | https://team.example.com/ |\n")
+
+	// Without a known address, no link is given.
+	buf.Reset()
+	writeMarkdownSummary(&buf, &team.RemoteConfig{}, "req-1", req)
+	require.NotContains(t, buf.String(), "| TEAM |")
+}
+
+func TestCheckSummary(t *testing.T) {
+	cfg := fixtureConfig()
+	cfg.Defaults = &ProfileDefaults{Output: "json"}
+
+	startupConfig = cfg
+	t.Cleanup(func() { startupConfig = nil })
+
+	check := func(args ...string) (*cobra.Command, error) {
+		cmd, _, err := newRootCmd().Find([]string{"request"})
+		require.NoError(t, err)
+		require.NoError(t, cmd.ParseFlags(args))
+
+		summary, err := cmd.Flags().GetString("summary")
+		require.NoError(t, err)
+
+		return cmd, checkSummary(cmd, summary)
+	}
+
+	// The JSON output the profile defaults to gives way to the table the summary follows.
+	cmd, err := check("--summary", "markdown")
+	require.NoError(t, err)
+
+	format, err := outputFormat(cmd)
+	require.NoError(t, err)
+	require.Equal(t, output.FormatTable, format)
+
+	_, err = check("--summary", "markdown", "-o", "table")
+	require.NoError(t, err)
+
+	for _, args := range [][]string{
+		{"--summary", "markdown", "-o", "json"},
+		{"--summary", "markdown", "--quiet"},
+		{"--summary", "markdown", "--format", "{{.ID}}"},
+	} {
+		_, err := check(args...)
+		require.ErrorIs(t, err, ErrUsage, args)
+	}
+
+	_, err = check("--summary", "html")
+	require.ErrorContains(t, err, `unknown summary format "html"`)
+}
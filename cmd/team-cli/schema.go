@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// outputSchemas maps each command with structured output to a value of its output type. It must be kept in sync
+// with the values the commands pass to render.
+var outputSchemas = map[string]any{
+	"alias list":    aliasList{},
+	"config show":   &configView{},
+	"error":         &errorView{},
+	"get":           fieldValue{},
+	"history":       historyList{},
+	"list-accounts": accountList{},
+	"profile list":  profileList{},
+	"request":       &requestResult{},
+	"whoami":        &whoamiView{},
+}
+
+func schemaCmdRun(cmd *cobra.Command, args []string) error {
+	name := strings.Join(args, " ")
+
+	v, ok := outputSchemas[name]
+	if !ok {
+		return fmt.Errorf(
+			"%w: %q has no structured output, expected one of: %s",
+			ErrUsage,
+			name,
+			strings.Join(slices.Sorted(maps.Keys(outputSchemas)), ", "),
+		)
+	}
+
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(output.Schema(name, v)); err != nil {
+		return fmt.Errorf("could not encode schema: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+var updateSchema = flag.Bool("update-schema", false, "record the output schemas for a new schema version")
+
+// TestSchemaVersion fails whenever an output struct changes shape without output.SchemaVersion being bumped. Each
+// version's schemas are recorded once and never rewritten, so after bumping the version run
+// go test ./cmd/team-cli -run TestSchemaVersion -update-schema to record the new one.
+func TestSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	schemas := make(map[string]any, len(outputSchemas))
+
+	for name, v := range outputSchemas {
+		schemas[name] = output.Schema(name, v)
+	}
+
+	got, err := json.MarshalIndent(schemas, "", "  ")
+	require.NoError(t, err)
+
+	path := filepath.Join("testdata", "schema", fmt.Sprintf("v%d.json", output.SchemaVersion))
+
+	want, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && *updateSchema {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, append(got, '\n'), 0644))
+
+		return
+	}
+
+	require.NoError(t, err, "no schemas recorded for version %d, run with -update-schema", output.SchemaVersion)
+	require.JSONEq(
+		t,
+		string(want),
+		string(got),
+		"output structs changed shape: bump output.SchemaVersion and record the new schemas with -update-schema",
+	)
+}
+
+func TestSchemaCmd(t *testing.T) {
+	isolateConfig(t)
+
+	stdout, _, err := executeCmd(t, "schema", "list-accounts")
+	require.NoError(t, err)
+
+	var schema map[string]any
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &schema))
+	require.Equal(t, "list-accounts", schema["title"])
+
+	_, _, err = executeCmd(t, "schema", "approve")
+	require.ErrorIs(t, err, ErrUsage)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// passphraseEnvVar supplies the passphrase of encrypted secrets without prompting.
+const passphraseEnvVar = "TEAM_CLI_PASSPHRASE"
+
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+const (
+	secretsKDF    = "argon2id"
+	secretsCipher = "xchacha20-poly1305"
+)
+
+// defaultKDFParams are used for newly encrypted files. Files record the parameters they were written with, so these
+// can be raised without breaking existing files.
+var defaultKDFParams = kdfParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+type kdfParams struct {
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+func (p kdfParams) equal(other kdfParams) bool {
+	return bytes.Equal(p.Salt, other.Salt) &&
+		p.Time == other.Time &&
+		p.Memory == other.Memory &&
+		p.Threads == other.Threads
+}
+
+// sealedSecrets is the credentials file when encrypt_secrets is set: the plain credentials file, encrypted with a key
+// derived from the passphrase.
+type sealedSecrets struct {
+	KDF string `json:"kdf"`
+	kdfParams
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// secretsKey is the last key derived in this invocation. Deriving a key is deliberately slow, and the config is read
+// and written several times per invocation, so the key, and the salt it was derived with, are reused.
+var secretsKey struct {
+	sync.Mutex
+
+	passphrase string
+	params     kdfParams
+	key        []byte
+}
+
+func deriveSecretsKey(passphrase string, params kdfParams) []byte {
+	secretsKey.Lock()
+	defer secretsKey.Unlock()
+
+	if secretsKey.key != nil && secretsKey.passphrase == passphrase && secretsKey.params.equal(params) {
+		return secretsKey.key
+	}
+
+	key := argon2.IDKey([]byte(passphrase), params.Salt, params.Time, params.Memory, params.Threads,
+		chacha20poly1305.KeySize)
+
+	secretsKey.passphrase, secretsKey.params, secretsKey.key = passphrase, params, key
+
+	return key
+}
+
+// knownPassphrase returns the passphrase of this invocation without prompting, along with the parameters a key was
+// last derived from it with: TEAM_CLI_PASSPHRASE, or the passphrase entered earlier.
+func knownPassphrase() (string, kdfParams, bool) {
+	secretsKey.Lock()
+	defer secretsKey.Unlock()
+
+	if passphrase := os.Getenv(passphraseEnvVar); passphrase != "" {
+		if passphrase == secretsKey.passphrase {
+			return passphrase, secretsKey.params, true
+		}
+
+		return passphrase, kdfParams{}, true
+	}
+
+	return secretsKey.passphrase, secretsKey.params, secretsKey.key != nil
+}
+
+// secretsPassphrase prompts for the passphrase. When confirm is set, as when secrets are first encrypted, it has to be
+// entered twice.
+func secretsPassphrase(confirm bool) (string, error) {
+	in := input{name: "passphrase for the stored secrets", env: passphraseEnvVar}
+
+	passphrase, err := promptSecret("Passphrase for stored secrets: ", in)
+	if err != nil {
+		return "", err
+	}
+
+	if passphrase == "" {
+		return "", fmt.Errorf("%w: the passphrase must not be empty", ErrUsage)
+	}
+
+	if confirm {
+		again, err := promptSecret("Repeat passphrase: ", in)
+		if err != nil {
+			return "", err
+		}
+
+		if again != passphrase {
+			return "", fmt.Errorf("%w: passphrases do not match", ErrUsage)
+		}
+	}
+
+	return passphrase, nil
+}
+
+// sealSecrets encrypts plaintext with a fresh nonce. The passphrase of this invocation is reused when there is one.
+func sealSecrets(plaintext []byte) (*sealedSecrets, error) {
+	passphrase, params, ok := knownPassphrase()
+	if !ok {
+		var err error
+
+		passphrase, err = secretsPassphrase(true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if params.Salt == nil {
+		params = defaultKDFParams
+		params.Salt = make([]byte, 16)
+
+		if _, err := rand.Read(params.Salt); err != nil {
+			return nil, fmt.Errorf("could not generate salt: %w", err)
+		}
+	}
+
+	aead, err := chacha20poly1305.NewX(deriveSecretsKey(passphrase, params))
+	if err != nil {
+		return nil, fmt.Errorf("could not create cipher: %w", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	return &sealedSecrets{
+		KDF:        secretsKDF,
+		kdfParams:  params,
+		Cipher:     secretsCipher,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	}, nil
+}
+
+// open decrypts the secrets kept in location, asking for the passphrase if needed.
+func (s *sealedSecrets) open(location string) ([]byte, error) {
+	if s.KDF != secretsKDF || s.Cipher != secretsCipher {
+		return nil, fmt.Errorf(
+			"%w: credentials in %s use unsupported encryption %s/%s", ErrInvalidConfig, location, s.KDF, s.Cipher,
+		)
+	}
+
+	passphrase, _, ok := knownPassphrase()
+	if !ok {
+		var err error
+
+		passphrase, err = secretsPassphrase(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	aead, err := chacha20poly1305.NewX(deriveSecretsKey(passphrase, s.kdfParams))
+	if err != nil {
+		return nil, fmt.Errorf("could not create cipher: %w", err)
+	}
+
+	if len(s.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: credentials in %s have an invalid nonce", ErrInvalidConfig, location)
+	}
+
+	plaintext, err := aead.Open(nil, s.Nonce, s.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not decrypt credentials in %s", ErrWrongPassphrase, location)
+	}
+
+	return plaintext, nil
+}
+
+func configMigrateSecretsCmdRun(cmd *cobra.Command, _ []string) error {
+	decrypt, err := cmd.Flags().GetBool("decrypt")
+	if err != nil {
+		return fmt.Errorf("decrypt flag: %w", err)
+	}
+
+	path, err := configFilePath()
+	if err != nil {
+		return fmt.Errorf("failed to get config path: %w", err)
+	}
+
+	store, err := credentialStoreFor(path)
+	if err != nil {
+		return err
+	}
+
+	// The credentials are always rewritten, so a file left in the other form by hand edits is converted too.
+	_, err = updateConfig(cmd.Context(), func(cfg *Config) (bool, error) {
+		cfg.EncryptSecrets = !decrypt
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if decrypt {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Secrets in %s are stored in plain text\n", store)
+	} else {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Secrets in %s are encrypted\n", store)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedSecrets(t *testing.T) {
+	path := writeProfiles(t)
+	credsPath := credentialsPath(path)
+
+	t.Setenv(passphraseEnvVar, "correct horse")
+
+	_, _, err := executeCmd(t, "config", "migrate-secrets")
+	require.NoError(t, err)
+
+	raw, err := os.ReadFile(credsPath)
+	require.NoError(t, err)
+	require.Contains(t, string(raw), `"encrypted"`)
+	require.NotContains(t, string(raw), "refresh")
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+	require.True(t, cfg.EncryptSecrets)
+	require.Equal(t, "refresh", cfg.AuthToken.RefreshToken)
+
+	// Every write uses a fresh nonce.
+	_, _, err = executeCmd(t, "alias", "set", "db", "database")
+	require.NoError(t, err)
+
+	rewritten, err := os.ReadFile(credsPath)
+	require.NoError(t, err)
+	require.NotEqual(t, string(raw), string(rewritten))
+
+	t.Setenv(passphraseEnvVar, "wrong")
+
+	_, err = readConfig()
+	require.ErrorIs(t, err, ErrWrongPassphrase)
+	require.Equal(t, ExitAuth, exitCode(err))
+
+	// Without the passphrase and without a terminal, there is no way to ask for it.
+	t.Setenv(passphraseEnvVar, "")
+	forgetPassphrase()
+
+	_, err = readConfig()
+
+	var inputErr *InputRequiredError
+
+	require.ErrorAs(t, err, &inputErr)
+	require.ErrorContains(t, err, "set "+passphraseEnvVar)
+
+	t.Setenv(passphraseEnvVar, "correct horse")
+
+	_, _, err = executeCmd(t, "config", "migrate-secrets", "--decrypt")
+	require.NoError(t, err)
+
+	raw, err = os.ReadFile(credsPath)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), `"encrypted"`)
+	require.Contains(t, string(raw), "refresh")
+}
+
+// forgetPassphrase drops the passphrase of this invocation, as a new invocation would.
+func forgetPassphrase() {
+	secretsKey.Lock()
+	defer secretsKey.Unlock()
+
+	secretsKey.passphrase, secretsKey.params, secretsKey.key = "", kdfParams{}, nil
+}
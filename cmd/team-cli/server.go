@@ -0,0 +1,201 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/spf13/cobra"
+)
+
+// resolveConfig returns the config a command talks to the server with, warning when its token is about to expire.
+func resolveConfig(cmd *cobra.Command) (*Config, error) {
+	cfg, err := resolveServerConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	warnTokenExpiry(cmd, cfg)
+
+	return cfg, nil
+}
+
+// retryUnauthorized runs op, which talks to the server with cfg. If the server rejects the token, which it may do
+// before the token expires, for example once it has been revoked, the token is renewed as if it had expired, cfg is
+// updated to hold it, and op is run once more.
+func retryUnauthorized[T any](cmd *cobra.Command, cfg *Config, op func() (T, error)) (T, error) {
+	res, err := op()
+	if !errors.Is(err, gql.ErrUnauthorized) || cfg.AuthToken == nil {
+		return res, err
+	}
+
+	slog.Info("Server rejected the auth token, renewing it", "err", err)
+
+	if expireErr := expireToken(cmd.Context(), cfg.AuthToken); expireErr != nil {
+		slog.Debug("Could not mark the stored auth token as expired", "err", expireErr)
+	}
+
+	renewed, renewErr := resolveServerConfig(cmd)
+	if renewErr != nil {
+		return res, fmt.Errorf("%w (renewing the token failed: %w)", err, renewErr)
+	}
+
+	// A token from the environment, or one that could not be replaced, would only be rejected again.
+	if renewed.AuthToken == nil || renewed.AuthToken.AccessToken == cfg.AuthToken.AccessToken {
+		return res, err
+	}
+
+	*cfg = *renewed
+
+	return op()
+}
+
+// expireToken marks the token stored in the selected profile as expired if it is still rejected, so that reading the
+// config renews it. Another process may already have replaced it.
+func expireToken(ctx context.Context, rejected *team.AuthToken) error {
+	_, err := updateConfig(ctx, func(cfg *Config) (bool, error) {
+		if cfg.AuthToken == nil || cfg.AuthToken.AccessToken != rejected.AccessToken {
+			return false, nil
+		}
+
+		cfg.AuthToken.ExpiresAt = time.Time{}
+
+		return true, nil
+	})
+
+	return err
+}
+
+// resolveServerConfig selects the server given with --server, then a server and token from the environment, then the
+// selected profile. A usable token is obtained in each case, unless the profile is authorized without a login, in
+// which case the server config is given the authorizer to use instead.
+func resolveServerConfig(cmd *cobra.Command) (*Config, error) {
+	cfg, err := resolveServer(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cfg.Profile == nil || cfg.ServerConfig == nil:
+	case cfg.AuthMode == authModeIAM:
+		// The AWS config is loaded once, so that credentials from single sign-on or a role are cached between requests.
+		awsCfg, err := config.LoadDefaultConfig(cmd.Context())
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not load the AWS config: %w", ErrAuth, err)
+		}
+
+		cfg.ServerConfig.Authorizer = gql.IAMAuth{Config: &awsCfg}
+	case cfg.AuthMode == authModeAPIKey:
+		key := cmp.Or(os.Getenv(envAPIKey), cfg.APIKey)
+		if key == "" {
+			return nil, fmt.Errorf("%w: profile %q needs an api_key, or %s to be set", ErrAuth, cfg.ProfileName, envAPIKey)
+		}
+
+		cfg.ServerConfig.Authorizer = gql.APIKeyAuth{Key: key}
+	}
+
+	return cfg, nil
+}
+
+func resolveServer(cmd *cobra.Command) (*Config, error) {
+	server, err := cmd.Flags().GetString("server")
+	if err != nil {
+		return nil, fmt.Errorf("server flag: %w", err)
+	}
+
+	if server == "" {
+		return readConfigReAuth(cmd.Context())
+	}
+
+	save, err := cmd.Flags().GetBool("save")
+	if err != nil {
+		return nil, fmt.Errorf("save flag: %w", err)
+	}
+
+	return serverConfig(cmd, server, save)
+}
+
+// serverConfig builds a config for a server that is not stored in any profile. The login settings of the selected
+// profile are used to authenticate, and the token is only kept in memory unless save is set, in which case the
+// server and token are stored in the selected profile.
+func serverConfig(cmd *cobra.Command, server string, save bool) (*Config, error) {
+	ctx := cmd.Context()
+
+	stored, err := readConfigOrEmpty()
+	if err != nil {
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+
+	// Saving into a profile that was picked implicitly would silently replace the server it is set up for.
+	if save && stored.hasProfile(stored.ProfileName) && !profileSelectedExplicitly(stored.ProfileName) {
+		return nil, fmt.Errorf(
+			"%w: --save would replace the server of profile %q, pass --profile to choose the profile to save to",
+			ErrUsage, stored.ProfileName,
+		)
+	}
+
+	spinCtx, stopSpinner := startSpinner(cmd, "fetching server configuration")
+	remote, err := team.ExtractConfig(spinCtx, nil, server)
+	stopSpinner()
+
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the configuration of %s: %w", server, err)
+	}
+
+	slog.Info("Extracted remote configuration", "cfg", remote)
+
+	token := reusableToken(ctx, stored, remote)
+	if token == nil && !stored.withoutLogin() {
+		token, err = fetchToken(ctx, stored, remote)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if save {
+		cfg, err := updateConfig(ctx, func(cfg *Config) (bool, error) {
+			cfg.ServerConfig = remote
+			cfg.AuthToken = token
+
+			if cfg.DefaultProfile == "" && !cfg.hasProfile(defaultProfileName) {
+				cfg.DefaultProfile = cfg.ProfileName
+			}
+
+			return true, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save server: %w", err)
+		}
+
+		fmt.Fprintf(cmd.ErrOrStderr(), "Saved %s to profile %q\n", remote.Server, cfg.ProfileName)
+
+		return cfg, nil
+	}
+
+	cfg := *stored
+	cfg.Profile = &Profile{
+		ServerConfig:  remote,
+		AuthToken:     token,
+		UseDeviceCode: stored.UseDeviceCode,
+		NoBrowser:     stored.NoBrowser,
+		CallbackPort:  stored.CallbackPort,
+		Insecure:      stored.Insecure,
+		Defaults:      stored.Defaults,
+		AuthMode:      stored.AuthMode,
+		APIKey:        stored.APIKey,
+	}
+
+	// Aliases refer to the accounts of the stored server, so they only carry over when it is the same one.
+	if sameServer(stored.ServerConfig, remote) {
+		cfg.Aliases = stored.Aliases
+	}
+
+	return &cfg, nil
+}
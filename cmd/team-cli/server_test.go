@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTEAMServer serves the homepage and JS bundle that configure extracts the server config from.
+func fakeTEAMServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<html><script src="/static/js/main.js"></script></html>`))
+		case "/static/js/main.js":
+			_, _ = w.Write([]byte(`var c={aws_appsync_graphqlEndpoint:"https://api.example.com/graphql",` +
+				`aws_user_pools_web_client_id:"client",oauth:{domain:"auth.example.com",scope:["openid","email"],` +
+				`redirectSignIn:"https://team.example.com/,http://localhost:43672/",responseType:"code"}};`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	trustServer(t, srv)
+
+	return srv
+}
+
+func TestServerConfigInMemory(t *testing.T) {
+	home := isolateConfig(t)
+	path := filepath.Join(home, "config.json")
+	t.Setenv(configEnvVar, path)
+
+	srv := fakeTEAMServer(t)
+
+	stored := fixtureConfig()
+	stored.ServerConfig.Server = srv.URL
+	stored.AuthToken.ExpiresAt = time.Now().Add(time.Hour)
+	stored.Aliases = map[string]string{"pay": "payments"}
+	require.NoError(t, writeConfig(stored))
+
+	before, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	cmd := newRootCmd()
+	cmd.SetContext(t.Context())
+
+	// The stored login is for the same server, so it is reused rather than logging in again.
+	cfg, err := serverConfig(cmd, srv.URL, false)
+	require.NoError(t, err)
+	require.Equal(t, srv.URL, cfg.ServerConfig.Server)
+	require.Equal(t, "https://api.example.com/graphql", cfg.ServerConfig.GraphQLEndpoint)
+	require.Equal(t, []string{"https://team.example.com/", "http://localhost:43672/"}, cfg.ServerConfig.RedirectURIs)
+	require.Equal(t, stored.AuthToken.AccessToken, cfg.AuthToken.AccessToken)
+	require.Equal(t, stored.Aliases, cfg.Aliases)
+	require.False(t, cfg.persistent())
+
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(before), string(after))
+}
+
+func TestServerConfigSave(t *testing.T) {
+	home := isolateConfig(t)
+	t.Setenv(configEnvVar, filepath.Join(home, "config.json"))
+	require.NoError(t, writeConfig(fixtureConfig()))
+
+	_, _, err := executeCmd(t, "list-accounts", "--save")
+	require.ErrorIs(t, err, ErrUsage)
+	require.ErrorContains(t, err, "--save can only be used with --server")
+
+	_, _, err = executeCmd(t, "list-accounts", "--server", "https://staging.example.com", "--save")
+	require.ErrorIs(t, err, ErrUsage)
+	require.ErrorContains(t, err, "pass --profile")
+}
+
+func TestRetryUnauthorized(t *testing.T) {
+	writeProfiles(t)
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+
+	// The stored token looks valid, but the server has revoked it.
+	cfg.CredentialCommand = os.Args[0] + " -test.run=^TestCredentialHelperProcess$"
+	cfg.AuthToken.ExpiresAt = time.Now().Add(time.Hour)
+	require.NoError(t, writeConfig(cfg))
+
+	// The credential command issues the given access token.
+	issue := func(accessToken string) {
+		tokens, err := json.Marshal(map[string]any{
+			"access_token": accessToken,
+			"id_token":     unsignedIDToken(t, map[string]any{"userId": "user"}),
+			"expires_in":   3600,
+		})
+		require.NoError(t, err)
+		t.Setenv(credentialHelperEnvVar, string(tokens))
+	}
+
+	issue("renewed-access")
+
+	cmd, _, err := newRootCmd().Find([]string{"get"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.ParseFlags(nil))
+	cmd.SetContext(t.Context())
+
+	var calls int
+
+	res, err := retryUnauthorized(cmd, cfg, func() (string, error) {
+		calls++
+
+		if cfg.AuthToken.AccessToken != "renewed-access" {
+			return "", fmt.Errorf("failed to execute: %w: status code 401", gql.ErrUnauthorized)
+		}
+
+		return "done", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "done", res)
+	require.Equal(t, 2, calls)
+
+	stored, err := readConfig()
+	require.NoError(t, err)
+	require.Equal(t, "renewed-access", stored.AuthToken.AccessToken)
+
+	// Other errors are returned as they are.
+	calls = 0
+
+	_, err = retryUnauthorized(cmd, cfg, func() (string, error) {
+		calls++
+
+		return "", gql.ErrUnexpected
+	})
+	require.ErrorIs(t, err, gql.ErrUnexpected)
+	require.Equal(t, 1, calls)
+
+	// A renewed token that is rejected as well is tried once, and not renewed again.
+	issue("rejected-access")
+
+	calls = 0
+
+	_, err = retryUnauthorized(cmd, cfg, func() (string, error) {
+		calls++
+
+		return "", gql.ErrUnauthorized
+	})
+	require.ErrorIs(t, err, gql.ErrUnauthorized)
+	require.Equal(t, ErrorKindAuth, classifyError(err))
+	require.Equal(t, 2, calls)
+	require.Equal(t, "rejected-access", cfg.AuthToken.AccessToken)
+
+	// A token that cannot be replaced is not tried again.
+	calls = 0
+
+	_, err = retryUnauthorized(cmd, cfg, func() (string, error) {
+		calls++
+
+		return "", gql.ErrUnauthorized
+	})
+	require.ErrorIs(t, err, gql.ErrUnauthorized)
+	require.Equal(t, 1, calls)
+}
+
+func TestResolveServerConfigIAM(t *testing.T) {
+	home := isolateConfig(t)
+	t.Setenv(configEnvVar, filepath.Join(home, "config.json"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_REGION", "eu-west-1")
+
+	authorization := make(chan string, 1)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case authorization <- r.Header.Get("Authorization"):
+		default:
+		}
+
+		_, _ = w.Write([]byte(`{"data": {"getRequests": null}}`))
+	}))
+	t.Cleanup(api.Close)
+
+	// The profile has no login, and none is attempted: requests are signed with the AWS credentials instead.
+	cfg := fixtureConfig()
+	cfg.AuthToken = nil
+	cfg.AuthMode = authModeIAM
+	cfg.ServerConfig.GraphQLEndpoint = api.URL + "/graphql"
+	require.NoError(t, writeConfig(cfg))
+
+	_, _, err := executeCmd(t, "get", "abc", "status")
+	require.ErrorContains(t, err, `not found: request "abc"`)
+	require.Contains(t, <-authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/")
+
+	// whoami describes a login, which IAM profiles do not have.
+	_, _, err = executeCmd(t, "whoami")
+	require.ErrorIs(t, err, ErrUsage)
+
+	cfg.AuthMode = "sso"
+	require.Contains(t, cfg.validate(), `profiles.default.auth_mode: "sso" is not one of "token", "iam" or "api_key"`)
+}
+
+func TestResolveServerConfigAPIKey(t *testing.T) {
+	home := isolateConfig(t)
+	t.Setenv(configEnvVar, filepath.Join(home, "config.json"))
+
+	apiKey := make(chan string, 1)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case apiKey <- r.Header.Get("x-api-key"):
+		default:
+		}
+
+		_, _ = w.Write([]byte(`{"data": {"getRequests": null}}`))
+	}))
+	t.Cleanup(api.Close)
+
+	cfg := fixtureConfig()
+	cfg.AuthToken = nil
+	cfg.AuthMode = authModeAPIKey
+	cfg.APIKey = "da2-stored"
+	cfg.ServerConfig.GraphQLEndpoint = api.URL + "/graphql"
+	require.NoError(t, writeConfig(cfg))
+
+	// The key is a secret, so it is kept in the credentials file.
+	settings, err := os.ReadFile(filepath.Join(home, "config.json"))
+	require.NoError(t, err)
+	require.NotContains(t, string(settings), "da2-stored")
+
+	secrets, err := os.ReadFile(filepath.Join(home, "credentials.json"))
+	require.NoError(t, err)
+	require.Contains(t, string(secrets), "da2-stored")
+
+	_, _, err = executeCmd(t, "get", "abc", "status")
+	require.ErrorContains(t, err, `not found: request "abc"`)
+	require.Equal(t, "da2-stored", <-apiKey)
+
+	// The environment takes precedence, and with a server from the environment needs no profile at all.
+	t.Setenv(envAPIKey, "da2-env")
+
+	_, _, _ = executeCmd(t, "get", "abc", "status")
+	require.Equal(t, "da2-env", <-apiKey)
+
+	t.Setenv(configEnvVar, filepath.Join(home, "missing.json"))
+	t.Setenv(envGraphQLEndpoint, api.URL+"/graphql")
+
+	_, _, _ = executeCmd(t, "get", "abc", "status")
+	require.Equal(t, "da2-env", <-apiKey)
+}
@@ -0,0 +1,31 @@
+//go:build otel
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/tracing"
+)
+
+// setupTracing starts exporting spans when the OTEL_* environment variables ask for it, and returns the function
+// flushing them. Tracing problems are only warned about, since they must not stop the command.
+func setupTracing() func() {
+	shutdown, err := tracing.Setup(context.Background(), Version)
+	if err != nil {
+		slog.Warn("Tracing is disabled", "err", err)
+
+		return func() {}
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdown(ctx); err != nil {
+			slog.Warn("Could not export traces", "err", err)
+		}
+	}
+}
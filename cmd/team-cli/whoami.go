@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// whoamiView describes who the selected profile is logged in as.
+type whoamiView struct {
+	Profile        string    `json:"profile"`
+	Server         string    `json:"server"`
+	UserID         string    `json:"userId"`
+	Email          string    `json:"email,omitempty"`
+	GroupIDs       []string  `json:"groupIds"`
+	TokenExpiresAt time.Time `json:"tokenExpiresAt"`
+}
+
+func (v *whoamiView) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Profile: %s\n", v.Profile)
+	fmt.Fprintf(w, "Server: %s\n", v.Server)
+	fmt.Fprintf(w, "User ID: %s\n", v.UserID)
+
+	if v.Email != "" {
+		fmt.Fprintf(w, "Email: %s\n", v.Email)
+	}
+
+	fmt.Fprintf(w, "Groups: %s\n", strings.Join(v.GroupIDs, ", "))
+	fmt.Fprintf(w, "Token expires: %s\n", fmtDate(v.TokenExpiresAt))
+
+	return nil
+}
+
+func whoamiCmdRun(cmd *cobra.Command, _ []string) error {
+	cfg, err := readConfigReAuth(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if cfg.withoutLogin() {
+		return fmt.Errorf(
+			"%w: profile %q is authorized by %s, so there is no login to describe", ErrUsage, cfg.ProfileName, cfg.AuthMode,
+		)
+	}
+
+	// The claims are verified, so the identity shown is the one the TEAM API will see.
+	idTok, err := cfg.AuthToken.ParseIDToken(cmd.Context(), cfg.ServerConfig)
+	if err != nil {
+		return fmt.Errorf("could not read ID token: %w", err)
+	}
+
+	view := &whoamiView{
+		Profile:        cfg.ProfileName,
+		Server:         cfg.ServerConfig.Server,
+		UserID:         idTok.UserID,
+		GroupIDs:       idTok.GroupIDs,
+		TokenExpiresAt: cfg.AuthToken.ExpiresAt.UTC(),
+	}
+
+	if email, ok := idTok.Email.(string); ok {
+		view.Email = email
+	}
+
+	if view.GroupIDs == nil {
+		view.GroupIDs = []string{}
+	}
+
+	return render(cmd, view)
+}
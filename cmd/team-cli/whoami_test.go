@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+// unsignedIDToken returns a JWT carrying claims, for tests run with --no-verify.
+func unsignedIDToken(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func TestWhoami(t *testing.T) {
+	writeProfiles(t)
+
+	cfg, err := readConfig()
+	require.NoError(t, err)
+
+	admin := *cfg.Profile
+	admin.AuthToken = &team.AuthToken{
+		IdToken: unsignedIDToken(t, map[string]any{
+			"userId":   "admin-user",
+			"email":    "admin@example.com",
+			"groupIds": "break-glass",
+		}),
+		AccessToken: "access",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	cfg.Profiles["admin"] = &admin
+	require.NoError(t, writeConfig(cfg))
+
+	stdout, _, err := executeCmd(t, "whoami", "--profile", "admin", "--no-verify", "-o", "json")
+	require.NoError(t, err)
+
+	var got whoamiView
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &got))
+	require.Equal(t, "admin", got.Profile)
+	require.Equal(t, "https://team.example.com", got.Server)
+	require.Equal(t, "admin-user", got.UserID)
+	require.Equal(t, "admin@example.com", got.Email)
+	require.Equal(t, []string{"break-glass"}, got.GroupIDs)
+
+	// The identity tells the profiles on the same server apart.
+	stdout, _, err = executeCmd(t, "profile", "list", "-o", "json")
+	require.NoError(t, err)
+
+	var profiles struct {
+		Items []profileView `json:"items"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(stdout), &profiles))
+	require.Equal(t, "admin", profiles.Items[0].Name)
+	require.Equal(t, "admin@example.com", profiles.Items[0].Identity)
+}
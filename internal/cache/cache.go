@@ -0,0 +1,240 @@
+// Package cache keeps derived data, such as fetched accounts, apart from the config. Everything in a cache can be
+// fetched again, so it may be deleted at any time, and problems reading it are treated as a miss.
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// markerName is the file a Store writes into each directory it creates, so that Clear can tell them apart from
+// directories that were already there, which may hold files of the user.
+const markerName = ".team-cli-cache"
+
+// entryVersion is the version of the envelope entries are stored in. Entries of another version are ignored.
+const entryVersion = 1
+
+// Store is a directory of cached JSON entries.
+type Store struct {
+	dir string
+	// parent is the store that dir is in, if it was opened with Sub.
+	parent *Store
+}
+
+// entry wraps a cached value with the time it was stored, so that readers can decide whether it is still fresh.
+type entry struct {
+	Version  int             `json:"version"`
+	StoredAt time.Time       `json:"stored_at"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// Open returns the store kept in dir. The directory is only created when the first entry is written.
+func Open(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Sub returns the store kept in the subdirectory name, such as the cache of a profile.
+func (s *Store) Sub(name string) *Store {
+	return &Store{dir: filepath.Join(s.dir, name), parent: s}
+}
+
+// Dir returns the directory of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Path returns the path of the named file in the store, for callers that manage a file themselves. The directory is
+// created if needed.
+func (s *Store) Path(name string) (string, error) {
+	if err := s.create(); err != nil {
+		return "", fmt.Errorf("could not create cache dir: %w", err)
+	}
+
+	return filepath.Join(s.dir, name), nil
+}
+
+// create creates the directory of the store, and those of its parents, marking the ones it creates. Directories that
+// already exist are left unmarked.
+func (s *Store) create() error {
+	if s.parent != nil {
+		if err := s.parent.create(); err != nil {
+			return err
+		}
+	}
+
+	err := os.Mkdir(s.dir, 0700)
+
+	// The directories above a root store, such as ~/.cache, are not the cache's own and so are not marked.
+	if errors.Is(err, os.ErrNotExist) && s.parent == nil {
+		if err := os.MkdirAll(filepath.Dir(s.dir), 0700); err != nil {
+			return err
+		}
+
+		err = os.Mkdir(s.dir, 0700)
+	}
+
+	switch {
+	case errors.Is(err, os.ErrExist):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(s.dir, markerName), nil, 0600)
+}
+
+// Put stores v as JSON under name.
+func (s *Store) Put(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not marshal: %w", err)
+	}
+
+	enc, err := json.MarshalIndent(&entry{Version: entryVersion, StoredAt: time.Now().UTC(), Data: data}, "", "    ")
+	if err != nil {
+		return fmt.Errorf("could not marshal: %w", err)
+	}
+
+	path, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+
+	// The entry is written next to its final name and renamed, so readers never see a partial entry.
+	tmp, err := os.CreateTemp(s.dir, name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file: %w", err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(enc); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("could not write: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not write: %w", err)
+	}
+
+	return nil
+}
+
+// Get decodes the entry stored under name into v and returns when it was stored. It reports a miss when there is no
+// entry, it cannot be read, or it is older than maxAge. A maxAge of zero accepts entries of any age.
+func (s *Store) Get(name string, maxAge time.Duration, v any) (time.Time, bool) {
+	path := filepath.Join(s.dir, name)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Could not read cache entry", "path", path, "err", err)
+		}
+
+		return time.Time{}, false
+	}
+
+	var e entry
+
+	if err := json.Unmarshal(raw, &e); err != nil || e.Version != entryVersion {
+		slog.Warn("Ignoring unreadable cache entry", "path", path, "err", err)
+
+		return time.Time{}, false
+	}
+
+	if maxAge > 0 && time.Since(e.StoredAt) > maxAge {
+		slog.Debug("Cache entry has expired", "path", path, "stored_at", e.StoredAt)
+
+		return time.Time{}, false
+	}
+
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		slog.Warn("Ignoring unreadable cache entry", "path", path, "err", err)
+
+		return time.Time{}, false
+	}
+
+	return e.StoredAt, true
+}
+
+// Delete removes the entry stored under name, if any.
+func (s *Store) Delete(name string) error {
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove cache entry: %w", err)
+	}
+
+	return nil
+}
+
+// Clear removes what the store holds, leaving its directory in place. In a directory the store created, everything
+// is removed. In one that was already there, such as a directory given with --cache-dir, only the known files and the
+// subdirectories created by stores are, so that pointing a store at a directory of other files cannot delete them.
+func (s *Store) Clear(known ...string) error {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not clear cache: %w", err)
+	}
+
+	owned := marked(s.dir)
+
+	for _, e := range entries {
+		path := filepath.Join(s.dir, e.Name())
+
+		switch {
+		case e.Name() == markerName:
+			continue
+		case owned, e.IsDir() && marked(path), !e.IsDir() && slices.Contains(known, e.Name()):
+		default:
+			slog.Debug("Leaving file the cache did not create", "path", path)
+
+			continue
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("could not clear cache: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Remove removes the directory of the store when the store created it. Otherwise it clears it as Clear does, and then
+// removes the directory only if nothing is left in it.
+func (s *Store) Remove(known ...string) error {
+	if !marked(s.dir) {
+		if err := s.Clear(known...); err != nil {
+			return err
+		}
+
+		// A directory still holding files fails to be removed, which is what is wanted.
+		_ = os.Remove(s.dir)
+
+		return nil
+	}
+
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("could not remove cache: %w", err)
+	}
+
+	return nil
+}
+
+// marked reports whether dir was created by a store.
+func marked(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, markerName))
+
+	return err == nil
+}
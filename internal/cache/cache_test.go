@@ -0,0 +1,115 @@
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/cache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	store := cache.Open(filepath.Join(t.TempDir(), "team-cli", "default"))
+
+	var got map[string]int
+
+	_, ok := store.Get("counts.json", 0, &got)
+	require.False(t, ok)
+
+	before := time.Now()
+
+	require.NoError(t, store.Put("counts.json", map[string]int{"a": 1}))
+
+	storedAt, ok := store.Get("counts.json", time.Hour, &got)
+	require.True(t, ok)
+	require.Equal(t, map[string]int{"a": 1}, got)
+	require.WithinDuration(t, before, storedAt, time.Minute)
+
+	// An entry older than the maximum age is a miss.
+	time.Sleep(10 * time.Millisecond)
+
+	_, ok = store.Get("counts.json", time.Millisecond, &got)
+	require.False(t, ok)
+
+	require.NoError(t, store.Delete("counts.json"))
+	require.NoError(t, store.Delete("counts.json"))
+
+	_, ok = store.Get("counts.json", 0, &got)
+	require.False(t, ok)
+}
+
+func TestStoreCorrupt(t *testing.T) {
+	t.Parallel()
+
+	store := cache.Open(t.TempDir())
+
+	path, err := store.Path("counts.json")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":`), 0600))
+
+	var got map[string]int
+
+	_, ok := store.Get("counts.json", 0, &got)
+	require.False(t, ok)
+}
+
+func TestStoreClear(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	store := cache.Open(filepath.Join(root, "team-cli"))
+	profile := store.Sub("default")
+
+	require.NoError(t, store.Put("counts.json", 1))
+	require.NoError(t, profile.Put("counts.json", 1))
+	require.NoError(t, store.Clear())
+
+	// The directory the store created is emptied but kept.
+	entries, err := os.ReadDir(store.Dir())
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "only the marker is left")
+
+	require.NoError(t, store.Put("counts.json", 1))
+	require.NoError(t, profile.Put("counts.json", 1))
+	require.NoError(t, profile.Remove())
+
+	_, err = os.Stat(profile.Dir())
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestStoreClearForeignDir(t *testing.T) {
+	t.Parallel()
+
+	// A directory that existed before the store, such as one given with --cache-dir, holds files of the user.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("mine"), 0600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "photos"), 0700))
+
+	store := cache.Open(dir)
+	require.NoError(t, store.Put("keys.json", 1))
+	require.NoError(t, store.Sub("default").Put("counts.json", 1))
+	require.NoError(t, store.Put("other.json", 1))
+
+	require.NoError(t, store.Clear("keys.json"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	// Only the known file and the subdirectory the store created are removed.
+	require.ElementsMatch(t, []string{"notes.txt", "photos", "other.json"}, names)
+
+	// Removing the store leaves the directory in place while it holds other files.
+	require.NoError(t, store.Remove())
+
+	_, err = os.Stat(dir)
+	require.NoError(t, err)
+}
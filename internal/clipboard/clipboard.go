@@ -0,0 +1,69 @@
+// Package clipboard copies text to the system clipboard using the platform's command line tools.
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var ErrUnavailable = errors.New("no clipboard tool available")
+
+const copyTimeout = 2 * time.Second
+
+// Copy places text on the system clipboard, trying each tool available on the platform in turn.
+func Copy(ctx context.Context, text string) error {
+	ctx, cancel := context.WithTimeout(ctx, copyTimeout)
+	defer cancel()
+
+	var errs []error
+
+	for _, args := range commands(runtime.GOOS, os.Getenv("WAYLAND_DISPLAY") != "") {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+
+		if err := cmd.Run(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", args[0], err))
+
+			continue
+		}
+
+		return nil
+	}
+
+	if len(errs) == 0 {
+		return ErrUnavailable
+	}
+
+	return fmt.Errorf("could not copy to clipboard: %w", errors.Join(errs...))
+}
+
+// commands returns the clipboard tools to try on goos, each reading the text from stdin.
+func commands(goos string, wayland bool) [][]string {
+	switch goos {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	}
+
+	cmds := [][]string{
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+	}
+
+	if wayland {
+		cmds = append([][]string{{"wl-copy"}}, cmds...)
+	}
+
+	return cmds
+}
@@ -0,0 +1,17 @@
+package clipboard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommands(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, [][]string{{"pbcopy"}}, commands("darwin", false))
+	require.Equal(t, [][]string{{"clip"}}, commands("windows", false))
+	require.Equal(t, "xclip", commands("linux", false)[0][0])
+	require.Equal(t, "wl-copy", commands("linux", true)[0][0])
+	require.Len(t, commands("freebsd", true), 3)
+}
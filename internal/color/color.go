@@ -0,0 +1,78 @@
+// Package color centralises decisions about whether terminal colours are emitted. Commands should only ever colour
+// text through this package so that NO_COLOR, --no-color and non-terminal output are respected consistently.
+package color
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/term"
+)
+
+type Style string
+
+const (
+	Red    Style = "\x1b[31m"
+	Green  Style = "\x1b[32m"
+	Yellow Style = "\x1b[33m"
+	Bold   Style = "\x1b[1m"
+	Dim    Style = "\x1b[2m"
+
+	reset = "\x1b[0m"
+)
+
+var enabled atomic.Bool
+
+// Configure decides whether colour is enabled. Colour is disabled when noColor is set, when the NO_COLOR environment
+// variable is non-empty, or when out is not a terminal.
+func Configure(noColor bool, out *os.File) {
+	v := shouldEnable(noColor, os.Getenv("NO_COLOR"), out != nil && term.IsTerminal(int(out.Fd())))
+
+	// Older Windows consoles need virtual terminal processing switching on before escape sequences are honoured.
+	if v && !enableVT(out) {
+		v = false
+	}
+
+	enabled.Store(v)
+}
+
+func shouldEnable(noColor bool, noColorEnv string, isTerminal bool) bool {
+	return !noColor && noColorEnv == "" && isTerminal
+}
+
+// SetEnabled forces colour on or off, overriding Configure.
+func SetEnabled(v bool) {
+	enabled.Store(v)
+}
+
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Apply wraps s in the given style when colour is enabled, and returns it unchanged otherwise.
+func Apply(style Style, s string) string {
+	if !Enabled() || s == "" {
+		return s
+	}
+
+	return string(style) + s + reset
+}
+
+// Status colours a request or session status: pending is yellow, approved and active are green, rejected and revoked
+// are red, and expired or ended states are dimmed. Unknown statuses are returned unchanged. Structured output must
+// never be passed through this function.
+func Status(status string) string {
+	switch strings.ToLower(status) {
+	case "pending":
+		return Apply(Yellow, status)
+	case "approved", "active", "in progress", "scheduled":
+		return Apply(Green, status)
+	case "rejected", "revoked", "error", "cancelled":
+		return Apply(Red, status)
+	case "expired", "ended":
+		return Apply(Dim, status)
+	default:
+		return status
+	}
+}
@@ -0,0 +1,37 @@
+package color
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldEnable(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, shouldEnable(false, "", true))
+	require.False(t, shouldEnable(true, "", true))
+	require.False(t, shouldEnable(false, "1", true))
+	require.False(t, shouldEnable(false, "", false))
+}
+
+func TestApply(t *testing.T) {
+	SetEnabled(false)
+	require.Equal(t, "pending", Apply(Yellow, "pending"))
+
+	SetEnabled(true)
+	defer SetEnabled(false)
+
+	require.Equal(t, "\x1b[33mpending\x1b[0m", Apply(Yellow, "pending"))
+}
+
+func TestStatus(t *testing.T) {
+	SetEnabled(true)
+	defer SetEnabled(false)
+
+	require.Equal(t, "\x1b[33mpending\x1b[0m", Status("pending"))
+	require.Equal(t, "\x1b[32mapproved\x1b[0m", Status("approved"))
+	require.Equal(t, "\x1b[31mrejected\x1b[0m", Status("rejected"))
+	require.Equal(t, "\x1b[2mexpired\x1b[0m", Status("expired"))
+	require.Equal(t, "unknown", Status("unknown"))
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package color
+
+import "os"
+
+func enableVT(_ *os.File) bool {
+	return true
+}
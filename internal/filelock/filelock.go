@@ -0,0 +1,69 @@
+// Package filelock provides advisory, cross-process file locks used to serialise read-modify-write cycles of files
+// shared between concurrent invocations.
+package filelock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+var ErrTimeout = errors.New("timed out waiting for lock")
+
+// retryInterval is how often a held lock is retried.
+const retryInterval = 50 * time.Millisecond
+
+// Lock is an exclusive lock held on a lock file.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire takes an exclusive lock on the file at path, creating it if needed, waiting at most timeout for another
+// holder to release it. The lock is advisory: it only excludes other callers of Acquire.
+func Acquire(ctx context.Context, path string, timeout time.Duration) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open lock file: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			_ = f.Close()
+
+			return nil, fmt.Errorf("could not lock %s: %w", path, err)
+		}
+
+		if ok {
+			return &Lock{f: f}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("%w: %s", ErrTimeout, path)
+			}
+
+			return nil, ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// Release releases the lock. The lock file itself is left in place, as removing it would race with other holders.
+func (l *Lock) Release() error {
+	if err := unlock(l.f); err != nil {
+		_ = l.f.Close()
+
+		return fmt.Errorf("could not unlock: %w", err)
+	}
+
+	return l.f.Close()
+}
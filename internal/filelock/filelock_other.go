@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package filelock
+
+import "os"
+
+// Platforms without file locking run unlocked.
+func tryLock(_ *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlock(_ *os.File) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+package filelock_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/filelock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquire(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config.lock")
+
+	lock, err := filelock.Acquire(context.Background(), path, time.Second)
+	require.NoError(t, err)
+
+	// flock locks belong to the open file, so a second acquisition conflicts even within one process.
+	_, err = filelock.Acquire(context.Background(), path, 200*time.Millisecond)
+	require.ErrorIs(t, err, filelock.ErrTimeout)
+
+	require.NoError(t, lock.Release())
+
+	lock, err = filelock.Acquire(context.Background(), path, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+}
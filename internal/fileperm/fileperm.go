@@ -0,0 +1,8 @@
+// Package fileperm checks whether files holding secrets can be read by anyone other than their owner.
+package fileperm
+
+// Exposure describes who other than the owner can access the file at path, or returns an empty string when only
+// the owner can.
+func Exposure(path string) (string, error) {
+	return exposure(path)
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package fileperm
+
+import (
+	"fmt"
+	"os"
+)
+
+func exposure(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("could not stat %s: %w", path, err)
+	}
+
+	// Like ssh, any access for the group or others is too open.
+	if mode := info.Mode().Perm(); mode&0o077 != 0 {
+		return fmt.Sprintf("accessible by group or others (mode %#o)", mode), nil
+	}
+
+	return "", nil
+}
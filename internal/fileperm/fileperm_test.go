@@ -0,0 +1,29 @@
+//go:build !windows
+
+package fileperm_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/fileperm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExposure(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0600))
+
+	exposure, err := fileperm.Exposure(path)
+	require.NoError(t, err)
+	require.Empty(t, exposure)
+
+	require.NoError(t, os.Chmod(path, 0644))
+
+	exposure, err = fileperm.Exposure(path)
+	require.NoError(t, err)
+	require.Equal(t, "accessible by group or others (mode 0644)", exposure)
+}
@@ -0,0 +1,69 @@
+//go:build windows
+
+package fileperm
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// broadGroups are the well-known groups that make a file readable by other users of the machine.
+var broadGroups = map[windows.WELL_KNOWN_SID_TYPE]string{
+	windows.WinWorldSid:             "Everyone",
+	windows.WinAuthenticatedUserSid: "Authenticated Users",
+	windows.WinBuiltinUsersSid:      "Users",
+	windows.WinBuiltinGuestsSid:     "Guests",
+}
+
+const readAccess = windows.FILE_READ_DATA | windows.GENERIC_READ | windows.GENERIC_ALL
+
+func exposure(path string) (string, error) {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return "", fmt.Errorf("could not read ACL of %s: %w", path, err)
+	}
+
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return "", fmt.Errorf("could not read ACL of %s: %w", path, err)
+	}
+
+	// A missing DACL grants everyone full access.
+	if dacl == nil {
+		return "readable by everyone (no ACL)", nil
+	}
+
+	var exposed []string
+
+	for i := range uint32(dacl.AceCount) {
+		var ace *windows.ACCESS_ALLOWED_ACE
+
+		if err := windows.GetAce(dacl, i, &ace); err != nil {
+			return "", fmt.Errorf("could not read ACL of %s: %w", path, err)
+		}
+
+		if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE || ace.Mask&readAccess == 0 {
+			continue
+		}
+
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+
+		// The groups are checked in a fixed order, so the same ACL is always described the same way.
+		for _, sidType := range slices.Sorted(maps.Keys(broadGroups)) {
+			if sid.IsWellKnown(sidType) {
+				exposed = append(exposed, broadGroups[sidType])
+			}
+		}
+	}
+
+	if len(exposed) == 0 {
+		return "", nil
+	}
+
+	return "readable by " + strings.Join(exposed, ", "), nil
+}
@@ -0,0 +1,185 @@
+package gql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// Authorizer authorizes the queries and mutations of a client, and its realtime connections and subscriptions.
+type Authorizer interface {
+	// AuthorizeRequest adds the headers authorizing req, which posts body.
+	AuthorizeRequest(ctx context.Context, req *http.Request, body []byte) error
+	// AuthorizeRealtime returns the authorization of a realtime message, given as that of posting body to u. A
+	// connection posts "{}" to the connect URL of the API, and a subscription posts itself to the API.
+	AuthorizeRealtime(ctx context.Context, u *url.URL, body []byte) (map[string]string, error)
+}
+
+// WithAuthorizer authorizes requests with a, instead of with the tokens given to NewClient, which may then be nil.
+func WithAuthorizer(a Authorizer) Option {
+	return func(client *Client) {
+		client.auth = a
+	}
+}
+
+// TokenAuth authorizes with the access tokens of a source, as APIs using Cognito user pools expect.
+type TokenAuth struct {
+	Tokens TokenSource
+}
+
+func (a TokenAuth) AuthorizeRequest(ctx context.Context, req *http.Request, _ []byte) error {
+	accessToken, err := a.Tokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	req.Header.Set("Authorization", accessToken)
+
+	return nil
+}
+
+func (a TokenAuth) AuthorizeRealtime(ctx context.Context, u *url.URL, _ []byte) (map[string]string, error) {
+	accessToken, err := a.Tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	return map[string]string{
+		"host":          u.Hostname(),
+		"Authorization": accessToken,
+	}, nil
+}
+
+// APIKeyAuth authorizes with an API key, as APIs using API key authorization expect.
+type APIKeyAuth struct {
+	Key string
+}
+
+func (a APIKeyAuth) AuthorizeRequest(_ context.Context, req *http.Request, _ []byte) error {
+	req.Header.Set("x-api-key", a.Key)
+
+	return nil
+}
+
+func (a APIKeyAuth) AuthorizeRealtime(_ context.Context, u *url.URL, _ []byte) (map[string]string, error) {
+	return map[string]string{
+		"host":      u.Host,
+		"x-api-key": a.Key,
+	}, nil
+}
+
+// IAMAuth signs requests with SigV4, as AppSync APIs using IAM authorization expect.
+type IAMAuth struct {
+	// Region is the region of the API. By default, it is taken from the AppSync host name, or else from Config.
+	Region string
+	// Config holds the credentials to sign with and the fallback region. By default, it is loaded as the AWS CLI
+	// would, with config.LoadDefaultConfig, on every request.
+	Config *aws.Config
+}
+
+func (a IAMAuth) AuthorizeRequest(ctx context.Context, req *http.Request, body []byte) error {
+	return a.sign(ctx, req.URL, req.Header, body)
+}
+
+func (a IAMAuth) AuthorizeRealtime(ctx context.Context, u *url.URL, body []byte) (map[string]string, error) {
+	// AppSync signs realtime messages as if they were requests with these headers.
+	header := http.Header{
+		"Accept":           []string{"application/json, text/javascript"},
+		"Content-Encoding": []string{"amz-1.0"},
+		"Content-Type":     []string{"application/json; charset=UTF-8"},
+	}
+
+	if err := a.sign(ctx, u, header, body); err != nil {
+		return nil, err
+	}
+
+	// The names are cased as in the AppSync documentation.
+	auth := map[string]string{
+		"accept":           header.Get("Accept"),
+		"content-encoding": header.Get("Content-Encoding"),
+		"content-type":     header.Get("Content-Type"),
+		"host":             u.Host,
+		"x-amz-date":       header.Get("X-Amz-Date"),
+		"Authorization":    header.Get("Authorization"),
+	}
+
+	if token := header.Get("X-Amz-Security-Token"); token != "" {
+		auth["X-Amz-Security-Token"] = token
+	}
+
+	return auth, nil
+}
+
+func (a IAMAuth) sign(ctx context.Context, u *url.URL, header http.Header, body []byte) error {
+	cfg := a.Config
+	if cfg == nil {
+		loaded, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load AWS config: %w", err)
+		}
+
+		cfg = &loaded
+	}
+
+	if cfg.Credentials == nil {
+		return fmt.Errorf("%w: no AWS credentials found", ErrUnexpected)
+	}
+
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get AWS credentials: %w", err)
+	}
+
+	region := a.Region
+	if region == "" {
+		region = appSyncRegion(u.Hostname())
+	}
+
+	if region == "" {
+		region = cfg.Region
+	}
+
+	if region == "" {
+		return fmt.Errorf("%w: no AWS region for %s, set AWS_REGION", ErrUnexpected, u.Hostname())
+	}
+
+	// The signer signs a request, so realtime messages are signed as the request they stand for. The body is given by
+	// its hash alone, so that no Content-Length is signed, which realtime messages do not carry.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request to sign: %w", err)
+	}
+
+	req.Header = header
+
+	payloadHash := sha256.Sum256(body)
+
+	err = v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "appsync", region, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return nil
+}
+
+// appSyncRegion returns the region in an AppSync host name, such as abc.appsync-api.eu-west-1.amazonaws.com, or "".
+func appSyncRegion(host string) string {
+	parts := strings.Split(host, ".")
+
+	for i, part := range parts[:len(parts)-1] {
+		if part == "appsync-api" || part == "appsync-realtime-api" {
+			return parts[i+1]
+		}
+	}
+
+	return ""
+}
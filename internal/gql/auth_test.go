@@ -0,0 +1,240 @@
+package gql_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+var iamCreds = aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "session"}
+
+var iamAuth = gql.IAMAuth{
+	Region: "eu-west-1",
+	Config: &aws.Config{Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return iamCreds, nil
+	})},
+}
+
+// expectedSignature returns the Authorization header signing a post of body to u with header, at the time given by
+// the X-Amz-Date value.
+func expectedSignature(t *testing.T, u *url.URL, header http.Header, body []byte, amzDate string) string {
+	t.Helper()
+
+	now, err := time.Parse("20060102T150405Z", amzDate)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	require.NoError(t, err)
+
+	req.Header = header
+	payloadHash := sha256.Sum256(body)
+
+	err = v4.NewSigner().SignHTTP(
+		context.Background(), iamCreds, req, hex.EncodeToString(payloadHash[:]), "appsync", "eu-west-1", now,
+	)
+	require.NoError(t, err)
+
+	return req.Header.Get("Authorization")
+}
+
+func TestExecuteIAMAuth(t *testing.T) {
+	t.Parallel()
+
+	var (
+		received http.Header
+		url      *url.URL
+		body     []byte
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		url = &(*r.URL)
+		url.Scheme, url.Host = "http", r.Host
+		body, _ = io.ReadAll(r.Body)
+
+		_, _ = w.Write([]byte(`{"data": {"x": 1}}`))
+	}))
+	defer server.Close()
+
+	client := gql.NewClient(server.URL+"/graphql", nil, gql.WithAuthorizer(iamAuth))
+
+	_, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+	require.NoError(t, err)
+
+	require.Equal(t, "session", received.Get("X-Amz-Security-Token"))
+	require.Equal(t,
+		expectedSignature(t, url, http.Header{"Content-Type": {"application/json"}}, body, received.Get("X-Amz-Date")),
+		received.Get("Authorization"),
+	)
+}
+
+func TestSubscribeIAMAuth(t *testing.T) {
+	t.Parallel()
+
+	var (
+		host        string
+		connectAuth map[string]string
+		startAuth   map[string]string
+		startData   string
+	)
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-ws"}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+
+		for _, protocol := range strings.Split(r.Header.Get("Sec-Websocket-Protocol"), ", ") {
+			if enc, ok := strings.CutPrefix(protocol, "header-"); ok {
+				raw, _ := base64.RawURLEncoding.DecodeString(enc)
+				_ = json.Unmarshal(raw, &connectAuth)
+			}
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer ws.Close()
+
+		var msg struct {
+			ID      string `json:"id"`
+			Payload struct {
+				Data       string `json:"data"`
+				Extensions struct {
+					Authorization map[string]string `json:"authorization"`
+				} `json:"extensions"`
+			} `json:"payload"`
+		}
+
+		for _, ack := range []string{"connection_ack", "start_ack"} {
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+
+			if err := ws.WriteJSON(map[string]string{"type": ack, "id": msg.ID}); err != nil {
+				return
+			}
+		}
+
+		startAuth, startData = msg.Payload.Extensions.Authorization, msg.Payload.Data
+
+		_ = ws.WriteJSON(map[string]any{"type": "data", "id": msg.ID, "payload": map[string]any{"data": 1}})
+
+		completeOnStop(ws)
+	}))
+	defer server.Close()
+
+	client := gql.NewClient(server.URL+"/graphql", nil, gql.WithAuthorizer(iamAuth))
+
+	_, err := collectClient(client, 1)
+	require.NoError(t, err)
+
+	// The connection is signed as a post of {} to the connect URL, and the subscription as a post of itself.
+	realtimeHeader := func() http.Header {
+		return http.Header{
+			"Accept":           {"application/json, text/javascript"},
+			"Content-Encoding": {"amz-1.0"},
+			"Content-Type":     {"application/json; charset=UTF-8"},
+		}
+	}
+
+	api := &url.URL{Scheme: "http", Host: host, Path: "/graphql"}
+
+	require.Equal(t, host, connectAuth["host"])
+	require.Equal(t, "session", connectAuth["X-Amz-Security-Token"])
+	require.Equal(t,
+		expectedSignature(t, api.JoinPath("connect"), realtimeHeader(), []byte("{}"), connectAuth["x-amz-date"]),
+		connectAuth["Authorization"],
+	)
+
+	require.Equal(t, host, startAuth["host"])
+	require.Equal(t,
+		expectedSignature(t, api, realtimeHeader(), []byte(startData), startAuth["x-amz-date"]),
+		startAuth["Authorization"],
+	)
+}
+
+func TestIAMAuthRegion(t *testing.T) {
+	t.Parallel()
+
+	auth := gql.IAMAuth{Config: &aws.Config{Credentials: iamAuth.Config.Credentials}}
+
+	// The region is taken from AppSync host names.
+	req, err := http.NewRequest(http.MethodPost, "https://abc.appsync-api.eu-central-1.amazonaws.com/graphql", nil)
+	require.NoError(t, err)
+	require.NoError(t, auth.AuthorizeRequest(context.Background(), req, nil))
+	require.Contains(t, req.Header.Get("Authorization"), "/eu-central-1/appsync/aws4_request")
+
+	// Other hosts need it from the config.
+	req, err = http.NewRequest(http.MethodPost, "https://api.example.com/graphql", nil)
+	require.NoError(t, err)
+	require.Error(t, auth.AuthorizeRequest(context.Background(), req, nil))
+
+	auth.Config.Region = "us-west-2"
+
+	require.NoError(t, auth.AuthorizeRequest(context.Background(), req, nil))
+	require.Contains(t, req.Header.Get("Authorization"), "/us-west-2/appsync/aws4_request")
+}
+
+// The environment is process wide, so this test does not run in parallel.
+func TestIAMAuthDefaultConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", dir+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", dir+"/credentials")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "ap-south-1")
+
+	// Without a config, the credentials and region are found as the AWS CLI finds them.
+	req, err := http.NewRequest(http.MethodPost, "https://api.example.com/graphql", nil)
+	require.NoError(t, err)
+	require.NoError(t, gql.IAMAuth{}.AuthorizeRequest(context.Background(), req, nil))
+	require.Contains(t, req.Header.Get("Authorization"), "Credential=AKIDENV/")
+	require.Contains(t, req.Header.Get("Authorization"), "/ap-south-1/appsync/aws4_request")
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	t.Parallel()
+
+	var received http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+
+		_, _ = w.Write([]byte(`{"data": {"x": 1}}`))
+	}))
+	defer server.Close()
+
+	client := gql.NewClient(server.URL+"/graphql", nil, gql.WithAuthorizer(gql.APIKeyAuth{Key: "da2-key"}))
+
+	_, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+	require.NoError(t, err)
+	require.Equal(t, "da2-key", received.Get("x-api-key"))
+	require.Empty(t, received.Get("Authorization"))
+
+	// The realtime authorization carries the key in place of the Authorization header.
+	u, err := url.Parse("https://abc.appsync-api.eu-west-1.amazonaws.com/graphql")
+	require.NoError(t, err)
+
+	auth, err := gql.APIKeyAuth{Key: "da2-key"}.AuthorizeRealtime(context.Background(), u, []byte("{}"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"host": "abc.appsync-api.eu-west-1.amazonaws.com", "x-api-key": "da2-key"}, auth)
+}
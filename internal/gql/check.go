@@ -0,0 +1,840 @@
+package gql
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrSyntax is returned when a GraphQL document cannot be parsed.
+var ErrSyntax = errors.New("syntax error")
+
+// Check validates the operations of document against the schema, for catching operations that have drifted from a
+// deployed API. Each problem found is described in the result: unknown types, fields, arguments and fragments, missing
+// required arguments, fields selected wrongly for their type, and variables that are undefined or cannot be passed
+// where they are used. It only fails when the document cannot be parsed.
+func (s *Schema) Check(document string) ([]string, error) {
+	doc, err := parseDocument(document)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checker{schema: s, doc: doc}
+
+	for _, op := range doc.operations {
+		c.checkOperation(op)
+	}
+
+	return c.problems, nil
+}
+
+// checker accumulates the problems of a document.
+type checker struct {
+	schema   *Schema
+	doc      *document
+	problems []string
+
+	// label names the operation being checked, vars holds its variables, and visiting the fragments being expanded.
+	label    string
+	vars     map[string]*variableDef
+	visiting []string
+}
+
+func (c *checker) report(path, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+
+	if path != "" {
+		msg = path + ": " + msg
+	}
+
+	c.problems = append(c.problems, c.label+": "+msg)
+}
+
+func (c *checker) checkOperation(op *operationDef) {
+	c.label = strings.TrimSpace(op.kind + " " + op.name)
+	c.vars = make(map[string]*variableDef, len(op.variables))
+
+	for _, v := range op.variables {
+		c.vars[v.name] = v
+
+		switch t := c.schema.Type(v.typ.named()); {
+		case t == nil:
+			c.report("", "variable $%s has unknown type %s", v.name, v.typ.named())
+		case !slices.Contains([]string{"SCALAR", "ENUM", "INPUT_OBJECT"}, t.Kind):
+			c.report("", "variable $%s has type %s, which is not an input type", v.name, t.Name)
+		}
+	}
+
+	var root *NamedTypeRef
+
+	switch op.kind {
+	case "query":
+		root = c.schema.QueryType
+	case "mutation":
+		root = c.schema.MutationType
+	case "subscription":
+		root = c.schema.SubscriptionType
+	}
+
+	var rootType *SchemaType
+	if root != nil {
+		rootType = c.schema.Type(root.Name)
+	}
+
+	if rootType == nil {
+		c.report("", "the schema has no %s type", op.kind)
+
+		return
+	}
+
+	c.checkSelections(rootType, op.selections, "")
+}
+
+func (c *checker) checkSelections(parent *SchemaType, selections []*selection, path string) {
+	for _, sel := range selections {
+		c.checkVariables(sel.variables, path)
+
+		switch {
+		case sel.spread != "":
+			c.checkSpread(sel.spread, path)
+		case sel.inline:
+			target := parent
+
+			if sel.typeCondition != "" {
+				if target = c.schema.Type(sel.typeCondition); target == nil {
+					c.report(path, "unknown type %s", sel.typeCondition)
+
+					continue
+				}
+			}
+
+			c.checkSelections(target, sel.selections, path)
+		default:
+			c.checkField(parent, sel, path)
+		}
+	}
+}
+
+func (c *checker) checkSpread(name, path string) {
+	frag := c.doc.fragments[name]
+	if frag == nil {
+		c.report(path, "unknown fragment %s", name)
+
+		return
+	}
+
+	// Cycles are invalid, but only need to be stopped here.
+	if slices.Contains(c.visiting, name) {
+		return
+	}
+
+	target := c.schema.Type(frag.typeCondition)
+	if target == nil {
+		c.report(path, "fragment %s is on unknown type %s", name, frag.typeCondition)
+
+		return
+	}
+
+	c.visiting = append(c.visiting, name)
+	c.checkSelections(target, frag.selections, path)
+	c.visiting = c.visiting[:len(c.visiting)-1]
+}
+
+func (c *checker) checkField(parent *SchemaType, sel *selection, path string) {
+	if path != "" {
+		path += "."
+	}
+
+	path += sel.name
+
+	if sel.name == "__typename" {
+		if sel.selections != nil {
+			c.report(path, "String has no subfields")
+		}
+
+		return
+	}
+
+	// The introspection fields are only defined on the query type, but not listed.
+	if strings.HasPrefix(sel.name, "__") && c.schema.QueryType != nil && parent.Name == c.schema.QueryType.Name {
+		return
+	}
+
+	idx := slices.IndexFunc(parent.Fields, func(f *Field) bool { return f.Name == sel.name })
+	if idx < 0 {
+		c.report(path, "unknown field on type %s", parent.Name)
+
+		return
+	}
+
+	field := parent.Fields[idx]
+
+	c.checkArguments(field, sel.args, path)
+
+	t := c.schema.Type(field.Type.named())
+	if t == nil {
+		c.report(path, "field has unknown type %s", field.Type.named())
+
+		return
+	}
+
+	composite := slices.Contains([]string{"OBJECT", "INTERFACE", "UNION"}, t.Kind)
+
+	switch {
+	case composite && sel.selections == nil:
+		c.report(path, "%s needs a selection of subfields", t.Name)
+	case !composite && sel.selections != nil:
+		c.report(path, "%s has no subfields", t.Name)
+	case composite:
+		c.checkSelections(t, sel.selections, path)
+	}
+}
+
+func (c *checker) checkArguments(field *Field, args []*argument, path string) {
+	for _, arg := range args {
+		idx := slices.IndexFunc(field.Args, func(a *InputValue) bool { return a.Name == arg.name })
+		if idx < 0 {
+			c.report(path, "unknown argument %s", arg.name)
+
+			continue
+		}
+
+		def := field.Args[idx]
+
+		if arg.variable == "" {
+			continue
+		}
+
+		if v := c.vars[arg.variable]; v == nil {
+			c.report(path, "undefined variable $%s", arg.variable)
+		} else if !allowedVariable(v.typ, v.hasDefault, def.Type) {
+			c.report(path, "variable $%s of type %s cannot be passed to argument %s of type %s",
+				v.name, v.typ, def.Name, def.Type)
+		}
+	}
+
+	for _, def := range field.Args {
+		if def.Type.Kind != "NON_NULL" || def.DefaultValue != nil {
+			continue
+		}
+
+		if !slices.ContainsFunc(args, func(a *argument) bool { return a.name == def.Name }) {
+			c.report(path, "missing required argument %s: %s", def.Name, def.Type)
+		}
+	}
+}
+
+func (c *checker) checkVariables(names []string, path string) {
+	for _, name := range names {
+		if c.vars[name] == nil {
+			c.report(path, "undefined variable $%s", name)
+		}
+	}
+}
+
+// allowedVariable reports whether a variable of type varType can be passed where locType is expected. A nullable
+// variable with a default may be passed to a non-null argument.
+func allowedVariable(varType *TypeRef, hasDefault bool, locType *TypeRef) bool {
+	if locType.Kind == "NON_NULL" && varType.Kind != "NON_NULL" && hasDefault {
+		return compatibleTypes(varType, locType.OfType)
+	}
+
+	return compatibleTypes(varType, locType)
+}
+
+// compatibleTypes reports whether a value of type sub is always valid as a value of type super.
+func compatibleTypes(sub, super *TypeRef) bool {
+	switch {
+	case super.Kind == "NON_NULL":
+		return sub.Kind == "NON_NULL" && compatibleTypes(sub.OfType, super.OfType)
+	case sub.Kind == "NON_NULL":
+		return compatibleTypes(sub.OfType, super)
+	case super.Kind == "LIST":
+		return sub.Kind == "LIST" && compatibleTypes(sub.OfType, super.OfType)
+	case sub.Kind == "LIST":
+		return false
+	default:
+		return sub.named() == super.named()
+	}
+}
+
+// document is a parsed GraphQL document, holding what Check needs of it.
+type document struct {
+	operations []*operationDef
+	fragments  map[string]*fragmentDef
+}
+
+type operationDef struct {
+	kind       string
+	name       string
+	variables  []*variableDef
+	selections []*selection
+}
+
+type variableDef struct {
+	name       string
+	typ        *TypeRef
+	hasDefault bool
+}
+
+type fragmentDef struct {
+	typeCondition string
+	selections    []*selection
+}
+
+// selection is a field, a fragment spread or an inline fragment. selections is nil for fields without subfields.
+type selection struct {
+	name       string
+	args       []*argument
+	selections []*selection
+
+	spread        string
+	inline        bool
+	typeCondition string
+
+	// variables are those referenced in the directives of the selection.
+	variables []string
+}
+
+type argument struct {
+	name string
+	// variable is the variable passed as the argument, if it is one.
+	variable string
+}
+
+// parser is a recursive descent parser of the executable definitions of GraphQL documents.
+type parser struct {
+	tokens []token
+	pos    int
+	// vars collects the variables referenced by the values parsed, for checkVariables.
+	vars []string
+}
+
+func parseDocument(src string) (*document, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	doc := &document{fragments: map[string]*fragmentDef{}}
+
+	for p.peek().kind != tokEOF {
+		tok := p.peek()
+
+		switch {
+		case tok.is(tokPunct, "{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+
+			doc.operations = append(doc.operations, &operationDef{kind: "query", selections: selections})
+		case tok.is(tokName, "fragment"):
+			name, frag, err := p.fragmentDefinition()
+			if err != nil {
+				return nil, err
+			}
+
+			doc.fragments[name] = frag
+		case tok.is(tokName, "query"), tok.is(tokName, "mutation"), tok.is(tokName, "subscription"):
+			op, err := p.operationDefinition()
+			if err != nil {
+				return nil, err
+			}
+
+			doc.operations = append(doc.operations, op)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	return doc, nil
+}
+
+func (p *parser) operationDefinition() (*operationDef, error) {
+	op := &operationDef{kind: p.next().value}
+
+	if p.peek().kind == tokName {
+		op.name = p.next().value
+	}
+
+	if p.peek().is(tokPunct, "(") {
+		p.next()
+
+		for !p.peek().is(tokPunct, ")") {
+			v, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+
+			op.variables = append(op.variables, v)
+		}
+
+		p.next()
+	}
+
+	if err := p.directives(); err != nil {
+		return nil, err
+	}
+
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	op.selections = selections
+
+	return op, nil
+}
+
+func (p *parser) variableDefinition() (*variableDef, error) {
+	if _, err := p.expect(tokPunct, "$"); err != nil {
+		return nil, err
+	}
+
+	name, err := p.expect(tokName, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(tokPunct, ":"); err != nil {
+		return nil, err
+	}
+
+	typ, err := p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &variableDef{name: name, typ: typ}
+
+	if p.peek().is(tokPunct, "=") {
+		p.next()
+
+		if _, err := p.value(); err != nil {
+			return nil, err
+		}
+
+		v.hasDefault = true
+	}
+
+	return v, p.directives()
+}
+
+func (p *parser) typeRef() (*TypeRef, error) {
+	var ref *TypeRef
+
+	if p.peek().is(tokPunct, "[") {
+		p.next()
+
+		inner, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.expect(tokPunct, "]"); err != nil {
+			return nil, err
+		}
+
+		ref = &TypeRef{Kind: "LIST", OfType: inner}
+	} else {
+		name, err := p.expect(tokName, "")
+		if err != nil {
+			return nil, err
+		}
+
+		ref = &TypeRef{Name: &name}
+	}
+
+	if p.peek().is(tokPunct, "!") {
+		p.next()
+
+		ref = &TypeRef{Kind: "NON_NULL", OfType: ref}
+	}
+
+	return ref, nil
+}
+
+func (p *parser) fragmentDefinition() (string, *fragmentDef, error) {
+	p.next()
+
+	name, err := p.expect(tokName, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, err := p.expect(tokName, "on"); err != nil {
+		return "", nil, err
+	}
+
+	typeCondition, err := p.expect(tokName, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := p.directives(); err != nil {
+		return "", nil, err
+	}
+
+	selections, err := p.selectionSet()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return name, &fragmentDef{typeCondition: typeCondition, selections: selections}, nil
+}
+
+func (p *parser) selectionSet() ([]*selection, error) {
+	if _, err := p.expect(tokPunct, "{"); err != nil {
+		return nil, err
+	}
+
+	selections := []*selection{}
+
+	for !p.peek().is(tokPunct, "}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+
+		selections = append(selections, sel)
+	}
+
+	p.next()
+
+	return selections, nil
+}
+
+func (p *parser) selection() (*selection, error) {
+	p.vars = nil
+	sel := &selection{}
+
+	if p.peek().is(tokPunct, "...") {
+		p.next()
+
+		switch {
+		case p.peek().is(tokName, "on"):
+			p.next()
+
+			typeCondition, err := p.expect(tokName, "")
+			if err != nil {
+				return nil, err
+			}
+
+			sel.inline, sel.typeCondition = true, typeCondition
+		case p.peek().kind == tokName:
+			sel.spread = p.next().value
+		default:
+			sel.inline = true
+		}
+	} else {
+		name, err := p.expect(tokName, "")
+		if err != nil {
+			return nil, err
+		}
+
+		// The name of an aliased field follows the alias.
+		if p.peek().is(tokPunct, ":") {
+			p.next()
+
+			if name, err = p.expect(tokName, ""); err != nil {
+				return nil, err
+			}
+		}
+
+		sel.name = name
+
+		if sel.args, err = p.arguments(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.directives(); err != nil {
+		return nil, err
+	}
+
+	sel.variables = p.vars
+
+	if sel.spread == "" && (sel.inline || p.peek().is(tokPunct, "{")) {
+		selections, err := p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+
+		sel.selections = selections
+	}
+
+	return sel, nil
+}
+
+// arguments parses the arguments of a field, if any. The variables referenced by values other than a variable
+// standing alone are left in vars.
+func (p *parser) arguments() ([]*argument, error) {
+	if !p.peek().is(tokPunct, "(") {
+		return nil, nil
+	}
+
+	p.next()
+
+	var args []*argument
+
+	for !p.peek().is(tokPunct, ")") {
+		name, err := p.expect(tokName, "")
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.expect(tokPunct, ":"); err != nil {
+			return nil, err
+		}
+
+		variable, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, &argument{name: name, variable: variable})
+	}
+
+	p.next()
+
+	return args, nil
+}
+
+func (p *parser) directives() error {
+	for p.peek().is(tokPunct, "@") {
+		p.next()
+
+		if _, err := p.expect(tokName, ""); err != nil {
+			return err
+		}
+
+		if p.peek().is(tokPunct, "(") {
+			p.next()
+
+			for !p.peek().is(tokPunct, ")") {
+				if _, err := p.expect(tokName, ""); err != nil {
+					return err
+				}
+
+				if _, err := p.expect(tokPunct, ":"); err != nil {
+					return err
+				}
+
+				variable, err := p.value()
+				if err != nil {
+					return err
+				}
+
+				if variable != "" {
+					p.vars = append(p.vars, variable)
+				}
+			}
+
+			p.next()
+		}
+	}
+
+	return nil
+}
+
+// value parses a value, returning the name of the variable when it is one. The variables nested in lists and objects
+// are added to vars.
+func (p *parser) value() (string, error) {
+	tok := p.next()
+
+	switch {
+	case tok.is(tokPunct, "$"):
+		return p.expect(tokName, "")
+	case tok.is(tokPunct, "["):
+		for !p.peek().is(tokPunct, "]") {
+			if err := p.nestedValue(); err != nil {
+				return "", err
+			}
+		}
+
+		p.next()
+	case tok.is(tokPunct, "{"):
+		for !p.peek().is(tokPunct, "}") {
+			if _, err := p.expect(tokName, ""); err != nil {
+				return "", err
+			}
+
+			if _, err := p.expect(tokPunct, ":"); err != nil {
+				return "", err
+			}
+
+			if err := p.nestedValue(); err != nil {
+				return "", err
+			}
+		}
+
+		p.next()
+	case tok.kind == tokName, tok.kind == tokNumber, tok.kind == tokString:
+	default:
+		p.pos--
+
+		return "", p.unexpected()
+	}
+
+	return "", nil
+}
+
+func (p *parser) nestedValue() error {
+	variable, err := p.value()
+	if variable != "" {
+		p.vars = append(p.vars, variable)
+	}
+
+	return err
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+// expect consumes the next token, which must be of kind and, unless value is empty, have that value.
+func (p *parser) expect(kind tokenKind, value string) (string, error) {
+	tok := p.peek()
+
+	if tok.kind != kind || (value != "" && tok.value != value) {
+		return "", p.unexpected()
+	}
+
+	p.next()
+
+	return tok.value, nil
+}
+
+func (p *parser) unexpected() error {
+	tok := p.peek()
+
+	if tok.kind == tokEOF {
+		return fmt.Errorf("%w: unexpected end of document", ErrSyntax)
+	}
+
+	return fmt.Errorf("%w: unexpected %q at offset %d", ErrSyntax, tok.value, tok.pos)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokNumber
+	tokString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) is(kind tokenKind, value string) bool {
+	return t.kind == kind && t.value == value
+}
+
+// lex splits src into tokens, dropping whitespace, commas and comments. The values of strings are not unescaped, as
+// Check has no use for them.
+func lex(src string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(src); {
+		ch := src[i]
+
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == ',':
+			i++
+		case ch == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, token{kind: tokPunct, value: "...", pos: i})
+			i += 3
+		case strings.IndexByte("!$&()[]{}:=@|", ch) >= 0:
+			tokens = append(tokens, token{kind: tokPunct, value: string(ch), pos: i})
+			i++
+		case ch == '_' || isLetter(ch):
+			start := i
+
+			for i < len(src) && (src[i] == '_' || isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokName, value: src[start:i], pos: start})
+		case ch == '-' || isDigit(ch):
+			start := i
+			i++
+
+			for i < len(src) && (isDigit(src[i]) || strings.IndexByte(".eE+-", src[i]) >= 0) {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokNumber, value: src[start:i], pos: start})
+		case strings.HasPrefix(src[i:], `"""`):
+			end := i + 3
+
+			for end < len(src) && !strings.HasPrefix(src[end:], `"""`) {
+				if strings.HasPrefix(src[end:], `\"""`) {
+					end += 4
+				} else {
+					end++
+				}
+			}
+
+			if end >= len(src) {
+				return nil, fmt.Errorf("%w: unterminated block string at offset %d", ErrSyntax, i)
+			}
+
+			tokens = append(tokens, token{kind: tokString, value: src[i : end+3], pos: i})
+			i = end + 3
+		case ch == '"':
+			end := i + 1
+
+			for end < len(src) && src[end] != '"' && src[end] != '\n' {
+				if src[end] == '\\' {
+					end++
+				}
+
+				end++
+			}
+
+			if end >= len(src) || src[end] != '"' {
+				return nil, fmt.Errorf("%w: unterminated string at offset %d", ErrSyntax, i)
+			}
+
+			tokens = append(tokens, token{kind: tokString, value: src[i : end+1], pos: i})
+			i = end + 1
+		case strings.HasPrefix(src[i:], "\uFEFF"):
+			// A byte order mark is ignored like whitespace.
+			i += len("\uFEFF")
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q at offset %d", ErrSyntax, ch, i)
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+func isLetter(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
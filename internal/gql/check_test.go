@@ -0,0 +1,98 @@
+package gql_test
+
+import (
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaCheck(t *testing.T) {
+	t.Parallel()
+
+	schema := testSchema(t)
+
+	for name, tc := range map[string]struct {
+		document string
+		want     []string
+	}{
+		"valid": {
+			document: `# Lists requests.
+query ListRequests($filter: ModelRequestsFilterInput, $limit: Int = 10, $skip: Boolean!) {
+  listRequests(filter: $filter, limit: $limit, nextToken: "a \"quoted\" token") {
+    items { id status ...Approvers @skip(if: $skip) __typename }
+    nextToken
+  }
+  search(text: """block "string" """) {
+    ... on Requests { id }
+    ... on Account { name }
+    __typename
+  }
+  __schema { description }
+}
+
+fragment Approvers on Requests { approvers, approver_ids }`,
+		},
+		"shorthand": {
+			document: `{ getRequests(id: "1") { renamed: id } }`,
+		},
+		"unknown field": {
+			document: `mutation UpdateRequests($input: UpdateRequestsInput!) {
+  updateRequests(input: $input) { id revoker }
+}`,
+			want: []string{"mutation UpdateRequests: updateRequests.revoker: unknown field on type Requests"},
+		},
+		"arguments": {
+			document: `query GetRequests($id: ID) { getRequests(id: $id, owner: "me") { id } search { __typename } }`,
+			want: []string{
+				"query GetRequests: getRequests: variable $id of type ID cannot be passed to argument id of type ID!",
+				"query GetRequests: getRequests: unknown argument owner",
+				"query GetRequests: search: missing required argument text: String!",
+			},
+		},
+		"variables": {
+			document: `query Q($id: Missing, $r: Requests) { getRequests(id: $undefined) { id @include(if: $nope) } }`,
+			want: []string{
+				"query Q: variable $id has unknown type Missing",
+				"query Q: variable $r has type Requests, which is not an input type",
+				"query Q: getRequests: undefined variable $undefined",
+				"query Q: getRequests: undefined variable $nope",
+			},
+		},
+		"selections": {
+			document: `query { getRequests(id: "1") { id { value } } search(text: "x") { id ...Missing ... on Nope { id } } }`,
+			want: []string{
+				"query: getRequests.id: ID has no subfields",
+				"query: search.id: unknown field on type SearchResult",
+				"query: search: unknown fragment Missing",
+				"query: search: unknown type Nope",
+			},
+		},
+		"missing subfields": {
+			document: `subscription OnUpdate { onUpdateRequests }`,
+			want:     []string{"subscription OnUpdate: onUpdateRequests: Requests needs a selection of subfields"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			problems, err := schema.Check(tc.document)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, problems)
+		})
+	}
+}
+
+func TestSchemaCheckSyntaxError(t *testing.T) {
+	t.Parallel()
+
+	for _, document := range []string{
+		`query { getRequests(id: "1") { id }`,
+		`query { getRequests(id: "unterminated) { id } }`,
+		`query { getRequests(id: 1) { id } } %`,
+		`type Query { id: ID }`,
+	} {
+		_, err := (&gql.Schema{}).Check(document)
+		require.ErrorIs(t, err, gql.ErrSyntax, document)
+	}
+}
@@ -0,0 +1,163 @@
+package gql
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/csnewman/team-cli/internal/redact"
+	"github.com/csnewman/team-cli/internal/transport"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TokenSource supplies the access token sent with each request and subscription.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource that always returns the same token.
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// Client talks to a single GraphQL endpoint. Settings that are not given as options follow the process-wide
+// transport settings at the time of each call.
+type Client struct {
+	endpoint   string
+	tokens     TokenSource
+	auth       Authorizer
+	httpClient *http.Client
+	timeouts   transport.Timeouts
+	logger     *slog.Logger
+	retry      *RetryPolicy
+	reconnect  *ReconnectPolicy
+	protocol   Protocol
+	readLimit  int64
+	bodyLimit  int64
+	realtime   string
+	handshake  Handshake
+	limiter    *RateLimiter
+	dialer     WebsocketDialer
+	// tracerProvider is the provider set with WithTracerProvider, nil for the global one.
+	tracerProvider trace.TracerProvider
+	// queryAuth is set once a connection has only been accepted with the authorization in query parameters.
+	queryAuth atomic.Bool
+
+	// connMu guards conn, the websocket connection shared by subscriptions.
+	connMu sync.Mutex
+	conn   *wsConn
+}
+
+// Option customises a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the client used for queries and mutations, instead of transport.Client.
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// WithTimeouts overrides the transport timeouts. Zero fields keep following the transport settings.
+func WithTimeouts(timeouts transport.Timeouts) Option {
+	return func(client *Client) {
+		client.timeouts = timeouts
+	}
+}
+
+// WithReadLimit caps the size in bytes of the websocket messages received, instead of transport.WSReadLimit. A
+// subscription receiving a larger message fails with a MessageTooLargeError.
+func WithReadLimit(limit int64) Option {
+	return func(client *Client) {
+		client.readLimit = limit
+	}
+}
+
+// WithBodyLimit caps the size in bytes of the HTTP response bodies read, instead of transport.BodyLimit. A request
+// receiving a larger body fails with a BodyTooLargeError.
+func WithBodyLimit(limit int64) Option {
+	return func(client *Client) {
+		client.bodyLimit = limit
+	}
+}
+
+// WithRealtimeEndpoint sets the URL that subscriptions connect to, instead of deriving it from the endpoint with
+// GenerateWSAddr. http and https URLs are dialled as ws and wss.
+func WithRealtimeEndpoint(endpoint string) Option {
+	return func(client *Client) {
+		client.realtime = endpoint
+	}
+}
+
+// WithLogger sets the logger for connection progress and unexpected messages, instead of slog.Default. Credentials
+// are redacted from the records before they reach it.
+func WithLogger(logger *slog.Logger) Option {
+	return func(client *Client) {
+		client.logger = logger
+	}
+}
+
+// NewClient returns a client for the GraphQL endpoint, authenticating with tokens from the given source, which may be
+// nil when WithAuthorizer is given.
+func NewClient(endpoint string, tokens TokenSource, opts ...Option) *Client {
+	c := &Client{
+		endpoint: endpoint,
+		tokens:   tokens,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *Client) http() *http.Client {
+	if c.httpClient != nil {
+		return c.httpClient
+	}
+
+	return transport.Client()
+}
+
+func (c *Client) currentTimeouts() transport.Timeouts {
+	current := transport.CurrentTimeouts()
+
+	return transport.Timeouts{
+		HTTP:      cmp.Or(c.timeouts.HTTP, current.HTTP),
+		WSRead:    cmp.Or(c.timeouts.WSRead, current.WSRead),
+		WSWrite:   cmp.Or(c.timeouts.WSWrite, current.WSWrite),
+		Subscribe: cmp.Or(c.timeouts.Subscribe, current.Subscribe),
+		Handshake: cmp.Or(c.timeouts.Handshake, current.Handshake),
+	}
+}
+
+// log returns the logger of the client, which redacts credentials from everything logged through it.
+func (c *Client) log() *slog.Logger {
+	if c.logger != nil {
+		return redact.Logger(c.logger)
+	}
+
+	return redact.Logger(slog.Default())
+}
+
+func (c *Client) authorizer() Authorizer {
+	if c.auth != nil {
+		return c.auth
+	}
+
+	return TokenAuth{Tokens: c.tokens}
+}
+
+func (c *Client) retryPolicy() RetryPolicy {
+	if c.retry == nil {
+		return DefaultRetryPolicy
+	}
+
+	return c.retry.withDefaults()
+}
@@ -0,0 +1,182 @@
+package gql_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+type tokenFunc func(ctx context.Context) (string, error)
+
+func (f tokenFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+func TestClientExecute(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil || r.Header.Get("Authorization") != "token" || string(body) != `{"query":"query { x }"}` {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"data": {"x": 1}}`))
+	}))
+	defer server.Close()
+
+	var requests int
+
+	httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests++
+
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithHTTPClient(httpClient))
+
+	payload, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"x": 1}`, string(payload.Data))
+	require.Equal(t, 1, requests)
+}
+
+func TestClientTokenSourceError(t *testing.T) {
+	t.Parallel()
+
+	errNoToken := errors.New("no token")
+
+	client := gql.NewClient("http://127.0.0.1:0/graphql", tokenFunc(func(context.Context) (string, error) {
+		return "", errNoToken
+	}))
+
+	_, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+	require.ErrorIs(t, err, errNoToken)
+
+	err = client.Subscribe(
+		context.Background(),
+		&gql.Request{Query: "subscription { x }"},
+		func(context.Context) error { return nil },
+		func(context.Context, *gql.Payload) (bool, error) { return false, nil },
+	)
+	require.ErrorIs(t, err, errNoToken)
+}
+
+func TestClientOptions(t *testing.T) {
+	t.Parallel()
+
+	server := realtimeServer(t, nil, 0)
+
+	var logs bytes.Buffer
+
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	client := gql.NewClient(
+		server.URL+"/graphql",
+		gql.StaticToken("token"),
+		gql.WithTimeouts(transport.Timeouts{WSRead: 100 * time.Millisecond}),
+		gql.WithLogger(logger),
+	)
+
+	start := time.Now()
+
+	err := client.Subscribe(
+		context.Background(),
+		&gql.Request{Query: "subscription { x }"},
+		func(context.Context) error { return nil },
+		func(context.Context, *gql.Payload) (bool, error) { return false, nil },
+	)
+	require.ErrorContains(t, err, "i/o timeout")
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Contains(t, logs.String(), "Connecting to websocket")
+}
+
+func TestExecuteRequestTimeout(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+
+		_, _ = w.Write([]byte(`{"data": {"x": 1}}`))
+	}))
+	defer server.Close()
+
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"),
+		gql.WithHTTPClient(&http.Client{Timeout: 100 * time.Millisecond}),
+		gql.WithTimeouts(transport.Timeouts{HTTP: 100 * time.Millisecond}),
+		gql.WithRetryPolicy(gql.NoRetries),
+	)
+
+	req := &gql.Request{Query: "query { x }"}
+
+	_, err := client.Execute(context.Background(), req)
+	require.Error(t, err)
+
+	// A longer timeout for the call outlasts both the HTTP timeout and the timeout of the HTTP client.
+	payload, err := client.Execute(context.Background(), req, gql.WithRequestTimeout(5*time.Second))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"x": 1}`, string(payload.Data))
+
+	// An earlier deadline of the caller is kept.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, err = client.Execute(ctx, req, gql.WithRequestTimeout(5*time.Second))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 250*time.Millisecond)
+}
+
+func TestExecuteGzip(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+
+		zw := gzip.NewWriter(w)
+		_, _ = zw.Write([]byte(`{"data": {"x": 1}}`))
+		_ = zw.Close()
+	}))
+	defer server.Close()
+
+	// Responses are decompressed whether or not the transport would have done so itself.
+	for name, httpClient := range map[string]*http.Client{
+		"default":   http.DefaultClient,
+		"transport": {Transport: roundTripFunc(http.DefaultTransport.RoundTrip)},
+	} {
+		client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithHTTPClient(httpClient))
+
+		payload, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+		require.NoError(t, err, name)
+		require.JSONEq(t, `{"x": 1}`, string(payload.Data), name)
+	}
+}
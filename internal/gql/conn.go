@@ -0,0 +1,645 @@
+package gql
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/logging"
+	"github.com/csnewman/team-cli/internal/redact"
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WebsocketConn is the part of a websocket connection that subscriptions use. *websocket.Conn implements it, and
+// gqltest.Conn fakes it, so that the protocol can be exercised without a server.
+type WebsocketConn interface {
+	// Subprotocol returns the subprotocol the server picked.
+	Subprotocol() string
+	// SetReadLimit caps the size in bytes of the frames read.
+	SetReadLimit(limit int64)
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	// NextReader returns the type and content of the next data message.
+	NextReader() (int, io.Reader, error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	Close() error
+}
+
+// WebsocketDialer opens a websocket to url with the given handshake header. The handshake response is returned even
+// when the server rejects the handshake, if there was one.
+type WebsocketDialer func(ctx context.Context, url string, header http.Header) (WebsocketConn, *http.Response, error)
+
+// WithWebsocketDialer sets how the connections of subscriptions are opened, instead of transport.DialWebsocket.
+func WithWebsocketDialer(dialer WebsocketDialer) Option {
+	return func(client *Client) {
+		client.dialer = dialer
+	}
+}
+
+// dialTransport is the default WebsocketDialer.
+func dialTransport(ctx context.Context, url string, header http.Header) (WebsocketConn, *http.Response, error) {
+	ws, resp, err := transport.DialWebsocket(ctx, url, header)
+	if err != nil {
+		// A nil *websocket.Conn would make a non-nil WebsocketConn.
+		return nil, resp, err
+	}
+
+	return ws, resp, nil
+}
+
+// wsConn is a websocket connection shared by the subscriptions of a client. It is initialised once, after which a
+// reader routes the messages received to the subscriptions by ID. It is closed when the last subscription leaves, or
+// as soon as it fails.
+type wsConn struct {
+	client   *Client
+	ws       WebsocketConn
+	protocol wsProtocol
+	// writeMu serialises writes, which may come from the pinger and the reader as well as the subscriptions.
+	writeMu sync.Mutex
+	// stopPinging stops the pinger, for protocols in which the client keeps the connection alive.
+	stopPinging func()
+	// readTimeout is how long to wait for a message, keep-alives included: the WSRead timeout, or the shorter one the
+	// server may set when acknowledging the connection.
+	readTimeout time.Duration
+	// handshakeTimeout bounds the wait for connection_ack, and then for each start_ack.
+	handshakeTimeout time.Duration
+	// writeTimeout bounds sending each message.
+	writeTimeout time.Duration
+	// readLimit is the size in bytes of the largest message accepted.
+	readLimit int64
+	// handshake is the header of the handshake response, identifying the connection in errors.
+	handshake http.Header
+	// lastMessage is when the last message was received.
+	lastMessage time.Time
+	logger      *slog.Logger
+
+	// mu guards subs.
+	mu   sync.Mutex
+	subs map[string]*wsSubscriber
+
+	// done is closed once the connection has failed or been closed, after which err holds why.
+	done     chan struct{}
+	err      error
+	failOnce sync.Once
+	// readerDone is closed once the reader has returned.
+	readerDone   chan struct{}
+	teardownOnce sync.Once
+}
+
+// join adds a subscription to the client's connection, dialing a new one if there is none or it has failed.
+func (c *Client) join(ctx context.Context, u *url.URL) (*wsSubscriber, error) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	// A failed connection is normally forgotten by its reader, but may not have been yet.
+	if c.conn != nil {
+		select {
+		case <-c.conn.done:
+			c.conn = nil
+		default:
+		}
+	}
+
+	if c.conn == nil {
+		conn, err := c.dial(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+
+		c.conn = conn
+	}
+
+	return c.conn.add(ctx), nil
+}
+
+// realtimeURL returns the URL of the realtime endpoint of the API at u.
+func (c *Client) realtimeURL(u *url.URL) (*url.URL, error) {
+	if c.realtime == "" {
+		realtime := *u
+		GenerateWSAddr(&realtime)
+
+		return &realtime, nil
+	}
+
+	realtime, err := url.Parse(c.realtime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid realtime endpoint: %w", err)
+	}
+
+	realtime.Scheme = wsScheme(realtime.Scheme)
+
+	return realtime, nil
+}
+
+// dialWebsocket opens a websocket to realtime. auth, the encoded authorization of the connection, is passed in the
+// header and payload query parameters when query is set, and as a subprotocol otherwise.
+func (c *Client) dialWebsocket(
+	ctx context.Context,
+	realtime *url.URL,
+	auth []byte,
+	query bool,
+) (WebsocketConn, *http.Response, error) {
+	var subprotocols []string
+
+	switch c.protocol {
+	case ProtocolAuto:
+		subprotocols = []string{string(ProtocolAppSync), string(ProtocolTransportWS)}
+	case ProtocolAppSync:
+		subprotocols = []string{string(ProtocolAppSync)}
+	default:
+		subprotocols = []string{string(c.protocol)}
+	}
+
+	target := *realtime
+
+	// AppSync takes the auth data from the header subprotocol or query parameter, other servers from the
+	// connection_init message. Both use unpadded base64url.
+	if c.protocol != ProtocolTransportWS {
+		encAuth := base64.RawURLEncoding.EncodeToString(auth)
+
+		if query {
+			params := target.Query()
+			params.Set("header", encAuth)
+			params.Set("payload", base64.RawURLEncoding.EncodeToString([]byte("{}")))
+			target.RawQuery = params.Encode()
+		} else {
+			subprotocols = append(subprotocols, "header-"+encAuth)
+		}
+	}
+
+	// Offered as a single header, since some servers only read the first.
+	dialHeader := http.Header{"sec-websocket-protocol": []string{strings.Join(subprotocols, ", ")}}
+
+	if agent := transport.UserAgent(); agent != "" {
+		dialHeader.Set("User-Agent", agent)
+	}
+
+	injectTraceContext(ctx, dialHeader)
+
+	endpoint := target.String()
+
+	if logging.TraceEnabled(ctx) {
+		logging.Trace(ctx, "Dialing websocket", "endpoint", redact.URL(endpoint), "headers", redact.Header(dialHeader))
+	}
+
+	dialer := c.dialer
+	if dialer == nil {
+		dialer = dialTransport
+	}
+
+	return dialer(ctx, endpoint, dialHeader)
+}
+
+// dial connects to the realtime endpoint of the API at u and initialises the connection, recording both as a span.
+func (c *Client) dial(ctx context.Context, u *url.URL) (*wsConn, error) {
+	ctx, span := c.tracer(ctx).Start(ctx, "websocket connect", trace.WithSpanKind(trace.SpanKindClient))
+
+	conn, err := c.openConn(ctx, u)
+
+	endSpan(span, err)
+
+	return conn, err
+}
+
+// openConn is dial without its span.
+func (c *Client) openConn(ctx context.Context, u *url.URL) (*wsConn, error) {
+	logger := c.log()
+
+	connectURL := u.JoinPath("connect")
+
+	authExt, err := c.authorizer().AuthorizeRealtime(ctx, connectURL, []byte("{}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize connection: %w", err)
+	}
+
+	realtime, err := c.realtimeURL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Connecting to websocket", "endpoint", redact.URL(realtime.String()))
+
+	encAuth, err := json.Marshal(authExt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal auth data: %w", err)
+	}
+
+	query := c.handshake == HandshakeQuery || c.queryAuth.Load()
+
+	ws, resp, err := c.dialWebsocket(ctx, realtime, encAuth, query)
+	if err != nil && !query && c.handshake == HandshakeAuto && c.protocol != ProtocolTransportWS &&
+		resp != nil && resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		// Some deployments, and proxies mangling Sec-WebSocket-Protocol, only accept the authorization in the URL.
+		logger.Debug("Websocket handshake rejected, retrying with query parameters", "status", resp.StatusCode)
+
+		ws, resp, err = c.dialWebsocket(ctx, realtime, encAuth, true)
+		if err == nil {
+			c.queryAuth.Store(true)
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, transport.ErrProxy) {
+			// Proxies often only allow the API host, while subscriptions use a separate realtime host.
+			return nil, fmt.Errorf("failed to dial websocket: %w (the realtime endpoint %s may need an allow-list entry)",
+				err, realtime.Host)
+		}
+
+		if resp == nil {
+			return nil, fmt.Errorf("failed to dial websocket: %w", err)
+		}
+
+		if unauthorizedStatus(resp.StatusCode) {
+			body, _ := io.ReadAll(resp.Body)
+			err = unauthorizedError(resp.StatusCode, resp.Header, body)
+		}
+
+		return nil, withResponse(fmt.Errorf("failed to dial websocket: %w", err), resp.Header)
+	}
+
+	protocol := Protocol(ws.Subprotocol())
+	if c.protocol != ProtocolAuto {
+		protocol = c.protocol
+	}
+
+	logger.Debug(
+		"Websocket connected",
+		"protocol", cmp.Or(protocol, ProtocolAppSync),
+		"requestId", resp.Header.Get("x-amzn-RequestId"),
+		"accept", resp.Header.Get("Sec-WebSocket-Accept"),
+	)
+
+	timeouts := c.currentTimeouts()
+	readLimit := cmp.Or(c.readLimit, transport.WSReadLimit())
+
+	ws.SetReadLimit(readLimit)
+
+	conn := &wsConn{
+		client:           c,
+		ws:               ws,
+		protocol:         protocolFor(string(protocol)),
+		readTimeout:      timeouts.WSRead,
+		handshakeTimeout: timeouts.Handshake,
+		writeTimeout:     timeouts.WSWrite,
+		readLimit:        readLimit,
+		handshake:        resp.Header,
+		lastMessage:      time.Now(),
+		logger:           logger,
+		subs:             map[string]*wsSubscriber{},
+		done:             make(chan struct{}),
+		readerDone:       make(chan struct{}),
+	}
+
+	if err := conn.initConnection(ctx, authExt); err != nil {
+		close(conn.readerDone)
+		conn.teardown()
+
+		return nil, withResponse(fmt.Errorf("failed to init connection: %w", err), resp.Header)
+	}
+
+	logger.Debug("Websocket initialized")
+
+	go conn.readLoop()
+
+	return conn, nil
+}
+
+func (c *wsConn) initConnection(ctx context.Context, authExt map[string]string) error {
+	// Moving the read deadline to now when ctx ends interrupts a blocked read. Once initialised, the connection
+	// outlives the context of the subscription that dialed it.
+	stopWatch := context.AfterFunc(ctx, func() { _ = c.ws.SetReadDeadline(time.Now()) })
+	defer stopWatch()
+
+	if err := c.send(c.protocol.connectionInit(authExt)); err != nil {
+		return fmt.Errorf("failed to send connection_init: %w", err)
+	}
+
+	deadline := time.Now().Add(c.handshakeTimeout)
+
+	for {
+		pkt, err := c.readHandshake(ctx, "connection_ack", deadline)
+		if err != nil {
+			return fmt.Errorf("failed to read packet: %w", err)
+		}
+
+		switch pkt.Type {
+		case "ka":
+		// Ignore keep-alives
+		case "connection_ack":
+			if pkt.Payload != nil && pkt.Payload.ConnectionTimeoutMs > 0 {
+				// Allow for the keep-alive being delayed on its way. AppSync allows five minutes while sending a
+				// keep-alive every minute, so the WSRead timeout still applies when it is shorter, to notice a dead
+				// connection sooner.
+				serverTimeout := time.Duration(pkt.Payload.ConnectionTimeoutMs)*time.Millisecond + keepAliveSlack
+				c.readTimeout = min(c.readTimeout, serverTimeout)
+
+				c.logger.Debug("Server set the connection timeout", "timeout", c.readTimeout)
+			}
+
+			if c.protocol.clientPings() {
+				c.startPinging(c.readTimeout / 2)
+			}
+
+			return nil
+		case "connection_error":
+			return websocketError(c.logger, pkt)
+		default:
+			c.logger.Warn("Received unexpected packet", "type", pkt.Type)
+		}
+	}
+}
+
+// add registers a new subscription, which must later leave.
+func (c *wsConn) add(ctx context.Context) *wsSubscriber {
+	s := newSubscriber(ctx, c)
+
+	c.mu.Lock()
+	c.subs[s.id] = s
+	c.mu.Unlock()
+
+	return s
+}
+
+// leave removes a subscription, closing the connection if it was the last.
+func (c *wsConn) leave(s *wsSubscriber) {
+	c.client.connMu.Lock()
+
+	c.mu.Lock()
+	delete(c.subs, s.id)
+	last := len(c.subs) == 0
+	c.mu.Unlock()
+
+	if last && c.client.conn == c {
+		c.client.conn = nil
+	}
+
+	c.client.connMu.Unlock()
+
+	if last {
+		c.close()
+	}
+}
+
+// readLoop routes the messages received to their subscriptions until the connection fails or is closed.
+func (c *wsConn) readLoop() {
+	defer close(c.readerDone)
+
+	for {
+		pkt, err := c.read()
+		if err != nil {
+			c.fail(err)
+
+			return
+		}
+
+		switch {
+		case pkt.Type == "ka":
+		// Ignore keep-alives
+		case pkt.ID != "":
+			c.mu.Lock()
+			s := c.subs[pkt.ID]
+			c.mu.Unlock()
+
+			if s == nil {
+				c.logger.Warn("Received packet for unknown subscription", "type", pkt.Type, "id", pkt.ID)
+
+				continue
+			}
+
+			s.deliver(pkt)
+		case pkt.Type == "error":
+			// Errors not tied to a subscription concern all of them.
+			c.mu.Lock()
+			for _, s := range c.subs {
+				s.deliver(pkt)
+			}
+			c.mu.Unlock()
+		default:
+			c.logger.Warn("Received unexpected packet", "type", pkt.Type)
+		}
+	}
+}
+
+// fail ends every subscription with err, and closes the connection so that no new ones join it.
+func (c *wsConn) fail(err error) {
+	c.failOnce.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+
+	c.client.connMu.Lock()
+	if c.client.conn == c {
+		c.client.conn = nil
+	}
+	c.client.connMu.Unlock()
+
+	c.teardown()
+}
+
+// close closes the connection once no subscription uses it. Unless it has failed, a close frame is sent first, so that
+// the server does not count the connection as dropped.
+func (c *wsConn) close() {
+	select {
+	case <-c.done:
+	default:
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+
+		if err := c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(shutdownTimeout)); err != nil {
+			c.logger.Debug("Failed to send close frame", "err", err)
+		}
+	}
+
+	c.teardown()
+
+	<-c.readerDone
+}
+
+// teardown stops the pinger and closes the socket, which ends the reader.
+func (c *wsConn) teardown() {
+	c.teardownOnce.Do(func() {
+		if c.stopPinging != nil {
+			c.stopPinging()
+		}
+
+		_ = c.ws.Close()
+	})
+}
+
+// read reads the next message. Without one, not even a keep-alive, within the read timeout, the connection is taken
+// to have died silently, as when the network drops its packets, and ErrKeepAliveTimeout is returned.
+func (c *wsConn) read() (*wsMessage, error) {
+	pkt, err := c.readBefore(context.Background(), time.Now().Add(c.readTimeout))
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil, fmt.Errorf("%w: nothing received for %s: %w",
+			ErrKeepAliveTimeout, time.Since(c.lastMessage).Round(time.Millisecond), err)
+	}
+
+	return pkt, err
+}
+
+// readHandshake reads the next message while waiting for the given acknowledgement, which must arrive before deadline
+// however many keep-alives come first.
+func (c *wsConn) readHandshake(ctx context.Context, ack string, deadline time.Time) (*wsMessage, error) {
+	if time.Now().Add(c.readTimeout).Before(deadline) {
+		return c.read()
+	}
+
+	pkt, err := c.readBefore(ctx, deadline)
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil, handshakeTimeoutError(ack, c.handshakeTimeout, err)
+	}
+
+	return pkt, err
+}
+
+// handshakeTimeoutError reports that the acknowledgement did not arrive within timeout.
+func handshakeTimeoutError(ack string, timeout time.Duration, err error) error {
+	return fmt.Errorf("%w: no %s within %s: %w", ErrHandshakeTimeout, ack, timeout, err)
+}
+
+// readBefore reads the next message, failing if none arrives before deadline or ctx ends.
+func (c *wsConn) readBefore(ctx context.Context, deadline time.Time) (*wsMessage, error) {
+	if err := c.ws.SetReadDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("failed to set read deadline: %w", err)
+	}
+
+	// The context may have ended before the deadline was set, replacing the one that interrupts reads.
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	raw, err := c.readMessage()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("failed to read message: %w", ctxErr)
+		}
+
+		// The server closing the connection normally ends the subscriptions, anything else merely drops them.
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			return nil, fmt.Errorf("failed to read message: %w", err)
+		}
+
+		// Reconnecting would only receive the same message again.
+		if errors.Is(err, websocket.ErrReadLimit) {
+			return nil, fmt.Errorf("failed to read message: %w", &MessageTooLargeError{Limit: c.readLimit})
+		}
+
+		return nil, fmt.Errorf("%w: failed to read message: %w", errConnectionLost, err)
+	}
+
+	c.lastMessage = time.Now()
+
+	if logging.TraceEnabled(context.Background()) {
+		logging.Trace(context.Background(), "Received websocket frame", "frame", redact.JSON(raw))
+	}
+
+	res, err := c.protocol.decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON: %w", err)
+	}
+
+	// Pings are answered straight away, and otherwise count as keep-alives.
+	if res.Type == "ping" {
+		if err := c.send(&wsMessage{Type: "pong"}); err != nil {
+			return nil, fmt.Errorf("failed to answer ping: %w", err)
+		}
+
+		res.Type = "ka"
+	}
+
+	return res, nil
+}
+
+// readMessage reads the next message. The read limit of the connection applies to the frames as sent, so compressed
+// messages are held to it again once decompressed.
+func (c *wsConn) readMessage() ([]byte, error) {
+	_, r, err := c.ws.NextReader()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r, c.readLimit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(raw)) > c.readLimit {
+		return nil, websocket.ErrReadLimit
+	}
+
+	return raw, nil
+}
+
+// startPinging pings the server every interval until the connection is closed, so that it answers with pongs that
+// keep the connection alive.
+func (c *wsConn) startPinging(interval time.Duration) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := c.send(&wsMessage{Type: "ping"}); err != nil {
+					c.logger.Debug("Failed to ping server", "err", err)
+
+					return
+				}
+			}
+		}
+	}()
+
+	c.stopPinging = func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (c *wsConn) send(msg any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.ws.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+		return fmt.Errorf("failed to set write deadline: %w", err)
+	}
+
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	if logging.TraceEnabled(context.Background()) {
+		logging.Trace(context.Background(), "Sending websocket frame", "frame", redact.JSON(raw))
+	}
+
+	if err := c.ws.WriteMessage(websocket.TextMessage, raw); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+
+	return nil
+}
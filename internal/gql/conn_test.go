@@ -0,0 +1,252 @@
+package gql_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// multiplexServer runs any number of subscriptions per connection, publishing to each of them every 10ms until
+// stopped. The number of connections is counted, and the close code of each is sent to closed.
+func multiplexServer(t *testing.T, closed chan<- int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var connections atomic.Int32
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-ws"}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer ws.Close()
+
+		connections.Add(1)
+
+		var (
+			mu     sync.Mutex
+			active = map[string]bool{}
+		)
+
+		send := func(msg any) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			_ = ws.WriteJSON(msg)
+		}
+
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+				}
+
+				mu.Lock()
+				for id := range active {
+					_ = ws.WriteJSON(map[string]any{"type": "data", "id": id, "payload": map[string]any{"data": id}})
+				}
+				mu.Unlock()
+			}
+		}()
+
+		for {
+			var msg struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+			}
+
+			if err := ws.ReadJSON(&msg); err != nil {
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					closed <- closeErr.Code
+				}
+
+				return
+			}
+
+			switch msg.Type {
+			case "connection_init":
+				send(map[string]string{"type": "connection_ack"})
+			case "start":
+				mu.Lock()
+				active[msg.ID] = true
+				mu.Unlock()
+
+				send(map[string]string{"type": "start_ack", "id": msg.ID})
+			case "stop":
+				mu.Lock()
+				delete(active, msg.ID)
+				mu.Unlock()
+
+				send(map[string]string{"type": "complete", "id": msg.ID})
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &connections
+}
+
+func TestSubscribeMultiplexes(t *testing.T) {
+	t.Parallel()
+
+	closed := make(chan int, 1)
+	server, connections := multiplexServer(t, closed)
+
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), quiet)
+
+	var (
+		firstDone atomic.Bool
+		wg        sync.WaitGroup
+		errs      [2]error
+		ids       [2]map[string]bool
+	)
+
+	// Each subscription only sees its own data. The second carries on after the first stops.
+	run := func(i int, cont func(seen int) bool) {
+		defer wg.Done()
+
+		ids[i] = map[string]bool{}
+		seen := 0
+
+		errs[i] = client.Subscribe(
+			context.Background(),
+			&gql.Request{Query: "subscription { x }"},
+			func(context.Context) error { return nil },
+			func(_ context.Context, payload *gql.Payload) (bool, error) {
+				ids[i][string(payload.Data)] = true
+				seen++
+
+				return cont(seen), nil
+			},
+		)
+	}
+
+	afterFirst := 0
+
+	wg.Add(2)
+
+	go run(0, func(seen int) bool {
+		if seen < 3 {
+			return true
+		}
+
+		firstDone.Store(true)
+
+		return false
+	})
+	go run(1, func(int) bool {
+		if firstDone.Load() {
+			afterFirst++
+		}
+
+		return afterFirst < 5
+	})
+
+	wg.Wait()
+
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	require.Len(t, ids[0], 1)
+	require.Len(t, ids[1], 1)
+	require.NotEqual(t, ids[0], ids[1])
+	require.Equal(t, int32(1), connections.Load())
+
+	// The connection is closed cleanly once the last subscription stops.
+	select {
+	case code := <-closed:
+		require.Equal(t, websocket.CloseNormalClosure, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed")
+	}
+
+	// A later subscription dials a new connection.
+	_, err := collectClient(client, 1)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), connections.Load())
+}
+
+// compressingServer sends a large, compressed data message on each subscription, and reports the extensions each
+// client offers to extensions.
+func compressingServer(t *testing.T, extensions chan<- string) *httptest.Server {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-ws"}, EnableCompression: true}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case extensions <- r.Header.Get("Sec-Websocket-Extensions"):
+		default:
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer ws.Close()
+
+		var msg struct {
+			ID string `json:"id"`
+		}
+
+		for _, ack := range []string{"connection_ack", "start_ack"} {
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+
+			if err := ws.WriteJSON(map[string]string{"type": ack, "id": msg.ID}); err != nil {
+				return
+			}
+		}
+
+		ws.EnableWriteCompression(true)
+
+		policy := strings.Repeat(`{"accountId": "123456789012"}, `, 1000)
+		_ = ws.WriteJSON(map[string]any{"type": "data", "id": msg.ID, "payload": map[string]any{"data": policy}})
+
+		completeOnStop(ws)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestSubscribeCompression(t *testing.T) {
+	t.Parallel()
+
+	extensions := make(chan string, 1)
+	server := compressingServer(t, extensions)
+
+	seen, err := collect(server, 1)
+	require.NoError(t, err)
+	require.Len(t, seen, 1)
+	require.Contains(t, seen[0], "123456789012")
+	require.Contains(t, <-extensions, "permessage-deflate")
+
+	// The read limit applies to the decompressed message, which is far larger than the frames sent.
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithReadLimit(8192))
+
+	_, err = collectClient(client, 1)
+	require.ErrorIs(t, err, gql.ErrMessageTooLarge)
+}
@@ -0,0 +1,318 @@
+package gql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnauthorized is returned when the server rejects the access token with 401 Unauthorized or 403 Forbidden,
+// typically because it has expired or been revoked. Obtaining a new token may resolve it.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// unauthorizedStatus reports whether a response with the status code rejects the access token.
+func unauthorizedStatus(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// unauthorizedError describes a response rejecting the access token, including the error type that AWS services
+// send in the x-amzn-ErrorType header.
+func unauthorizedError(code int, header http.Header, body []byte) error {
+	if errorType := amznErrorType(header); errorType != "" {
+		return fmt.Errorf("%w: status code %d (%s): %q", ErrUnauthorized, code, errorType, excerpt(body))
+	}
+
+	return fmt.Errorf("%w: status code %d: %q", ErrUnauthorized, code, excerpt(body))
+}
+
+// maxExcerpt is the number of bytes of a response body quoted in errors, enough to identify an error page without
+// flooding the terminal.
+const maxExcerpt = 256
+
+// excerpt returns the start of body, to quote in errors.
+func excerpt(body []byte) string {
+	if len(body) <= maxExcerpt {
+		return string(body)
+	}
+
+	// The cut is moved back to the start of a rune, so as not to split it.
+	end := maxExcerpt
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+
+	return string(body[:end]) + "…"
+}
+
+// amznErrorType returns the error type that AWS services send in the x-amzn-ErrorType header, or "".
+func amznErrorType(header http.Header) string {
+	// The header may carry a URL after the type, as in "UnauthorizedException:http://internal.amazon.com/...".
+	errorType, _, _ := strings.Cut(header.Get("x-amzn-ErrorType"), ":")
+
+	return errorType
+}
+
+// ResponseError adds the identifiers of the response an error came from, which the administrators of the API need to
+// find the failure in its logs.
+type ResponseError struct {
+	// RequestID is the x-amzn-RequestId header of the response.
+	RequestID string
+	// ErrorType is the x-amzn-ErrorType header of the response.
+	ErrorType string
+	// WebSocketAccept is the Sec-WebSocket-Accept header of a websocket handshake response.
+	WebSocketAccept string
+	Err             error
+}
+
+func (e *ResponseError) Error() string {
+	var b strings.Builder
+
+	b.WriteString(e.Err.Error())
+
+	if e.ErrorType != "" && !strings.Contains(b.String(), e.ErrorType) {
+		fmt.Fprintf(&b, " (%s)", e.ErrorType)
+	}
+
+	if e.WebSocketAccept != "" {
+		fmt.Fprintf(&b, " (websocket accept: %s)", e.WebSocketAccept)
+	}
+
+	// The request ID goes last, so that it is easy to copy.
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request id: %s)", e.RequestID)
+	}
+
+	return b.String()
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+// withResponse wraps err in a ResponseError carrying the identifiers found in the header of its response, if any.
+func withResponse(err error, header http.Header) error {
+	if err == nil || header == nil {
+		return err
+	}
+
+	res := &ResponseError{
+		RequestID:       header.Get("x-amzn-RequestId"),
+		ErrorType:       amznErrorType(header),
+		WebSocketAccept: header.Get("Sec-WebSocket-Accept"),
+		Err:             err,
+	}
+
+	if res.RequestID == "" && res.ErrorType == "" && res.WebSocketAccept == "" {
+		return err
+	}
+
+	return res
+}
+
+// ErrMessageTooLarge is matched by the MessageTooLargeError returned when the server sends a websocket message over
+// the read limit.
+var ErrMessageTooLarge = errors.New("websocket message too large")
+
+// MessageTooLargeError reports a websocket message over the read limit, which large payloads may need raised. It
+// matches ErrMessageTooLarge with errors.Is.
+type MessageTooLargeError struct {
+	Limit int64
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("%s: over the limit of %d bytes", ErrMessageTooLarge, e.Limit)
+}
+
+func (e *MessageTooLargeError) Is(target error) bool {
+	return target == ErrMessageTooLarge
+}
+
+// ErrBodyTooLarge is matched by the BodyTooLargeError returned when the server sends a response body over the limit.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// BodyTooLargeError reports an HTTP response body over the limit, which is left unread. It matches ErrBodyTooLarge
+// with errors.Is.
+type BodyTooLargeError struct {
+	Limit       int64
+	StatusCode  int
+	ContentType string
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("%s: over the limit of %d bytes (status code %d, content type %q)",
+		ErrBodyTooLarge, e.Limit, e.StatusCode, e.ContentType)
+}
+
+func (e *BodyTooLargeError) Is(target error) bool {
+	return target == ErrBodyTooLarge
+}
+
+// ErrNotJSON is matched by the NotJSONError returned when a response body is not JSON.
+var ErrNotJSON = errors.New("response is not JSON")
+
+// NotJSONError reports a response body that is not JSON, as when the endpoint is misconfigured or a proxy answers
+// with an HTML page of its own. It matches ErrNotJSON and ErrUnexpected with errors.Is.
+type NotJSONError struct {
+	StatusCode  int
+	ContentType string
+	// Excerpt is the start of the body.
+	Excerpt string
+}
+
+func (e *NotJSONError) Error() string {
+	return fmt.Sprintf("%s: status code %d, content type %q: %q", ErrNotJSON, e.StatusCode, e.ContentType, e.Excerpt)
+}
+
+func (e *NotJSONError) Is(target error) bool {
+	return target == ErrNotJSON || target == ErrUnexpected
+}
+
+// Error is an entry in the errors of a GraphQL response, or of a websocket error message.
+type Error struct {
+	ErrorType string `json:"errorType"`
+	Message   string `json:"message"`
+	// ErrorCode is the status code AppSync gives some websocket errors, such as 401 for UnauthorizedException.
+	ErrorCode int `json:"errorCode,omitempty"`
+	// ErrorInfo is the additional information a resolver may attach to an error, as decoded JSON.
+	ErrorInfo any `json:"errorInfo,omitempty"`
+	// Path locates the field that failed, as field names and list indices.
+	Path []any `json:"path,omitempty"`
+}
+
+func (e *Error) String() string {
+	var b strings.Builder
+
+	if e.ErrorType != "" {
+		b.WriteString(e.ErrorType)
+		b.WriteString(": ")
+	}
+
+	b.WriteString(e.Message)
+
+	if e.ErrorCode != 0 {
+		fmt.Fprintf(&b, " (code %d)", e.ErrorCode)
+	}
+
+	if len(e.Path) > 0 {
+		parts := make([]string, len(e.Path))
+		for i, p := range e.Path {
+			parts[i] = fmt.Sprint(p)
+		}
+
+		fmt.Fprintf(&b, " (at %s)", strings.Join(parts, "."))
+	}
+
+	if e.ErrorInfo != nil {
+		if info, err := json.Marshal(e.ErrorInfo); err == nil {
+			fmt.Fprintf(&b, " (info: %s)", info)
+		}
+	}
+
+	return b.String()
+}
+
+// logAttrs returns the attributes to log the error with.
+func (e *Error) logAttrs() []any {
+	attrs := []any{"errorType", e.ErrorType, "message", e.Message}
+
+	if e.ErrorCode != 0 {
+		attrs = append(attrs, "errorCode", e.ErrorCode)
+	}
+
+	if e.ErrorInfo != nil {
+		attrs = append(attrs, "errorInfo", e.ErrorInfo)
+	}
+
+	if len(e.Path) > 0 {
+		attrs = append(attrs, "path", e.Path)
+	}
+
+	return attrs
+}
+
+// GraphQLError is returned by Execute when the response carries errors. The response may still hold partial data,
+// so Execute returns its payload alongside. It matches ErrUnexpected with errors.Is.
+type GraphQLError struct {
+	Errors []*Error
+}
+
+func (e *GraphQLError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, entry := range e.Errors {
+		msgs[i] = entry.String()
+	}
+
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+func (e *GraphQLError) Is(target error) bool {
+	return target == ErrUnexpected
+}
+
+// ErrMaxSubscriptions is matched by a WebsocketError when the server refuses a subscription because the connection
+// holds as many as it allows. Backing off until other subscriptions end may resolve it.
+var ErrMaxSubscriptions = errors.New("too many subscriptions")
+
+// WebsocketError is returned by Subscribe when the server reports errors in an error or connection_error message. It
+// matches ErrUnexpected with errors.Is, as well as ErrUnauthorized when the server rejected the access token, so that
+// callers can obtain a new one, and ErrMaxSubscriptions when it refused the subscription, so that callers can back off.
+type WebsocketError struct {
+	// MessageType is the type of the message carrying the errors: error or connection_error.
+	MessageType string
+	Errors      []*Error
+}
+
+func (e *WebsocketError) Error() string {
+	prefix := "websocket error"
+	if e.MessageType == "connection_error" {
+		prefix = "connection error"
+	}
+
+	if len(e.Errors) == 0 {
+		return prefix
+	}
+
+	msgs := make([]string, len(e.Errors))
+	for i, entry := range e.Errors {
+		msgs[i] = entry.String()
+	}
+
+	return prefix + ": " + strings.Join(msgs, "; ")
+}
+
+func (e *WebsocketError) Is(target error) bool {
+	switch target {
+	case ErrUnexpected:
+		return true
+	case ErrUnauthorized:
+		return slices.ContainsFunc(e.Errors, func(entry *Error) bool {
+			return entry.ErrorType == "UnauthorizedException" || unauthorizedStatus(entry.ErrorCode)
+		})
+	case ErrMaxSubscriptions:
+		return slices.ContainsFunc(e.Errors, func(entry *Error) bool {
+			return entry.ErrorType == "MaxSubscriptionsReachedError"
+		})
+	default:
+		return false
+	}
+}
+
+// websocketError logs the errors of an error or connection_error message, and returns them as a WebsocketError.
+func websocketError(logger *slog.Logger, pkt *wsMessage) error {
+	err := &WebsocketError{MessageType: pkt.Type}
+
+	if pkt.Payload != nil {
+		err.Errors = pkt.Payload.Errors
+	}
+
+	for _, entry := range err.Errors {
+		logger.Warn("Received websocket error", entry.logAttrs()...)
+	}
+
+	return err
+}
@@ -0,0 +1,185 @@
+package gql_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteGraphQLError(t *testing.T) {
+	t.Parallel()
+
+	server, _ := statusServer(t, `{"data": {"a": 1, "b": null}, "errors": [`+
+		`{"errorType": "Unauthorized", "message": "Not Authorized to access b", "path": ["b", 0, "c"]},`+
+		`{"message": "Something else"}]}`, http.StatusOK)
+
+	payload, err := execute(server, gql.NoRetries)
+	require.ErrorIs(t, err, gql.ErrUnexpected)
+	require.EqualError(t, err, "graphql: Unauthorized: Not Authorized to access b (at b.0.c); Something else")
+
+	var gqlErr *gql.GraphQLError
+	require.ErrorAs(t, err, &gqlErr)
+	require.Len(t, gqlErr.Errors, 2)
+	require.Equal(t, "Unauthorized", gqlErr.Errors[0].ErrorType)
+	require.Equal(t, []any{"b", float64(0), "c"}, gqlErr.Errors[0].Path)
+
+	// The partial data is still available.
+	require.NotNil(t, payload)
+	require.JSONEq(t, `{"a": 1, "b": null}`, string(payload.Data))
+}
+
+func TestExecuteUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+
+		w.Header().Set("x-amzn-ErrorType", "UnauthorizedException:http://internal.amazon.com/coral/com.amazonaws.deepdish/")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"errors":[{"errorType":"UnauthorizedException","message":"Token has expired."}]}`))
+	}))
+	defer server.Close()
+
+	_, err := execute(server, fastRetries)
+	require.ErrorIs(t, err, gql.ErrUnauthorized)
+	require.NotErrorIs(t, err, gql.ErrUnexpected)
+	require.ErrorContains(t, err, "status code 401 (UnauthorizedException)")
+	require.ErrorContains(t, err, "Token has expired.")
+
+	// Retrying with the same token cannot help.
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestSubscribeUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	server, _ := statusServer(t, "Forbidden", http.StatusForbidden)
+
+	err := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token")).Subscribe(
+		context.Background(),
+		&gql.Request{Query: "subscription { x }"},
+		func(context.Context) error { return nil },
+		func(context.Context, *gql.Payload) (bool, error) { return false, nil },
+	)
+	require.ErrorIs(t, err, gql.ErrUnauthorized)
+	require.ErrorContains(t, err, "status code 403")
+}
+
+func TestExecuteRequestID(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("x-amzn-RequestId", "5a2c7e0e-0001")
+		w.Header().Set("x-amzn-ErrorType", "BadRequestException")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`bad`))
+	}))
+	defer server.Close()
+
+	_, err := execute(server, gql.NoRetries)
+	require.ErrorIs(t, err, gql.ErrUnexpected)
+	require.EqualError(t, err,
+		`response is not JSON: status code 400, content type "text/plain; charset=utf-8": "bad" (BadRequestException) `+
+			`(request id: 5a2c7e0e-0001)`,
+	)
+
+	var respErr *gql.ResponseError
+	require.ErrorAs(t, err, &respErr)
+	require.Equal(t, "5a2c7e0e-0001", respErr.RequestID)
+	require.Equal(t, "BadRequestException", respErr.ErrorType)
+}
+
+func TestSubscribeRequestID(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("x-amzn-RequestId", "5a2c7e0e-0002")
+		w.Header().Set("x-amzn-ErrorType", "UnauthorizedException")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token")).Subscribe(
+		context.Background(),
+		&gql.Request{Query: "subscription { x }"},
+		func(context.Context) error { return nil },
+		func(context.Context, *gql.Payload) (bool, error) { return false, nil },
+	)
+	require.ErrorIs(t, err, gql.ErrUnauthorized)
+	require.ErrorContains(t, err, "status code 403 (UnauthorizedException)")
+	require.NotContains(t, err.Error(), "(UnauthorizedException) (UnauthorizedException)")
+	require.True(t, strings.HasSuffix(err.Error(), "(request id: 5a2c7e0e-0002)"), err.Error())
+
+	// Failures on an established connection are identified by its handshake.
+	scripted := scriptedServer(t, func(ws *websocket.Conn, id string) {
+		_ = ws.WriteJSON(map[string]any{"type": "error", "id": id, "payload": map[string]any{
+			"errors": []map[string]any{{"message": "boom"}},
+		}})
+	})
+
+	_, err = collect(scripted, 1)
+	require.Error(t, err)
+	require.Regexp(t, `websocket error: boom \(websocket accept: [A-Za-z0-9+/=]+\)$`, err.Error())
+}
+
+func TestExecuteNotJSON(t *testing.T) {
+	t.Parallel()
+
+	page := "<html><body>" + strings.Repeat("é", 500) + "</body></html>"
+
+	for name, status := range map[string]int{
+		"ok":          http.StatusOK,
+		"bad gateway": http.StatusBadGateway,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(page))
+			}))
+			defer server.Close()
+
+			_, err := execute(server, gql.NoRetries)
+			require.ErrorIs(t, err, gql.ErrNotJSON)
+			require.ErrorIs(t, err, gql.ErrUnexpected)
+
+			var notJSON *gql.NotJSONError
+			require.ErrorAs(t, err, &notJSON)
+			require.Equal(t, status, notJSON.StatusCode)
+			require.Equal(t, "text/html", notJSON.ContentType)
+
+			// Only the start of the page is quoted, without splitting a character.
+			require.True(t, strings.HasPrefix(page, strings.TrimSuffix(notJSON.Excerpt, "…")))
+			require.True(t, strings.HasSuffix(notJSON.Excerpt, "é…"), notJSON.Excerpt)
+			require.LessOrEqual(t, len(notJSON.Excerpt), 256+len("…"))
+		})
+	}
+}
+
+func TestExecuteBodyLimit(t *testing.T) {
+	t.Parallel()
+
+	server, _ := statusServer(t, `{"data": {"x": "`+strings.Repeat("a", 100)+`"}}`, http.StatusOK)
+
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithBodyLimit(64))
+	_, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+	require.ErrorIs(t, err, gql.ErrBodyTooLarge)
+	require.ErrorContains(t, err, "over the limit of 64 bytes (status code 200")
+
+	// Bodies within the limit are read in full.
+	client = gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithBodyLimit(1024))
+	payload, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"x": "`+strings.Repeat("a", 100)+`"}`, string(payload.Data))
+}
@@ -2,24 +2,51 @@ package gql
 
 import (
 	"bytes"
+	"cmp"
+	"compress/gzip"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/csnewman/team-cli/internal/logging"
+	"github.com/csnewman/team-cli/internal/redact"
+	"github.com/csnewman/team-cli/internal/transport"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var ErrUnexpected = errors.New("unexpected error")
 
+// shutdownTimeout bounds each step of closing a subscription cleanly.
+const shutdownTimeout = time.Second
+
+// keepAliveSlack is added to the connection timeout set by the server.
+const keepAliveSlack = time.Second
+
+// ErrKeepAliveTimeout is returned by Subscribe when the server has sent nothing, not even a keep-alive, for longer
+// than it should have, so the connection has most likely died. With WithReconnect, the subscription is reconnected.
+var ErrKeepAliveTimeout = errors.New("keep-alive timeout")
+
+// ErrHandshakeTimeout is returned by Subscribe when the server does not acknowledge the connection or the
+// subscription within the Handshake timeout, even though it may still be sending keep-alives.
+var ErrHandshakeTimeout = errors.New("handshake timeout")
+
+// ErrComplete is returned by Subscribe when the server ends the subscription, after which no more data will arrive.
+// Callers that expect more may subscribe again.
+var ErrComplete = errors.New("subscription completed by the server")
+
 type wsMessage struct {
 	Type    string   `json:"type"`
 	Payload *Payload `json:"payload,omitempty"`
@@ -29,7 +56,10 @@ type wsMessage struct {
 type Payload struct {
 	Data       json.RawMessage    `json:"data,omitempty"`
 	Extensions *PayloadExtensions `json:"extensions,omitempty"`
-	Errors     []*wsError         `json:"errors,omitempty"`
+	Errors     []*Error           `json:"errors,omitempty"`
+	// ConnectionTimeoutMs is sent with connection_ack: how long the connection may go without a message, keep-alives
+	// included, before it should be considered dead.
+	ConnectionTimeoutMs int `json:"connectionTimeoutMs,omitempty"`
 }
 
 func (p *Payload) UnmarshalData(tgt any) error {
@@ -40,52 +70,254 @@ type PayloadExtensions struct {
 	Authorization map[string]string `json:"authorization"`
 }
 
-type wsError struct {
-	ErrorType string `json:"errorType"`
-	Message   string `json:"message"`
-}
-
 type Request struct {
 	Query     string         `json:"query"`
 	Variables map[string]any `json:"variables,omitempty"`
 }
 
+// Execute sends a query or mutation to endpoint. It is equivalent to Client.Execute on a client with default options.
 func Execute(
 	ctx context.Context,
 	endpoint string,
 	accessToken string,
 	req *Request,
 ) (*Payload, error) {
-	ctx, cancelTimeout := context.WithTimeout(ctx, time.Second*30)
+	return NewClient(endpoint, StaticToken(accessToken)).Execute(ctx, req)
+}
+
+// CallOption customises a single call of Client.Execute.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout time.Duration
+}
+
+// WithRequestTimeout bounds the call, all attempts included, by timeout instead of the HTTP timeout, for requests known
+// to take longer or that should fail sooner. An earlier deadline of the context still applies.
+func WithRequestTimeout(timeout time.Duration) CallOption {
+	return func(opts *callOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// Execute sends a query or mutation. Errors in the response are returned as a *GraphQLError, together with the
+// payload. The call is recorded as a span named after the operation, and its context is propagated to the server.
+func (c *Client) Execute(ctx context.Context, req *Request, opts ...CallOption) (*Payload, error) {
+	ctx, span := c.startOperation(ctx, req)
+
+	payload, err := c.execute(ctx, req, opts...)
+
+	endSpan(span, err)
+
+	return payload, err
+}
+
+// execute is Execute without its span.
+func (c *Client) execute(ctx context.Context, req *Request, opts ...CallOption) (*Payload, error) {
+	var call callOptions
+
+	for _, opt := range opts {
+		opt(&call)
+	}
+
+	timeout := cmp.Or(call.timeout, c.currentTimeouts().HTTP)
+
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
 	defer cancelTimeout()
 
+	// The HTTP client has a timeout of its own, which must not cut a longer call short.
+	httpClient := c.http()
+	if httpClient.Timeout != 0 && httpClient.Timeout < timeout {
+		lifted := *httpClient
+		lifted.Timeout = 0
+		httpClient = &lifted
+	}
+
 	enc, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("could not marshal request: %w", err)
 	}
 
-	r, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(enc))
+	policy := c.retryPolicy()
+
+	// Mutations are not idempotent, so they are only repeated when they cannot have reached the server.
+	kind, _ := operation(req)
+	idempotent := kind != "mutation"
+
+	limiter := c.rateLimiter()
+
+	for attempt := 1; ; attempt++ {
+		if err := limiter.wait(ctx); err != nil {
+			return nil, fmt.Errorf("gave up waiting for the rate limit: %w", err)
+		}
+
+		payload, err := c.post(ctx, httpClient, enc, idempotent)
+
+		retryable, ok := asRetryable(err)
+		if !ok || attempt >= policy.Attempts {
+			return payload, err
+		}
+
+		delay := policy.delay(attempt, retryable.retryAfter)
+
+		// Give up early rather than wait past the timeout shared by all attempts.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, err
+		}
+
+		c.log().Debug("Retrying GraphQL request", "attempt", attempt+1, "delay", delay, "err", err)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt+1)))
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// post makes a single attempt at sending the encoded request with httpClient. Failures to connect are marked as
+// retryable. Other failures are only when the request is idempotent, since it may have reached the server, and never
+// once the server has responded.
+func (c *Client) post(ctx context.Context, httpClient *http.Client, enc []byte, idempotent bool) (*Payload, error) {
+	var connected atomic.Bool
+
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { connected.Store(true) },
+	})
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(enc))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	r.Header.Add("Content-Type", "application/json")
-	r.Header.Add("Authorization", accessToken)
 
-	resp, err := http.DefaultClient.Do(r)
+	if err := c.authorizer().AuthorizeRequest(ctx, r, enc); err != nil {
+		return nil, fmt.Errorf("failed to authorize request: %w", err)
+	}
+
+	// Asking for gzip explicitly, rather than leaving it to the transport, has any transport given with
+	// WithHTTPClient compress responses too. They are then decompressed by readResponse. The header is left out of
+	// signatures, since proxies may rewrite it.
+	r.Header.Set("Accept-Encoding", "gzip")
+	injectTraceContext(ctx, r.Header)
+
+	if logging.TraceEnabled(ctx) {
+		logging.Trace(
+			ctx,
+			"Sending GraphQL request",
+			"endpoint", redact.URL(c.endpoint),
+			"headers", redact.Header(r.Header),
+			"body", redact.JSON(enc),
+		)
+	}
+
+	resp, err := httpClient.Do(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		err = fmt.Errorf("failed to send request: %w", err)
+
+		// Network errors are worth retrying, unless the request was abandoned or the network is off limits.
+		if ctx.Err() == nil && !errors.Is(err, transport.ErrOffline) &&
+			(idempotent || (!connected.Load() && connectError(err))) {
+			err = &retryableError{err: err}
+		}
+
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 
-	rawEnc, err := io.ReadAll(resp.Body)
+	recordResponse(ctx, resp)
+
+	payload, err := c.readResponse(ctx, resp)
+
+	// A non-idempotent request the server responded to may have taken effect, whatever the status.
+	if retryable, ok := asRetryable(err); ok && !idempotent {
+		err = retryable.err
+	}
+
+	if isThrottled(resp, err) {
+		c.log().Debug("Request throttled, lowering the rate limit", "status", resp.StatusCode)
+		c.rateLimiter().throttled()
+	}
+
+	c.log().Debug(
+		"Received GraphQL response",
+		"status", resp.StatusCode,
+		"requestId", resp.Header.Get("x-amzn-RequestId"),
+		"errorType", amznErrorType(resp.Header),
+	)
+
+	return payload, withResponse(err, resp.Header)
+}
+
+// readResponse reads the payload of a response to a request, decompressing it as needed.
+func (c *Client) readResponse(ctx context.Context, resp *http.Response) (*Payload, error) {
+	body := io.Reader(resp.Body)
+
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress body: %w", err)
+		}
+
+		defer zr.Close()
+
+		body = zr
+	}
+
+	limit := cmp.Or(c.bodyLimit, transport.BodyLimit())
+
+	rawEnc, err := io.ReadAll(io.LimitReader(body, limit+1))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read body: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w: unexpected status code: %d %q", ErrUnexpected, resp.StatusCode, string(rawEnc))
+	tooLarge := int64(len(rawEnc)) > limit
+	if tooLarge {
+		rawEnc = rawEnc[:limit]
+	}
+
+	if logging.TraceEnabled(ctx) {
+		logging.Trace(
+			ctx,
+			"Received GraphQL response",
+			"status", resp.Status,
+			"headers", redact.Header(resp.Header),
+			"body", redact.JSON(rawEnc),
+		)
+	}
+
+	if unauthorizedStatus(resp.StatusCode) {
+		return nil, unauthorizedError(resp.StatusCode, resp.Header, rawEnc)
+	}
+
+	if tooLarge {
+		return nil, &BodyTooLargeError{
+			Limit:       limit,
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+		}
+	}
+
+	switch {
+	case !json.Valid(rawEnc):
+		err = &NotJSONError{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Excerpt:     excerpt(rawEnc),
+		}
+	case resp.StatusCode != http.StatusOK:
+		err = fmt.Errorf("%w: unexpected status code: %d %q", ErrUnexpected, resp.StatusCode, excerpt(rawEnc))
+	}
+
+	if err != nil {
+		if retryableStatus(resp.StatusCode) {
+			err = &retryableError{err: err, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+		}
+
+		return nil, err
 	}
 
 	var payload *Payload
@@ -94,15 +326,39 @@ func Execute(
 		return nil, fmt.Errorf("failed to unmarshal payload body: %w", err)
 	}
 
+	if payload != nil && len(payload.Errors) > 0 {
+		return payload, &GraphQLError{Errors: payload.Errors}
+	}
+
 	return payload, nil
 }
 
+// wsSubscriber is a subscription on a shared connection, receiving the messages routed to its ID.
 type wsSubscriber struct {
-	ws      *websocket.Conn
-	authExt map[string]string
-	reqID   uuid.UUID
+	conn *wsConn
+	ctx  context.Context
+	id   string
+
+	// mu guards queue, which holds the messages received but not yet processed, so that a slow subscription does not
+	// hold up the others.
+	mu     sync.Mutex
+	queue  []*wsMessage
+	notify chan struct{}
+	logger *slog.Logger
+}
+
+func newSubscriber(ctx context.Context, conn *wsConn) *wsSubscriber {
+	return &wsSubscriber{
+		conn:   conn,
+		ctx:    ctx,
+		id:     uuid.NewString(),
+		notify: make(chan struct{}, 1),
+		logger: conn.logger,
+	}
 }
 
+// Subscribe runs a subscription against endpoint. It is equivalent to Client.Subscribe on a client with default
+// options.
 func Subscribe(
 	ctx context.Context,
 	endpoint string,
@@ -111,231 +367,312 @@ func Subscribe(
 	onReady func(ctx context.Context) error,
 	onData func(ctx context.Context, payload *Payload) (bool, error),
 ) error {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	return NewClient(endpoint, StaticToken(accessToken)).Subscribe(ctx, subscription, onReady, onData)
+}
 
-	u, err := url.Parse(endpoint)
-	if err != nil {
-		return fmt.Errorf("unable to parse endpoint %s: %w", endpoint, err)
-	}
+// Subscribe starts subscription over the realtime endpoint, calls onReady once it is established, and then onData
+// for each data message until onData returns false or an error. Both are given a context that ends with ctx or the
+// subscription timeout. With WithReconnect, a dropped connection is re-established rather than ending the
+// subscription. Concurrent subscriptions on the same client share one connection, which is closed once the last of
+// them ends.
+func (c *Client) Subscribe(
+	ctx context.Context,
+	subscription *Request,
+	onReady func(ctx context.Context) error,
+	onData func(ctx context.Context, payload *Payload) (bool, error),
+) error {
+	ctx, span := c.startOperation(ctx, subscription)
 
-	authExt := map[string]string{
-		"host":          u.Hostname(),
-		"Authorization": accessToken,
-	}
+	err := c.subscribe(ctx, subscription, onReady, onData)
 
-	endpoint = GenerateWSAddr(u)
+	endSpan(span, err)
 
-	slog.Debug("Connecting to websocket", "endpoint", endpoint)
+	return err
+}
 
-	encAuth, err := json.Marshal(authExt)
+// subscribe is Subscribe without its span.
+func (c *Client) subscribe(
+	ctx context.Context,
+	subscription *Request,
+	onReady func(ctx context.Context) error,
+	onData func(ctx context.Context, payload *Payload) (bool, error),
+) error {
+	ctx, cancel := context.WithTimeout(ctx, c.currentTimeouts().Subscribe)
+	defer cancel()
+
+	wss, err := c.connect(ctx, subscription)
 	if err != nil {
-		return fmt.Errorf("failed to marshal auth data: %w", err)
+		return err
 	}
 
-	subprotocol := `header-` + strings.ReplaceAll(base64.URLEncoding.EncodeToString(encAuth), "=", "")
+	if err := onReady(ctx); err != nil {
+		wss.shutdown(err)
 
-	ws, _, err := websocket.DefaultDialer.DialContext(
-		ctx,
-		endpoint,
-		http.Header{"sec-websocket-protocol": []string{"graphql-ws", subprotocol}},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to dial websocket: %w", err)
+		return fmt.Errorf("onReady error: %w", err)
 	}
 
-	defer ws.Close()
+	for {
+		err := wss.process(ctx, onData)
 
-	go func() {
-		select {
-		case <-ctx.Done():
-			_ = ws.Close()
+		wss.shutdown(err)
+
+		if err == nil {
+			return nil
+		}
+
+		if errors.Is(err, ErrComplete) {
+			return err
 		}
-	}()
 
-	wss := &wsSubscriber{
-		ws:      ws,
-		authExt: authExt,
-		reqID:   uuid.New(),
+		if c.reconnect == nil || !errors.Is(err, errConnectionLost) || ctx.Err() != nil {
+			return withResponse(fmt.Errorf("failed to process subscription: %w", err), wss.conn.handshake)
+		}
+
+		wss, err = c.resubscribe(ctx, subscription, err)
+		if err != nil {
+			return err
+		}
 	}
+}
 
-	if err := wss.initConnection(); err != nil {
-		return fmt.Errorf("failed to init connection: %w", err)
+// connect starts subscription on the client's connection, dialing one if needed. Subscriptions share the connection
+// until the last of them shuts down.
+func (c *Client) connect(ctx context.Context, subscription *Request) (*wsSubscriber, error) {
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse endpoint %s: %w", c.endpoint, err)
 	}
 
-	slog.Debug("Websocket initialized")
+	wss, err := c.join(ctx, u)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := wss.start(subscription); err != nil {
-		return fmt.Errorf("failed to start subscription: %w", err)
+	// Subscriptions are authorized in their own right, as the connection may have been authorized long ago.
+	authorize := func(body []byte) (map[string]string, error) {
+		return c.authorizer().AuthorizeRealtime(ctx, u, body)
 	}
 
-	slog.Debug("Websocket subscription ready")
+	_, span := c.tracer(ctx).Start(ctx, "websocket start")
 
-	if err := onReady(ctx); err != nil {
-		return fmt.Errorf("onReady error: %w", err)
-	}
+	err = wss.start(subscription, authorize)
+
+	endSpan(span, err)
 
-	if err := wss.process(onData); err != nil {
-		return fmt.Errorf("failed to process subscription: %w", err)
+	if err != nil {
+		wss.conn.leave(wss)
+
+		return nil, withResponse(fmt.Errorf("failed to start subscription: %w", err), wss.conn.handshake)
 	}
 
-	return nil
+	wss.logger.Debug("Websocket subscription ready")
+
+	return wss, nil
 }
 
+// GenerateWSAddr turns u, the URL of a GraphQL API, into the URL of its realtime endpoint and returns it. The default
+// AppSync domains serve it from a separate realtime host, while custom domains serve it below the API path, which is
+// /graphql when u has none.
 func GenerateWSAddr(u *url.URL) string {
+	path := strings.TrimRight(u.Path, "/")
+	if path == "" {
+		path = "/graphql"
+	}
+
 	if strings.Contains(u.Host, ".appsync-api.") && strings.Contains(u.Host, ".amazonaws.") {
 		u.Host = strings.Replace(u.Host, ".appsync-api.", ".appsync-realtime-api.", 1)
 	} else {
-		u.Path += "/realtime"
+		path += "/realtime"
 	}
 
-	if u.Scheme == "https" {
-		u.Scheme = "wss"
-	} else {
-		u.Scheme = "ws"
-	}
+	u.Path, u.RawPath = path, ""
+	u.Scheme = wsScheme(u.Scheme)
 
 	return u.String()
 }
 
-func (s *wsSubscriber) initConnection() error {
-	if err := s.send(&wsMessage{Type: "connection_init"}); err != nil {
-		return fmt.Errorf("failed to send connection_init: %w", err)
+// wsScheme returns the websocket scheme matching the HTTP or websocket scheme given.
+func wsScheme(scheme string) string {
+	if scheme == "https" || scheme == "wss" {
+		return "wss"
+	}
+
+	return "ws"
+}
+
+// deliver queues a message for the subscription.
+func (s *wsSubscriber) deliver(pkt *wsMessage) {
+	s.mu.Lock()
+	s.queue = append(s.queue, pkt)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the next message for the subscription. It fails once the connection has failed and the messages
+// received before are processed, when the context ends, or when deadline passes, unless it is zero.
+func (s *wsSubscriber) next(deadline time.Time) (*wsMessage, error) {
+	var expired <-chan time.Time
+
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+
+		expired = timer.C
 	}
 
 	for {
-		pkt, err := s.read()
+		s.mu.Lock()
+
+		if len(s.queue) > 0 {
+			pkt := s.queue[0]
+			s.queue = s.queue[1:]
+
+			s.mu.Unlock()
+
+			return pkt, nil
+		}
+
+		s.mu.Unlock()
+
+		select {
+		case <-s.notify:
+		case <-s.conn.done:
+			// Messages received before the connection failed are still processed.
+			s.mu.Lock()
+			pending := len(s.queue)
+			s.mu.Unlock()
+
+			if pending == 0 {
+				return nil, s.conn.err
+			}
+		case <-s.ctx.Done():
+			return nil, fmt.Errorf("failed to read message: %w", s.ctx.Err())
+		case <-expired:
+			return nil, fmt.Errorf("failed to read message: %w", os.ErrDeadlineExceeded)
+		}
+	}
+}
+
+// shutdown leaves the connection after the subscription ended with err, which is nil when onData asked to stop.
+// Unless the connection was lost, the subscription is stopped and the server given a moment to complete it.
+func (s *wsSubscriber) shutdown(err error) {
+	defer s.conn.leave(s)
+
+	if errors.Is(err, errConnectionLost) || errors.Is(err, ErrComplete) {
+		return
+	}
+
+	stop, acked := s.conn.protocol.stop(s.id)
+
+	if err := s.conn.send(stop); err != nil {
+		s.logger.Debug("Failed to stop subscription", "err", err)
+
+		return
+	}
+
+	// Messages are not awaited once the context ends, so the complete message can only be awaited before.
+	if acked && s.ctx.Err() == nil {
+		s.awaitComplete()
+	}
+}
+
+// awaitComplete waits up to shutdownTimeout for the server to acknowledge a stop with a complete message.
+func (s *wsSubscriber) awaitComplete() {
+	deadline := time.Now().Add(shutdownTimeout)
+
+	for {
+		pkt, err := s.next(deadline)
 		if err != nil {
-			return fmt.Errorf("failed to read packet: %w", err)
+			s.logger.Debug("Server did not complete the stopped subscription", "err", err)
+
+			return
 		}
 
-		switch pkt.Type {
-		case "connection_ack":
-			return nil
-		case "connection_error":
-			return fmt.Errorf("%w: connection error: %q", ErrUnexpected, pkt.Payload)
-		default:
-			slog.Warn("Received unexpected packet", "type", pkt.Type)
+		if pkt.Type == "complete" {
+			return
 		}
 	}
 }
 
-func (s *wsSubscriber) start(subscription *Request) error {
-	encSubscription, err := json.Marshal(subscription)
+func (s *wsSubscriber) start(
+	subscription *Request,
+	authorize func(body []byte) (map[string]string, error),
+) error {
+	msg, acked, err := s.conn.protocol.start(s.id, subscription, authorize)
 	if err != nil {
-		return fmt.Errorf("failed to marshal subscription: %w", err)
+		return err
 	}
 
-	wrappedSubscription, err := json.Marshal(string(encSubscription))
-	if err != nil {
-		return fmt.Errorf("failed to marshal wrapped subscription: %w", err)
+	if err := s.conn.send(msg); err != nil {
+		return fmt.Errorf("failed to send start: %w", err)
 	}
 
-	if err := s.send(&wsMessage{
-		Type: "start",
-		ID:   s.reqID.String(),
-		Payload: &Payload{
-			Data: wrappedSubscription,
-			Extensions: &PayloadExtensions{
-				Authorization: s.authExt,
-			},
-		},
-	}); err != nil {
-		return fmt.Errorf("failed to send connection_init: %w", err)
+	// Without an acknowledgement, the subscription is running once sent.
+	if !acked {
+		return nil
 	}
 
+	deadline := time.Now().Add(s.conn.handshakeTimeout)
+
 	for {
-		pkt, err := s.read()
+		pkt, err := s.next(deadline)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return handshakeTimeoutError("start_ack", s.conn.handshakeTimeout, err)
+		}
+
 		if err != nil {
 			return fmt.Errorf("failed to read packet: %w", err)
 		}
 
 		switch pkt.Type {
-		case "ka":
-		// Ignore keep-alives
 		case "error":
-			for _, err := range pkt.Payload.Errors {
-				slog.Warn("Received websocket error", "error", err)
-			}
-
-			return fmt.Errorf("%w: websocket error", ErrUnexpected)
+			return websocketError(s.logger, pkt)
 		case "start_ack":
-			if pkt.ID != s.reqID.String() {
-				slog.Warn("Received unexpected start_ack", "got", pkt.ID, "expected", s.reqID.String())
-
-				continue
-			}
-
 			return nil
 		default:
-			slog.Warn("Received unexpected packet", "type", pkt.Type)
+			s.logger.Warn("Received unexpected packet", "type", pkt.Type)
 		}
 	}
 }
 
-func (s *wsSubscriber) process(onData func(ctx context.Context, payload *Payload) (bool, error)) error {
+// process passes the data messages of the subscription to onData, with ctx, until onData returns false or an error.
+func (s *wsSubscriber) process(
+	ctx context.Context,
+	onData func(ctx context.Context, payload *Payload) (bool, error),
+) error {
 	for {
-		pkt, err := s.read()
+		pkt, err := s.next(time.Time{})
 		if err != nil {
 			return fmt.Errorf("failed to read packet: %w", err)
 		}
 
 		switch pkt.Type {
-		case "ka":
-		// Ignore keep-alives
 		case "error":
-			for _, err := range pkt.Payload.Errors {
-				slog.Warn("Received websocket error", "error", err)
-			}
-
-			return fmt.Errorf("%w: websocket error", ErrUnexpected)
+			return websocketError(s.logger, pkt)
 		case "data":
-			if pkt.ID != s.reqID.String() {
-				slog.Warn("Received unexpected data packet", "got", pkt.ID, "expected", s.reqID.String())
-
-				continue
-			}
-
-			slog.Debug("Received data packet", "data", string(pkt.Payload.Data))
+			s.logger.Debug("Received data packet", "data", redact.JSON(pkt.Payload.Data))
+			trace.SpanFromContext(ctx).AddEvent("data", trace.WithAttributes(attribute.Int("size", len(pkt.Payload.Data))))
 
-			cont, err := onData(context.Background(), pkt.Payload)
+			cont, err := onData(ctx, pkt.Payload)
 			if err != nil {
 				return fmt.Errorf("failed to process data packet: %w", err)
 			}
 
 			if !cont {
-				slog.Debug("Data handler requested exit")
+				s.logger.Debug("Data handler requested exit")
 
 				return nil
 			}
+		case "complete":
+			s.logger.Debug("Server completed the subscription")
+
+			return ErrComplete
 		default:
-			slog.Warn("Received unexpected packet", "type", pkt.Type)
+			s.logger.Warn("Received unexpected packet", "type", pkt.Type)
 		}
 	}
 }
-
-func (s *wsSubscriber) read() (*wsMessage, error) {
-	if err := s.ws.SetReadDeadline(time.Now().Add(60 * time.Second)); err != nil {
-		return nil, fmt.Errorf("failed to set read deadline: %w", err)
-	}
-
-	var res *wsMessage
-
-	if err := s.ws.ReadJSON(&res); err != nil {
-		return res, fmt.Errorf("failed to read JSON: %w", err)
-	}
-
-	return res, nil
-}
-
-func (s *wsSubscriber) send(msg *wsMessage) error {
-	if err := s.ws.SetWriteDeadline(time.Now().Add(time.Second * 10)); err != nil {
-		return fmt.Errorf("failed to set write deadline: %w", err)
-	}
-
-	if err := s.ws.WriteJSON(msg); err != nil {
-		return fmt.Errorf("failed to write JSON: %w", err)
-	}
-
-	return nil
-}
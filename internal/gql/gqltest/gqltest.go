@@ -0,0 +1,345 @@
+// Package gqltest fakes the websocket of gql subscriptions in memory, so that tests can script the frames a server
+// sends and check those the client sends, without a server or a network.
+package gqltest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/gorilla/websocket"
+)
+
+// expectTimeout bounds the wait for the client to send a frame in Expect.
+const expectTimeout = 5 * time.Second
+
+// Frame is a message sent by the client.
+type Frame struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Raw is the frame as sent.
+	Raw []byte `json:"-"`
+}
+
+// Conn is an in-memory gql.WebsocketConn. The frames queued with Send are read by the client in order, and the frames
+// the client writes are read back with Receive or Expect. Its deadlines behave as those of a network connection.
+type Conn struct {
+	protocol string
+
+	mu sync.Mutex
+	// changed is closed and replaced whenever the state below changes, waking the waiters.
+	changed chan struct{}
+	// incoming holds the frames queued for the client, and closeErr the error reading fails with once they are read.
+	incoming [][]byte
+	closeErr error
+	// outgoing holds the frames written by the client and not yet received.
+	outgoing     [][]byte
+	readDeadline time.Time
+	readLimit    int64
+	closed       bool
+	closeCode    int
+	url          string
+	header       http.Header
+}
+
+// NewConn returns a connection on which the server picked protocol, which may be empty as with AppSync.
+func NewConn(protocol string) *Conn {
+	return &Conn{protocol: protocol, changed: make(chan struct{})}
+}
+
+// Dialer returns a dialer handing out conns in order, one per dial. Further dials fail.
+func Dialer(conns ...*Conn) gql.WebsocketDialer {
+	var (
+		mu   sync.Mutex
+		next int
+	)
+
+	return func(_ context.Context, url string, header http.Header) (gql.WebsocketConn, *http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if next == len(conns) {
+			return nil, nil, fmt.Errorf("gqltest: no connection left for dial %d", next+1)
+		}
+
+		c := conns[next]
+		next++
+
+		c.mu.Lock()
+		c.url, c.header = url, header.Clone()
+		c.mu.Unlock()
+
+		resp := &http.Response{
+			StatusCode: http.StatusSwitchingProtocols,
+			Header:     http.Header{"Sec-Websocket-Protocol": []string{c.protocol}},
+			Body:       http.NoBody,
+		}
+
+		return c, resp, nil
+	}
+}
+
+// Dialed returns the URL and header the connection was dialed with.
+func (c *Conn) Dialed() (string, http.Header) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.url, c.header
+}
+
+// Send queues text frames for the client to read.
+func (c *Conn) Send(frames ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, frame := range frames {
+		c.incoming = append(c.incoming, []byte(frame))
+	}
+
+	c.notify()
+}
+
+// SendClose makes the client's reads fail with a close frame of code and text, once the frames queued are read.
+func (c *Conn) SendClose(code int, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closeErr = &websocket.CloseError{Code: code, Text: text}
+	c.notify()
+}
+
+// Drop makes the client's reads fail as if the network dropped the connection, once the frames queued are read.
+func (c *Conn) Drop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closeErr = io.ErrUnexpectedEOF
+	c.notify()
+}
+
+// Receive returns the next frame written by the client, waiting for it until ctx ends. It fails once the client has
+// closed the connection and every frame it wrote has been received.
+func (c *Conn) Receive(ctx context.Context) (*Frame, error) {
+	for {
+		c.mu.Lock()
+
+		if len(c.outgoing) > 0 {
+			raw := c.outgoing[0]
+			c.outgoing = c.outgoing[1:]
+
+			c.mu.Unlock()
+
+			frame := &Frame{Raw: raw}
+			if err := json.Unmarshal(raw, frame); err != nil {
+				return nil, fmt.Errorf("gqltest: client sent a frame that is not JSON: %w", err)
+			}
+
+			return frame, nil
+		}
+
+		closed, changed := c.closed, c.changed
+
+		c.mu.Unlock()
+
+		if closed {
+			return nil, net.ErrClosed
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Expect receives the next frame written by the client, failing the test unless one of type typ arrives within a few
+// seconds.
+func (c *Conn) Expect(t testing.TB, typ string) *Frame {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), expectTimeout)
+	defer cancel()
+
+	frame, err := c.Receive(ctx)
+	if err != nil {
+		t.Fatalf("gqltest: expected %s frame: %v", typ, err)
+	}
+
+	if frame.Type != typ {
+		t.Fatalf("gqltest: expected %s frame, client sent %s", typ, frame.Raw)
+	}
+
+	return frame
+}
+
+// Closed reports whether the client has closed the connection, and the code of the close frame it sent first, if any.
+func (c *Conn) Closed() (bool, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed, c.closeCode
+}
+
+// WaitClosed waits until the client has closed the connection or ctx ends.
+func (c *Conn) WaitClosed(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		closed, changed := c.closed, c.changed
+		c.mu.Unlock()
+
+		if closed {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// notify wakes the waiters. It must be called with mu held.
+func (c *Conn) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Subprotocol implements gql.WebsocketConn.
+func (c *Conn) Subprotocol() string {
+	return c.protocol
+}
+
+// SetReadLimit implements gql.WebsocketConn. Frames larger than limit fail with websocket.ErrReadLimit.
+func (c *Conn) SetReadLimit(limit int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readLimit = limit
+}
+
+// SetReadDeadline implements gql.WebsocketConn. Moving the deadline wakes a blocked read, as on a network connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDeadline = t
+	c.notify()
+
+	return nil
+}
+
+// SetWriteDeadline implements gql.WebsocketConn. Writes never block, so it has no effect.
+func (*Conn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// NextReader implements gql.WebsocketConn, returning the next frame queued with Send.
+func (c *Conn) NextReader() (int, io.Reader, error) {
+	for {
+		c.mu.Lock()
+
+		deadline, changed := c.readDeadline, c.changed
+
+		switch {
+		case c.closed:
+			c.mu.Unlock()
+
+			return 0, nil, net.ErrClosed
+		case !deadline.IsZero() && !time.Now().Before(deadline):
+			c.mu.Unlock()
+
+			return 0, nil, os.ErrDeadlineExceeded
+		case len(c.incoming) > 0:
+			frame := c.incoming[0]
+			c.incoming = c.incoming[1:]
+			limit := c.readLimit
+
+			c.mu.Unlock()
+
+			if limit > 0 && int64(len(frame)) > limit {
+				return 0, nil, websocket.ErrReadLimit
+			}
+
+			return websocket.TextMessage, bytes.NewReader(frame), nil
+		case c.closeErr != nil:
+			err := c.closeErr
+
+			c.mu.Unlock()
+
+			return 0, nil, err
+		}
+
+		c.mu.Unlock()
+
+		if deadline.IsZero() {
+			<-changed
+
+			continue
+		}
+
+		// The deadline having passed is caught on the next iteration.
+		timer := time.NewTimer(time.Until(deadline))
+
+		select {
+		case <-changed:
+		case <-timer.C:
+		}
+
+		timer.Stop()
+	}
+}
+
+// WriteMessage implements gql.WebsocketConn, recording the frame for Receive.
+func (c *Conn) WriteMessage(_ int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	c.outgoing = append(c.outgoing, slices.Clone(data))
+	c.notify()
+
+	return nil
+}
+
+// WriteControl implements gql.WebsocketConn, recording the code of close frames.
+func (c *Conn) WriteControl(messageType int, data []byte, _ time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	if messageType == websocket.CloseMessage && len(data) >= 2 {
+		c.closeCode = int(data[0])<<8 | int(data[1])
+	}
+
+	return nil
+}
+
+// Close implements gql.WebsocketConn.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	c.notify()
+
+	return nil
+}
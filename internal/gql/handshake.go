@@ -0,0 +1,23 @@
+package gql
+
+// Handshake is how the authorization of a websocket connection is passed to AppSync when dialing.
+type Handshake string
+
+const (
+	// HandshakeAuto passes the authorization as a subprotocol, and dials again with query parameters when the server
+	// rejects that with a client error. Once the query parameters work, the client keeps using them.
+	HandshakeAuto Handshake = ""
+	// HandshakeSubprotocol passes the authorization as a header- subprotocol.
+	HandshakeSubprotocol Handshake = "subprotocol"
+	// HandshakeQuery passes the authorization in the header and payload query parameters of the websocket URL, for
+	// deployments and proxies that do not accept the subprotocol.
+	HandshakeQuery Handshake = "query"
+)
+
+// WithHandshake sets how the authorization of websocket connections is passed, instead of trying the subprotocol
+// first. Servers that are not spoken to in AppSync's protocol take it from the connection_init message regardless.
+func WithHandshake(handshake Handshake) Option {
+	return func(client *Client) {
+		client.handshake = handshake
+	}
+}
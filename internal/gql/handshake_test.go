@@ -0,0 +1,120 @@
+package gql_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// queryAuthServer only accepts connections carrying their authorization in query parameters, answering others with
+// 400 as AppSync deployments behind a proxy rewriting Sec-WebSocket-Protocol do. It counts the dials it receives, and
+// reports the authorization of the last accepted one.
+func queryAuthServer(t *testing.T) (*httptest.Server, *atomic.Int32, *atomic.Pointer[map[string]string]) {
+	t.Helper()
+
+	var (
+		dials atomic.Int32
+		auth  atomic.Pointer[map[string]string]
+	)
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-ws"}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dials.Add(1)
+
+		header, payload := r.URL.Query().Get("header"), r.URL.Query().Get("payload")
+
+		// AppSync expects unpadded base64url.
+		raw, err := base64.RawURLEncoding.DecodeString(header)
+		if err != nil || payload != "e30" || strings.Contains(r.Header.Get("Sec-Websocket-Protocol"), "header-") {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		var decoded map[string]string
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		auth.Store(&decoded)
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer ws.Close()
+
+		var msg struct {
+			ID string `json:"id"`
+		}
+
+		for _, ack := range []string{"connection_ack", "start_ack"} {
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+
+			if err := ws.WriteJSON(map[string]string{"type": ack, "id": msg.ID}); err != nil {
+				return
+			}
+		}
+
+		_ = ws.WriteJSON(map[string]any{"type": "data", "id": msg.ID, "payload": map[string]any{"data": 1}})
+
+		completeOnStop(ws)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &dials, &auth
+}
+
+func TestSubscribeQueryHandshakeFallback(t *testing.T) {
+	t.Parallel()
+
+	server, dials, auth := queryAuthServer(t)
+
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"))
+
+	_, err := collectClient(client, 1)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), dials.Load())
+	require.Equal(t, "token", (*auth.Load())["Authorization"])
+
+	// Later connections go straight to the query parameters.
+	_, err = collectClient(client, 1)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), dials.Load())
+}
+
+func TestSubscribeHandshakeOption(t *testing.T) {
+	t.Parallel()
+
+	server, dials, _ := queryAuthServer(t)
+
+	_, err := collectClient(gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"),
+		gql.WithHandshake(gql.HandshakeQuery)), 1)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), dials.Load())
+
+	err = gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"),
+		gql.WithHandshake(gql.HandshakeSubprotocol)).Subscribe(
+		context.Background(),
+		&gql.Request{Query: "subscription { x }"},
+		func(context.Context) error { return nil },
+		func(context.Context, *gql.Payload) (bool, error) { return false, nil },
+	)
+	require.ErrorContains(t, err, "bad handshake")
+	require.Equal(t, int32(2), dials.Load())
+}
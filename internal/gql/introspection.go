@@ -0,0 +1,392 @@
+package gql
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// IntrospectionQuery is the standard query for the schema of a GraphQL API, as sent by GraphiQL and graphql-js.
+const IntrospectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives {
+      name
+      description
+      locations
+      args { ...InputValue }
+    }
+  }
+}
+
+fragment FullType on __Type {
+  kind
+  name
+  description
+  fields(includeDeprecated: true) {
+    name
+    description
+    args { ...InputValue }
+    type { ...TypeRef }
+    isDeprecated
+    deprecationReason
+  }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) {
+    name
+    description
+    isDeprecated
+    deprecationReason
+  }
+  possibleTypes { ...TypeRef }
+}
+
+fragment InputValue on __InputValue {
+  name
+  description
+  type { ...TypeRef }
+  defaultValue
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType {
+    kind
+    name
+    ofType {
+      kind
+      name
+      ofType {
+        kind
+        name
+        ofType {
+          kind
+          name
+          ofType {
+            kind
+            name
+            ofType {
+              kind
+              name
+              ofType {
+                kind
+                name
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// Schema is the schema of a GraphQL API, as returned by IntrospectionQuery.
+type Schema struct {
+	QueryType        *NamedTypeRef `json:"queryType"`
+	MutationType     *NamedTypeRef `json:"mutationType"`
+	SubscriptionType *NamedTypeRef `json:"subscriptionType"`
+	Types            []*SchemaType `json:"types"`
+	Directives       []*Directive  `json:"directives"`
+}
+
+// NamedTypeRef names a root operation type.
+type NamedTypeRef struct {
+	Name string `json:"name"`
+}
+
+// SchemaType is a type defined by a schema. Which fields are set depends on its kind.
+type SchemaType struct {
+	Kind          string        `json:"kind"`
+	Name          string        `json:"name"`
+	Description   *string       `json:"description"`
+	Fields        []*Field      `json:"fields"`
+	InputFields   []*InputValue `json:"inputFields"`
+	Interfaces    []*TypeRef    `json:"interfaces"`
+	EnumValues    []*EnumValue  `json:"enumValues"`
+	PossibleTypes []*TypeRef    `json:"possibleTypes"`
+}
+
+// Field is a field of an object or interface type.
+type Field struct {
+	Name              string        `json:"name"`
+	Description       *string       `json:"description"`
+	Args              []*InputValue `json:"args"`
+	Type              *TypeRef      `json:"type"`
+	IsDeprecated      bool          `json:"isDeprecated"`
+	DeprecationReason *string       `json:"deprecationReason"`
+}
+
+// InputValue is an argument, or a field of an input object type.
+type InputValue struct {
+	Name        string   `json:"name"`
+	Description *string  `json:"description"`
+	Type        *TypeRef `json:"type"`
+	// DefaultValue is the default in GraphQL syntax, if there is one.
+	DefaultValue *string `json:"defaultValue"`
+}
+
+// EnumValue is a value of an enum type.
+type EnumValue struct {
+	Name              string  `json:"name"`
+	Description       *string `json:"description"`
+	IsDeprecated      bool    `json:"isDeprecated"`
+	DeprecationReason *string `json:"deprecationReason"`
+}
+
+// Directive is a directive defined by a schema.
+type Directive struct {
+	Name        string        `json:"name"`
+	Description *string       `json:"description"`
+	Locations   []string      `json:"locations"`
+	Args        []*InputValue `json:"args"`
+}
+
+// TypeRef refers to a type, wrapped in any number of lists and non-null modifiers.
+type TypeRef struct {
+	Kind   string   `json:"kind"`
+	Name   *string  `json:"name"`
+	OfType *TypeRef `json:"ofType"`
+}
+
+// String returns the reference in GraphQL syntax, as in "[String!]!".
+func (r *TypeRef) String() string {
+	switch {
+	case r == nil:
+		return ""
+	case r.Kind == "NON_NULL":
+		return r.OfType.String() + "!"
+	case r.Kind == "LIST":
+		return "[" + r.OfType.String() + "]"
+	case r.Name != nil:
+		return *r.Name
+	default:
+		return ""
+	}
+}
+
+// named returns the name of the type referred to, without its modifiers.
+func (r *TypeRef) named() string {
+	for r != nil {
+		if r.Name != nil {
+			return *r.Name
+		}
+
+		r = r.OfType
+	}
+
+	return ""
+}
+
+// Introspect fetches the schema of the API with IntrospectionQuery. Servers may disable introspection, in which case
+// the GraphQLError they respond with is returned.
+func (c *Client) Introspect(ctx context.Context) (*Schema, error) {
+	data, err := ExecuteInto[struct {
+		Schema *Schema `json:"__schema"`
+	}](ctx, c, &Request{Query: IntrospectionQuery})
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Schema == nil {
+		return nil, fmt.Errorf("%w: response holds no schema", ErrUnexpected)
+	}
+
+	return data.Schema, nil
+}
+
+// Type returns the type named name, or nil.
+func (s *Schema) Type(name string) *SchemaType {
+	for _, t := range s.Types {
+		if t.Name == name {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// builtinScalars are defined by every schema, and so left out of its SDL.
+var builtinScalars = []string{"String", "Int", "Float", "Boolean", "ID"}
+
+// builtinDirectives are defined by every schema, and so left out of its SDL.
+var builtinDirectives = []string{"skip", "include", "deprecated", "specifiedBy", "oneOf"}
+
+// SDL returns the schema in the GraphQL schema definition language, with the types sorted by name so that schemas
+// can be compared with diff. Built-in scalars, directives and introspection types are left out.
+func (s *Schema) SDL() string {
+	var b strings.Builder
+
+	if s.hasCustomRoots() {
+		b.WriteString("schema {\n")
+
+		for _, root := range []struct {
+			op  string
+			ref *NamedTypeRef
+		}{{"query", s.QueryType}, {"mutation", s.MutationType}, {"subscription", s.SubscriptionType}} {
+			if root.ref != nil {
+				fmt.Fprintf(&b, "  %s: %s\n", root.op, root.ref.Name)
+			}
+		}
+
+		b.WriteString("}\n\n")
+	}
+
+	directives := slices.SortedFunc(slices.Values(s.Directives), func(a, b *Directive) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	for _, d := range directives {
+		if slices.Contains(builtinDirectives, d.Name) {
+			continue
+		}
+
+		writeDescription(&b, "", d.Description)
+		fmt.Fprintf(&b, "directive @%s%s on %s\n\n", d.Name, sdlArgs(d.Args), strings.Join(d.Locations, " | "))
+	}
+
+	types := slices.SortedFunc(slices.Values(s.Types), func(a, b *SchemaType) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	for _, t := range types {
+		if strings.HasPrefix(t.Name, "__") || (t.Kind == "SCALAR" && slices.Contains(builtinScalars, t.Name)) {
+			continue
+		}
+
+		writeDescription(&b, "", t.Description)
+		writeType(&b, t)
+		b.WriteString("\n")
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// hasCustomRoots reports whether the root types are named otherwise than Query, Mutation and Subscription, which
+// SDL leaves implicit.
+func (s *Schema) hasCustomRoots() bool {
+	return (s.QueryType != nil && s.QueryType.Name != "Query") ||
+		(s.MutationType != nil && s.MutationType.Name != "Mutation") ||
+		(s.SubscriptionType != nil && s.SubscriptionType.Name != "Subscription")
+}
+
+func writeType(b *strings.Builder, t *SchemaType) {
+	switch t.Kind {
+	case "SCALAR":
+		fmt.Fprintf(b, "scalar %s\n", t.Name)
+	case "OBJECT", "INTERFACE":
+		keyword := "type"
+		if t.Kind == "INTERFACE" {
+			keyword = "interface"
+		}
+
+		fmt.Fprintf(b, "%s %s", keyword, t.Name)
+
+		if len(t.Interfaces) > 0 {
+			names := make([]string, 0, len(t.Interfaces))
+			for _, i := range t.Interfaces {
+				names = append(names, i.named())
+			}
+
+			fmt.Fprintf(b, " implements %s", strings.Join(names, " & "))
+		}
+
+		b.WriteString(" {\n")
+
+		for _, f := range t.Fields {
+			writeDescription(b, "  ", f.Description)
+			fmt.Fprintf(b, "  %s%s: %s%s\n", f.Name, sdlArgs(f.Args), f.Type, deprecation(f.IsDeprecated, f.DeprecationReason))
+		}
+
+		b.WriteString("}\n")
+	case "UNION":
+		names := make([]string, 0, len(t.PossibleTypes))
+		for _, p := range t.PossibleTypes {
+			names = append(names, p.named())
+		}
+
+		fmt.Fprintf(b, "union %s = %s\n", t.Name, strings.Join(names, " | "))
+	case "ENUM":
+		fmt.Fprintf(b, "enum %s {\n", t.Name)
+
+		for _, v := range t.EnumValues {
+			writeDescription(b, "  ", v.Description)
+			fmt.Fprintf(b, "  %s%s\n", v.Name, deprecation(v.IsDeprecated, v.DeprecationReason))
+		}
+
+		b.WriteString("}\n")
+	case "INPUT_OBJECT":
+		fmt.Fprintf(b, "input %s {\n", t.Name)
+
+		for _, f := range t.InputFields {
+			writeDescription(b, "  ", f.Description)
+			fmt.Fprintf(b, "  %s\n", sdlInputValue(f))
+		}
+
+		b.WriteString("}\n")
+	}
+}
+
+// sdlArgs returns the argument definitions of a field or directive, in parentheses, or nothing when there are none.
+func sdlArgs(args []*InputValue) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	defs := make([]string, 0, len(args))
+	for _, a := range args {
+		defs = append(defs, sdlInputValue(a))
+	}
+
+	return "(" + strings.Join(defs, ", ") + ")"
+}
+
+func sdlInputValue(v *InputValue) string {
+	def := v.Name + ": " + v.Type.String()
+	if v.DefaultValue != nil {
+		def += " = " + *v.DefaultValue
+	}
+
+	return def
+}
+
+func deprecation(deprecated bool, reason *string) string {
+	if !deprecated {
+		return ""
+	}
+
+	if reason == nil || *reason == "" {
+		return " @deprecated"
+	}
+
+	return fmt.Sprintf(" @deprecated(reason: %q)", *reason)
+}
+
+// writeDescription writes a description as a block string, indented by indent, if there is one.
+func writeDescription(b *strings.Builder, indent string, description *string) {
+	if description == nil || *description == "" {
+		return
+	}
+
+	text := strings.ReplaceAll(*description, `"""`, `\"""`)
+
+	if !strings.Contains(text, "\n") {
+		fmt.Fprintf(b, "%s\"\"\"%s\"\"\"\n", indent, text)
+
+		return
+	}
+
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+
+	for line := range strings.SplitSeq(text, "\n") {
+		fmt.Fprintf(b, "%s%s\n", indent, line)
+	}
+
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+}
@@ -0,0 +1,73 @@
+package gql_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/stretchr/testify/require"
+)
+
+// schemaServer answers every request with the introspection result in testdata/schema.json, after checking that it
+// is the introspection query.
+func schemaServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	body, err := os.ReadFile("testdata/schema.json")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req gql.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Query != gql.IntrospectionQuery {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// testSchema returns the schema in testdata/schema.json.
+func testSchema(t *testing.T) *gql.Schema {
+	t.Helper()
+
+	schema, err := gql.NewClient(schemaServer(t).URL, gql.StaticToken("token")).Introspect(t.Context())
+	require.NoError(t, err)
+
+	return schema
+}
+
+func TestIntrospect(t *testing.T) {
+	t.Parallel()
+
+	schema := testSchema(t)
+	require.Equal(t, "Query", schema.QueryType.Name)
+	require.Equal(t, "[String]", schema.Type("Requests").Fields[2].Type.String())
+	require.Nil(t, schema.Type("Missing"))
+
+	want, err := os.ReadFile("testdata/schema.graphql")
+	require.NoError(t, err)
+	require.Equal(t, string(want), schema.SDL())
+}
+
+func TestIntrospectDisabled(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"data": null, "errors": [{"message": "introspection is disabled"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := gql.NewClient(server.URL, gql.StaticToken("token")).Introspect(t.Context())
+
+	var gqlErr *gql.GraphQLError
+	require.ErrorAs(t, err, &gqlErr)
+	require.ErrorContains(t, err, "introspection is disabled")
+}
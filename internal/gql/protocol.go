@@ -0,0 +1,171 @@
+package gql
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Protocol is a dialect of GraphQL over websockets, named by its websocket subprotocol.
+type Protocol string
+
+const (
+	// ProtocolAuto offers both protocols and speaks whichever the server picks, falling back to AppSync's.
+	ProtocolAuto Protocol = ""
+	// ProtocolAppSync is AppSync's dialect of the Apollo subscriptions-transport-ws protocol.
+	ProtocolAppSync Protocol = "graphql-ws"
+	// ProtocolTransportWS is the standard graphql-transport-ws protocol, as spoken by servers built on graphql-ws.
+	ProtocolTransportWS Protocol = "graphql-transport-ws"
+)
+
+// WithProtocol forces the protocol used for subscriptions, instead of the one the server picks.
+func WithProtocol(protocol Protocol) Option {
+	return func(client *Client) {
+		client.protocol = protocol
+	}
+}
+
+// wsProtocol translates between the messages of a protocol and the AppSync ones handled by wsSubscriber:
+// connection_ack, connection_error, start_ack, ka, ping, data, error and complete.
+type wsProtocol interface {
+	// connectionInit returns the message opening the connection.
+	connectionInit(auth map[string]string) any
+	// start returns the message starting subscription under id, and whether the server acknowledges it with start_ack.
+	// Protocols authorizing each subscription do so with authorize.
+	start(id string, subscription *Request, authorize func(body []byte) (map[string]string, error)) (any, bool, error)
+	// stop returns the message stopping the subscription under id, and whether the server acknowledges it with
+	// complete.
+	stop(id string) (any, bool)
+	// clientPings reports whether the client, rather than the server, keeps the connection alive.
+	clientPings() bool
+	// decode parses a received message.
+	decode(raw []byte) (*wsMessage, error)
+}
+
+// protocolFor returns the implementation of the protocol negotiated for a connection.
+func protocolFor(negotiated string) wsProtocol {
+	if Protocol(negotiated) == ProtocolTransportWS {
+		return transportWSProtocol{}
+	}
+
+	return appSyncProtocol{}
+}
+
+type appSyncProtocol struct{}
+
+func (appSyncProtocol) connectionInit(map[string]string) any {
+	return &wsMessage{Type: "connection_init"}
+}
+
+func (appSyncProtocol) start(
+	id string,
+	subscription *Request,
+	authorize func(body []byte) (map[string]string, error),
+) (any, bool, error) {
+	encSubscription, err := json.Marshal(subscription)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal subscription: %w", err)
+	}
+
+	auth, err := authorize(encSubscription)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to authorize subscription: %w", err)
+	}
+
+	wrappedSubscription, err := json.Marshal(string(encSubscription))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal wrapped subscription: %w", err)
+	}
+
+	return &wsMessage{
+		Type: "start",
+		ID:   id,
+		Payload: &Payload{
+			Data: wrappedSubscription,
+			Extensions: &PayloadExtensions{
+				Authorization: auth,
+			},
+		},
+	}, true, nil
+}
+
+func (appSyncProtocol) stop(id string) (any, bool) {
+	return &wsMessage{Type: "stop", ID: id}, true
+}
+
+func (appSyncProtocol) clientPings() bool {
+	return false
+}
+
+func (appSyncProtocol) decode(raw []byte) (*wsMessage, error) {
+	var res *wsMessage
+
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// transportWSMessage is a graphql-transport-ws message, whose payload depends on its type.
+type transportWSMessage struct {
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Payload any    `json:"payload,omitempty"`
+}
+
+// transportWSProtocol authenticates with the connection_init payload, and has the server answer pings rather than
+// send keep-alives.
+type transportWSProtocol struct{}
+
+func (transportWSProtocol) connectionInit(auth map[string]string) any {
+	return &transportWSMessage{Type: "connection_init", Payload: auth}
+}
+
+func (transportWSProtocol) start(
+	id string,
+	subscription *Request,
+	_ func(body []byte) (map[string]string, error),
+) (any, bool, error) {
+	return &transportWSMessage{Type: "subscribe", ID: id, Payload: subscription}, false, nil
+}
+
+func (transportWSProtocol) stop(id string) (any, bool) {
+	return &transportWSMessage{Type: "complete", ID: id}, false
+}
+
+func (transportWSProtocol) clientPings() bool {
+	return true
+}
+
+func (transportWSProtocol) decode(raw []byte) (*wsMessage, error) {
+	var msg struct {
+		Type    string          `json:"type"`
+		ID      string          `json:"id"`
+		Payload json.RawMessage `json:"payload"`
+	}
+
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+
+	res := &wsMessage{Type: msg.Type, ID: msg.ID}
+
+	switch msg.Type {
+	case "next":
+		res.Type = "data"
+
+		if err := json.Unmarshal(msg.Payload, &res.Payload); err != nil {
+			return nil, err
+		}
+	case "error":
+		res.Payload = &Payload{}
+
+		if err := json.Unmarshal(msg.Payload, &res.Payload.Errors); err != nil {
+			return nil, err
+		}
+	case "pong":
+		res.Type = "ka"
+	}
+
+	return res, nil
+}
@@ -0,0 +1,195 @@
+package gql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+type transportWSMessage struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// transportWSServer speaks graphql-transport-ws: it checks the connection_init auth and the subscription, then runs
+// script with a function sending messages. The messages received are sent to received, if given.
+func transportWSServer(
+	t *testing.T,
+	received chan<- transportWSMessage,
+	script func(send func(msg any), id string),
+) *httptest.Server {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-transport-ws"}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer ws.Close()
+
+		var msg transportWSMessage
+
+		if err := ws.ReadJSON(&msg); err != nil || msg.Type != "connection_init" {
+			return
+		}
+
+		var auth map[string]string
+
+		if err := json.Unmarshal(msg.Payload, &auth); err != nil || auth["Authorization"] != "token" {
+			_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(4403, "Forbidden"), time.Time{})
+
+			return
+		}
+
+		if err := ws.WriteJSON(map[string]string{"type": "connection_ack"}); err != nil {
+			return
+		}
+
+		if err := ws.ReadJSON(&msg); err != nil || msg.Type != "subscribe" {
+			return
+		}
+
+		var sub gql.Request
+
+		if err := json.Unmarshal(msg.Payload, &sub); err != nil || sub.Query != "subscription { x }" {
+			return
+		}
+
+		// Pongs are written while the script runs.
+		var writeMu sync.Mutex
+
+		send := func(msg any) {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+
+			_ = ws.WriteJSON(msg)
+		}
+
+		go func() {
+			for {
+				var msg transportWSMessage
+
+				if err := ws.ReadJSON(&msg); err != nil {
+					return
+				}
+
+				if msg.Type == "ping" {
+					send(map[string]string{"type": "pong"})
+				}
+
+				if received != nil {
+					received <- msg
+				}
+			}
+		}()
+
+		script(send, msg.ID)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestSubscribeTransportWS(t *testing.T) {
+	t.Parallel()
+
+	for name, protocol := range map[string]gql.Protocol{"auto": gql.ProtocolAuto, "forced": gql.ProtocolTransportWS} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			received := make(chan transportWSMessage, 10)
+
+			server := transportWSServer(t, received, func(send func(msg any), id string) {
+				// The server's pings must be answered.
+				send(map[string]string{"type": "ping"})
+
+				for _, data := range []string{"1", "2"} {
+					send(map[string]any{"type": "next", "id": id, "payload": map[string]any{"data": data}})
+				}
+
+				time.Sleep(time.Second)
+			})
+
+			var seen []string
+
+			client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithProtocol(protocol))
+
+			err := client.Subscribe(
+				context.Background(),
+				&gql.Request{Query: "subscription { x }"},
+				func(context.Context) error { return nil },
+				func(_ context.Context, payload *gql.Payload) (bool, error) {
+					seen = append(seen, string(payload.Data))
+
+					return len(seen) < 2, nil
+				},
+			)
+			require.NoError(t, err)
+			require.Equal(t, []string{`"1"`, `"2"`}, seen)
+
+			require.Equal(t, "pong", (<-received).Type)
+
+			// Stopping the subscription completes it, as the server does not.
+			require.Equal(t, "complete", (<-received).Type)
+		})
+	}
+}
+
+func TestSubscribeTransportWSPings(t *testing.T) {
+	t.Parallel()
+
+	// The server sends nothing for longer than the read timeout, so only the client's pings keep the connection
+	// alive.
+	server := transportWSServer(t, nil, func(send func(msg any), id string) {
+		time.Sleep(500 * time.Millisecond)
+
+		send(map[string]any{"type": "next", "id": id, "payload": map[string]any{"data": 1}})
+
+		time.Sleep(time.Second)
+	})
+
+	client := gql.NewClient(
+		server.URL+"/graphql",
+		gql.StaticToken("token"),
+		gql.WithTimeouts(transport.Timeouts{WSRead: 200 * time.Millisecond}),
+	)
+
+	err := client.Subscribe(
+		context.Background(),
+		&gql.Request{Query: "subscription { x }"},
+		func(context.Context) error { return nil },
+		func(context.Context, *gql.Payload) (bool, error) { return false, nil },
+	)
+	require.NoError(t, err)
+}
+
+func TestSubscribeTransportWSError(t *testing.T) {
+	t.Parallel()
+
+	server := transportWSServer(t, nil, func(send func(msg any), id string) {
+		send(map[string]any{"type": "error", "id": id, "payload": []map[string]any{{"message": "denied"}}})
+
+		time.Sleep(time.Second)
+	})
+
+	err := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), quiet).Subscribe(
+		context.Background(),
+		&gql.Request{Query: "subscription { x }"},
+		func(context.Context) error { return nil },
+		func(context.Context, *gql.Payload) (bool, error) { return true, nil },
+	)
+	require.ErrorIs(t, err, gql.ErrUnexpected)
+}
@@ -0,0 +1,170 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/transport"
+)
+
+const (
+	// throttleCooldown is how long the rate stays lowered after the server throttled a request.
+	throttleCooldown = 30 * time.Second
+	// minThrottleFactor bounds how far repeated throttling lowers the rate.
+	minThrottleFactor = 1.0 / 16
+)
+
+// RateLimiter is a token bucket bounding the rate of requests sent by Execute, across all the calls and clients
+// sharing it. Each throttled response halves the rate until no request has been throttled for 30 seconds.
+type RateLimiter struct {
+	// limit is fixed for limiters from NewRateLimiter, and nil for the shared ones following
+	// transport.CurrentRateLimit.
+	limit *transport.RateLimit
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	// factor scales the rate down after throttling, until slowUntil.
+	factor    float64
+	slowUntil time.Time
+}
+
+// NewRateLimiter returns a limiter allowing limit. Zero fields are taken from transport.DefaultRateLimit.
+func NewRateLimiter(limit transport.RateLimit) *RateLimiter {
+	if limit.Rate <= 0 {
+		limit.Rate = transport.DefaultRateLimit.Rate
+	}
+
+	if limit.Burst <= 0 {
+		limit.Burst = transport.DefaultRateLimit.Burst
+	}
+
+	return &RateLimiter{limit: &limit}
+}
+
+// WithRateLimiter sets the limiter of the requests sent by Execute, instead of the one shared by all clients of the
+// same endpoint, which follows the transport settings.
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(client *Client) {
+		client.limiter = l
+	}
+}
+
+var (
+	endpointLimitersMu sync.Mutex
+	endpointLimiters   = make(map[string]*RateLimiter)
+)
+
+// rateLimiter returns the limiter set with WithRateLimiter, or the one shared by the clients of the endpoint. Sharing
+// it matters, since callers such as the team package create a client per operation.
+func (c *Client) rateLimiter() *RateLimiter {
+	if c.limiter != nil {
+		return c.limiter
+	}
+
+	endpointLimitersMu.Lock()
+	defer endpointLimitersMu.Unlock()
+
+	l, ok := endpointLimiters[c.endpoint]
+	if !ok {
+		l = &RateLimiter{}
+		endpointLimiters[c.endpoint] = l
+	}
+
+	return l
+}
+
+// wait blocks until a request may be sent, or ctx ends.
+func (l *RateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+
+	now := time.Now()
+	rate, burst := l.current(now)
+
+	// Tokens accumulate while idle, up to the burst. Going into debt queues callers behind each other.
+	if l.last.IsZero() {
+		l.tokens = float64(burst)
+	} else {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*rate, float64(burst))
+	}
+
+	l.last = now
+	l.tokens--
+
+	delay := time.Duration(-l.tokens / rate * float64(time.Second))
+
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		// The request is not sent, so the token is handed back.
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// current returns the rate and burst in effect at now. It must be called with mu held.
+func (l *RateLimiter) current(now time.Time) (float64, int) {
+	limit := transport.CurrentRateLimit()
+	if l.limit != nil {
+		limit = *l.limit
+	}
+
+	if l.factor == 0 || now.After(l.slowUntil) {
+		l.factor = 1
+	}
+
+	return limit.Rate * l.factor, limit.Burst
+}
+
+// throttled lowers the rate after the server throttled a request, and drops the tokens saved up so that the next
+// requests are spread out straight away.
+func (l *RateLimiter) throttled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.current(now)
+
+	l.factor = max(l.factor/2, minThrottleFactor)
+	l.slowUntil = now.Add(throttleCooldown)
+	l.tokens = min(l.tokens, 0)
+	l.last = now
+}
+
+// throttlingTypes are the error types AppSync and the services behind it report throttling with.
+var throttlingTypes = []string{"ThrottlingException", "TooManyRequestsException", "Throttled"}
+
+// isThrottled reports whether a response, with its error if any, shows that the server throttled the request.
+func isThrottled(resp *http.Response, err error) bool {
+	if resp.StatusCode == http.StatusTooManyRequests || slices.Contains(throttlingTypes, amznErrorType(resp.Header)) {
+		return true
+	}
+
+	var gqlErr *GraphQLError
+	if errors.As(err, &gqlErr) {
+		for _, e := range gqlErr.Errors {
+			if slices.Contains(throttlingTypes, e.ErrorType) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
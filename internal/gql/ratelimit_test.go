@@ -0,0 +1,79 @@
+package gql_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteRateLimit(t *testing.T) {
+	t.Parallel()
+
+	server, requests := statusServer(t, `{"data": {"x": 1}}`, http.StatusOK)
+
+	limiter := gql.NewRateLimiter(transport.RateLimit{Rate: 20, Burst: 2})
+
+	start := time.Now()
+
+	// Clients sharing the limiter share the rate.
+	for range 3 {
+		client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithRateLimiter(limiter))
+
+		for range 2 {
+			_, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+			require.NoError(t, err)
+		}
+	}
+
+	// The burst goes out at once, and the other 4 requests at 20 per second.
+	require.GreaterOrEqual(t, time.Since(start), 180*time.Millisecond)
+	require.Equal(t, int32(6), requests.Load())
+}
+
+func TestExecuteThrottledSlowsDown(t *testing.T) {
+	t.Parallel()
+
+	server, _ := statusServer(t, `{"data": {"x": 1}}`, http.StatusOK)
+	throttling, _ := statusServer(t, `{"errors": [{"errorType": "ThrottlingException", "message": "Rate exceeded"}]}`,
+		http.StatusOK)
+
+	limiter := gql.NewRateLimiter(transport.RateLimit{Rate: 40, Burst: 1})
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithRateLimiter(limiter))
+
+	_, err := gql.NewClient(throttling.URL+"/graphql", gql.StaticToken("token"), gql.WithRateLimiter(limiter)).Execute(
+		context.Background(), &gql.Request{Query: "query { x }"},
+	)
+	require.ErrorIs(t, err, gql.ErrUnexpected)
+
+	start := time.Now()
+
+	for range 4 {
+		_, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+		require.NoError(t, err)
+	}
+
+	// At the halved rate of 20 per second, rather than 40.
+	require.GreaterOrEqual(t, time.Since(start), 180*time.Millisecond)
+}
+
+func TestExecuteRateLimitTimeout(t *testing.T) {
+	t.Parallel()
+
+	server, requests := statusServer(t, `{"data": {"x": 1}}`, http.StatusOK)
+
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"),
+		gql.WithRateLimiter(gql.NewRateLimiter(transport.RateLimit{Rate: 0.1, Burst: 1})))
+
+	_, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+	require.NoError(t, err)
+
+	_, err = client.Execute(context.Background(), &gql.Request{Query: "query { x }"},
+		gql.WithRequestTimeout(50*time.Millisecond))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int32(1), requests.Load())
+}
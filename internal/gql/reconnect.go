@@ -0,0 +1,92 @@
+package gql
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errConnectionLost marks a subscription that ended because its connection dropped, rather than being closed.
+var errConnectionLost = errors.New("connection lost")
+
+// ReconnectPolicy controls how a subscription recovers from its connection dropping, as happens when a proxy
+// recycles long-lived connections. The subscription is redialled and restarted with backoff between attempts.
+type ReconnectPolicy struct {
+	// Attempts is how many times in a row reconnecting is tried before the subscription fails.
+	Attempts int
+	// BaseDelay is the delay before the first attempt, which doubles for each attempt after it.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+	// OnReconnect, if set, is called once the subscription has been restarted, so the caller can fetch anything
+	// published while it was disconnected. An error ends the subscription.
+	OnReconnect func(ctx context.Context) error
+}
+
+// DefaultReconnectPolicy fills the zero fields of a policy given to WithReconnect.
+var DefaultReconnectPolicy = ReconnectPolicy{
+	Attempts:  5,
+	BaseDelay: time.Second,
+	MaxDelay:  30 * time.Second,
+}
+
+// WithReconnect makes subscriptions reconnect when their connection drops, instead of failing. Subscriptions ended
+// by onData or by the server are not restarted.
+func WithReconnect(policy ReconnectPolicy) Option {
+	return func(client *Client) {
+		client.reconnect = &policy
+	}
+}
+
+// backoff returns the attempts and delays of p, with zero fields set from DefaultReconnectPolicy.
+func (p ReconnectPolicy) backoff() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  cmp.Or(p.Attempts, DefaultReconnectPolicy.Attempts),
+		BaseDelay: cmp.Or(p.BaseDelay, DefaultReconnectPolicy.BaseDelay),
+		MaxDelay:  cmp.Or(p.MaxDelay, DefaultReconnectPolicy.MaxDelay),
+	}
+}
+
+// resubscribe reconnects and restarts subscription after its connection was lost with cause.
+func (c *Client) resubscribe(ctx context.Context, subscription *Request, cause error) (*wsSubscriber, error) {
+	backoff := c.reconnect.backoff()
+	logger := c.log()
+
+	for attempt := 1; ; attempt++ {
+		delay := backoff.delay(attempt, 0)
+
+		logger.Info("Subscription connection lost, reconnecting", "attempt", attempt, "delay", delay, "err", cause)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to process subscription: %w", cause)
+		case <-time.After(delay):
+		}
+
+		wss, err := c.connect(ctx, subscription)
+		if err != nil {
+			// A rejected token will be rejected again.
+			if attempt >= backoff.Attempts || errors.Is(err, ErrUnauthorized) {
+				return nil, fmt.Errorf("failed to reconnect after %d attempts: %w", attempt, err)
+			}
+
+			cause = err
+
+			continue
+		}
+
+		logger.Info("Subscription reconnected")
+
+		if c.reconnect.OnReconnect != nil {
+			if err := c.reconnect.OnReconnect(ctx); err != nil {
+				wss.shutdown(err)
+
+				return nil, fmt.Errorf("onReconnect error: %w", err)
+			}
+		}
+
+		return wss, nil
+	}
+}
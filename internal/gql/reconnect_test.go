@@ -0,0 +1,174 @@
+package gql_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// droppingServer acknowledges subscriptions and publishes the number of the connection, then drops the first
+// dropped connections without a close frame, as a proxy recycling them would. Connections beyond limit are refused,
+// unless limit is zero.
+func droppingServer(t *testing.T, dropped, limit int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{Subprotocols: []string{"graphql-ws"}}
+
+	var connections atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := connections.Add(1)
+		if limit > 0 && n > limit {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer ws.Close()
+
+		var msg struct {
+			ID string `json:"id"`
+		}
+
+		for _, ack := range []string{"connection_ack", "start_ack"} {
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+
+			if err := ws.WriteJSON(map[string]string{"type": ack, "id": msg.ID}); err != nil {
+				return
+			}
+		}
+
+		if err := ws.WriteJSON(map[string]any{"type": "data", "id": msg.ID, "payload": map[string]any{
+			"data": map[string]any{"connection": n},
+		}}); err != nil {
+			return
+		}
+
+		if n <= dropped {
+			_ = ws.UnderlyingConn().Close()
+
+			return
+		}
+
+		completeOnStop(ws)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &connections
+}
+
+// quiet discards the reconnection messages, which are logged at info.
+var quiet = gql.WithLogger(slog.New(slog.DiscardHandler))
+
+// completeOnStop reads from ws until it fails, answering stop messages with complete as AppSync does.
+func completeOnStop(ws *websocket.Conn) {
+	for {
+		var msg struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}
+
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		if msg.Type == "stop" {
+			if err := ws.WriteJSON(map[string]string{"type": "complete", "id": msg.ID}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func subscribeConnections(client *gql.Client, until int) ([]int, error) {
+	var seen []int
+
+	err := client.Subscribe(
+		context.Background(),
+		&gql.Request{Query: "subscription { x }"},
+		func(context.Context) error { return nil },
+		func(_ context.Context, payload *gql.Payload) (bool, error) {
+			var data struct {
+				Connection int `json:"connection"`
+			}
+
+			if err := payload.UnmarshalData(&data); err != nil {
+				return false, err
+			}
+
+			seen = append(seen, data.Connection)
+
+			return data.Connection < until, nil
+		},
+	)
+
+	return seen, err
+}
+
+func TestSubscribeReconnects(t *testing.T) {
+	t.Parallel()
+
+	server, connections := droppingServer(t, 2, 0)
+
+	var reconnects int
+
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), quiet, gql.WithReconnect(gql.ReconnectPolicy{
+		BaseDelay: time.Millisecond,
+		MaxDelay:  10 * time.Millisecond,
+		OnReconnect: func(context.Context) error {
+			reconnects++
+
+			return nil
+		},
+	}))
+
+	seen, err := subscribeConnections(client, 3)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3}, seen)
+	require.Equal(t, 2, reconnects)
+	require.Equal(t, int32(3), connections.Load())
+}
+
+func TestSubscribeReconnectDisabled(t *testing.T) {
+	t.Parallel()
+
+	server, connections := droppingServer(t, 1, 0)
+
+	seen, err := subscribeConnections(gql.NewClient(server.URL+"/graphql", gql.StaticToken("token")), 2)
+	require.Error(t, err)
+	require.Equal(t, []int{1}, seen)
+	require.Equal(t, int32(1), connections.Load())
+}
+
+func TestSubscribeReconnectGivesUp(t *testing.T) {
+	t.Parallel()
+
+	// The server stops accepting connections after the first one drops.
+	server, connections := droppingServer(t, 1, 1)
+
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), quiet, gql.WithReconnect(gql.ReconnectPolicy{
+		Attempts:  3,
+		BaseDelay: time.Millisecond,
+		MaxDelay:  10 * time.Millisecond,
+	}))
+
+	seen, err := subscribeConnections(client, 2)
+	require.ErrorContains(t, err, "failed to reconnect after 3 attempts")
+	require.Equal(t, []int{1}, seen)
+	require.Equal(t, int32(4), connections.Load())
+}
@@ -0,0 +1,137 @@
+package gql
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how Execute retries requests that failed to connect to the server. Queries are also retried
+// when the connection fails later on, or the server turns them away with 429 Too Many Requests or a 5xx status.
+// Mutations are not, since they may have taken effect, nor is any request once its response has begun to arrive. All
+// attempts share the HTTP timeout.
+type RetryPolicy struct {
+	// Attempts is the total number of attempts, including the first. One disables retries.
+	Attempts int
+	// BaseDelay is the delay before the first retry, which doubles for each retry after it.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts, including one requested by a Retry-After header.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used by clients without WithRetryPolicy, and fills the zero fields of a policy given to it.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  5 * time.Second,
+}
+
+// NoRetries disables retries.
+var NoRetries = RetryPolicy{Attempts: 1}
+
+// WithRetryPolicy sets how failed requests are retried, instead of DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(client *Client) {
+		client.retry = &policy
+	}
+}
+
+// withDefaults returns p with zero fields set from DefaultRetryPolicy.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  cmp.Or(p.Attempts, DefaultRetryPolicy.Attempts),
+		BaseDelay: cmp.Or(p.BaseDelay, DefaultRetryPolicy.BaseDelay),
+		MaxDelay:  cmp.Or(p.MaxDelay, DefaultRetryPolicy.MaxDelay),
+	}
+}
+
+// delay returns how long to wait after the given attempt. Unless the server asked for a delay, the upper half is
+// jittered so that clients failing together do not retry together.
+func (p RetryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, p.MaxDelay)
+	}
+
+	d := p.BaseDelay << (attempt - 1)
+	if d < p.BaseDelay || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryableError marks a failed attempt that may succeed if repeated.
+type retryableError struct {
+	err error
+	// retryAfter is the delay the server asked for, or zero.
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// retryableStatus reports whether a response with the status code may succeed if repeated.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as a date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0)
+	}
+
+	return 0
+}
+
+// connectError reports whether err is a failure to connect to the server, such as a refused connection, a name that
+// does not resolve or a failed TLS handshake, which the request cannot have reached the server before.
+func connectError(err error) bool {
+	var (
+		opErr        *net.OpError
+		dnsErr       *net.DNSError
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+	)
+
+	switch {
+	case errors.As(err, &opErr):
+		return opErr.Op == "dial" || opErr.Op == "proxyconnect"
+	case errors.As(err, &dnsErr), errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr):
+		return true
+	default:
+		return false
+	}
+}
+
+// asRetryable returns the retryable error in err's chain, if any.
+func asRetryable(err error) (*retryableError, bool) {
+	var retryable *retryableError
+
+	ok := errors.As(err, &retryable)
+
+	return retryable, ok
+}
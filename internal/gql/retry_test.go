@@ -0,0 +1,183 @@
+package gql_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/stretchr/testify/require"
+)
+
+var fastRetries = gql.RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+// statusServer answers with the given statuses in turn, and then with the last one, counting the requests.
+func statusServer(t *testing.T, body string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := int(requests.Add(1))
+
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func execute(server *httptest.Server, policy gql.RetryPolicy) (*gql.Payload, error) {
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithRetryPolicy(policy))
+
+	return client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+}
+
+func TestExecuteRetriesServerErrors(t *testing.T) {
+	t.Parallel()
+
+	server, requests := statusServer(t, `{"data": {"x": 1}}`,
+		http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+
+	payload, err := execute(server, fastRetries)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"x": 1}`, string(payload.Data))
+	require.Equal(t, int32(3), requests.Load())
+}
+
+func TestExecuteGivesUpAfterAttempts(t *testing.T) {
+	t.Parallel()
+
+	server, requests := statusServer(t, "", http.StatusBadGateway)
+
+	_, err := execute(server, fastRetries)
+	require.ErrorIs(t, err, gql.ErrUnexpected)
+	require.ErrorContains(t, err, "502")
+	require.Equal(t, int32(3), requests.Load())
+
+	server, requests = statusServer(t, "", http.StatusBadGateway)
+
+	_, err = execute(server, gql.NoRetries)
+	require.Error(t, err)
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestExecuteDoesNotRetry(t *testing.T) {
+	t.Parallel()
+
+	// The request reached the server, so repeating it could repeat its effects.
+	server, requests := statusServer(t, `{"errors": [{"errorType": "Internal", "message": "boom"}]}`, http.StatusOK)
+
+	_, err := execute(server, fastRetries)
+	require.ErrorContains(t, err, "boom")
+	require.Equal(t, int32(1), requests.Load())
+
+	server, requests = statusServer(t, "", http.StatusBadRequest)
+
+	_, err = execute(server, fastRetries)
+	require.Error(t, err)
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestExecuteRetriesNetworkErrors(t *testing.T) {
+	t.Parallel()
+
+	errReset := errors.New("connection reset")
+
+	var attempts int
+
+	httpClient := &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		attempts++
+
+		return nil, errReset
+	})}
+
+	client := gql.NewClient("http://team.example.invalid/graphql", gql.StaticToken("token"),
+		gql.WithHTTPClient(httpClient), gql.WithRetryPolicy(fastRetries))
+
+	_, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+	require.ErrorIs(t, err, errReset)
+	require.Equal(t, 3, attempts)
+}
+
+func TestExecuteRetriesMutationsOnlyBeforeConnecting(t *testing.T) {
+	t.Parallel()
+
+	mutation := &gql.Request{Query: "mutation CreateRequest { createRequests { id } }"}
+
+	// A mutation turned away by the server may still have taken effect.
+	server, requests := statusServer(t, "", http.StatusServiceUnavailable)
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithRetryPolicy(fastRetries))
+
+	_, err := client.Execute(context.Background(), mutation)
+	require.ErrorIs(t, err, gql.ErrUnexpected)
+	require.Equal(t, int32(1), requests.Load())
+
+	// So may one whose connection failed once it was established.
+	var attempts atomic.Int32
+
+	dropping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts.Add(1)
+
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	t.Cleanup(dropping.Close)
+
+	client = gql.NewClient(dropping.URL+"/graphql", gql.StaticToken("token"), gql.WithRetryPolicy(fastRetries))
+
+	_, err = client.Execute(context.Background(), mutation)
+	require.Error(t, err)
+	require.Equal(t, int32(1), attempts.Load())
+
+	// Queries are idempotent, so they are retried.
+	_, err = client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+	require.Error(t, err)
+	require.Equal(t, int32(4), attempts.Load())
+
+	// A mutation that could not connect cannot have reached the server.
+	var dials atomic.Int32
+
+	refusing := &http.Client{Transport: &http.Transport{
+		DialContext: func(context.Context, string, string) (net.Conn, error) {
+			dials.Add(1)
+
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+		},
+	}}
+
+	client = gql.NewClient("http://team.example.invalid/graphql", gql.StaticToken("token"),
+		gql.WithHTTPClient(refusing), gql.WithRetryPolicy(fastRetries))
+
+	_, err = client.Execute(context.Background(), mutation)
+	require.ErrorContains(t, err, "connection refused")
+	require.Equal(t, int32(3), dials.Load())
+}
+
+func TestExecuteDoesNotRetryBodyFailures(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+
+	// The server responds, but the body is cut short.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"data":`))
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := execute(server, fastRetries)
+	require.ErrorContains(t, err, "failed to read body")
+	require.Equal(t, int32(1), requests.Load())
+}
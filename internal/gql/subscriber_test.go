@@ -0,0 +1,403 @@
+package gql_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/gql/gqltest"
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// subscription is the outcome of a subscription run by fakeSubscribe.
+type subscription struct {
+	seen []string
+	err  error
+}
+
+// fakeSubscribe subscribes over conn in the background, on a client with the given options, and collects the data
+// published until the given number of messages have arrived. The outcome is delivered once the subscription ends.
+func fakeSubscribe(conn *gqltest.Conn, until int, opts ...gql.Option) <-chan subscription {
+	client := gql.NewClient("https://example.com/graphql", gql.StaticToken("token"),
+		append([]gql.Option{gql.WithWebsocketDialer(gqltest.Dialer(conn))}, opts...)...)
+
+	done := make(chan subscription, 1)
+
+	go func() {
+		seen, err := collectClient(client, until)
+		done <- subscription{seen: seen, err: err}
+	}()
+
+	return done
+}
+
+// await returns the outcome of a subscription, failing the test if it does not end within a few seconds.
+func await(t *testing.T, done <-chan subscription) subscription {
+	t.Helper()
+
+	select {
+	case sub := <-done:
+		return sub
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription did not end")
+
+		return subscription{}
+	}
+}
+
+// acknowledge initialises conn and returns the ID of the subscription the client then starts, which is not
+// acknowledged yet.
+func acknowledge(t *testing.T, conn *gqltest.Conn, ack string) string {
+	t.Helper()
+
+	conn.Expect(t, "connection_init")
+	conn.Send(ack)
+
+	return conn.Expect(t, "start").ID
+}
+
+func TestSubscribeInit(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		frames  []string
+		wantErr error
+		errText string
+	}{
+		"ack": {
+			frames: []string{`{"type":"connection_ack"}`},
+		},
+		"keep-alive before ack": {
+			frames: []string{`{"type":"ka"}`, `{"type":"unknown"}`, `{"type":"connection_ack"}`},
+		},
+		"connection error": {
+			frames:  []string{`{"type":"connection_error","payload":{"errors":[{"message":"denied"}]}}`},
+			wantErr: gql.ErrUnexpected,
+			errText: "connection error",
+		},
+		"no ack": {
+			frames:  []string{`{"type":"ka"}`},
+			wantErr: gql.ErrHandshakeTimeout,
+			errText: "no connection_ack within 100ms",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := gqltest.NewConn("")
+			done := fakeSubscribe(conn, 1, gql.WithTimeouts(transport.Timeouts{Handshake: 100 * time.Millisecond}))
+
+			conn.Expect(t, "connection_init")
+			conn.Send(tc.frames...)
+
+			if tc.wantErr != nil {
+				sub := await(t, done)
+				require.ErrorIs(t, sub.err, tc.wantErr)
+				require.ErrorContains(t, sub.err, tc.errText)
+
+				closed, _ := conn.Closed()
+				require.True(t, closed)
+
+				return
+			}
+
+			start := conn.Expect(t, "start")
+			conn.Send(
+				fmt.Sprintf(`{"type":"start_ack","id":%q}`, start.ID),
+				fmt.Sprintf(`{"type":"data","id":%q,"payload":{"data":1}}`, start.ID),
+			)
+
+			conn.Expect(t, "stop")
+			conn.Send(fmt.Sprintf(`{"type":"complete","id":%q}`, start.ID))
+
+			sub := await(t, done)
+			require.NoError(t, sub.err)
+			require.Equal(t, []string{"1"}, sub.seen)
+		})
+	}
+}
+
+func TestSubscribeStartAck(t *testing.T) {
+	t.Parallel()
+
+	t.Run("other subscription", func(t *testing.T) {
+		t.Parallel()
+
+		conn := gqltest.NewConn("")
+		done := fakeSubscribe(conn, 1)
+
+		id := acknowledge(t, conn, `{"type":"connection_ack"}`)
+
+		// Acknowledgements of other subscriptions are not mistaken for this one's.
+		conn.Send(
+			`{"type":"start_ack","id":"other"}`,
+			`{"type":"data","id":"other","payload":{"data":0}}`,
+			fmt.Sprintf(`{"type":"start_ack","id":%q}`, id),
+			fmt.Sprintf(`{"type":"data","id":%q,"payload":{"data":1}}`, id),
+		)
+
+		conn.Expect(t, "stop")
+		conn.Send(fmt.Sprintf(`{"type":"complete","id":%q}`, id))
+
+		sub := await(t, done)
+		require.NoError(t, sub.err)
+		require.Equal(t, []string{"1"}, sub.seen)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		t.Parallel()
+
+		conn := gqltest.NewConn("")
+		done := fakeSubscribe(conn, 1, gql.WithTimeouts(transport.Timeouts{Handshake: 100 * time.Millisecond}))
+
+		acknowledge(t, conn, `{"type":"connection_ack"}`)
+		conn.Send(`{"type":"start_ack","id":"other"}`, `{"type":"ka"}`)
+
+		sub := await(t, done)
+		require.ErrorIs(t, sub.err, gql.ErrHandshakeTimeout)
+		require.ErrorContains(t, sub.err, "no start_ack within 100ms")
+	})
+}
+
+func TestSubscribeErrorFrames(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		// frames are sent once the subscription is started, with its ID in place of $ID.
+		frames []string
+		seen   []string
+		// stopped is whether the subscription had started, so that the client stops it.
+		stopped bool
+	}{
+		"instead of start_ack": {
+			frames: []string{`{"type":"error","id":"$ID","payload":{"errors":[{"message":"bad query"}]}}`},
+		},
+		"after data": {
+			frames: []string{
+				`{"type":"start_ack","id":"$ID"}`,
+				`{"type":"data","id":"$ID","payload":{"data":1}}`,
+				`{"type":"error","id":"$ID","payload":{"errors":[{"message":"resolver failed"}]}}`,
+			},
+			seen:    []string{"1"},
+			stopped: true,
+		},
+		"connection-wide": {
+			frames: []string{
+				`{"type":"start_ack","id":"$ID"}`,
+				`{"type":"error","payload":{"errors":[{"message":"throttled"}]}}`,
+			},
+			stopped: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := gqltest.NewConn("")
+			done := fakeSubscribe(conn, 10)
+
+			id := acknowledge(t, conn, `{"type":"connection_ack"}`)
+
+			for _, frame := range tc.frames {
+				conn.Send(strings.ReplaceAll(frame, "$ID", id))
+			}
+
+			if tc.stopped {
+				conn.Expect(t, "stop")
+				conn.Send(fmt.Sprintf(`{"type":"complete","id":%q}`, id))
+			}
+
+			sub := await(t, done)
+			require.ErrorIs(t, sub.err, gql.ErrUnexpected)
+			require.ErrorContains(t, sub.err, "websocket error")
+			require.Equal(t, tc.seen, sub.seen)
+		})
+	}
+}
+
+func TestSubscribeErrorDetails(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		frame   string
+		wantErr error
+		errText string
+	}{
+		"unauthorized": {
+			frame: `{"type":"error","id":"$ID","payload":{"errors":[` +
+				`{"errorType":"UnauthorizedException","errorCode":401,"message":"Token has expired."}]}}`,
+			wantErr: gql.ErrUnauthorized,
+			errText: "websocket error: UnauthorizedException: Token has expired. (code 401)",
+		},
+		"max subscriptions": {
+			frame: `{"type":"error","id":"$ID","payload":{"errors":[` +
+				`{"errorType":"MaxSubscriptionsReachedError","message":"Max number of 100 subscriptions reached"}]}}`,
+			wantErr: gql.ErrMaxSubscriptions,
+			errText: "websocket error: MaxSubscriptionsReachedError: Max number of 100 subscriptions reached",
+		},
+		"error info": {
+			frame: `{"type":"error","id":"$ID","payload":{"errors":[` +
+				`{"errorType":"Custom","message":"bad input","errorInfo":{"field":"date"}}]}}`,
+			wantErr: gql.ErrUnexpected,
+			errText: `websocket error: Custom: bad input (info: {"field":"date"})`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := gqltest.NewConn("")
+			done := fakeSubscribe(conn, 1)
+
+			id := acknowledge(t, conn, `{"type":"connection_ack"}`)
+			conn.Send(strings.ReplaceAll(tc.frame, "$ID", id))
+
+			sub := await(t, done)
+			require.ErrorIs(t, sub.err, tc.wantErr)
+			require.ErrorIs(t, sub.err, gql.ErrUnexpected)
+			require.ErrorContains(t, sub.err, tc.errText)
+
+			var wsErr *gql.WebsocketError
+			require.ErrorAs(t, sub.err, &wsErr)
+			require.Equal(t, "error", wsErr.MessageType)
+			require.Len(t, wsErr.Errors, 1)
+
+			// Only the matching sentinel is matched, so that callers can tell the failures apart.
+			for _, other := range []error{gql.ErrUnauthorized, gql.ErrMaxSubscriptions} {
+				if other != tc.wantErr {
+					require.NotErrorIs(t, sub.err, other)
+				}
+			}
+		})
+	}
+
+	t.Run("connection error", func(t *testing.T) {
+		t.Parallel()
+
+		conn := gqltest.NewConn("")
+		done := fakeSubscribe(conn, 1)
+
+		conn.Expect(t, "connection_init")
+		conn.Send(`{"type":"connection_error","payload":{"errors":[` +
+			`{"errorType":"UnauthorizedException","message":"You are not authorized to make this call."}]}}`)
+
+		sub := await(t, done)
+		require.ErrorIs(t, sub.err, gql.ErrUnauthorized)
+		require.ErrorContains(t, sub.err,
+			"connection error: UnauthorizedException: You are not authorized to make this call.")
+	})
+}
+
+func TestSubscribeKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	t.Run("kept alive", func(t *testing.T) {
+		t.Parallel()
+
+		conn := gqltest.NewConn("")
+		done := fakeSubscribe(conn, 2, gql.WithTimeouts(transport.Timeouts{WSRead: 200 * time.Millisecond}))
+
+		id := acknowledge(t, conn, `{"type":"connection_ack"}`)
+		conn.Send(
+			fmt.Sprintf(`{"type":"start_ack","id":%q}`, id),
+			fmt.Sprintf(`{"type":"data","id":%q,"payload":{"data":1}}`, id),
+		)
+
+		// Keep-alives spanning several read timeouts hold the connection open.
+		for range 5 {
+			time.Sleep(100 * time.Millisecond)
+			conn.Send(`{"type":"ka"}`)
+		}
+
+		conn.Send(fmt.Sprintf(`{"type":"data","id":%q,"payload":{"data":2}}`, id))
+
+		conn.Expect(t, "stop")
+		conn.Send(fmt.Sprintf(`{"type":"complete","id":%q}`, id))
+
+		sub := await(t, done)
+		require.NoError(t, sub.err)
+		require.Equal(t, []string{"1", "2"}, sub.seen)
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		t.Parallel()
+
+		conn := gqltest.NewConn("")
+		done := fakeSubscribe(conn, 2, gql.WithTimeouts(transport.Timeouts{WSRead: 200 * time.Millisecond}))
+
+		id := acknowledge(t, conn, `{"type":"connection_ack"}`)
+		conn.Send(fmt.Sprintf(`{"type":"start_ack","id":%q}`, id))
+
+		sub := await(t, done)
+		require.ErrorIs(t, sub.err, gql.ErrKeepAliveTimeout)
+	})
+}
+
+func TestSubscribeDataLoop(t *testing.T) {
+	t.Parallel()
+
+	t.Run("handler stops", func(t *testing.T) {
+		t.Parallel()
+
+		conn := gqltest.NewConn("")
+		done := fakeSubscribe(conn, 3)
+
+		id := acknowledge(t, conn, `{"type":"connection_ack"}`)
+		conn.Send(fmt.Sprintf(`{"type":"start_ack","id":%q}`, id))
+
+		for i := range 5 {
+			conn.Send(fmt.Sprintf(`{"type":"data","id":%q,"payload":{"data":%d}}`, id, i))
+		}
+
+		require.Equal(t, id, conn.Expect(t, "stop").ID)
+		conn.Send(fmt.Sprintf(`{"type":"complete","id":%q}`, id))
+
+		sub := await(t, done)
+		require.NoError(t, sub.err)
+		require.Equal(t, []string{"0", "1", "2"}, sub.seen)
+
+		// The last subscription leaving closes the connection, normally.
+		closed, code := conn.Closed()
+		require.True(t, closed)
+		require.Equal(t, websocket.CloseNormalClosure, code)
+	})
+
+	t.Run("server completes", func(t *testing.T) {
+		t.Parallel()
+
+		conn := gqltest.NewConn("")
+		done := fakeSubscribe(conn, 3)
+
+		id := acknowledge(t, conn, `{"type":"connection_ack"}`)
+		conn.Send(
+			fmt.Sprintf(`{"type":"start_ack","id":%q}`, id),
+			fmt.Sprintf(`{"type":"data","id":%q,"payload":{"data":"a"}}`, id),
+			fmt.Sprintf(`{"type":"complete","id":%q}`, id),
+		)
+
+		sub := await(t, done)
+		require.ErrorIs(t, sub.err, gql.ErrComplete)
+		require.Equal(t, []string{`"a"`}, sub.seen)
+	})
+
+	t.Run("connection dropped", func(t *testing.T) {
+		t.Parallel()
+
+		conn := gqltest.NewConn("")
+		done := fakeSubscribe(conn, 3)
+
+		id := acknowledge(t, conn, `{"type":"connection_ack"}`)
+		conn.Send(
+			fmt.Sprintf(`{"type":"start_ack","id":%q}`, id),
+			fmt.Sprintf(`{"type":"data","id":%q,"payload":{"data":1}}`, id),
+		)
+		conn.Drop()
+
+		// Messages received before the connection dropped are still delivered.
+		sub := await(t, done)
+		require.ErrorContains(t, sub.err, "failed to read message")
+		require.Equal(t, []string{"1"}, sub.seen)
+	})
+}
@@ -0,0 +1,107 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/csnewman/team-cli/internal/redact"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans of this package.
+const instrumentationName = "github.com/csnewman/team-cli/internal/gql"
+
+// WithTracerProvider sets the provider of the tracer recording operations, instead of that of the span of the context
+// each operation is given. Without a span, nothing is recorded, so tracing costs nothing by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(client *Client) {
+		client.tracerProvider = tp
+	}
+}
+
+func (c *Client) tracer(ctx context.Context) trace.Tracer {
+	if c.tracerProvider != nil {
+		return c.tracerProvider.Tracer(instrumentationName)
+	}
+
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(instrumentationName)
+}
+
+// operationRegex matches the type and name of the first operation in a document, skipping comments.
+var operationRegex = regexp.MustCompile(`^(?:\s|,|#[^\n]*)*(query|mutation|subscription)\b(?:\s|,)*([_A-Za-z]\w*)?`)
+
+// operation returns the type and name of the operation in the query of req. The name is empty for anonymous
+// operations, and the shorthand { ... } form is a query.
+func operation(req *Request) (string, string) {
+	m := operationRegex.FindStringSubmatch(req.Query)
+	if m == nil {
+		return "query", ""
+	}
+
+	return m[1], m[2]
+}
+
+// startOperation starts the span of sending req, named after its operation as in "query GetRequest".
+func (c *Client) startOperation(ctx context.Context, req *Request) (context.Context, trace.Span) {
+	kind, name := operation(req)
+
+	spanName := kind
+	if name != "" {
+		spanName += " " + name
+	}
+
+	return c.tracer(ctx).Start(
+		ctx,
+		spanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("graphql.operation.type", kind),
+			attribute.String("graphql.operation.name", name),
+		),
+	)
+}
+
+// endSpan ends span, recording err as its status. Subscriptions completed by the server are not failures.
+func endSpan(span trace.Span, err error) {
+	var respErr *ResponseError
+	if errors.As(err, &respErr) && respErr.RequestID != "" {
+		span.SetAttributes(attribute.String("aws.request_id", respErr.RequestID))
+	}
+
+	if err != nil && !errors.Is(err, ErrComplete) {
+		// Error messages may quote response bodies, so they are redacted as logs are.
+		span.SetStatus(codes.Error, redact.Text(err.Error()))
+	}
+
+	span.End()
+}
+
+// recordResponse adds the status and request ID of a response to the span of ctx.
+func recordResponse(ctx context.Context, resp *http.Response) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	if id := resp.Header.Get("x-amzn-RequestId"); id != "" {
+		span.SetAttributes(attribute.String("aws.request_id", id))
+	}
+}
+
+// injectTraceContext adds the span context of ctx to header in the W3C Trace Context format, so that the server can
+// continue the trace. Nothing is added unless a span is being recorded.
+func injectTraceContext(ctx context.Context, header http.Header) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	header.Set("traceparent", fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags()))
+
+	if state := sc.TraceState().String(); state != "" {
+		header.Set("tracestate", state)
+	}
+}
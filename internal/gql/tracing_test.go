@@ -0,0 +1,154 @@
+package gql_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordingProvider() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), recorder
+}
+
+// spanNames returns the names of the ended spans, in the order they ended.
+func spanNames(recorder *tracetest.SpanRecorder) []string {
+	var names []string
+
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+
+	return names
+}
+
+func TestExecuteSpans(t *testing.T) {
+	t.Parallel()
+
+	server, _ := statusServer(t, `{"data": {"x": 1}}`, http.StatusOK)
+	provider, recorder := recordingProvider()
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithTracerProvider(provider))
+
+	for _, query := range []string{
+		"query GetRequest($id: ID!) { getRequests(id: $id) { id } }",
+		"# Comments come first.\nmutation\n  UpdateRequest { x }",
+		"subscription{ x }",
+		"{ x }",
+	} {
+		_, err := client.Execute(context.Background(), &gql.Request{Query: query})
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, []string{"query GetRequest", "mutation UpdateRequest", "subscription", "query"}, spanNames(recorder))
+
+	span := recorder.Ended()[0]
+	require.Contains(t, span.Attributes(), attribute.String("graphql.operation.type", "query"))
+	require.Contains(t, span.Attributes(), attribute.String("graphql.operation.name", "GetRequest"))
+	require.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+	require.Equal(t, codes.Unset, span.Status().Code)
+}
+
+func TestExecuteSpanError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("x-amzn-RequestId", "5a2c7e0e-0003")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"token": "secret"}`))
+	}))
+	defer server.Close()
+
+	provider, recorder := recordingProvider()
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithTracerProvider(provider))
+
+	_, err := client.Execute(context.Background(), &gql.Request{Query: "query GetRequest { x }"})
+	require.Error(t, err)
+
+	span := recorder.Ended()[0]
+	require.Equal(t, codes.Error, span.Status().Code)
+	require.NotContains(t, span.Status().Description, "secret")
+	require.Contains(t, span.Attributes(), attribute.String("aws.request_id", "5a2c7e0e-0003"))
+}
+
+func TestSubscribeSpans(t *testing.T) {
+	t.Parallel()
+
+	server := scriptedServer(t, func(ws *websocket.Conn, id string) {
+		for range 2 {
+			_ = ws.WriteJSON(map[string]any{"type": "data", "id": id, "payload": map[string]any{"data": 1}})
+		}
+
+		completeOnStop(ws)
+	})
+
+	provider, recorder := recordingProvider()
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithTracerProvider(provider))
+
+	err := client.Subscribe(
+		context.Background(),
+		&gql.Request{Query: "subscription OnUpdate { x }"},
+		func(context.Context) error { return nil },
+		func(context.Context, *gql.Payload) (bool, error) { return false, nil },
+	)
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Equal(t, []string{"websocket connect", "websocket start", "subscription OnUpdate"}, spanNames(recorder))
+
+	// The connection and the subscription handshake are part of the operation.
+	operation := spans[2]
+	require.Equal(t, operation.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	require.Equal(t, operation.SpanContext().SpanID(), spans[1].Parent().SpanID())
+	require.Len(t, operation.Events(), 1)
+	require.Equal(t, "data", operation.Events()[0].Name)
+}
+
+func TestExecuteSpanFromContext(t *testing.T) {
+	t.Parallel()
+
+	server, _ := statusServer(t, `{"data": {"x": 1}}`, http.StatusOK)
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"))
+
+	// Without a provider of its own, the client records into the trace of the caller.
+	provider, recorder := recordingProvider()
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "command")
+
+	_, err := client.Execute(ctx, &gql.Request{Query: "query GetRequest { x }"})
+	require.NoError(t, err)
+
+	parent.End()
+
+	require.Equal(t, []string{"query GetRequest", "command"}, spanNames(recorder))
+	require.Equal(t, parent.SpanContext().SpanID(), recorder.Ended()[0].Parent().SpanID())
+}
+
+func TestExecutePropagatesTraceContext(t *testing.T) {
+	t.Parallel()
+
+	var traceparent string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		_, _ = w.Write([]byte(`{"data": {"x": 1}}`))
+	}))
+	defer server.Close()
+
+	provider, recorder := recordingProvider()
+	client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"), gql.WithTracerProvider(provider))
+
+	_, err := client.Execute(context.Background(), &gql.Request{Query: "query { x }"})
+	require.NoError(t, err)
+
+	span := recorder.Ended()[0].SpanContext()
+	require.Equal(t, "00-"+span.TraceID().String()+"-"+span.SpanID().String()+"-01", traceparent)
+}
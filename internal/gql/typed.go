@@ -0,0 +1,51 @@
+package gql
+
+import (
+	"context"
+	"fmt"
+)
+
+// ExecuteInto sends a query or mutation with client, and returns its data unmarshalled into a T. Errors in the
+// response are returned as a *GraphQLError, without the partial data; callers wanting it use Client.Execute instead.
+func ExecuteInto[T any](ctx context.Context, client *Client, req *Request, opts ...CallOption) (T, error) {
+	var data T
+
+	payload, err := client.Execute(ctx, req, opts...)
+	if err != nil {
+		return data, err
+	}
+
+	if err := unmarshalData(payload, &data); err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+// DecodeData adapts onData, which takes the data of each message unmarshalled into a T, to the callback of
+// Client.Subscribe. Data that does not unmarshal into a T ends the subscription with the error.
+func DecodeData[T any](
+	onData func(ctx context.Context, data T) (bool, error),
+) func(ctx context.Context, payload *Payload) (bool, error) {
+	return func(ctx context.Context, payload *Payload) (bool, error) {
+		var data T
+
+		if err := unmarshalData(payload, &data); err != nil {
+			return false, err
+		}
+
+		return onData(ctx, data)
+	}
+}
+
+func unmarshalData(payload *Payload, tgt any) error {
+	if payload == nil || len(payload.Data) == 0 {
+		return fmt.Errorf("%w: response holds no data", ErrUnexpected)
+	}
+
+	if err := payload.UnmarshalData(tgt); err != nil {
+		return fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	return nil
+}
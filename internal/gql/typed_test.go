@@ -0,0 +1,115 @@
+package gql_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/gql/gqltest"
+	"github.com/stretchr/testify/require"
+)
+
+type typedResult struct {
+	X struct {
+		Name string `json:"name"`
+	} `json:"x"`
+}
+
+func TestExecuteInto(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		body    string
+		want    string
+		wantErr error
+		errText string
+	}{
+		"data": {
+			body: `{"data": {"x": {"name": "a"}}}`,
+			want: "a",
+		},
+		"graphql errors": {
+			body:    `{"data": {"x": {"name": "partial"}}, "errors": [{"message": "failed"}]}`,
+			wantErr: gql.ErrUnexpected,
+			errText: "graphql: failed",
+		},
+		"no data": {
+			body:    `{}`,
+			wantErr: gql.ErrUnexpected,
+			errText: "response holds no data",
+		},
+		"wrong shape": {
+			body:    `{"data": {"x": [1]}}`,
+			errText: "failed to unmarshal data",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server, _ := statusServer(t, tc.body, http.StatusOK)
+			client := gql.NewClient(server.URL+"/graphql", gql.StaticToken("token"))
+
+			data, err := gql.ExecuteInto[typedResult](context.Background(), client, &gql.Request{Query: "query { x }"})
+
+			if tc.errText != "" {
+				if tc.wantErr != nil {
+					require.ErrorIs(t, err, tc.wantErr)
+				}
+
+				require.ErrorContains(t, err, tc.errText)
+				// Partial data is not returned.
+				require.Empty(t, data.X.Name)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.want, data.X.Name)
+		})
+	}
+}
+
+func TestDecodeData(t *testing.T) {
+	t.Parallel()
+
+	conn := gqltest.NewConn("")
+	client := gql.NewClient("https://example.com/graphql", gql.StaticToken("token"),
+		gql.WithWebsocketDialer(gqltest.Dialer(conn)))
+
+	done := make(chan subscription, 1)
+
+	go func() {
+		var seen []string
+
+		err := client.Subscribe(
+			context.Background(),
+			&gql.Request{Query: "subscription { x }"},
+			func(context.Context) error { return nil },
+			gql.DecodeData(func(_ context.Context, data typedResult) (bool, error) {
+				seen = append(seen, data.X.Name)
+
+				return true, nil
+			}),
+		)
+
+		done <- subscription{seen: seen, err: err}
+	}()
+
+	id := acknowledge(t, conn, `{"type":"connection_ack"}`)
+	conn.Send(
+		fmt.Sprintf(`{"type":"start_ack","id":%q}`, id),
+		fmt.Sprintf(`{"type":"data","id":%q,"payload":{"data":{"x":{"name":"a"}}}}`, id),
+		fmt.Sprintf(`{"type":"data","id":%q,"payload":{"data":{"x":{"name":"b"}}}}`, id),
+		// Data of the wrong shape ends the subscription.
+		fmt.Sprintf(`{"type":"data","id":%q,"payload":{"data":{"x":"c"}}}`, id),
+	)
+
+	conn.Expect(t, "stop")
+	conn.Send(fmt.Sprintf(`{"type":"complete","id":%q}`, id))
+
+	sub := await(t, done)
+	require.ErrorContains(t, sub.err, "failed to unmarshal data")
+	require.Equal(t, []string{"a", "b"}, sub.seen)
+}
@@ -0,0 +1,148 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// DefaultMaxFileSize is the size at which log files are rotated when no limit is configured.
+const DefaultMaxFileSize = 10 * 1024 * 1024
+
+// RotatingFile is an append-only log file which is rotated to a single ".1" backup once it exceeds its maximum size,
+// so that logs cannot grow unbounded.
+type RotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	size    int64
+	file    *os.File
+}
+
+// OpenFile opens (or creates with mode 0600) the log file at path, rotating it first if it is already too large.
+func OpenFile(path string, maxSize int64) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFileSize
+	}
+
+	f := &RotatingFile{
+		path:    path,
+		maxSize: maxSize,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	if f.size >= maxSize {
+		if err := f.rotate(); err != nil {
+			_ = f.file.Close()
+
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("could not stat log file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("could not close log file: %w", err)
+	}
+
+	if err := os.Rename(f.path, f.path+".1"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not rotate log file: %w", err)
+	}
+
+	return f.open()
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+// TeeHandler dispatches each record to all of its handlers.
+type TeeHandler []slog.Handler
+
+func (t TeeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t TeeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (t TeeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(TeeHandler, len(t))
+
+	for i, h := range t {
+		out[i] = h.WithAttrs(attrs)
+	}
+
+	return out
+}
+
+func (t TeeHandler) WithGroup(name string) slog.Handler {
+	out := make(TeeHandler, len(t))
+
+	for i, h := range t {
+		out[i] = h.WithGroup(name)
+	}
+
+	return out
+}
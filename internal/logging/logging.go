@@ -0,0 +1,48 @@
+// Package logging defines the log levels used across team-cli on top of log/slog.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// LevelTrace is below slog.LevelDebug, and enables dumps of HTTP exchanges and websocket frames. Anything logged at
+// this level must be passed through the redact package first.
+const LevelTrace = slog.LevelDebug - 4
+
+// ParseLevel parses a level name: trace, debug, info, warn or error.
+func ParseLevel(raw string) (slog.Level, error) {
+	if strings.EqualFold(raw, "trace") {
+		return LevelTrace, nil
+	}
+
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(raw)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: %w", raw, err)
+	}
+
+	return level, nil
+}
+
+// ReplaceLevelName renders LevelTrace as "TRACE" rather than "DEBUG-4". It is intended for
+// slog.HandlerOptions.ReplaceAttr.
+func ReplaceLevelName(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey {
+		if level, ok := a.Value.Any().(slog.Level); ok && level <= LevelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	}
+
+	return a
+}
+
+func Trace(ctx context.Context, msg string, args ...any) {
+	slog.Log(ctx, LevelTrace, msg, args...)
+}
+
+func TraceEnabled(ctx context.Context) bool {
+	return slog.Default().Enabled(ctx, LevelTrace)
+}
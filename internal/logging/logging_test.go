@@ -0,0 +1,96 @@
+package logging_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	t.Parallel()
+
+	for raw, expected := range map[string]slog.Level{
+		"trace": logging.LevelTrace,
+		"TRACE": logging.LevelTrace,
+		"debug": slog.LevelDebug,
+		"warn":  slog.LevelWarn,
+	} {
+		level, err := logging.ParseLevel(raw)
+		require.NoError(t, err)
+		require.Equal(t, expected, level)
+	}
+
+	_, err := logging.ParseLevel("verbose")
+	require.Error(t, err)
+}
+
+func TestReplaceLevelName(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level:       logging.LevelTrace,
+		ReplaceAttr: logging.ReplaceLevelName,
+	}))
+
+	logger.Log(t.Context(), logging.LevelTrace, "frame")
+
+	require.Contains(t, buf.String(), "level=TRACE")
+}
+
+func TestRotatingFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "team-cli.log")
+
+	f, err := logging.OpenFile(path, 10)
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("12345678\n"))
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("abc\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "abc\n", string(current))
+
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	require.Equal(t, "12345678\n", string(rotated))
+
+	// Windows does not use modes; the file inherits the ACL of its directory.
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+}
+
+func TestTeeHandler(t *testing.T) {
+	t.Parallel()
+
+	var terminal, file bytes.Buffer
+
+	logger := slog.New(logging.TeeHandler{
+		slog.NewTextHandler(&terminal, &slog.HandlerOptions{Level: slog.LevelWarn}),
+		slog.NewTextHandler(&file, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	})
+
+	logger.Debug("debug only")
+	logger.Warn("both")
+
+	require.NotContains(t, terminal.String(), "debug only")
+	require.Contains(t, terminal.String(), "both")
+	require.Contains(t, file.String(), "debug only")
+	require.Contains(t, file.String(), "both")
+}
@@ -0,0 +1,284 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrUnsupported = errors.New("unsupported output")
+
+type Format string
+
+const (
+	FormatTable Format = "table"
+	FormatJSON  Format = "json"
+	FormatYAML  Format = "yaml"
+	FormatCSV   Format = "csv"
+)
+
+var Formats = []Format{FormatTable, FormatJSON, FormatYAML, FormatCSV}
+
+func ParseFormat(raw string) (Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(raw, string(f)) {
+			return f, nil
+		}
+	}
+
+	names := make([]string, 0, len(Formats))
+
+	for _, f := range Formats {
+		names = append(names, string(f))
+	}
+
+	return "", fmt.Errorf("%w: unknown format %q, expected one of: %s", ErrUnsupported, raw, strings.Join(names, ", "))
+}
+
+// IsStructured reports whether the format is intended for machine consumption.
+func (f Format) IsStructured() bool {
+	return f != FormatTable
+}
+
+// Texter is implemented by values that have a human-readable representation, used by the table format.
+type Texter interface {
+	WriteText(w io.Writer) error
+}
+
+// Table is a flat, row-oriented representation of a value. Column order is part of the output contract.
+type Table struct {
+	// Keys are the machine-readable column names used for column selection. They are optional, and when present
+	// are parallel to Headers.
+	Keys    []string
+	Headers []string
+	Rows    [][]string
+}
+
+func (t *Table) TextTable() *Table {
+	return t
+}
+
+// Select returns a copy of the table containing only the columns with the given keys, in the requested order.
+func (t *Table) Select(keys []string) (*Table, error) {
+	indices := make([]int, 0, len(keys))
+
+	for _, key := range keys {
+		idx := slices.Index(t.Keys, strings.ToLower(strings.TrimSpace(key)))
+		if idx < 0 {
+			return nil, fmt.Errorf(
+				"%w: unknown column %q, expected one of: %s",
+				ErrUnsupported,
+				key,
+				strings.Join(t.Keys, ", "),
+			)
+		}
+
+		indices = append(indices, idx)
+	}
+
+	out := &Table{
+		Keys:    make([]string, 0, len(indices)),
+		Headers: make([]string, 0, len(indices)),
+		Rows:    make([][]string, 0, len(t.Rows)),
+	}
+
+	for _, idx := range indices {
+		out.Keys = append(out.Keys, t.Keys[idx])
+		out.Headers = append(out.Headers, t.Headers[idx])
+	}
+
+	for _, row := range t.Rows {
+		selected := make([]string, 0, len(indices))
+
+		for _, idx := range indices {
+			cell := ""
+
+			if idx < len(row) {
+				cell = row[idx]
+			}
+
+			selected = append(selected, cell)
+		}
+
+		out.Rows = append(out.Rows, selected)
+	}
+
+	return out, nil
+}
+
+// Tabular is implemented by values that can be flattened into a Table, used by the csv format.
+type Tabular interface {
+	Table() *Table
+}
+
+// Summarizer is implemented by values that can describe themselves in a single line, printed after the table
+// format. The summary is never included in structured formats.
+type Summarizer interface {
+	Summary() string
+}
+
+type summarizedTable struct {
+	*Table
+	summary string
+}
+
+func (t *summarizedTable) Summary() string {
+	return t.summary
+}
+
+// WithSummary attaches the summary of v, if it has one, to a table derived from it.
+func WithSummary(table *Table, v any) TextTabular {
+	if s, ok := v.(Summarizer); ok {
+		return &summarizedTable{Table: table, summary: s.Summary()}
+	}
+
+	return table
+}
+
+// Identifiable is implemented by values that can be reduced to a list of identifiers, used by quiet mode.
+type Identifiable interface {
+	IDs() []string
+}
+
+// RenderIDs writes the identifiers of v to w, one per line.
+func RenderIDs(w io.Writer, v any) error {
+	ids, ok := v.(Identifiable)
+	if !ok {
+		return fmt.Errorf("%w: %T cannot be rendered as identifiers", ErrUnsupported, v)
+	}
+
+	for _, id := range ids.IDs() {
+		if _, err := fmt.Fprintln(w, id); err != nil {
+			return fmt.Errorf("could not write: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Render writes v to w in the given format. Structured formats use the JSON field names of v, so the json struct
+// tags are the single source of truth for field naming, and always carry the schema version.
+func Render(w io.Writer, format Format, v any) error {
+	switch format {
+	case FormatTable:
+		if err := renderText(w, v); err != nil {
+			return err
+		}
+
+		if s, ok := v.(Summarizer); ok {
+			if _, err := fmt.Fprintf(w, "\n%s\n", s.Summary()); err != nil {
+				return fmt.Errorf("could not write summary: %w", err)
+			}
+		}
+
+		return nil
+	case FormatJSON:
+		raw, err := versioned(v)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+
+		if err := json.Indent(&buf, raw, "", "  "); err != nil {
+			return fmt.Errorf("could not indent json: %w", err)
+		}
+
+		buf.WriteByte('\n')
+
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("could not write json: %w", err)
+		}
+
+		return nil
+	case FormatYAML:
+		return renderYAML(w, v)
+	case FormatCSV:
+		t, ok := v.(Tabular)
+		if !ok {
+			return fmt.Errorf("%w: %T cannot be rendered as %s", ErrUnsupported, v, format)
+		}
+
+		return renderCSV(w, t.Table())
+	default:
+		return fmt.Errorf("%w: unknown format %q", ErrUnsupported, format)
+	}
+}
+
+func renderText(w io.Writer, v any) error {
+	if t, ok := v.(TextTabular); ok {
+		return renderTextTable(w, t.TextTable())
+	}
+
+	t, ok := v.(Texter)
+	if !ok {
+		return fmt.Errorf("%w: %T cannot be rendered as %s", ErrUnsupported, v, FormatTable)
+	}
+
+	return t.WriteText(w)
+}
+
+func renderCSV(w io.Writer, table *Table) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(table.Headers); err != nil {
+		return fmt.Errorf("could not write csv header: %w", err)
+	}
+
+	if err := cw.WriteAll(table.Rows); err != nil {
+		return fmt.Errorf("could not write csv rows: %w", err)
+	}
+
+	return nil
+}
+
+func renderYAML(w io.Writer, v any) error {
+	raw, err := versioned(v)
+	if err != nil {
+		return err
+	}
+
+	// JSON is valid YAML, so decoding it into a node tree keeps the field order and names of the JSON encoding.
+	var node yaml.Node
+
+	if err := yaml.Unmarshal(raw, &node); err != nil {
+		return fmt.Errorf("could not decode json as yaml: %w", err)
+	}
+
+	resetStyle(&node)
+
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(&node); err != nil {
+		return fmt.Errorf("could not encode yaml: %w", err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("could not encode yaml: %w", err)
+	}
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("could not write yaml: %w", err)
+	}
+
+	return nil
+}
+
+// resetStyle clears the flow and quoting styles inherited from the JSON source so the output uses block style.
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
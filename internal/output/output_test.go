@@ -0,0 +1,148 @@
+package output_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+type testItem struct {
+	ID    string   `json:"id"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+func TestRenderStructured(t *testing.T) {
+	t.Parallel()
+
+	item := &testItem{ID: "123123123123", Count: 3, Tags: []string{"a", "b"}}
+
+	var buf bytes.Buffer
+
+	require.NoError(t, output.Render(&buf, output.FormatJSON, item))
+	require.JSONEq(t, `{"schemaVersion":7,"id":"123123123123","count":3,"tags":["a","b"]}`, buf.String())
+
+	buf.Reset()
+
+	require.NoError(t, output.Render(&buf, output.FormatYAML, item))
+	require.Equal(t, "schemaVersion: 7\nid: \"123123123123\"\ncount: 3\ntags:\n  - a\n  - b\n", buf.String())
+
+	buf.Reset()
+
+	require.NoError(t, output.Render(&buf, output.FormatJSON, []*testItem{item}))
+	require.JSONEq(t, `{"schemaVersion":7,"items":[{"id":"123123123123","count":3,"tags":["a","b"]}]}`, buf.String())
+
+	buf.Reset()
+
+	require.NoError(t, output.Render(&buf, output.FormatJSON, "x"))
+	require.JSONEq(t, `{"schemaVersion":7,"value":"x"}`, buf.String())
+}
+
+func (i *testItem) Table() *output.Table {
+	return &output.Table{
+		Headers: []string{"id", "tags"},
+		Rows:    [][]string{{i.ID, strings.Join(i.Tags, ",")}},
+	}
+}
+
+func TestRenderCSV(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	require.NoError(t, output.Render(&buf, output.FormatCSV, &testItem{ID: "1", Tags: []string{"a", "b"}}))
+	require.Equal(t, "id,tags\n1,\"a,b\"\n", buf.String())
+}
+
+func TestRenderTableUnsupported(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	require.ErrorIs(t, output.Render(&buf, output.FormatTable, &testItem{}), output.ErrUnsupported)
+}
+
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+
+	format, err := output.ParseFormat("JSON")
+	require.NoError(t, err)
+	require.Equal(t, output.FormatJSON, format)
+
+	_, err = output.ParseFormat("xml")
+	require.ErrorIs(t, err, output.ErrUnsupported)
+}
+
+func TestRenderTemplate(t *testing.T) {
+	t.Parallel()
+
+	items := []*testItem{
+		{ID: "1", Count: 2, Tags: []string{"a"}},
+		{ID: "2", Count: 3},
+	}
+
+	var buf bytes.Buffer
+
+	require.NoError(t, output.RenderTemplate(&buf, `{{.ID}}\t{{.Count}}\t{{json .Tags}}`, items))
+	require.Equal(t, "1\t2\t[\"a\"]\n2\t3\tnull\n", buf.String())
+
+	err := output.RenderTemplate(&buf, `{{.Missing}}`, items)
+	require.ErrorIs(t, err, output.ErrTemplate)
+	require.ErrorContains(t, err, "Missing")
+	require.ErrorContains(t, err, "available fields: ID, Count, Tags")
+}
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "short", output.Truncate("short", 10))
+	require.Equal(t, "abcd…", output.Truncate("abcdefgh", 5))
+	require.Equal(t, "日本語…", output.Truncate("日本語テキスト", 4))
+	require.Equal(t, "unchanged", output.Truncate("unchanged", 0))
+}
+
+func TestTableSelect(t *testing.T) {
+	t.Parallel()
+
+	table := &output.Table{
+		Keys:    []string{"id", "name", "role"},
+		Headers: []string{"ID", "NAME", "ROLE"},
+		Rows:    [][]string{{"1", "example", "ReadOnly"}},
+	}
+
+	selected, err := table.Select([]string{"role", "ID"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ROLE", "ID"}, selected.Headers)
+	require.Equal(t, [][]string{{"ReadOnly", "1"}}, selected.Rows)
+
+	_, err = table.Select([]string{"bogus"})
+	require.ErrorIs(t, err, output.ErrUnsupported)
+	require.ErrorContains(t, err, "expected one of: id, name, role")
+}
+
+type summarizedItems []*testItem
+
+func (s summarizedItems) TextTable() *output.Table {
+	return &output.Table{Keys: []string{"id"}, Headers: []string{"ID"}, Rows: [][]string{{"1"}}}
+}
+
+func (s summarizedItems) Summary() string {
+	return "1 item"
+}
+
+func TestRenderSummary(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	require.NoError(t, output.Render(&buf, output.FormatTable, summarizedItems{}))
+	require.Equal(t, "ID\n1\n\n1 item\n", buf.String())
+
+	buf.Reset()
+
+	require.NoError(t, output.Render(&buf, output.FormatJSON, summarizedItems{}))
+	require.NotContains(t, buf.String(), "1 item")
+}
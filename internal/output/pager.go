@@ -0,0 +1,79 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const DefaultPager = "less -R"
+
+// WriteWithPager writes content to w, piping it through the pager command instead when w is a terminal and the
+// content is taller than it. If the pager cannot be started the content is written directly.
+func WriteWithPager(w io.Writer, content []byte, pager string) error {
+	if !exceedsTerminal(w, content) {
+		return writeAll(w, content)
+	}
+
+	args := pagerArgs(pager)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+
+		// A pager exiting with an error (e.g. when quit early) has still displayed the output.
+		if errors.As(err, &exitErr) {
+			slog.Debug("Pager exited with an error", "pager", pager, "err", err)
+
+			return nil
+		}
+
+		slog.Warn("Failed to start pager", "pager", pager, "err", err)
+
+		return writeAll(w, content)
+	}
+
+	return nil
+}
+
+// pagerArgs splits the pager command into its arguments. An empty or blank command selects DefaultPager.
+func pagerArgs(pager string) []string {
+	if args := strings.Fields(pager); len(args) > 0 {
+		return args
+	}
+
+	return strings.Fields(DefaultPager)
+}
+
+func exceedsTerminal(w io.Writer, content []byte) bool {
+	f, ok := w.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return false
+	}
+
+	_, height, err := term.GetSize(int(f.Fd()))
+	if err != nil || height <= 0 {
+		return false
+	}
+
+	return bytes.Count(content, []byte("\n")) >= height
+}
+
+func writeAll(w io.Writer, content []byte) error {
+	if _, err := w.Write(content); err != nil {
+		return fmt.Errorf("could not write output: %w", err)
+	}
+
+	return nil
+}
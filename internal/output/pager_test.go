@@ -0,0 +1,16 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPagerArgs(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, []string{"less", "-R"}, pagerArgs(""))
+	require.Equal(t, []string{"less", "-R"}, pagerArgs(" \t "))
+	require.Equal(t, []string{"more"}, pagerArgs("more"))
+	require.Equal(t, []string{"bat", "--paging", "always"}, pagerArgs("  bat --paging  always "))
+}
@@ -0,0 +1,196 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the structured output schema. It must be bumped whenever the shape of any
+// structured output changes, which the schema tests enforce.
+const SchemaVersion = 7
+
+const (
+	schemaVersionKey = "schemaVersion"
+	itemsKey         = "items"
+	valueKey         = "value"
+	jsonSchemaDraft  = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// versioned returns the JSON encoding of v carrying the schema version. Structs and maps gain a leading
+// schemaVersion field, slices are wrapped under items and any other value under value, so every document is an
+// object. The envelope is chosen from the Go type rather than the encoded value so it always matches Schema.
+func versioned(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode json: %w", err)
+	}
+
+	raw = bytes.TrimSpace(raw)
+	version := fmt.Sprintf("{%q:%d", schemaVersionKey, SchemaVersion)
+
+	switch documentKind(reflect.TypeOf(v)) {
+	case "object":
+		if len(raw) == 0 || raw[0] != '{' {
+			// A nil map or pointer encodes as null.
+			return []byte(version + "}"), nil
+		}
+
+		body := bytes.TrimSpace(raw[1:])
+
+		if len(body) > 0 && body[0] == '}' {
+			return []byte(version + "}"), nil
+		}
+
+		return append([]byte(version+","), body...), nil
+	case "array":
+		return append(append([]byte(fmt.Sprintf("%s,%q:", version, itemsKey)), raw...), '}'), nil
+	default:
+		return append(append([]byte(fmt.Sprintf("%s,%q:", version, valueKey)), raw...), '}'), nil
+	}
+}
+
+// documentKind returns the JSON Schema type a value of type t is documented as at the top level: object, array, or
+// an empty string for anything else.
+func documentKind(t reflect.Type) string {
+	kind, _ := typeSchema(t)["type"].(string)
+
+	if kind == "object" || kind == "array" {
+		return kind
+	}
+
+	return ""
+}
+
+// Schema returns the JSON Schema of the structured output of v, including the schema version envelope. It is
+// derived from the Go type of v and its json struct tags.
+func Schema(title string, v any) map[string]any {
+	inner := typeSchema(reflect.TypeOf(v))
+	version := map[string]any{"type": "integer", "const": SchemaVersion}
+
+	var schema map[string]any
+
+	switch documentKind(reflect.TypeOf(v)) {
+	case "object":
+		schema = inner
+
+		props, _ := schema["properties"].(map[string]any)
+		if props == nil {
+			props = map[string]any{}
+			schema["properties"] = props
+		}
+
+		props[schemaVersionKey] = version
+		schema["required"] = append(
+			[]string{schemaVersionKey},
+			slices.DeleteFunc(requiredOf(schema), func(s string) bool { return s == schemaVersionKey })...,
+		)
+	case "array":
+		schema = envelope(version, itemsKey, inner)
+	default:
+		schema = envelope(version, valueKey, inner)
+	}
+
+	schema["$schema"] = jsonSchemaDraft
+	schema["title"] = title
+
+	return schema
+}
+
+func envelope(version map[string]any, key string, inner map[string]any) map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			schemaVersionKey: version,
+			key:              inner,
+		},
+		"required": []string{schemaVersionKey, key},
+	}
+}
+
+func requiredOf(schema map[string]any) []string {
+	required, _ := schema["required"].([]string)
+
+	return required
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func typeSchema(t reflect.Type) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+
+	if t.Kind() == reflect.Pointer {
+		return typeSchema(t.Elem())
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType):
+		// Custom encodings cannot be described from the type alone.
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		return map[string]any{}
+	}
+}
+
+func structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	required := []string{}
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		props[name] = typeSchema(field.Type)
+
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
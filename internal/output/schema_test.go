@@ -0,0 +1,36 @@
+package output_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+type schemaItem struct {
+	ID      string            `json:"id"`
+	Created time.Time         `json:"created"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Hidden  string            `json:"-"`
+}
+
+func TestSchema(t *testing.T) {
+	t.Parallel()
+
+	schema := output.Schema("items", []*schemaItem{})
+
+	require.Equal(t, "items", schema["title"])
+	require.Equal(t, []string{"schemaVersion", "items"}, schema["required"])
+
+	props := schema["properties"].(map[string]any)
+	require.Equal(t, map[string]any{"type": "integer", "const": output.SchemaVersion}, props["schemaVersion"])
+
+	item := props["items"].(map[string]any)["items"].(map[string]any)
+	require.Equal(t, []string{"id", "created"}, item["required"])
+
+	fields := item["properties"].(map[string]any)
+	require.Len(t, fields, 3)
+	require.Equal(t, map[string]any{"type": "string", "format": "date-time"}, fields["created"])
+	require.Equal(t, "object", fields["labels"].(map[string]any)["type"])
+}
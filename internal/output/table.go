@@ -0,0 +1,145 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	columnPadding  = 2
+	minColumnWidth = 8
+	ellipsis       = "…"
+)
+
+// TextTabular is implemented by values that are displayed to humans as an aligned table, used by the table format.
+type TextTabular interface {
+	TextTable() *Table
+}
+
+func renderTextTable(w io.Writer, table *Table) error {
+	table = fitTable(table, TerminalWidth(w))
+
+	tw := tabwriter.NewWriter(w, 0, 0, columnPadding, ' ', 0)
+
+	fmt.Fprintln(tw, strings.Join(table.Headers, "\t"))
+
+	for _, row := range table.Rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("could not write table: %w", err)
+	}
+
+	return nil
+}
+
+// TerminalWidth returns the width of the terminal w writes to, or 0 when w is not a terminal.
+func TerminalWidth(w io.Writer) int {
+	f, ok := w.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return 0
+	}
+
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+
+	return width
+}
+
+// fitTable truncates the widest columns until the table fits within width. Columns are never shrunk below a
+// minimum width, so very narrow terminals will still wrap. A width of 0 disables fitting.
+func fitTable(table *Table, width int) *Table {
+	if width <= 0 {
+		return table
+	}
+
+	widths := make([]int, len(table.Headers))
+
+	for i, h := range table.Headers {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+
+	for _, row := range table.Rows {
+		for i, cell := range row {
+			if i < len(widths) {
+				widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+			}
+		}
+	}
+
+	total := func() int {
+		sum := columnPadding * (len(widths) - 1)
+
+		for _, w := range widths {
+			sum += w
+		}
+
+		return sum
+	}
+
+	changed := false
+
+	for total() > width {
+		widest := 0
+
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+
+		if widths[widest] <= minColumnWidth {
+			break
+		}
+
+		widths[widest] = max(minColumnWidth, widths[widest]-(total()-width))
+		changed = true
+	}
+
+	if !changed {
+		return table
+	}
+
+	out := &Table{
+		Headers: make([]string, len(table.Headers)),
+		Rows:    make([][]string, len(table.Rows)),
+	}
+
+	for i, h := range table.Headers {
+		out.Headers[i] = Truncate(h, widths[i])
+	}
+
+	for r, row := range table.Rows {
+		out.Rows[r] = make([]string, len(row))
+
+		for i, cell := range row {
+			if i < len(widths) {
+				cell = Truncate(cell, widths[i])
+			}
+
+			out.Rows[r][i] = cell
+		}
+	}
+
+	return out
+}
+
+// Truncate shortens s to at most n runes, replacing the tail with an ellipsis when it is cut.
+func Truncate(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+
+	return string(runes[:n-1]) + ellipsis
+}
@@ -0,0 +1,30 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFitTable(t *testing.T) {
+	t.Parallel()
+
+	table := &Table{
+		Headers: []string{"ID", "NAME"},
+		Rows: [][]string{
+			{"1", "corp-prod-payments-eu-west-1"},
+			{"2", "dev"},
+		},
+	}
+
+	require.Same(t, table, fitTable(table, 0))
+	require.Same(t, table, fitTable(table, 80))
+
+	fitted := fitTable(table, 20)
+	require.Equal(t, []string{"1", "corp-prod-payme…"}, fitted.Rows[0])
+	require.Equal(t, []string{"2", "dev"}, fitted.Rows[1])
+
+	// Columns are never shrunk below the minimum width.
+	fitted = fitTable(table, 5)
+	require.Equal(t, "corp-pr…", fitted.Rows[0][1])
+}
@@ -0,0 +1,82 @@
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+var ErrTemplate = errors.New("template error")
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		enc, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+
+		return string(enc), nil
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// RenderTemplate executes a text/template against v, once per element when v is a slice, writing a newline after
+// each execution. The escape sequences \t and \n are interpreted so templates can be passed verbatim from a shell.
+func RenderTemplate(w io.Writer, text string, v any) error {
+	text = strings.NewReplacer(`\t`, "\t", `\n`, "\n").Replace(text)
+
+	tmpl, err := template.New("format").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("%w: could not parse: %w", ErrTemplate, err)
+	}
+
+	items := []any{v}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		items = make([]any, 0, rv.Len())
+
+		for i := range rv.Len() {
+			items = append(items, rv.Index(i).Interface())
+		}
+	}
+
+	for _, item := range items {
+		if err := tmpl.Execute(w, item); err != nil {
+			return fmt.Errorf("%w: %w (available fields: %s)", ErrTemplate, err, strings.Join(fieldNames(item), ", "))
+		}
+
+		if _, err := fmt.Fprintln(w); err != nil {
+			return fmt.Errorf("could not write: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func fieldNames(v any) []string {
+	t := reflect.TypeOf(v)
+
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	names := make([]string, 0, t.NumField())
+
+	for i := range t.NumField() {
+		if f := t.Field(i); f.IsExported() {
+			names = append(names, f.Name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,119 @@
+// Package progress reports the status of slow operations. Library code reports status through the context, and
+// the CLI decides whether and how to display it.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+type Reporter interface {
+	Status(msg string)
+}
+
+type reporterKey struct{}
+
+func WithReporter(ctx context.Context, r Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, r)
+}
+
+// Report updates the status shown for the current operation, if a reporter is attached to ctx.
+func Report(ctx context.Context, msg string) {
+	if r, ok := ctx.Value(reporterKey{}).(Reporter); ok {
+		r.Status(msg)
+	}
+}
+
+var frames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const clearLine = "\r\x1b[K"
+
+// Spinner animates a status line on a terminal. It is a no-op when disabled, so callers need not check.
+type Spinner struct {
+	w       io.Writer
+	enabled bool
+
+	mu      sync.Mutex
+	msg     string
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewSpinner creates a spinner writing to f, which is only enabled when requested and f is a terminal.
+func NewSpinner(f *os.File, enabled bool) *Spinner {
+	return &Spinner{
+		w:       f,
+		enabled: enabled && f != nil && term.IsTerminal(int(f.Fd())),
+	}
+}
+
+func (s *Spinner) Start(msg string) {
+	if !s.enabled {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.msg = msg
+
+	if s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+
+	go s.run(s.stop, s.stopped)
+}
+
+func (s *Spinner) Status(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.msg = msg
+}
+
+// Stop halts the animation and clears the status line, so normal output can follow.
+func (s *Spinner) Stop() {
+	s.mu.Lock()
+	stop, stopped := s.stop, s.stopped
+	s.stop, s.stopped = nil, nil
+	s.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	<-stopped
+}
+
+func (s *Spinner) run(stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for i := 0; ; i++ {
+		s.mu.Lock()
+		msg := s.msg
+		s.mu.Unlock()
+
+		fmt.Fprintf(s.w, "%s%s %s", clearLine, frames[i%len(frames)], msg)
+
+		select {
+		case <-stop:
+			fmt.Fprint(s.w, clearLine)
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package progress_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/progress"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder []string
+
+func (r *recorder) Status(msg string) {
+	*r = append(*r, msg)
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	// Reporting without a reporter must be a no-op.
+	progress.Report(context.Background(), "ignored")
+
+	var r recorder
+
+	ctx := progress.WithReporter(context.Background(), &r)
+
+	progress.Report(ctx, "fetching homepage")
+	progress.Report(ctx, "fetching main JS file")
+
+	require.Equal(t, recorder{"fetching homepage", "fetching main JS file"}, r)
+}
+
+func TestSpinnerDisabled(t *testing.T) {
+	t.Parallel()
+
+	s := progress.NewSpinner(nil, true)
+	s.Start("working")
+	s.Status("still working")
+	s.Stop()
+}
@@ -0,0 +1,179 @@
+// Package redact removes authorization material from values before they are logged. All logging of headers,
+// payloads or URLs that may carry credentials must go through this package.
+package redact
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const Placeholder = "[REDACTED]"
+
+// subprotocolPrefix marks the AppSync websocket subprotocol that carries base64-encoded authorization headers.
+const subprotocolPrefix = "header-"
+
+// authQueryKey is the query parameter carrying base64-encoded authorization headers on AppSync websocket URLs.
+const authQueryKey = "header"
+
+var sensitiveKeys = map[string]bool{
+	"authorization":        true,
+	"access_token":         true,
+	"accesstoken":          true,
+	"id_token":             true,
+	"idtoken":              true,
+	"refresh_token":        true,
+	"refreshtoken":         true,
+	"token":                true,
+	"x-api-key":            true,
+	"api_key":              true,
+	"apikey":               true,
+	"jwt":                  true,
+	"x-amz-security-token": true,
+	"cookie":               true,
+	"set-cookie":           true,
+	"code_verifier":        true,
+	"client_secret":        true,
+	"password":             true,
+}
+
+// IsSensitiveKey reports whether a header, query parameter or JSON field name carries secret material.
+func IsSensitiveKey(key string) bool {
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// Header returns a copy of h with sensitive values replaced.
+func Header(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+
+	for key, values := range h {
+		redacted := make([]string, len(values))
+
+		for i, v := range values {
+			switch {
+			case IsSensitiveKey(key):
+				redacted[i] = Placeholder
+			case strings.EqualFold(key, "Sec-Websocket-Protocol"):
+				redacted[i] = Subprotocol(v)
+			default:
+				redacted[i] = v
+			}
+		}
+
+		out[key] = redacted
+	}
+
+	return out
+}
+
+// Subprotocol redacts the base64-encoded authorization carried in an AppSync websocket subprotocol value.
+func Subprotocol(v string) string {
+	parts := strings.Split(v, ",")
+
+	for i, p := range parts {
+		trimmed := strings.TrimSpace(p)
+
+		if strings.HasPrefix(trimmed, subprotocolPrefix) {
+			parts[i] = strings.Replace(p, trimmed, subprotocolPrefix+Placeholder, 1)
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// URL returns raw with the password and the values of query parameters carrying credentials replaced. URLs that
+// cannot be parsed are replaced entirely.
+func URL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Placeholder
+	}
+
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+
+		for i, param := range params {
+			key, _, _ := strings.Cut(param, "=")
+			if name, err := url.QueryUnescape(key); err != nil || IsSensitiveKey(name) || name == authQueryKey {
+				params[i] = key + "=" + Placeholder
+			}
+		}
+
+		u.RawQuery = strings.Join(params, "&")
+	}
+
+	return u.Redacted()
+}
+
+var jsonFallbackRegex = regexp.MustCompile(
+	`(?i)("(?:authorization|access_?token|id_?token|refresh_?token|token|x-api-key)"\s*:\s*)"(?:[^"\\]|\\.)*"`,
+)
+
+// JSON returns raw with the values of sensitive fields replaced, at any depth. Invalid JSON is redacted on a best
+// effort basis.
+func JSON(raw []byte) string {
+	var v any
+
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return jsonFallbackRegex.ReplaceAllString(string(raw), `${1}"`+Placeholder+`"`)
+	}
+
+	enc, err := json.Marshal(value(v))
+	if err != nil {
+		return jsonFallbackRegex.ReplaceAllString(string(raw), `${1}"`+Placeholder+`"`)
+	}
+
+	return string(enc)
+}
+
+// Value returns a copy of a decoded JSON value (or a map of strings) with sensitive fields replaced.
+func Value(v any) any {
+	return value(v)
+}
+
+func value(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+
+		for key, child := range v {
+			switch child.(type) {
+			case map[string]any, []any:
+				// Containers under a sensitive key (e.g. AppSync's authorization extension) are redacted field by field.
+				out[key] = value(child)
+			default:
+				if IsSensitiveKey(key) {
+					out[key] = Placeholder
+				} else {
+					out[key] = child
+				}
+			}
+		}
+
+		return out
+	case map[string]string:
+		out := make(map[string]string, len(v))
+
+		for key, child := range v {
+			if IsSensitiveKey(key) {
+				out[key] = Placeholder
+			} else {
+				out[key] = child
+			}
+		}
+
+		return out
+	case []any:
+		out := make([]any, len(v))
+
+		for i, child := range v {
+			out[i] = value(child)
+		}
+
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,103 @@
+package redact
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+)
+
+var (
+	bearerRegex      = regexp.MustCompile(`(?i)(bearer\s+)[\w.~+/=-]+`)
+	jwtRegex         = regexp.MustCompile(`eyJ[\w-]*\.[\w-]+\.[\w-]*`)
+	subprotocolRegex = regexp.MustCompile(subprotocolPrefix + `[\w-]{16,}`)
+	// quotedJSONRegex is jsonFallbackRegex for JSON quoted in a Go string, as response bodies are in errors.
+	quotedJSONRegex = regexp.MustCompile(
+		`(?i)(\\"(?:authorization|access_?token|id_?token|refresh_?token|token|x-api-key)\\"\s*:\s*)\\"(?:[^"\\]|\\[^"])*\\"`,
+	)
+)
+
+// Text returns s with credentials that can be recognised in free text replaced: sensitive JSON fields, bearer
+// tokens, JWTs and AppSync header subprotocols.
+func Text(s string) string {
+	s = jsonFallbackRegex.ReplaceAllString(s, `${1}"`+Placeholder+`"`)
+	s = quotedJSONRegex.ReplaceAllString(s, `${1}\"`+Placeholder+`\"`)
+	s = bearerRegex.ReplaceAllString(s, "${1}"+Placeholder)
+	s = jwtRegex.ReplaceAllString(s, Placeholder)
+
+	return subprotocolRegex.ReplaceAllString(s, subprotocolPrefix+Placeholder)
+}
+
+// Logger returns a logger writing to the handler of l, after redacting the attributes of each record with Attr.
+func Logger(l *slog.Logger) *slog.Logger {
+	if _, ok := l.Handler().(handler); ok {
+		return l
+	}
+
+	return slog.New(handler{next: l.Handler()})
+}
+
+// Attr returns a with its value redacted: replaced entirely under a sensitive key, and otherwise as by Text for
+// strings and errors, and by Value for decoded JSON.
+func Attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+
+	switch {
+	case v.Kind() == slog.KindGroup:
+		group := v.Group()
+		redacted := make([]slog.Attr, len(group))
+
+		for i, child := range group {
+			redacted[i] = Attr(child)
+		}
+
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	case IsSensitiveKey(a.Key):
+		return slog.String(a.Key, Placeholder)
+	case v.Kind() == slog.KindString:
+		return slog.String(a.Key, Text(v.String()))
+	case v.Kind() == slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, Text(x.Error()))
+		case map[string]any, map[string]string, []any:
+			return slog.Any(a.Key, Value(x))
+		}
+	}
+
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// handler redacts the attributes of records before passing them on.
+type handler struct {
+	next slog.Handler
+}
+
+func (h handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h handler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(Attr(a))
+
+		return true
+	})
+
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+
+	for i, a := range attrs {
+		redacted[i] = Attr(a)
+	}
+
+	return handler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{next: h.next.WithGroup(name)}
+}
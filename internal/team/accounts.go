@@ -3,12 +3,10 @@ package team
 import (
 	"context"
 	"fmt"
-	"log/slog"
 	"strconv"
-	"strings"
-	"time"
 
 	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/progress"
 )
 
 const (
@@ -95,46 +93,72 @@ type Role struct {
 	MaxDurApproval   int
 }
 
+// VerifyAccess checks that token is accepted by the GraphQL API of remote, by requesting the user's own policy.
+func VerifyAccess(ctx context.Context, remote *RemoteConfig, token *AuthToken) error {
+	idTok, err := token.ParseIDToken(ctx, remote)
+	if err != nil {
+		return fmt.Errorf("failed to parse ID token: %w", err)
+	}
+
+	_, err = execute(ctx, remote.client(token), &gql.Request{
+		Query: policyRequest,
+		Variables: map[string]any{
+			"userId":   idTok.UserID,
+			"groupIds": idTok.GroupIDs,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute: %w", err)
+	}
+
+	return nil
+}
+
 func FetchAccounts(ctx context.Context, remote *RemoteConfig, token *AuthToken) (map[string]*Account, error) {
-	slog.Info("Fetching AWS accounts")
+	logger().Info("Fetching AWS accounts")
 
-	idTok, err := token.ParseIDToken()
+	idTok, err := token.ParseIDToken(ctx, remote)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse ID token: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
-	defer cancel()
-
 	var rawPolicy rawPolicyData
 
-	if err := gql.Subscribe(
+	progress.Report(ctx, "connecting to realtime endpoint")
+
+	// The policy is published in response to the request, so it is requested again should the connection drop
+	// before it arrives.
+	requestPolicy := func(ctx context.Context) error {
+		progress.Report(ctx, "requesting user policy")
+
+		if _, err := execute(ctx, remote.client(token), &gql.Request{
+			Query: policyRequest,
+			Variables: map[string]any{
+				"userId":   idTok.UserID,
+				"groupIds": idTok.GroupIDs,
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to request: %w", err)
+		}
+
+		progress.Report(ctx, "waiting for policy publish…")
+
+		return nil
+	}
+
+	client := remote.client(token, gql.WithReconnect(gql.ReconnectPolicy{OnReconnect: requestPolicy}))
+
+	if err := client.Subscribe(
 		ctx,
-		remote.GraphQLEndpoint,
-		token.AccessToken,
 		&gql.Request{
 			Query: policySubscription,
 		},
-		func(ctx context.Context) error {
-			if _, err := gql.Execute(ctx, remote.GraphQLEndpoint, token.AccessToken, &gql.Request{
-				Query: policyRequest,
-				Variables: map[string]any{
-					"userId":   idTok.UserID,
-					"groupIds": strings.Split(idTok.GroupIDs, ","),
-				},
-			}); err != nil {
-				return fmt.Errorf("failed to request: %w", err)
-			}
-
-			return nil
-		},
-		func(ctx context.Context, payload *gql.Payload) (bool, error) {
-			if err := payload.UnmarshalData(&rawPolicy); err != nil {
-				return false, fmt.Errorf("failed to unmarshal payload: %w", err)
-			}
+		requestPolicy,
+		gql.DecodeData(func(_ context.Context, data rawPolicyData) (bool, error) {
+			rawPolicy = data
 
 			return false, nil
-		},
+		}),
 	); err != nil {
 		return nil, fmt.Errorf("failed to fetch: %w", err)
 	}
@@ -142,7 +166,7 @@ func FetchAccounts(ctx context.Context, remote *RemoteConfig, token *AuthToken)
 	accounts := make(map[string]*Account)
 
 	for _, pol := range rawPolicy.OnPublishPolicy.Policy {
-		slog.Debug("Policy", "dur", pol.Duration, "approval_required", pol.ApprovalRequired)
+		logger().Debug("Policy", "dur", pol.Duration, "approval_required", pol.ApprovalRequired)
 
 		duration, err := strconv.Atoi(pol.Duration)
 		if err != nil {
@@ -150,7 +174,7 @@ func FetchAccounts(ctx context.Context, remote *RemoteConfig, token *AuthToken)
 		}
 
 		for _, account := range pol.Accounts {
-			slog.Debug("Account", "name", account.Name, "id", account.Id)
+			logger().Debug("Account", "name", account.Name, "id", account.Id)
 
 			acc, ok := accounts[account.Id]
 			if !ok {
@@ -164,7 +188,7 @@ func FetchAccounts(ctx context.Context, remote *RemoteConfig, token *AuthToken)
 			}
 
 			for _, perm := range pol.Permissions {
-				slog.Debug("Permission", "name", perm.Name, "id", perm.Id)
+				logger().Debug("Permission", "name", perm.Name, "id", perm.Id)
 
 				role, ok := acc.Roles[perm.Id]
 				if !ok {
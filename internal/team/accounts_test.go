@@ -0,0 +1,57 @@
+package team_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyAccess(t *testing.T) {
+	team.ConfigureTokenVerification(team.TokenVerification{Disabled: true})
+	t.Cleanup(func() { team.ConfigureTokenVerification(team.TokenVerification{}) })
+
+	var failing bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "access", r.Header.Get("Authorization"))
+
+		var req struct {
+			Variables map[string]any `json:"variables"`
+		}
+
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "user", req.Variables["userId"])
+
+		if failing {
+			_, _ = w.Write([]byte(`{"errors":[{"errorType":"Unauthorized","message":"Not Authorized to access getUserPolicy"}]}`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"data":{"getUserPolicy":{"id":"user"}}}`))
+	}))
+	defer srv.Close()
+
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"userId":"user","groupIds":"a,b"}`))
+	token := &team.AuthToken{IdToken: "h." + claims + ".s", AccessToken: "access"}
+	remote := &team.RemoteConfig{GraphQLEndpoint: srv.URL}
+
+	require.NoError(t, team.VerifyAccess(context.Background(), remote, token))
+
+	failing = true
+
+	err := team.VerifyAccess(context.Background(), remote, token)
+	require.ErrorIs(t, err, team.ErrUnexpected)
+	require.ErrorContains(t, err, "Not Authorized")
+
+	var gqlErr *gql.GraphQLError
+	require.ErrorAs(t, err, &gqlErr)
+	require.Equal(t, "Unauthorized", gqlErr.Errors[0].ErrorType)
+}
@@ -1,6 +1,7 @@
 package team
 
 import (
+	"cmp"
 	"context"
 	"crypto/sha256"
 	_ "embed"
@@ -9,54 +10,57 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
 	"math/rand/v2"
 	"net/http"
 	"net/url"
-	"os/exec"
-	"runtime"
+	"os"
 	"strings"
 	"time"
+
+	"github.com/csnewman/team-cli/internal/clipboard"
+	"github.com/csnewman/team-cli/internal/transport"
 )
 
 //go:embed auth.html
 var closePageSrc string
 
-const localhostRedir = "http://localhost:43672/"
-
 type AuthToken struct {
 	IdToken      string    `json:"id_token"`
 	AccessToken  string    `json:"access_token"`
 	RefreshToken string    `json:"refresh_token"`
 	ExpiresAt    time.Time `json:"expires_at"`
 	TokenType    string    `json:"token_type"`
+	// Unverified marks a token supplied by the user rather than obtained from the user pool, whose ID token is used
+	// without verification. The user pool need not be known, and the server still checks the access token.
+	Unverified bool `json:"-"`
 }
 
-type IDToken struct {
-	UserID   string `json:"userId"`
-	GroupIDs string `json:"groupIds"`
-	Email    any    `json:"email"`
-}
-
-func (t *AuthToken) ParseIDToken() (*IDToken, error) {
-	parts := strings.Split(t.IdToken, ".")
+// JWTExpiry returns the expiry time encoded in the exp claim of a JWT, without verifying the token.
+func JWTExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
 
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("%w: invalid format", ErrUnexpected)
+		return time.Time{}, fmt.Errorf("%w: invalid format", ErrUnexpected)
 	}
 
 	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode: %w", err)
+		return time.Time{}, fmt.Errorf("failed to decode: %w", err)
 	}
 
-	var out *IDToken
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("failed to unmarshal: %w", err)
+	}
 
-	if err := json.Unmarshal(raw, &out); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal: %w", err)
+	if claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("%w: no exp claim", ErrUnexpected)
 	}
 
-	return out, nil
+	return time.Unix(claims.Exp, 0), nil
 }
 
 type rawAuthToken struct {
@@ -67,110 +71,327 @@ type rawAuthToken struct {
 	TokenType    string `json:"token_type"`
 }
 
+// ErrDeviceCodeExpired is returned when the device code expires before the user completes the login.
+var ErrDeviceCodeExpired = errors.New("device code expired")
+
+// OAuthError is an error response from the OAuth token or device authorization endpoint.
+type OAuthError struct {
+	StatusCode  int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("%s: %s (status %d)", e.Code, e.Description, e.StatusCode)
+	}
+
+	return fmt.Sprintf("%s (status %d)", e.Code, e.StatusCode)
+}
+
+func (e *OAuthError) Unwrap() error {
+	return ErrUnexpected
+}
+
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+const (
+	deviceCodeGrantType     = "urn:ietf:params:oauth:grant-type:device_code"
+	defaultDevicePollPeriod = 5 * time.Second
+	devicePollSlowDown      = 5 * time.Second
+)
+
+// FetchTokenViaDeviceCode authenticates with a login that can be completed on any device. The callback port of login
+// is unused.
+//
+// By default, the login redirects to the device_code page of the TEAM deployment, which shows the authorization code
+// for the user to enter here, read with login.ReadRedirect. With a DeviceAuthorizationEndpoint configured, the OAuth
+// device authorization grant (RFC 8628) is used instead: the verification URI and user code are shown, while the
+// token endpoint is polled until the login is complete. Unless login.NoBrowser is set, the verification URI is also
+// opened in the local browser, after calling pause when it is non-nil.
 func FetchTokenViaDeviceCode(
 	ctx context.Context,
 	cfg *RemoteConfig,
-	readCode func(context.Context) (string, error),
+	login BrowserLogin,
+	pause func(context.Context) error,
 ) (*AuthToken, error) {
-	slog.Info("Fetching authentication token")
+	if cfg.DeviceAuthorizationEndpoint == "" {
+		return fetchTokenViaCodePage(ctx, cfg, login)
+	}
 
-	state := randomCharacters(32)
-	pkceKey, challenge := generateChallenge()
+	logger().Info("Fetching authentication token via device code")
 
-	redirUri := cfg.RedirectSignIn + "device_code/"
+	auth, err := requestDeviceAuthorization(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	params := url.Values{
-		"redirect_uri":  {redirUri},
-		"response_type": {cfg.OAuthResponseType},
-		"client_id":     {cfg.UserPoolClientID},
-		"scope":         {strings.Join(cfg.OAuthScopes, " ")},
-		"state":         {state},
+	fmt.Fprintln(os.Stderr, "\nTo authenticate, visit the following URL on any device:")
+	fmt.Fprintln(os.Stderr, auth.VerificationURI)
+	fmt.Fprintf(os.Stderr, "and enter the code: %s\n", auth.UserCode)
+
+	// The printed code stays the source of truth, so clipboard problems are only logged.
+	if err := clipboard.Copy(ctx, auth.UserCode); err != nil {
+		logger().Debug("Could not copy the user code to the clipboard", "err", err)
+	} else {
+		fmt.Fprintln(os.Stderr, "(the code has been copied to your clipboard)")
 	}
 
-	if cfg.OAuthResponseType == "code" {
-		params.Add("code_challenge", challenge)
-		params.Add("code_challenge_method", "S256")
+	if !login.NoBrowser {
+		if pause != nil {
+			if err := pause(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		login.open(cmp.Or(auth.VerificationURIComplete, auth.VerificationURI))
 	}
 
-	u := url.URL{
-		Scheme:   "https",
-		Host:     cfg.OAuthDomain,
-		Path:     "/oauth2/authorize",
-		RawQuery: params.Encode(),
+	return pollDeviceToken(ctx, cfg, auth)
+}
+
+// fetchTokenViaCodePage logs in through the hosted UI, which redirects to the device_code page of the TEAM deployment.
+// The page shows the authorization code, which is read back with login.ReadRedirect.
+func fetchTokenViaCodePage(ctx context.Context, cfg *RemoteConfig, login BrowserLogin) (*AuthToken, error) {
+	logger().Info("Fetching authentication token via the device code page")
+
+	if login.ReadRedirect == nil {
+		return nil, fmt.Errorf("%w: the device code flow needs a way to read the code", ErrUnexpected)
+	}
+
+	redirURI, err := url.JoinPath(cfg.Server, "device_code/")
+	if err != nil {
+		return nil, fmt.Errorf("could not combine path: %w", err)
 	}
 
-	fmt.Println("\nPlease visit the following URL in your browser to authenticate:")
-	fmt.Println(u.String())
+	state := randomCharacters(32)
+	pkceKey, challenge := generateChallenge()
+
+	fmt.Fprintln(os.Stderr, "\nPlease visit the following URL in your browser to authenticate:")
+	fmt.Fprintln(os.Stderr, authorizeURL(cfg, redirURI, state, challenge, login.PromptLogin))
 
-	code, err := readCode(ctx)
+	pasted, err := login.ReadRedirect(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("could not read code: %w", err)
 	}
 
-	u = url.URL{
+	code, err := parseRedirect(pasted, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return exchangeCode(ctx, cfg, code, redirURI, pkceKey)
+}
+
+func requestDeviceAuthorization(ctx context.Context, cfg *RemoteConfig) (*deviceAuthorization, error) {
+	data := url.Values{
+		"client_id": {cfg.UserPoolClientID},
+		"scope":     {strings.Join(cfg.OAuthScopes, " ")},
+	}
+
+	rawEnc, err := postForm(ctx, cfg.httpClient(), cfg.DeviceAuthorizationEndpoint, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request device code: %w", err)
+	}
+
+	var auth *deviceAuthorization
+
+	if err := json.Unmarshal(rawEnc, &auth); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device authorization: %w", err)
+	}
+
+	if auth == nil || auth.DeviceCode == "" || auth.UserCode == "" || auth.VerificationURI == "" {
+		return nil, fmt.Errorf("%w: incomplete device authorization response", ErrUnexpected)
+	}
+
+	return auth, nil
+}
+
+// pollDeviceToken polls the token endpoint at the advertised interval until the user completes the login, backing
+// off whenever the server asks to slow down.
+func pollDeviceToken(ctx context.Context, cfg *RemoteConfig, auth *deviceAuthorization) (*AuthToken, error) {
+	interval := defaultDevicePollPeriod
+	if auth.Interval > 0 {
+		interval = time.Duration(auth.Interval) * time.Second
+	}
+
+	if auth.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(auth.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	u := url.URL{
 		Scheme: "https",
 		Host:   cfg.OAuthDomain,
 		Path:   "/oauth2/token",
 	}
 
 	data := make(url.Values)
-	data.Set("grant_type", "authorization_code")
-	data.Set("code", code)
+	data.Set("grant_type", deviceCodeGrantType)
+	data.Set("device_code", auth.DeviceCode)
 	data.Set("client_id", cfg.UserPoolClientID)
-	data.Set("redirect_uri", redirUri)
-	data.Set("code_verifier", pkceKey)
 
-	return fetchToken(ctx, u, data)
-}
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("%w: run the command again to retry", ErrDeviceCodeExpired)
+			}
 
-func FetchToken(ctx context.Context, cfg *RemoteConfig, noBrowser bool) (*AuthToken, error) {
-	slog.Info("Fetching authentication token")
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
 
-	codeChan := make(chan string, 1)
+		token, err := fetchToken(ctx, cfg.httpClient(), u, data)
 
-	hs := &http.Server{
-		Addr: ":43672",
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			params := r.URL.Query()
+		var oauthErr *OAuthError
 
-			code := params.Get("code")
-			if code != "" {
-				slog.Debug("Got code from challenge", "code", code)
+		if !errors.As(err, &oauthErr) {
+			return token, err
+		}
 
-				select {
-				case codeChan <- code:
-				default:
-					slog.Warn("Failed to send code")
-				}
-			}
+		switch oauthErr.Code {
+		case "authorization_pending":
+			logger().Debug("Waiting for device authorization")
+		case "slow_down":
+			interval += devicePollSlowDown
+			logger().Debug("Slowing down device polling", "interval", interval)
+		case "expired_token":
+			return nil, fmt.Errorf("%w: run the command again to retry", ErrDeviceCodeExpired)
+		default:
+			return nil, err
+		}
+	}
+}
 
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte(closePageSrc))
-		}),
+// BrowserLogin configures the browser based login flow.
+type BrowserLogin struct {
+	// NoBrowser only prints the login URL instead of also opening it.
+	NoBrowser bool
+	// CallbackPort is the preferred port of the local redirect listener, DefaultCallbackPort when zero.
+	CallbackPort int
+	// BrowserCommand is the command that opens the login URL, with %s replaced by the URL. When empty, $BROWSER and
+	// then the platform default are used.
+	BrowserCommand string
+	// PromptLogin asks the IdP to show its login page even when the browser is still signed in, so that another
+	// identity can be chosen.
+	PromptLogin bool
+	// ReadRedirect, when set, replaces the redirect listener: once the login URL is printed, it is called to read
+	// the URL the browser was redirected to, or just its code, from the user. This completes logins in a browser that
+	// cannot reach this machine, such as over SSH.
+	ReadRedirect func(ctx context.Context) (string, error)
+}
+
+// open opens url in the browser. Failing to do so is not fatal, since the URL has already been printed.
+func (l BrowserLogin) open(url string) {
+	if err := openBrowser(url, l.BrowserCommand); err != nil {
+		logger().Warn("failed to open browser", "err", err)
+		fmt.Fprintln(os.Stderr, "Could not open a browser, please open the URL above manually.")
 	}
+}
 
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-		defer cancel()
+const browserLoginTimeout = 5 * time.Minute
 
-		if err := hs.Shutdown(ctx); err != nil {
-			slog.Warn("failed to shutdown http server", "err", err)
-		}
-	}()
+var ErrLoginTimeout = errors.New("timed out waiting for login")
+
+func FetchToken(ctx context.Context, cfg *RemoteConfig, login BrowserLogin) (*AuthToken, error) {
+	logger().Info("Fetching authentication token")
 
-	ctx, cancel := context.WithCancelCause(ctx)
+	local := cfg.LocalRedirectURIs()
 
-	go func() {
-		cancel(hs.ListenAndServe())
-	}()
+	if len(cfg.RedirectURIs) > 0 && len(local) == 0 {
+		fmt.Fprintf(os.Stderr, "\nThe app only allows login redirects to: %s\n", strings.Join(cfg.RedirectURIs, ", "))
+		fmt.Fprintln(os.Stderr, "If the login fails with a redirect error, ask your TEAM administrator to allow the")
+		fmt.Fprintln(os.Stderr, "redirect URI below on the Cognito app client, or use the device code flow instead.")
+	}
+
+	candidates := callbackCandidates(login.CallbackPort, local)
+
+	var listener *callbackListener
 
 	state := randomCharacters(32)
 	pkceKey, challenge := generateChallenge()
 
-	redirUri := localhostRedir
+	// Without a listener the redirect fails in the browser, but its URL, which carries the code, can still be pasted.
+	redirUri := candidates[0].redirectURI
+
+	if login.ReadRedirect == nil {
+		var err error
+
+		listener, err = listenCallback(candidates, state)
+		if err != nil {
+			return nil, err
+		}
 
+		defer listener.close()
+
+		redirUri = listener.redirectURI
+	}
+
+	authURL := authorizeURL(cfg, redirUri, state, challenge, login.PromptLogin)
+
+	if listener != nil {
+		fmt.Fprintf(os.Stderr, "\nWaiting for the login redirect to %s\n", redirUri)
+	}
+
+	// A redirect URI listed by the app is known to be allowed.
+	if len(local) == 0 {
+		fmt.Fprintf(os.Stderr, "(the redirect URI %s must be allowed on the Cognito app client)\n", redirUri)
+	}
+	fmt.Fprintln(os.Stderr, "\nPlease visit the following URL in your browser to authenticate:")
+	fmt.Fprintln(os.Stderr, authURL)
+
+	if listener == nil {
+		fmt.Fprintf(os.Stderr, "\nAfter logging in, the browser is sent to %s, which may fail to load.\n", redirUri)
+		fmt.Fprintln(os.Stderr, "Copy the full URL from its address bar, or just its code parameter.")
+
+		pasted, err := login.ReadRedirect(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read login redirect: %w", err)
+		}
+
+		code, err := parseRedirect(pasted, state)
+		if err != nil {
+			return nil, err
+		}
+
+		return exchangeCode(ctx, cfg, code, redirUri, pkceKey)
+	}
+
+	if !login.NoBrowser {
+		login.open(authURL)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, browserLoginTimeout)
+	defer cancel()
+
+	code, err := listener.wait(waitCtx)
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		logger().Info("Timeout waiting for challenge")
+
+		return nil, fmt.Errorf("%w after %s", ErrLoginTimeout, browserLoginTimeout)
+	case err != nil:
+		return nil, err
+	}
+
+	return exchangeCode(ctx, cfg, code, redirUri, pkceKey)
+}
+
+// authorizeURL returns the hosted UI URL that starts a login redirecting to redirectURI.
+func authorizeURL(cfg *RemoteConfig, redirectURI string, state string, challenge string, promptLogin bool) string {
 	params := url.Values{
-		"redirect_uri":  {redirUri},
+		"redirect_uri":  {redirectURI},
 		"response_type": {cfg.OAuthResponseType},
 		"client_id":     {cfg.UserPoolClientID},
 		"scope":         {strings.Join(cfg.OAuthScopes, " ")},
@@ -182,6 +403,10 @@ func FetchToken(ctx context.Context, cfg *RemoteConfig, noBrowser bool) (*AuthTo
 		params.Add("code_challenge_method", "S256")
 	}
 
+	if promptLogin {
+		params.Add("prompt", "login")
+	}
+
 	u := url.URL{
 		Scheme:   "https",
 		Host:     cfg.OAuthDomain,
@@ -189,29 +414,18 @@ func FetchToken(ctx context.Context, cfg *RemoteConfig, noBrowser bool) (*AuthTo
 		RawQuery: params.Encode(),
 	}
 
-	fmt.Println("\nPlease visit the following URL in your browser to authenticate:")
-	fmt.Println(u.String())
-
-	if !noBrowser {
-		if err := openBrowser(u.String()); err != nil {
-			slog.Warn("failed to open browser", "err", err)
-		}
-	}
-
-	var code string
-
-	select {
-	case code = <-codeChan:
-		// ok
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-time.After(time.Minute * 5):
-		slog.Info("Timeout waiting for challenge")
-
-		return nil, errors.New("timeout waiting for challenge")
-	}
+	return u.String()
+}
 
-	u = url.URL{
+// exchangeCode exchanges the authorization code the login redirected to redirectURI with for tokens.
+func exchangeCode(
+	ctx context.Context,
+	cfg *RemoteConfig,
+	code string,
+	redirectURI string,
+	pkceKey string,
+) (*AuthToken, error) {
+	u := url.URL{
 		Scheme: "https",
 		Host:   cfg.OAuthDomain,
 		Path:   "/oauth2/token",
@@ -221,10 +435,49 @@ func FetchToken(ctx context.Context, cfg *RemoteConfig, noBrowser bool) (*AuthTo
 	data.Set("grant_type", "authorization_code")
 	data.Set("code", code)
 	data.Set("client_id", cfg.UserPoolClientID)
-	data.Set("redirect_uri", redirUri)
+	data.Set("redirect_uri", redirectURI)
 	data.Set("code_verifier", pkceKey)
 
-	return fetchToken(ctx, u, data)
+	return fetchToken(ctx, cfg.httpClient(), u, data)
+}
+
+// ErrStateMismatch is returned for a pasted login redirect that does not belong to the login in progress.
+var ErrStateMismatch = errors.New("login redirect does not match this login")
+
+// parseRedirect returns the authorization code from a pasted login redirect, which is either the full URL or just
+// the code. A URL must carry the state of the login in progress, so a stale or foreign redirect is rejected.
+func parseRedirect(pasted string, state string) (string, error) {
+	pasted = strings.TrimSpace(pasted)
+
+	if !strings.Contains(pasted, "?") {
+		if pasted == "" {
+			return "", fmt.Errorf("%w: nothing was pasted", ErrUnexpected)
+		}
+
+		return pasted, nil
+	}
+
+	u, err := url.Parse(pasted)
+	if err != nil {
+		return "", fmt.Errorf("%w: could not parse the pasted URL: %w", ErrUnexpected, err)
+	}
+
+	query := u.Query()
+
+	if errCode := query.Get("error"); errCode != "" {
+		return "", fmt.Errorf("%w: login failed: %s %s", ErrUnexpected, errCode, query.Get("error_description"))
+	}
+
+	if query.Get("state") != state {
+		return "", ErrStateMismatch
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("%w: the pasted URL has no code", ErrUnexpected)
+	}
+
+	return code, nil
 }
 
 func RefreshToken(ctx context.Context, remote *RemoteConfig, old *AuthToken) (*AuthToken, error) {
@@ -239,51 +492,88 @@ func RefreshToken(ctx context.Context, remote *RemoteConfig, old *AuthToken) (*A
 	data.Set("client_id", remote.UserPoolClientID)
 	data.Set("refresh_token", old.RefreshToken)
 
-	return fetchToken(ctx, u, data)
+	token, err := fetchToken(ctx, remote.httpClient(), u, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeRefreshedToken(old, token), nil
+}
+
+// mergeRefreshedToken fills in the parts of a refreshed token that the token endpoint does not reissue. Cognito
+// only returns a new ID and access token for a refresh_token grant, so the original refresh token must be kept for
+// the next refresh.
+func mergeRefreshedToken(old *AuthToken, token *AuthToken) *AuthToken {
+	if token.RefreshToken == "" {
+		token.RefreshToken = old.RefreshToken
+	}
+
+	if token.IdToken == "" {
+		token.IdToken = old.IdToken
+	}
+
+	return token
 }
 
-func fetchToken(ctx context.Context, u url.URL, data url.Values) (*AuthToken, error) {
+func fetchToken(ctx context.Context, client *http.Client, u url.URL, data url.Values) (*AuthToken, error) {
 	now := time.Now()
 
-	ctx, cancelTimeout := context.WithTimeout(ctx, time.Second*30)
+	rawEnc, err := postForm(ctx, client, u.String(), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch token: %w", err)
+	}
+
+	var token *rawAuthToken
+
+	if err := json.Unmarshal(rawEnc, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token body: %w", err)
+	}
+
+	return &AuthToken{
+		IdToken:      token.IdToken,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    now.Add(time.Duration(token.ExpiresIn) * time.Second),
+		TokenType:    token.TokenType,
+	}, nil
+}
+
+// postForm posts data to an OAuth endpoint with client and returns the response body. Error responses in the standard
+// OAuth format are returned as an *OAuthError.
+func postForm(ctx context.Context, client *http.Client, endpoint string, data url.Values) ([]byte, error) {
+	ctx, cancelTimeout := context.WithTimeout(ctx, transport.CurrentTimeouts().HTTP)
 	defer cancelTimeout()
 
-	r, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(data.Encode()))
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(data.Encode()))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create token request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := http.DefaultClient.Do(r)
+	resp, err := client.Do(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send token request: %w", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
 	defer resp.Body.Close()
 
 	rawEnc, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read token body: %w", err)
+		return nil, fmt.Errorf("failed to read body: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w: unexpected token status code: %d %q", ErrUnexpected, resp.StatusCode, string(rawEnc))
-	}
+		oauthErr := &OAuthError{StatusCode: resp.StatusCode}
 
-	var token *rawAuthToken
+		if json.Unmarshal(rawEnc, oauthErr) == nil && oauthErr.Code != "" {
+			return nil, oauthErr
+		}
 
-	if err := json.Unmarshal(rawEnc, &token); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal token body: %w", err)
+		return nil, fmt.Errorf("%w: unexpected status code: %d %q", ErrUnexpected, resp.StatusCode, string(rawEnc))
 	}
 
-	return &AuthToken{
-		IdToken:      token.IdToken,
-		AccessToken:  token.AccessToken,
-		RefreshToken: token.RefreshToken,
-		ExpiresAt:    now.Add(time.Duration(token.ExpiresIn) * time.Second),
-		TokenType:    token.TokenType,
-	}, nil
+	return rawEnc, nil
 }
 
 var randChars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -309,24 +599,3 @@ func generateChallenge() (string, string) {
 
 	return challenge, encoded
 }
-
-func openBrowser(url string) error {
-	var (
-		cmd  string
-		args []string
-	)
-
-	switch runtime.GOOS {
-	case "windows":
-		cmd = "rundll32"
-		args = []string{"url.dll,FileProtocolHandler", url}
-	case "darwin":
-		cmd = "open"
-		args = []string{url}
-	default:
-		cmd = "xdg-open"
-		args = []string{url}
-	}
-
-	return exec.Command(cmd, args...).Start()
-}
@@ -0,0 +1,218 @@
+package team_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshTokenKeepsRefreshToken(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/oauth2/token", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "refresh_token", r.Form.Get("grant_type"))
+		require.Equal(t, "old-refresh", r.Form.Get("refresh_token"))
+
+		// Cognito does not reissue the refresh token.
+		_, _ = w.Write([]byte(`{"id_token":"new-id","access_token":"new-access","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	token, err := team.RefreshToken(
+		ctx,
+		&team.RemoteConfig{OAuthDomain: u.Host, UserPoolClientID: "client", HTTPClient: srv.Client()},
+		&team.AuthToken{IdToken: "old-id", AccessToken: "old-access", RefreshToken: "old-refresh"},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "new-id", token.IdToken)
+	require.Equal(t, "new-access", token.AccessToken)
+	require.Equal(t, "old-refresh", token.RefreshToken)
+	require.WithinDuration(t, time.Now().Add(time.Hour), token.ExpiresAt, time.Minute)
+}
+
+func TestFetchTokenViaDeviceCode(t *testing.T) {
+	t.Parallel()
+
+	var polls atomic.Int32
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+
+		switch r.URL.Path {
+		case "/oauth2/device_authorization":
+			require.Equal(t, "client", r.Form.Get("client_id"))
+
+			_, _ = w.Write([]byte(`{"device_code":"dev","user_code":"ABCD-EFGH",` +
+				`"verification_uri":"https://login.example.com/device","expires_in":60,"interval":1}`))
+		case "/oauth2/token":
+			require.Equal(t, "urn:ietf:params:oauth:grant-type:device_code", r.Form.Get("grant_type"))
+			require.Equal(t, "dev", r.Form.Get("device_code"))
+
+			if polls.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"authorization_pending"}`))
+
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"id_token":"id","access_token":"access","refresh_token":"refresh","expires_in":3600}`))
+		default:
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	token, err := team.FetchTokenViaDeviceCode(
+		ctx,
+		&team.RemoteConfig{
+			OAuthDomain:                 u.Host,
+			UserPoolClientID:            "client",
+			DeviceAuthorizationEndpoint: srv.URL + "/oauth2/device_authorization",
+			HTTPClient:                  srv.Client(),
+		},
+		team.BrowserLogin{NoBrowser: true},
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, "access", token.AccessToken)
+	require.Equal(t, int32(2), polls.Load())
+}
+
+func TestFetchTokenViaDeviceCodePage(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Without a device authorization endpoint, only the code shown by the device_code page is exchanged.
+		require.Equal(t, "/oauth2/token", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "authorization_code", r.Form.Get("grant_type"))
+		require.Equal(t, "shown-code", r.Form.Get("code"))
+		require.Equal(t, "https://team.example.com/device_code/", r.Form.Get("redirect_uri"))
+		require.NotEmpty(t, r.Form.Get("code_verifier"))
+
+		_, _ = w.Write([]byte(`{"id_token":"id","access_token":"access","refresh_token":"refresh","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	remote := &team.RemoteConfig{
+		Server:            "https://team.example.com",
+		OAuthDomain:       u.Host,
+		OAuthResponseType: "code",
+		HTTPClient:        srv.Client(),
+	}
+
+	token, err := team.FetchTokenViaDeviceCode(ctx, remote, team.BrowserLogin{
+		ReadRedirect: func(context.Context) (string, error) { return " shown-code\n", nil },
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "access", token.AccessToken)
+
+	_, err = team.FetchTokenViaDeviceCode(ctx, remote, team.BrowserLogin{}, nil)
+	require.ErrorIs(t, err, team.ErrUnexpected)
+}
+
+func TestFetchTokenViaDeviceCodeExpired(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/device" {
+			_, _ = w.Write([]byte(`{"device_code":"dev","user_code":"ABCD-EFGH",` +
+				`"verification_uri":"https://login.example.com/device","interval":1}`))
+
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"expired_token"}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	_, err = team.FetchTokenViaDeviceCode(
+		ctx,
+		&team.RemoteConfig{
+			OAuthDomain:                 u.Host,
+			DeviceAuthorizationEndpoint: srv.URL + "/device",
+			HTTPClient:                  srv.Client(),
+		},
+		team.BrowserLogin{NoBrowser: true},
+		nil,
+	)
+	require.ErrorIs(t, err, team.ErrDeviceCodeExpired)
+	require.ErrorContains(t, err, "retry")
+}
+
+func TestFetchTokenPastedRedirect(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/oauth2/token", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "authorization_code", r.Form.Get("grant_type"))
+		require.Equal(t, "pasted-code", r.Form.Get("code"))
+		require.Equal(t, "http://localhost:43672/", r.Form.Get("redirect_uri"))
+		require.NotEmpty(t, r.Form.Get("code_verifier"))
+
+		_, _ = w.Write([]byte(`{"id_token":"id","access_token":"access","refresh_token":"refresh","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	remote := &team.RemoteConfig{
+		OAuthDomain:       u.Host,
+		OAuthResponseType: "code",
+		UserPoolClientID:  "client",
+		RedirectURIs:      []string{"http://localhost:43672/"},
+		HTTPClient:        srv.Client(),
+	}
+
+	paste := func(s string) func(context.Context) (string, error) {
+		return func(context.Context) (string, error) { return s, nil }
+	}
+
+	token, err := team.FetchToken(ctx, remote, team.BrowserLogin{
+		NoBrowser:    true,
+		ReadRedirect: paste("pasted-code"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "access", token.AccessToken)
+
+	// A redirect from another login is rejected before the code is exchanged.
+	_, err = team.FetchToken(ctx, remote, team.BrowserLogin{
+		NoBrowser:    true,
+		ReadRedirect: paste("http://localhost:43672/?code=pasted-code&state=stale"),
+	})
+	require.ErrorIs(t, err, team.ErrStateMismatch)
+}
@@ -0,0 +1,84 @@
+package team
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var ErrNoBrowser = errors.New("no browser could be started")
+
+// openBrowser opens url using the configured browser command, then each command listed in $BROWSER, then the
+// platform default.
+func openBrowser(url string, command string) error {
+	var errs []error
+
+	for _, args := range browserCommands(url, command, os.Getenv("BROWSER")) {
+		err := exec.Command(args[0], args[1:]...).Start()
+		if err == nil {
+			return nil
+		}
+
+		logger().Debug("Could not start browser", "command", args[0], "err", err)
+		errs = append(errs, err)
+	}
+
+	return fmt.Errorf("%w: %w", ErrNoBrowser, errors.Join(errs...))
+}
+
+// browserCommands returns the commands to try, in order, to open url. Commands may contain %s, which is replaced by
+// the URL; otherwise the URL is appended as the last argument. $BROWSER may list several commands separated by the
+// path list separator.
+func browserCommands(url string, command string, envBrowser string) [][]string {
+	var commands [][]string
+
+	add := func(command string) {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return
+		}
+
+		substituted := false
+
+		for i, f := range fields {
+			if strings.Contains(f, "%s") {
+				fields[i] = strings.ReplaceAll(f, "%s", url)
+				substituted = true
+			}
+		}
+
+		if !substituted {
+			fields = append(fields, url)
+		}
+
+		commands = append(commands, fields)
+	}
+
+	add(command)
+
+	for _, c := range filepath.SplitList(envBrowser) {
+		add(c)
+	}
+
+	return append(commands, platformBrowserCommands(url)...)
+}
+
+// platformBrowserCommands returns the commands that open url in the default browser of the platform.
+func platformBrowserCommands(url string) [][]string {
+	switch runtime.GOOS {
+	case "windows":
+		// start is a cmd builtin, which needs the URL's & escaped. Its first quoted argument is the window title.
+		return [][]string{
+			{"rundll32", "url.dll,FileProtocolHandler", url},
+			{"cmd", "/c", "start", "", strings.ReplaceAll(url, "&", "^&")},
+		}
+	case "darwin":
+		return [][]string{{"open", url}}
+	default:
+		return [][]string{{"xdg-open", url}}
+	}
+}
@@ -0,0 +1,25 @@
+package team
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrowserCommands(t *testing.T) {
+	t.Parallel()
+
+	const url = "https://login.example.com/?a=b"
+
+	commands := browserCommands(url, "firefox -P work --new-tab %s", "chromium"+string(os.PathListSeparator)+"w3m")
+
+	// The configured command comes first, then each $BROWSER entry, then the platform default.
+	require.Len(t, commands, 3+len(platformBrowserCommands(url)))
+	require.Equal(t, []string{"firefox", "-P", "work", "--new-tab", url}, commands[0])
+	require.Equal(t, []string{"chromium", url}, commands[1])
+	require.Equal(t, []string{"w3m", url}, commands[2])
+	require.Equal(t, platformBrowserCommands(url), commands[3:])
+
+	require.Equal(t, platformBrowserCommands(url), browserCommands(url, "", ""))
+}
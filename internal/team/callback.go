@@ -0,0 +1,211 @@
+package team
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCallbackPort is the preferred port of the local listener that receives the browser login redirect.
+const DefaultCallbackPort = 43672
+
+const (
+	// callbackPortAttempts is the number of consecutive ports tried when the preferred one is busy.
+	callbackPortAttempts = 5
+	callbackShutdownWait = 5 * time.Second
+)
+
+var ErrCallbackUnavailable = errors.New("no callback port available")
+
+// callbackListener receives the authorization code that the login page redirects to on the local machine.
+type callbackListener struct {
+	server      *http.Server
+	codes       chan string
+	errs        chan error
+	redirectURI string
+	// state is that of the login in progress, which the redirect must carry.
+	state string
+}
+
+// callbackCandidate is a port the redirect listener may use, with the redirect URI that reaches it.
+type callbackCandidate struct {
+	port        int
+	redirectURI string
+}
+
+// callbackCandidates returns the ports to try for the redirect listener. When the app client allows local redirect
+// URIs, only their ports can be used, with the preferred port first. Otherwise the preferred port and the following
+// few are tried, in the hope that they are allowed.
+func callbackCandidates(port int, allowed []string) []callbackCandidate {
+	if port == 0 {
+		port = DefaultCallbackPort
+	}
+
+	var candidates []callbackCandidate
+
+	for _, uri := range allowed {
+		p, ok := redirectPort(uri)
+		if !ok {
+			continue
+		}
+
+		candidate := callbackCandidate{port: p, redirectURI: uri}
+
+		if p == port {
+			candidates = slices.Insert(candidates, 0, candidate)
+		} else {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	if len(candidates) > 0 {
+		return candidates
+	}
+
+	for p := port; p < port+callbackPortAttempts; p++ {
+		candidates = append(candidates, callbackCandidate{port: p, redirectURI: fmt.Sprintf("http://localhost:%d/", p)})
+	}
+
+	return candidates
+}
+
+// redirectPort returns the port a redirect URI leads to.
+func redirectPort(uri string) (int, bool) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return 0, false
+	}
+
+	p, err := strconv.Atoi(cmp.Or(u.Port(), "80"))
+
+	return p, err == nil
+}
+
+// AllowsCallbackPort reports whether the browser login can receive its redirect on port. Without local redirect
+// URIs listed by the app, which ones are allowed is not known, so any port is accepted.
+func (c *RemoteConfig) AllowsCallbackPort(port int) bool {
+	local := c.LocalRedirectURIs()
+
+	for _, uri := range local {
+		if p, ok := redirectPort(uri); ok && p == port {
+			return true
+		}
+	}
+
+	return len(local) == 0
+}
+
+// listenCallback starts the redirect listener on the first candidate port that is not busy, accepting only the
+// redirect of the login with the given state. It listens on the loopback interface alone, so that other machines
+// cannot reach it.
+func listenCallback(candidates []callbackCandidate, state string) (*callbackListener, error) {
+	var (
+		ln      net.Listener
+		chosen  callbackCandidate
+		ports   []string
+		lastErr error
+	)
+
+	for _, candidate := range candidates {
+		var err error
+
+		ln, err = net.Listen("tcp", net.JoinHostPort(loopbackHost(candidate.redirectURI), strconv.Itoa(candidate.port)))
+		if err == nil {
+			chosen = candidate
+
+			break
+		}
+
+		logger().Debug("Callback port unavailable", "port", candidate.port, "err", err)
+		ports = append(ports, strconv.Itoa(candidate.port))
+		lastErr = err
+	}
+
+	if ln == nil {
+		return nil, fmt.Errorf("%w: ports %s are in use: %w", ErrCallbackUnavailable, strings.Join(ports, ", "), lastErr)
+	}
+
+	l := &callbackListener{
+		codes:       make(chan string, 1),
+		errs:        make(chan error, 1),
+		redirectURI: chosen.redirectURI,
+		state:       state,
+	}
+
+	l.server = &http.Server{
+		Handler:           http.HandlerFunc(l.handle),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := l.server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			l.errs <- err
+		}
+	}()
+
+	return l, nil
+}
+
+// loopbackHost returns the loopback address a redirect URI reaches: ::1 for redirects to it, and 127.0.0.1 otherwise.
+func loopbackHost(redirectURI string) string {
+	if u, err := url.Parse(redirectURI); err == nil && u.Hostname() == "::1" {
+		return "::1"
+	}
+
+	return "127.0.0.1"
+}
+
+func (l *callbackListener) handle(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if code := query.Get("code"); code != "" {
+		// A redirect from another login, such as one a malicious page sends the browser to, must not complete this one.
+		if query.Get("state") != l.state {
+			logger().Warn("Ignoring login callback for another login")
+			http.Error(w, ErrStateMismatch.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		logger().Debug("Got code from challenge")
+
+		select {
+		case l.codes <- code:
+		default:
+			logger().Warn("Ignoring repeated login callback")
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(closePageSrc))
+}
+
+// wait returns the authorization code once the browser is redirected to the listener.
+func (l *callbackListener) wait(ctx context.Context) (string, error) {
+	select {
+	case code := <-l.codes:
+		return code, nil
+	case err := <-l.errs:
+		return "", fmt.Errorf("callback listener failed: %w", err)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// close stops the listener, letting an in-flight response such as the close page finish first.
+func (l *callbackListener) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), callbackShutdownWait)
+	defer cancel()
+
+	if err := l.server.Shutdown(ctx); err != nil {
+		logger().Warn("failed to shutdown http server", "err", err)
+	}
+}
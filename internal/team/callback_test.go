@@ -0,0 +1,181 @@
+package team
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbackListenerSkipsBusyPort(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+
+	defer busy.Close()
+
+	port := busy.Addr().(*net.TCPAddr).Port
+
+	l, err := listenCallback(callbackCandidates(port, nil), "xyz")
+	require.NoError(t, err)
+
+	defer l.close()
+
+	require.NotEqual(t, "http://localhost:"+strconv.Itoa(port)+"/", l.redirectURI)
+
+	resp, err := http.Get(l.redirectURI + "?code=abc&state=xyz")
+	require.NoError(t, err)
+
+	page, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, closePageSrc, string(page))
+
+	code, err := l.wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "abc", code)
+}
+
+func TestCallbackListenerChecksState(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+
+	defer busy.Close()
+
+	l, err := listenCallback(callbackCandidates(busy.Addr().(*net.TCPAddr).Port, nil), "xyz")
+	require.NoError(t, err)
+
+	defer l.close()
+
+	// A redirect from another login is refused, and the listener keeps waiting for this one.
+	for _, query := range []string{"?code=forged&state=other", "?code=forged"} {
+		resp, err := http.Get(l.redirectURI + query)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp, err := http.Get(l.redirectURI + "?code=abc&state=xyz")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	code, err := l.wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "abc", code)
+}
+
+func TestLoopbackHost(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "127.0.0.1", loopbackHost("http://localhost:43672/"))
+	require.Equal(t, "127.0.0.1", loopbackHost("http://127.0.0.1:8000/callback"))
+	require.Equal(t, "::1", loopbackHost("http://[::1]:8000/"))
+}
+
+func TestCallbackListenerAbandoned(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+
+	defer busy.Close()
+
+	l, err := listenCallback(callbackCandidates(busy.Addr().(*net.TCPAddr).Port, nil), "xyz")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = l.wait(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	l.close()
+
+	_, err = http.Get(l.redirectURI)
+	require.Error(t, err)
+}
+
+func TestCallbackCandidates(t *testing.T) {
+	t.Parallel()
+
+	candidates := callbackCandidates(0, nil)
+	require.Len(t, candidates, callbackPortAttempts)
+	require.Equal(t, callbackCandidate{DefaultCallbackPort, "http://localhost:43672/"}, candidates[0])
+
+	// Only allowed redirects are used, preferring the configured port, and keeping their path.
+	candidates = callbackCandidates(9000, []string{"http://localhost:8000/callback", "http://127.0.0.1:9000/"})
+	require.Equal(t, []callbackCandidate{
+		{9000, "http://127.0.0.1:9000/"},
+		{8000, "http://localhost:8000/callback"},
+	}, candidates)
+}
+
+func TestCallbackListenerAllowedRedirect(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+
+	defer busy.Close()
+
+	free, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+
+	freePort := free.Addr().(*net.TCPAddr).Port
+	require.NoError(t, free.Close())
+
+	allowed := []string{
+		"http://localhost:" + strconv.Itoa(busy.Addr().(*net.TCPAddr).Port) + "/",
+		"http://localhost:" + strconv.Itoa(freePort) + "/callback",
+	}
+
+	l, err := listenCallback(callbackCandidates(0, allowed), "xyz")
+	require.NoError(t, err)
+
+	defer l.close()
+
+	require.Equal(t, allowed[1], l.redirectURI)
+}
+
+func TestLocalRedirectURIs(t *testing.T) {
+	t.Parallel()
+
+	cfg := &RemoteConfig{RedirectURIs: []string{
+		"https://team.example.com/",
+		"http://localhost:43672/",
+		"https://localhost:8443/",
+		"http://127.0.0.1:8000/callback",
+	}}
+
+	require.Equal(t, []string{"http://localhost:43672/", "http://127.0.0.1:8000/callback"}, cfg.LocalRedirectURIs())
+	require.Empty(t, (&RemoteConfig{}).LocalRedirectURIs())
+
+	require.True(t, cfg.AllowsCallbackPort(8000))
+	require.False(t, cfg.AllowsCallbackPort(8443))
+	require.True(t, (&RemoteConfig{}).AllowsCallbackPort(8443), "any port may be allowed when none are listed")
+}
+
+func TestParseRedirect(t *testing.T) {
+	t.Parallel()
+
+	code, err := parseRedirect(" http://localhost:43672/?code=abc&state=s1 \n", "s1")
+	require.NoError(t, err)
+	require.Equal(t, "abc", code)
+
+	// A code alone cannot be checked against the state.
+	code, err = parseRedirect("abc\n", "s1")
+	require.NoError(t, err)
+	require.Equal(t, "abc", code)
+
+	_, err = parseRedirect("http://localhost:43672/?code=abc&state=other", "s1")
+	require.ErrorIs(t, err, ErrStateMismatch)
+
+	_, err = parseRedirect("http://localhost:43672/?code=abc", "s1")
+	require.ErrorIs(t, err, ErrStateMismatch)
+
+	_, err = parseRedirect("http://localhost:43672/?error=access_denied&state=s1", "s1")
+	require.ErrorContains(t, err, "access_denied")
+
+	_, err = parseRedirect("  ", "s1")
+	require.Error(t, err)
+}
@@ -0,0 +1,95 @@
+package team
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrCredentialCommand is returned when the credential command fails or prints something other than tokens.
+var ErrCredentialCommand = errors.New("credential command failed")
+
+// commandToken is the document a credential command prints. The expiry is given either as a time or as a number of
+// seconds; without either, the expiry of the access token is used.
+type commandToken struct {
+	AccessToken  string    `json:"access_token"`
+	IdToken      string    `json:"id_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	ExpiresIn    int       `json:"expires_in"`
+	TokenType    string    `json:"token_type"`
+}
+
+// FetchTokenViaCommand obtains tokens by running command, for deployments where tokens are minted by a broker rather
+// than the hosted UI. The command is split into arguments at whitespace, as the browser command is, and must print
+// a JSON document with access_token, id_token, optionally refresh_token, and expires_at or expires_in.
+func FetchTokenViaCommand(ctx context.Context, command string) (*AuthToken, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: empty command", ErrCredentialCommand)
+	}
+
+	logger().Info("Fetching authentication token via credential command", "command", args[0])
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	now := time.Now()
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s: %w: %s", ErrCredentialCommand, args[0], err, msg)
+		}
+
+		return nil, fmt.Errorf("%w: %s: %w", ErrCredentialCommand, args[0], err)
+	}
+
+	return parseCommandToken(stdout.Bytes(), now)
+}
+
+// parseCommandToken parses the output of a credential command that was started at now.
+func parseCommandToken(out []byte, now time.Time) (*AuthToken, error) {
+	var tok commandToken
+
+	if err := json.Unmarshal(out, &tok); err != nil {
+		return nil, fmt.Errorf("%w: output is not a JSON token document: %w", ErrCredentialCommand, err)
+	}
+
+	if tok.AccessToken == "" || tok.IdToken == "" {
+		return nil, fmt.Errorf("%w: output lacks access_token or id_token", ErrCredentialCommand)
+	}
+
+	expiresAt := tok.ExpiresAt
+
+	switch {
+	case !expiresAt.IsZero():
+	case tok.ExpiresIn > 0:
+		expiresAt = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	default:
+		exp, err := JWTExpiry(tok.AccessToken)
+		if err != nil {
+			return nil, fmt.Errorf("%w: output lacks expires_at and the access token has no expiry: %w",
+				ErrCredentialCommand, err)
+		}
+
+		expiresAt = exp
+	}
+
+	return &AuthToken{
+		IdToken:      tok.IdToken,
+		AccessToken:  tok.AccessToken,
+		RefreshToken: tok.RefreshToken,
+		ExpiresAt:    expiresAt,
+		TokenType:    tok.TokenType,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package team
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const credentialHelperEnvVar = "TEAM_CLI_TEST_CREDENTIALS"
+
+// TestCredentialHelperProcess is not a real test: it is the credential command run by the other tests. It prints the
+// output they ask for, or fails with the given message on stderr when that starts with "fail:".
+func TestCredentialHelperProcess(t *testing.T) {
+	output, ok := os.LookupEnv(credentialHelperEnvVar)
+	if !ok {
+		t.Skip("only run as a credential command")
+	}
+
+	if msg, failed := strings.CutPrefix(output, "fail:"); failed {
+		fmt.Fprintln(os.Stderr, msg)
+		os.Exit(1)
+	}
+
+	fmt.Print(output)
+	os.Exit(0)
+}
+
+func TestFetchTokenViaCommand(t *testing.T) {
+	helper := os.Args[0] + " -test.run=^TestCredentialHelperProcess$"
+
+	t.Setenv(credentialHelperEnvVar, `{"access_token":"access","id_token":"id","refresh_token":"refresh","expires_in":3600}`)
+
+	token, err := FetchTokenViaCommand(context.Background(), helper)
+	require.NoError(t, err)
+	require.Equal(t, "access", token.AccessToken)
+	require.Equal(t, "id", token.IdToken)
+	require.Equal(t, "refresh", token.RefreshToken)
+	require.WithinDuration(t, time.Now().Add(time.Hour), token.ExpiresAt, time.Minute)
+
+	// Failures carry what the command printed on stderr.
+	t.Setenv(credentialHelperEnvVar, "fail:broker unavailable")
+
+	_, err = FetchTokenViaCommand(context.Background(), helper)
+	require.ErrorIs(t, err, ErrCredentialCommand)
+	require.ErrorContains(t, err, "broker unavailable")
+
+	_, err = FetchTokenViaCommand(context.Background(), " ")
+	require.ErrorIs(t, err, ErrCredentialCommand)
+}
+
+func TestParseCommandToken(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	token, err := parseCommandToken([]byte(`{"access_token":"a","id_token":"i","expires_at":"2025-01-01T13:00:00Z"}`), now)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Hour), token.ExpiresAt.UTC())
+
+	// Without an expiry, the access token's own expiry is used.
+	access := "e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"exp":1735736400}`)) + ".sig"
+
+	token, err = parseCommandToken([]byte(`{"access_token":"`+access+`","id_token":"i"}`), now)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1735736400, 0), token.ExpiresAt)
+
+	for _, out := range []string{
+		`not json`,
+		`{"access_token":"a","expires_in":60}`,
+		`{"access_token":"a","id_token":"i"}`,
+	} {
+		_, err := parseCommandToken([]byte(out), now)
+		require.ErrorIs(t, err, ErrCredentialCommand, out)
+	}
+}
@@ -0,0 +1,65 @@
+package team
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TEAM expresses all durations, both in policies and requests, as a number of hours.
+
+// Hours converts a whole number of hours, as used by TEAM, into a time.Duration.
+func Hours(h int) time.Duration {
+	return time.Duration(h) * time.Hour
+}
+
+// ParseHours parses a TEAM duration string, which may contain a fractional number of hours.
+func ParseHours(raw string) (time.Duration, error) {
+	h, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", raw, err)
+	}
+
+	if h < 0 || math.IsNaN(h) || h > math.MaxInt64/float64(time.Hour) {
+		return 0, fmt.Errorf("%w: duration %q out of range", ErrUnexpected, raw)
+	}
+
+	return time.Duration(h * float64(time.Hour)).Round(time.Minute), nil
+}
+
+// FormatDuration renders a duration in a compact human form such as "9h", "2h30m" or "3d4h", at minute precision.
+func FormatDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + FormatDuration(-d)
+	}
+
+	d = d.Round(time.Minute)
+
+	if d == 0 {
+		return "0h"
+	}
+
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+
+	var sb strings.Builder
+
+	if days > 0 {
+		fmt.Fprintf(&sb, "%dd", days)
+	}
+
+	if hours > 0 {
+		fmt.Fprintf(&sb, "%dh", hours)
+	}
+
+	if minutes > 0 {
+		fmt.Fprintf(&sb, "%dm", minutes)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,52 @@
+package team_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatDuration(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		in  time.Duration
+		out string
+	}{
+		{0, "0h"},
+		{20 * time.Second, "0h"},
+		{30 * time.Minute, "30m"},
+		{team.Hours(9), "9h"},
+		{team.Hours(2) + 30*time.Minute, "2h30m"},
+		{team.Hours(24), "1d"},
+		{team.Hours(36), "1d12h"},
+		{team.Hours(24*365) + time.Minute, "365d1m"},
+		{-team.Hours(1), "-1h"},
+		{time.Duration(1<<63 - 1), "106751d23h47m"},
+	} {
+		require.Equal(t, tc.out, team.FormatDuration(tc.in), tc.in.String())
+	}
+}
+
+func TestParseHours(t *testing.T) {
+	t.Parallel()
+
+	d, err := team.ParseHours("9")
+	require.NoError(t, err)
+	require.Equal(t, team.Hours(9), d)
+
+	d, err = team.ParseHours(" 2.5 ")
+	require.NoError(t, err)
+	require.Equal(t, team.Hours(2)+30*time.Minute, d)
+
+	d, err = team.ParseHours("0")
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), d)
+
+	for _, invalid := range []string{"", "abc", "-1", "NaN", "1e300"} {
+		_, err := team.ParseHours(invalid)
+		require.Error(t, err, invalid)
+	}
+}
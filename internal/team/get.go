@@ -0,0 +1,66 @@
+package team
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/csnewman/team-cli/internal/gql"
+)
+
+const getQuery = `query GetRequests($id: ID!) {
+    getRequests(id: $id) {
+      id
+      email
+      accountId
+      accountName
+      role
+      roleId
+      startTime
+      duration
+      justification
+      status
+      comment
+      username
+      approver
+      approverId
+      approvers
+      approver_ids
+      revoker
+      revokerId
+      endTime
+      ticketNo
+      revokeComment
+      session_duration
+      createdAt
+      updatedAt
+      owner
+      __typename
+    }
+}`
+
+type rawGetResponse struct {
+	GetRequests *PermissionRequest `json:"getRequests"`
+}
+
+var ErrNotFound = errors.New("not found")
+
+func GetRequest(ctx context.Context, remote *RemoteConfig, token *AuthToken, id string) (*PermissionRequest, error) {
+	logger().Info("Fetching request", "id", id)
+
+	rawResult, err := executeInto[rawGetResponse](ctx, remote.client(token), &gql.Request{
+		Query: getQuery,
+		Variables: map[string]any{
+			"id": id,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute: %w", err)
+	}
+
+	if rawResult.GetRequests == nil {
+		return nil, fmt.Errorf("%w: request %q", ErrNotFound, id)
+	}
+
+	return rawResult.GetRequests, nil
+}
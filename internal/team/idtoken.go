@@ -0,0 +1,419 @@
+package team
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/cache"
+)
+
+// IDToken holds the claims of the ID token that identify the user to the TEAM API.
+type IDToken struct {
+	UserID string `json:"userId"`
+	// GroupIDs is normalised from the groupIds claim, whose encoding depends on how the IdP attributes are mapped.
+	GroupIDs []string `json:"-"`
+	Email    any      `json:"email"`
+}
+
+var (
+	ErrInvalidIDToken   = errors.New("invalid ID token")
+	ErrIDTokenSignature = fmt.Errorf("%w: signature does not verify", ErrInvalidIDToken)
+	ErrIDTokenIssuer    = fmt.Errorf("%w: untrusted issuer", ErrInvalidIDToken)
+	ErrIDTokenAudience  = fmt.Errorf("%w: issued for another client", ErrInvalidIDToken)
+	ErrIDTokenExpired   = fmt.Errorf("%w: expired", ErrInvalidIDToken)
+)
+
+// KeyCacheName is the entry the signing keys are stored under in the key cache.
+const KeyCacheName = "jwks.json"
+
+// TokenVerification configures how ParseIDToken verifies ID tokens.
+type TokenVerification struct {
+	// KeyCache is the cache the signing keys of the user pool are kept in, so they are not fetched on every run. When
+	// nil, the keys are fetched every time.
+	KeyCache *cache.Store
+	// Disabled skips verification entirely, for debugging where the signing keys cannot be fetched.
+	Disabled bool
+}
+
+var (
+	verificationMu sync.RWMutex
+	verification   TokenVerification
+)
+
+// ConfigureTokenVerification applies v to all later calls of ParseIDToken.
+func ConfigureTokenVerification(v TokenVerification) {
+	verificationMu.Lock()
+	defer verificationMu.Unlock()
+
+	verification = v
+}
+
+func currentVerification() TokenVerification {
+	verificationMu.RLock()
+	defer verificationMu.RUnlock()
+
+	return verification
+}
+
+// idTokenLeeway tolerates small differences between the local clock and the clock of the issuer.
+const idTokenLeeway = time.Minute
+
+var cognitoIssuerRegex = regexp.MustCompile(`^https://cognito-idp\.[a-z0-9-]+\.amazonaws\.com/[\w-]+$`)
+
+type idTokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type idTokenClaims struct {
+	IDToken
+
+	RawGroupIDs json.RawMessage `json:"groupIds"`
+	Issuer      string          `json:"iss"`
+	Audience    string          `json:"aud"`
+	Expiry      int64           `json:"exp"`
+}
+
+// ParseIDToken verifies the ID token against the user pool of remote and returns its claims. The signature, issuer,
+// audience and expiry are all checked, unless verification was disabled with ConfigureTokenVerification or the token
+// is Unverified.
+func (t *AuthToken) ParseIDToken(ctx context.Context, remote *RemoteConfig) (*IDToken, error) {
+	if t == nil {
+		return nil, fmt.Errorf("%w: no ID token, log in to identify the user", ErrUnexpected)
+	}
+
+	parts := strings.Split(t.IdToken, ".")
+
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: invalid format", ErrUnexpected)
+	}
+
+	var claims idTokenClaims
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("failed to decode claims: %w", err)
+	}
+
+	if v := currentVerification(); v.Disabled || t.Unverified {
+		logger().Debug("Skipping ID token verification")
+	} else if err := verifyIDToken(ctx, v, remote, parts, &claims); err != nil {
+		return nil, err
+	}
+
+	groupIDs, err := parseGroupIDs(claims.RawGroupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	claims.GroupIDs = groupIDs
+
+	return &claims.IDToken, nil
+}
+
+// Identity returns who the ID token was issued to, their email address when the token carries one and their user ID
+// otherwise, or "" when the token cannot be decoded. The token is not verified, so the result is only suitable for
+// telling stored tokens apart; ParseIDToken must be used before trusting the claims.
+func (t *AuthToken) Identity() string {
+	if t == nil {
+		return ""
+	}
+
+	parts := strings.Split(t.IdToken, ".")
+
+	if len(parts) != 3 {
+		return ""
+	}
+
+	var claims IDToken
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return ""
+	}
+
+	if email, ok := claims.Email.(string); ok && email != "" {
+		return email
+	}
+
+	return claims.UserID
+}
+
+func verifyIDToken(
+	ctx context.Context,
+	v TokenVerification,
+	remote *RemoteConfig,
+	parts []string,
+	claims *idTokenClaims,
+) error {
+	if err := claims.verify(remote, time.Now()); err != nil {
+		return err
+	}
+
+	var header idTokenHeader
+
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return fmt.Errorf("failed to decode header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrIDTokenSignature, err)
+	}
+
+	return verifySignature(ctx, remote.httpClient(), v.KeyCache, claims.Issuer, header, parts[0]+"."+parts[1], signature)
+}
+
+// parseGroupIDs normalises the groupIds claim, which arrives as a JSON array, a comma separated string or a string
+// holding a bracketed list such as "[g1, g2]". Whitespace is trimmed and empty entries dropped, since an empty group
+// ID makes the policy query return nothing.
+func parseGroupIDs(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var entries []string
+
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		var list string
+
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, fmt.Errorf("%w: groupIds claim is neither a string nor a list of strings", ErrUnexpected)
+		}
+
+		list = strings.TrimSpace(list)
+
+		if strings.HasPrefix(list, "[") && strings.HasSuffix(list, "]") {
+			list = list[1 : len(list)-1]
+		}
+
+		entries = strings.Split(list, ",")
+	}
+
+	groupIDs := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry = strings.Trim(strings.TrimSpace(entry), `"`); entry != "" {
+			groupIDs = append(groupIDs, entry)
+		}
+	}
+
+	return groupIDs, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("failed to decode: %w", err)
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+
+	return nil
+}
+
+func (c *idTokenClaims) verify(remote *RemoteConfig, now time.Time) error {
+	expiresAt := time.Unix(c.Expiry, 0)
+
+	if c.Expiry == 0 || now.After(expiresAt.Add(idTokenLeeway)) {
+		return fmt.Errorf("%w at %s", ErrIDTokenExpired, expiresAt.UTC().Format(time.RFC3339))
+	}
+
+	if c.Audience == "" || c.Audience != remote.UserPoolClientID {
+		return fmt.Errorf("%w: audience %q", ErrIDTokenAudience, c.Audience)
+	}
+
+	if !trustedIssuer(remote, c.Issuer) {
+		return fmt.Errorf("%w: %q", ErrIDTokenIssuer, c.Issuer)
+	}
+
+	return nil
+}
+
+// trustedIssuer reports whether tokens issued by iss are accepted for remote.
+func trustedIssuer(remote *RemoteConfig, iss string) bool {
+	if remote.UserPoolID != "" {
+		region, _, _ := strings.Cut(remote.UserPoolID, "_")
+
+		return iss == fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, remote.UserPoolID)
+	}
+
+	// Configs extracted before the user pool ID was recorded only know the app client, which the audience pins.
+	return cognitoIssuerRegex.MatchString(iss)
+}
+
+func verifySignature(
+	ctx context.Context,
+	client *http.Client,
+	keyCache *cache.Store,
+	issuer string,
+	header idTokenHeader,
+	signed string,
+	signature []byte,
+) error {
+	if header.Alg != "RS256" {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrIDTokenSignature, header.Alg)
+	}
+
+	key, err := signingKey(ctx, client, keyCache, issuer, header.Kid)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte(signed))
+
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return fmt.Errorf("%w: %w", ErrIDTokenSignature, err)
+	}
+
+	return nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jsonWebKeySet struct {
+	Keys []*jsonWebKey `json:"keys"`
+}
+
+func (s *jsonWebKeySet) find(kid string) *jsonWebKey {
+	for _, key := range s.Keys {
+		if key != nil && key.Kid == kid {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func (k *jsonWebKey) publicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" {
+		return nil, fmt.Errorf("%w: signing key %q has unsupported type %q", ErrIDTokenSignature, k.Kid, k.Kty)
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not decode modulus of signing key %q: %w", ErrUnexpected, k.Kid, err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not decode exponent of signing key %q: %w", ErrUnexpected, k.Kid, err)
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+// signingKey returns the key of the issuer with the given ID. Keys are taken from the cache when possible, and
+// fetched again with client when the key is not known yet, as happens after the user pool rotates its keys.
+func signingKey(
+	ctx context.Context,
+	client *http.Client,
+	keyCache *cache.Store,
+	issuer string,
+	kid string,
+) (*rsa.PublicKey, error) {
+	sets := readKeyCache(keyCache)
+
+	// A set that was cached as null, or without keys, is treated as a miss like any other unusable entry.
+	if set := sets[issuer]; set != nil && len(set.Keys) > 0 {
+		if key := set.find(kid); key != nil {
+			return key.publicKey()
+		}
+
+		logger().Debug("Signing key is not cached, fetching keys again", "kid", kid)
+	}
+
+	set, err := fetchKeySet(ctx, client, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	sets[issuer] = set
+	writeKeyCache(keyCache, sets)
+
+	key := set.find(kid)
+	if key == nil {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrIDTokenSignature, kid)
+	}
+
+	return key.publicKey()
+}
+
+func fetchKeySet(ctx context.Context, client *http.Client, issuer string) (*jsonWebKeySet, error) {
+	keysURL := issuer + "/.well-known/jwks.json"
+
+	logger().Info("Fetching signing keys", "url", keysURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, keysURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch signing keys: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: could not fetch signing keys: %v", ErrUnexpected, resp.Status)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read signing keys: %w", err)
+	}
+
+	var set *jsonWebKeySet
+
+	if err := json.Unmarshal(raw, &set); err != nil || set == nil {
+		return nil, fmt.Errorf("%w: could not decode signing keys: %w", ErrUnexpected, err)
+	}
+
+	return set, nil
+}
+
+// readKeyCache returns the cached key sets by issuer. The cache is only an optimisation, so an entry that cannot be
+// read is treated as empty.
+func readKeyCache(store *cache.Store) map[string]*jsonWebKeySet {
+	sets := make(map[string]*jsonWebKeySet)
+
+	if store == nil {
+		return sets
+	}
+
+	if _, ok := store.Get(KeyCacheName, 0, &sets); !ok || sets == nil {
+		return make(map[string]*jsonWebKeySet)
+	}
+
+	return sets
+}
+
+func writeKeyCache(store *cache.Store, sets map[string]*jsonWebKeySet) {
+	if store == nil {
+		return
+	}
+
+	if err := store.Put(KeyCacheName, sets); err != nil {
+		logger().Warn("Could not write signing key cache", "err", err)
+	}
+}
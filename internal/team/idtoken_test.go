@@ -0,0 +1,222 @@
+package team
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/cache"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = "https://cognito-idp.eu-west-1.amazonaws.com/eu-west-1_pool"
+
+// signedIDToken returns an RS256 JWT carrying claims, signed with key under the key ID "test".
+func signedIDToken(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// testJSONWebKey returns the public half of key as a JWK with the key ID "test".
+func testJSONWebKey(key *rsa.PrivateKey) *jsonWebKey {
+	return &jsonWebKey{
+		Kid: "test",
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestParseIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// The cache is seeded with the key, so no keys are fetched from the issuer.
+	keyCache := cache.Open(t.TempDir())
+	writeKeyCache(keyCache, map[string]*jsonWebKeySet{testIssuer: {Keys: []*jsonWebKey{testJSONWebKey(key)}}})
+
+	ConfigureTokenVerification(TokenVerification{KeyCache: keyCache})
+	t.Cleanup(func() { ConfigureTokenVerification(TokenVerification{}) })
+
+	remote := &RemoteConfig{UserPoolClientID: "client", UserPoolID: "eu-west-1_pool"}
+
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"userId":   "user",
+			"groupIds": "a,b",
+			"iss":      testIssuer,
+			"aud":      "client",
+			"exp":      time.Now().Add(time.Hour).Unix(),
+		}
+
+		for k, v := range overrides {
+			c[k] = v
+		}
+
+		return c
+	}
+
+	token := &AuthToken{IdToken: signedIDToken(t, key, claims(nil))}
+
+	idTok, err := token.ParseIDToken(context.Background(), remote)
+	require.NoError(t, err)
+	require.Equal(t, "user", idTok.UserID)
+	require.Equal(t, []string{"a", "b"}, idTok.GroupIDs)
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{
+			"expired",
+			signedIDToken(t, key, claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})),
+			ErrIDTokenExpired,
+		},
+		{"other client", signedIDToken(t, key, claims(map[string]any{"aud": "other"})), ErrIDTokenAudience},
+		{
+			"other user pool",
+			signedIDToken(t, key, claims(map[string]any{"iss": "https://cognito-idp.eu-west-1.amazonaws.com/other"})),
+			ErrIDTokenIssuer,
+		},
+		{"forged", signedIDToken(t, other, claims(nil)), ErrIDTokenSignature},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := (&AuthToken{IdToken: tc.token}).ParseIDToken(context.Background(), remote)
+			require.ErrorIs(t, err, tc.want)
+			require.ErrorIs(t, err, ErrInvalidIDToken)
+		})
+	}
+
+	// A token supplied by the user is used as given, without knowing the user pool.
+	forged := &AuthToken{IdToken: signedIDToken(t, other, claims(nil)), Unverified: true}
+
+	idTok, err = forged.ParseIDToken(context.Background(), &RemoteConfig{})
+	require.NoError(t, err)
+	require.Equal(t, "user", idTok.UserID)
+
+	// Without verification, even a forged token is accepted.
+	ConfigureTokenVerification(TokenVerification{Disabled: true})
+
+	_, err = (&AuthToken{IdToken: signedIDToken(t, other, claims(nil))}).ParseIDToken(context.Background(), remote)
+	require.NoError(t, err)
+}
+
+func TestSigningKeyUnusableCache(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/.well-known/jwks.json", r.URL.Path)
+		require.NoError(t, json.NewEncoder(w).Encode(&jsonWebKeySet{Keys: []*jsonWebKey{testJSONWebKey(key)}}))
+	}))
+	t.Cleanup(srv.Close)
+
+	for _, tc := range []struct {
+		name   string
+		cached *jsonWebKeySet
+	}{
+		{"null set", nil},
+		{"empty set", &jsonWebKeySet{}},
+		{"null key", &jsonWebKeySet{Keys: []*jsonWebKey{nil}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			keyCache := cache.Open(t.TempDir())
+			require.NoError(t, keyCache.Put(KeyCacheName, map[string]*jsonWebKeySet{srv.URL: tc.cached}))
+
+			// The unusable entry is a miss, so the keys are fetched again and replace it.
+			public, err := signingKey(context.Background(), srv.Client(), keyCache, srv.URL, "test")
+			require.NoError(t, err)
+			require.Equal(t, &key.PublicKey, public)
+
+			require.NotNil(t, readKeyCache(keyCache)[srv.URL].find("test"))
+		})
+	}
+}
+
+func TestTrustedIssuer(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, trustedIssuer(&RemoteConfig{UserPoolID: "eu-west-1_pool"}, testIssuer))
+	require.False(t, trustedIssuer(&RemoteConfig{UserPoolID: "eu-west-1_pool"}, testIssuer+"x"))
+
+	// Without a recorded user pool, any Cognito user pool is accepted and the audience check pins the client.
+	require.True(t, trustedIssuer(&RemoteConfig{}, testIssuer))
+	require.False(t, trustedIssuer(&RemoteConfig{}, "https://evil.example.com/eu-west-1_pool"))
+}
+
+func TestParseGroupIDs(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		raw  string
+		want []string
+	}{
+		{"missing", ``, nil},
+		{"null", `null`, nil},
+		{"array", `["g1", " g2 ", ""]`, []string{"g1", "g2"}},
+		{"single", `"g1"`, []string{"g1"}},
+		{"comma separated", `"g1, g2,,"`, []string{"g1", "g2"}},
+		{"bracketed", `"[g1, g2]"`, []string{"g1", "g2"}},
+		{"bracketed quoted", `"[\"g1\", \"g2\"]"`, []string{"g1", "g2"}},
+		{"empty", `""`, []string{}},
+		{"empty brackets", `"[]"`, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseGroupIDs(json.RawMessage(tc.raw))
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err := parseGroupIDs(json.RawMessage(`42`))
+	require.ErrorIs(t, err, ErrUnexpected)
+}
+
+func TestIdentity(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	withEmail := &AuthToken{IdToken: signedIDToken(t, key, map[string]any{"userId": "user", "email": "a@example.com"})}
+	require.Equal(t, "a@example.com", withEmail.Identity())
+
+	withoutEmail := &AuthToken{IdToken: signedIDToken(t, key, map[string]any{"userId": "user"})}
+	require.Equal(t, "user", withoutEmail.Identity())
+
+	require.Empty(t, (&AuthToken{IdToken: "id"}).Identity())
+	require.Empty(t, (*AuthToken)(nil).Identity())
+}
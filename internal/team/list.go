@@ -3,7 +3,6 @@ package team
 import (
 	"context"
 	"fmt"
-	"log/slog"
 	"time"
 
 	"github.com/csnewman/team-cli/internal/gql"
@@ -75,6 +74,21 @@ type PermissionRequest struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// End returns when the access granted by the request ends, derived from the start time and duration when the
+// server has not recorded an end time.
+func (r *PermissionRequest) End() time.Time {
+	if !r.EndTime.IsZero() {
+		return r.EndTime
+	}
+
+	d, err := ParseHours(r.Duration)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return r.StartTime.Add(d)
+}
+
 type rawListResponse struct {
 	ListRequests struct {
 		Items     []*PermissionRequest `json:"items"`
@@ -87,6 +101,7 @@ type ListRequestsFilter string
 const (
 	ListRequestsFilterAll                ListRequestsFilter = "all"
 	ListRequestsFilterRequiresMyApproval ListRequestsFilter = "requires-my-approval"
+	ListRequestsFilterMyActive           ListRequestsFilter = "my-active"
 )
 
 func ListRequests(
@@ -95,7 +110,7 @@ func ListRequests(
 	token *AuthToken,
 	filter ListRequestsFilter,
 ) ([]*PermissionRequest, error) {
-	idTok, err := token.ParseIDToken()
+	idTok, err := token.ParseIDToken(ctx, remote)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse ID token: %w", err)
 	}
@@ -125,11 +140,26 @@ func ListRequests(
 				},
 			},
 		}
+	case ListRequestsFilterMyActive:
+		filterBlob = map[string]any{
+			"and": []map[string]any{
+				{
+					"email": map[string]any{
+						"eq": idTok.Email,
+					},
+				},
+				{
+					"status": map[string]any{
+						"eq": "in progress",
+					},
+				},
+			},
+		}
 	default:
 		panic("unknown filter")
 	}
 
-	resp, err := gql.Execute(ctx, remote.GraphQLEndpoint, token.AccessToken, &gql.Request{
+	rawResult, err := executeInto[rawListResponse](ctx, remote.client(token), &gql.Request{
 		Query: listQuery,
 		Variables: map[string]any{
 			"filter":    filterBlob,
@@ -140,19 +170,5 @@ func ListRequests(
 		return nil, fmt.Errorf("failed to execute: %w", err)
 	}
 
-	if len(resp.Errors) > 0 {
-		for _, err := range resp.Errors {
-			slog.Error("Received error from server", "error", err)
-		}
-
-		return nil, fmt.Errorf("%w: server returned an error", ErrUnexpected)
-	}
-
-	var rawResult rawListResponse
-
-	if err := resp.UnmarshalData(&rawResult); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
-	}
-
 	return rawResult.ListRequests.Items, nil
 }
@@ -0,0 +1,13 @@
+package team
+
+import (
+	"log/slog"
+
+	"github.com/csnewman/team-cli/internal/redact"
+)
+
+// logger returns slog.Default, redacting credentials from everything logged through it. Bodies fetched from the
+// server and login callbacks are logged at debug level, so all logging in this package goes through it.
+func logger() *slog.Logger {
+	return redact.Logger(slog.Default())
+}
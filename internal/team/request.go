@@ -3,12 +3,12 @@ package team
 import (
 	"context"
 	"fmt"
-	"log/slog"
 	"regexp"
 	"strconv"
 	"time"
 
 	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/transport"
 )
 
 var TicketRegex = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
@@ -64,18 +64,31 @@ type rawCreateRequestResponse struct {
 	} `json:"createRequests"`
 }
 
+// serverNow returns the current time by the server's clock, as far as it is known from earlier responses, so that a
+// request starting now is neither delayed nor rejected for starting in the past when the local clock is off.
+func serverNow() time.Time {
+	skew, ok := transport.ClockSkew()
+	if !ok {
+		return time.Now()
+	}
+
+	logger().Debug("Adjusting start time for clock skew", "skew", skew)
+
+	return time.Now().Add(skew)
+}
+
 func Request(ctx context.Context, remote *RemoteConfig, token *AuthToken, req *AccessRequest) (string, error) {
-	slog.Info("Requesting access")
+	logger().Info("Requesting access")
 
 	startTime := req.StartTime
 
 	if startTime.IsZero() {
-		startTime = time.Now()
+		startTime = serverNow()
 	}
 
 	startTime = startTime.Truncate(time.Minute)
 
-	resp, err := gql.Execute(ctx, remote.GraphQLEndpoint, token.AccessToken, &gql.Request{
+	rawResult, err := executeInto[rawCreateRequestResponse](ctx, remote.client(token), &gql.Request{
 		Query: createRequest,
 		Variables: map[string]any{
 			"input": map[string]any{
@@ -94,19 +107,5 @@ func Request(ctx context.Context, remote *RemoteConfig, token *AuthToken, req *A
 		return "", fmt.Errorf("failed to execute: %w", err)
 	}
 
-	if len(resp.Errors) > 0 {
-		for _, err := range resp.Errors {
-			slog.Error("Received error from server", "error", err)
-		}
-
-		return "", fmt.Errorf("%w: server returned an error", ErrUnexpected)
-	}
-
-	var rawResult rawCreateRequestResponse
-
-	if err := resp.UnmarshalData(&rawResult); err != nil {
-		return "", fmt.Errorf("failed to unmarshal payload: %w", err)
-	}
-
 	return rawResult.CreateRequests.Id, nil
 }
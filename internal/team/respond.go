@@ -3,7 +3,6 @@ package team
 import (
 	"context"
 	"fmt"
-	"log/slog"
 
 	"github.com/csnewman/team-cli/internal/gql"
 )
@@ -49,9 +48,9 @@ type AccessResponse struct {
 }
 
 func Respond(ctx context.Context, remote *RemoteConfig, token *AuthToken, accResp *AccessResponse) error {
-	slog.Info("Responding to request")
+	logger().Info("Responding to request")
 
-	resp, err := gql.Execute(ctx, remote.GraphQLEndpoint, token.AccessToken, &gql.Request{
+	_, err := execute(ctx, remote.client(token), &gql.Request{
 		Query: respondQuery,
 		Variables: map[string]any{
 			"input": map[string]any{
@@ -65,13 +64,5 @@ func Respond(ctx context.Context, remote *RemoteConfig, token *AuthToken, accRes
 		return fmt.Errorf("failed to execute: %w", err)
 	}
 
-	if len(resp.Errors) > 0 {
-		for _, err := range resp.Errors {
-			slog.Error("Received error from server", "error", err)
-		}
-
-		return fmt.Errorf("%w: server returned an error", ErrUnexpected)
-	}
-
 	return nil
 }
@@ -0,0 +1,25 @@
+package team
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/csnewman/team-cli/internal/gql"
+)
+
+// Operations returns the GraphQL documents sent to the TEAM API, for checking them against its schema.
+func Operations() []string {
+	return []string{policySubscription, policyRequest, getQuery, listQuery, createRequest, respondQuery}
+}
+
+// FetchSchema fetches the schema of the TEAM API by introspection.
+func FetchSchema(ctx context.Context, remote *RemoteConfig, token *AuthToken) (*gql.Schema, error) {
+	logger().Info("Fetching schema")
+
+	schema, err := remote.client(token).Introspect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect: %w", err)
+	}
+
+	return schema, nil
+}
@@ -0,0 +1,21 @@
+package team_test
+
+import (
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/team"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationsParse(t *testing.T) {
+	t.Parallel()
+
+	// An empty schema has no root types to report against, but the operations are still parsed.
+	for _, op := range team.Operations() {
+		problems, err := (&gql.Schema{}).Check(op)
+		require.NoError(t, err)
+		require.NotEmpty(t, problems)
+		require.Contains(t, problems[len(problems)-1], "the schema has no")
+	}
+}
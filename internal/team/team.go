@@ -5,11 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
+	"os"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/csnewman/team-cli/internal/gql"
+	"github.com/csnewman/team-cli/internal/progress"
+	"github.com/csnewman/team-cli/internal/transport"
 )
 
 var (
@@ -23,9 +30,12 @@ var configExtractors = map[string]*regexp.Regexp{
 	"oauth_domain":                 regexp.MustCompile(`\Woauth\W*:.{0,999}.{0,999}.{0,999}.{0,999}\Wdomain\W*:\W*"([\w:/._-]+)"`),
 	"oauth_responseType":           regexp.MustCompile(`\Woauth\W*:.{0,999}.{0,999}.{0,999}.{0,999}\WresponseType\W*:\W*"([\w:/._-]+)"`),
 	"oauth_scope":                  regexp.MustCompile(`\Woauth\W*:.{0,999}.{0,999}.{0,999}.{0,999}\Wscope\W*:\W*\[(\W*(?:"[\w:/._-]+"\W*,?\W*)+)]`),
-	"redirectSignIn":               regexp.MustCompile(`\WredirectSignIn\W*:\W*"([\w:/._-]+)"`),
+	"redirectSignIn":               regexp.MustCompile(`\WredirectSignIn\W*:\W*"([\w:/.,_-]+)"`),
 }
 
+// userPoolIDRegex extracts the ID of the user pool, which older deployments may not expose.
+var userPoolIDRegex = regexp.MustCompile(`\Waws_user_pools_id\W*:\W*"([\w-]+)"`)
+
 type RemoteConfig struct {
 	Server            string   `json:"server"`
 	GraphQLEndpoint   string   `json:"graphql_endpoint"`
@@ -34,54 +44,112 @@ type RemoteConfig struct {
 	OAuthResponseType string   `json:"oauth_response_type"`
 	OAuthScopes       []string `json:"oauth_scopes"`
 	RedirectSignIn    string   `json:"redirectSignIn"`
+	// RedirectURIs are the URIs the app client allows the login to redirect to, split from RedirectSignIn.
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+	// UserPoolID identifies the user pool whose tokens are trusted. Configs extracted by older versions lack it.
+	UserPoolID string `json:"user_pool_id,omitempty"`
+	// DeviceAuthorizationEndpoint enables the OAuth device authorization grant for the device code flow, which
+	// otherwise uses the device_code page of the deployment. Cognito does not implement the grant itself.
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint,omitempty"`
+	// RealtimeEndpoint overrides the endpoint subscriptions connect to, which otherwise is derived from
+	// GraphQLEndpoint.
+	RealtimeEndpoint string `json:"realtime_endpoint,omitempty"`
+
+	// HTTPClient sends the requests to the deployment, its API and its user pool, in place of transport.Client. This
+	// lets tests stub the server and callers customise the transport.
+	HTTPClient *http.Client `json:"-"`
+	// Authorizer authorizes requests to the API, such as with gql.IAMAuth, in place of the access token of the user.
+	Authorizer gql.Authorizer `json:"-"`
 }
 
-var ErrUnexpected = errors.New("unexpected error")
+// httpClient returns the HTTPClient of the config, or transport.Client when none is set.
+func (r *RemoteConfig) httpClient() *http.Client {
+	return clientOrDefault(r.HTTPClient)
+}
 
-func ExtractConfig(ctx context.Context, addr string) (*RemoteConfig, error) {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
+// clientOrDefault returns c, or transport.Client when c is nil.
+func clientOrDefault(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
 
-	server, err := url.Parse(addr)
-	if err != nil {
-		return nil, fmt.Errorf("could not parse server URL: %w", err)
+	return transport.Client()
+}
+
+// client returns a GraphQL client for the server, authenticated by its Authorizer or else as token.
+func (r *RemoteConfig) client(token *AuthToken, opts ...gql.Option) *gql.Client {
+	opts = append([]gql.Option{gql.WithHTTPClient(r.httpClient())}, opts...)
+
+	if r.RealtimeEndpoint != "" {
+		opts = append(opts, gql.WithRealtimeEndpoint(r.RealtimeEndpoint))
 	}
 
-	if server.Scheme == "" {
-		server.Scheme = "http"
+	if r.Authorizer != nil {
+		return gql.NewClient(r.GraphQLEndpoint, nil, append(opts, gql.WithAuthorizer(r.Authorizer))...)
 	}
 
-	slog.Info("Fetching homepage", "server", server)
+	return gql.NewClient(r.GraphQLEndpoint, gql.StaticToken(token.AccessToken), opts...)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.String(), nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not create request: %w", err)
-	}
+// execute sends req with client, logging the errors the server responds with and reporting them as ErrUnexpected.
+func execute(ctx context.Context, client *gql.Client, req *gql.Request) (*gql.Payload, error) {
+	resp, err := client.Execute(ctx, req)
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("could not send request: %w", err)
+	return resp, serverError(err)
+}
+
+// executeInto is execute returning the data of the response unmarshalled into a T.
+func executeInto[T any](ctx context.Context, client *gql.Client, req *gql.Request) (T, error) {
+	data, err := gql.ExecuteInto[T](ctx, client, req)
+
+	return data, serverError(err)
+}
+
+// serverError logs the errors the server responded with, if err holds any, and reports them as ErrUnexpected.
+func serverError(err error) error {
+	var gqlErr *gql.GraphQLError
+	if errors.As(err, &gqlErr) {
+		for _, e := range gqlErr.Errors {
+			logger().Error("Received error from server", "error", e)
+		}
+
+		return fmt.Errorf("%w: server returned an error: %w", ErrUnexpected, err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w: could not fetch homepage: %v", ErrUnexpected, resp.Status)
+	return err
+}
+
+var ErrUnexpected = errors.New("unexpected error")
+
+// ExtractConfig extracts the config of the TEAM deployment at addr from its homepage and main JS file. The requests are
+// sent through client, or transport.Client when it is nil, which the config keeps as its HTTPClient.
+func ExtractConfig(ctx context.Context, client *http.Client, addr string) (*RemoteConfig, error) {
+	// Extraction fetches the homepage and its script bundle, which can be large, so it is given ten times the HTTP
+	// timeout: 5 minutes by default.
+	ctx, cancel := context.WithTimeout(ctx, 10*transport.CurrentTimeouts().HTTP)
+	defer cancel()
+
+	server, err := parseServer(addr)
+	if err != nil {
+		return nil, err
 	}
 
-	defer resp.Body.Close()
+	logger().Info("Fetching homepage", "server", server)
+	progress.Report(ctx, "fetching homepage")
 
-	rawBody, err := io.ReadAll(resp.Body)
+	rawBody, err := fetch(ctx, client, server.String())
 	if err != nil {
-		return nil, fmt.Errorf("could not read response body: %w", err)
+		return nil, fmt.Errorf("could not fetch homepage: %w", err)
 	}
 
-	slog.Debug("Extracting homepage matches", "body", string(rawBody))
+	logger().Debug("Extracting homepage matches", "body", string(rawBody))
 
 	matches := jsRegex.FindAllStringSubmatch(string(rawBody), -1)
 
 	paths := make([]string, 0, len(matches))
 
 	for _, match := range matches {
-		slog.Debug("Found match", "match", match)
+		logger().Debug("Found match", "match", match)
 
 		if len(match) != 2 {
 			continue
@@ -99,51 +167,160 @@ func ExtractConfig(ctx context.Context, addr string) (*RemoteConfig, error) {
 		return nil, fmt.Errorf("could not combine path: %w", err)
 	}
 
-	slog.Info("Fetching main JS file", "file", jsURL)
+	logger().Info("Fetching main JS file", "file", jsURL)
+	progress.Report(ctx, "fetching main JS file")
 
-	req, err = http.NewRequestWithContext(ctx, http.MethodGet, jsURL, nil)
+	rawBody, err = fetch(ctx, client, jsURL)
 	if err != nil {
-		return nil, fmt.Errorf("could not create js request: %w", err)
+		return nil, fmt.Errorf("could not fetch js: %w", err)
 	}
 
-	resp, err = http.DefaultClient.Do(req)
+	return configFromBundle(ctx, client, server, rawBody)
+}
+
+// ExtractConfigFromBundle extracts the config of the TEAM deployment at addr from its main JS file, given as a URL or
+// a local path, without fetching the homepage. This works where the homepage is unreachable but the APIs are not. The
+// client is used as in ExtractConfig.
+func ExtractConfigFromBundle(
+	ctx context.Context,
+	client *http.Client,
+	addr string,
+	bundle string,
+) (*RemoteConfig, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*transport.CurrentTimeouts().HTTP)
+	defer cancel()
+
+	server, err := parseServer(addr)
 	if err != nil {
-		return nil, fmt.Errorf("could not send js request: %w", err)
+		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w: could not fetch js: %v", ErrUnexpected, resp.Status)
+	var rawBody []byte
+
+	if u, err := url.Parse(bundle); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		logger().Info("Fetching JS bundle", "file", bundle)
+		progress.Report(ctx, "fetching JS bundle")
+
+		rawBody, err = fetch(ctx, client, bundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch js: %w", err)
+		}
+	} else {
+		logger().Info("Reading JS bundle", "file", bundle)
+
+		rawBody, err = os.ReadFile(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("could not read js: %w", err)
+		}
+	}
+
+	return configFromBundle(ctx, client, server, rawBody)
+}
+
+func parseServer(addr string) (*url.URL, error) {
+	server, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse server URL: %w", err)
+	}
+
+	if server.Scheme == "" {
+		server.Scheme = "http"
+	}
+
+	return server, nil
+}
+
+// fetch returns the body of the document at target, requested through client or transport.Client.
+func fetch(ctx context.Context, client *http.Client, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+
+	// The HTTP client has a timeout of its own, which must not cut short a fetch given a longer deadline.
+	client = clientOrDefault(client)
+	if deadline, ok := ctx.Deadline(); ok && client.Timeout != 0 && client.Timeout < time.Until(deadline) {
+		lifted := *client
+		lifted.Timeout = 0
+		client = &lifted
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not send request: %w", err)
 	}
 
 	defer resp.Body.Close()
 
-	rawBody, err = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpected, resp.Status)
+	}
+
+	rawBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("could not read response body: %w", err)
 	}
 
+	return rawBody, nil
+}
+
+// configFromBundle extracts the config of the deployment at server from its main JS file. Every setting that cannot
+// be extracted is reported, so a bundle from an unexpected build can be diagnosed in one go. The config sends its
+// requests through client.
+func configFromBundle(
+	ctx context.Context,
+	client *http.Client,
+	server *url.URL,
+	rawBody []byte,
+) (*RemoteConfig, error) {
+	progress.Report(ctx, "extracting configuration")
+
 	raw := make(map[string]string)
 
-	for name, reg := range configExtractors {
-		matches := reg.FindAllStringSubmatch(string(rawBody), -1)
+	var missing, ambiguous []string
+
+	for _, name := range slices.Sorted(maps.Keys(configExtractors)) {
+		matches := configExtractors[name].FindAllStringSubmatch(string(rawBody), -1)
 
-		slog.Debug("Found matches", "name", name, "matches", matches)
+		logger().Debug("Found matches", "name", name, "matches", matches)
 
-		if len(matches) != 1 {
-			return nil, fmt.Errorf("%w: could find extract %q (count=%v)", ErrUnexpected, name, len(matches))
+		switch len(matches) {
+		case 0:
+			missing = append(missing, name)
+		case 1:
+			raw[name] = matches[0][1]
+		default:
+			ambiguous = append(ambiguous, fmt.Sprintf("%s (%d matches)", name, len(matches)))
 		}
+	}
 
-		raw[name] = matches[0][1]
+	var problems []string
+
+	if len(missing) > 0 {
+		problems = append(problems, "not found: "+strings.Join(missing, ", "))
+	}
+
+	if len(ambiguous) > 0 {
+		problems = append(problems, "ambiguous: "+strings.Join(ambiguous, ", "))
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: could not extract the config from the JS file, %s", ErrUnexpected,
+			strings.Join(problems, "; "))
+	}
+
+	if matches := userPoolIDRegex.FindAllStringSubmatch(string(rawBody), -1); len(matches) == 1 {
+		raw["aws_user_pools_id"] = matches[0][1]
 	}
 
-	slog.Debug("Extracted raw config", "raw", raw)
+	logger().Debug("Extracted raw config", "raw", raw)
 
-	matches = scopeRegex.FindAllStringSubmatch(raw["oauth_scope"], -1)
+	matches := scopeRegex.FindAllStringSubmatch(raw["oauth_scope"], -1)
 
 	scopes := make([]string, 0, len(matches))
 
 	for _, match := range matches {
-		slog.Debug("Found scope match", "match", match)
+		logger().Debug("Found scope match", "match", match)
 
 		if len(match) != 2 {
 			return nil, fmt.Errorf("%w: invalid scope %q", ErrUnexpected, match[0])
@@ -152,13 +329,58 @@ func ExtractConfig(ctx context.Context, addr string) (*RemoteConfig, error) {
 		scopes = append(scopes, match[1])
 	}
 
+	var redirects []string
+
+	for _, uri := range strings.Split(raw["redirectSignIn"], ",") {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			redirects = append(redirects, uri)
+		}
+	}
+
 	return &RemoteConfig{
 		Server:            server.String(),
 		GraphQLEndpoint:   raw["aws_appsync_graphqlEndpoint"],
 		UserPoolClientID:  raw["aws_user_pools_web_client_id"],
+		UserPoolID:        raw["aws_user_pools_id"],
 		OAuthDomain:       raw["oauth_domain"],
 		OAuthResponseType: raw["oauth_responseType"],
 		OAuthScopes:       scopes,
 		RedirectSignIn:    raw["redirectSignIn"],
+		RedirectURIs:      redirects,
+		HTTPClient:        client,
 	}, nil
 }
+
+// AppURL returns the address of the TEAM web app: the first redirect URI the app client allows that does not lead
+// back to this machine, which is where the app is deployed, or else the server the config was extracted from.
+func (c *RemoteConfig) AppURL() string {
+	local := c.LocalRedirectURIs()
+
+	for _, uri := range c.RedirectURIs {
+		if u, err := url.Parse(uri); err == nil && u.Scheme == "https" && !slices.Contains(local, uri) {
+			return uri
+		}
+	}
+
+	return c.Server
+}
+
+// LocalRedirectURIs returns the allowed redirect URIs that lead back to this machine, which the browser login can
+// receive the authorization code on.
+func (c *RemoteConfig) LocalRedirectURIs() []string {
+	var local []string
+
+	for _, uri := range c.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme != "http" {
+			continue
+		}
+
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+			local = append(local, uri)
+		}
+	}
+
+	return local
+}
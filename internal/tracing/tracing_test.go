@@ -0,0 +1,90 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/tracing"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Setup changes the global tracer provider and the environment is process wide, so these tests do not run in
+// parallel.
+
+func TestEnabled(t *testing.T) {
+	for _, env := range []string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_SDK_DISABLED", "OTEL_TRACES_EXPORTER",
+	} {
+		t.Setenv(env, "")
+	}
+
+	require.False(t, tracing.Enabled())
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://localhost:4318/v1/traces")
+	require.True(t, tracing.Enabled())
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "none")
+	require.False(t, tracing.Enabled())
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "")
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	require.False(t, tracing.Enabled())
+}
+
+func TestSetup(t *testing.T) {
+	received := make(chan []byte, 1)
+
+	collector := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_SDK_DISABLED", "")
+	t.Setenv("OTEL_TRACES_EXPORTER", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf")
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	shutdown, err := tracing.Setup(context.Background(), "v1.2.3")
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "query GetRequest")
+	span.End()
+
+	require.NoError(t, shutdown(context.Background()))
+
+	// The protobuf encoding keeps strings as they are.
+	body := <-received
+	require.True(t, bytes.Contains(body, []byte("query GetRequest")))
+	require.True(t, bytes.Contains(body, []byte("team-cli")))
+	require.True(t, bytes.Contains(body, []byte("v1.2.3")))
+}
+
+func TestSetupDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	provider := otel.GetTracerProvider()
+
+	shutdown, err := tracing.Setup(context.Background(), "v1.2.3")
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+	require.Equal(t, provider, otel.GetTracerProvider())
+}
@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// skew holds the last measured clock skew, see ClockSkew.
+var skew atomic.Pointer[time.Duration]
+
+// ClockSkew returns how far the clocks of the servers talked to are ahead of the local clock, measured from the Date
+// header of the most recent response that had one. It is negative when the local clock is ahead, and false until a
+// response has been received through a configured client.
+func ClockSkew() (time.Duration, bool) {
+	d := skew.Load()
+	if d == nil {
+		return 0, false
+	}
+
+	return *d, true
+}
+
+// observeDate records the clock skew implied by a Date header received at the local time receivedAt.
+func observeDate(header string, receivedAt time.Time) {
+	if header == "" {
+		return
+	}
+
+	date, err := http.ParseTime(header)
+	if err != nil {
+		return
+	}
+
+	// The header has a resolution of a second, so the server's time lies somewhere within the second after it.
+	d := date.Add(time.Second / 2).Sub(receivedAt)
+
+	skew.Store(&d)
+}
+
+// dateObserver records the clock skew from every response passing through it.
+type dateObserver struct {
+	next http.RoundTripper
+}
+
+func (o dateObserver) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := o.next.RoundTrip(req)
+	if err == nil {
+		observeDate(resp.Header.Get("Date"), time.Now())
+	}
+
+	return resp, err
+}
@@ -0,0 +1,357 @@
+// Package transport holds the network settings shared by every outbound connection. HTTP requests and the
+// websocket dialer must both be created through this package so that proxy and TLS settings apply to all traffic.
+package transport
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrInvalidProxy    = errors.New("invalid proxy")
+	ErrInvalidCABundle = errors.New("invalid CA bundle")
+	// ErrOffline is returned for every connection attempted while Settings.Offline is set.
+	ErrOffline = errors.New("offline mode forbids network access")
+)
+
+// Settings configure outbound connections.
+type Settings struct {
+	// Proxy is the URL of a proxy used for all traffic. When empty, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are honoured.
+	Proxy string
+	// CABundle is the path of a PEM file whose certificates are trusted in addition to the system roots.
+	CABundle string
+	// InsecureSkipVerify disables certificate verification. It is only meant for throwaway test deployments.
+	InsecureSkipVerify bool
+	// Offline makes every connection fail immediately with ErrOffline, rather than waiting for dial timeouts on a
+	// machine without network.
+	Offline bool
+	// Timeouts bound how long network operations may take. Zero fields keep their defaults.
+	Timeouts Timeouts
+	// UserAgent is sent with every HTTP request and websocket handshake, unless the request sets its own.
+	UserAgent string
+	// WSReadLimit caps the size in bytes of a websocket message, DefaultWSReadLimit when zero.
+	WSReadLimit int64
+	// BodyLimit caps the size in bytes of an HTTP response body, DefaultBodyLimit when zero.
+	BodyLimit int64
+	// RateLimit bounds the rate of GraphQL requests to each endpoint. Zero fields keep their defaults.
+	RateLimit RateLimit
+}
+
+// RateLimit bounds the rate of requests with a token bucket.
+type RateLimit struct {
+	// Rate is the number of requests per second that can be sustained.
+	Rate float64
+	// Burst is the number of requests that can be sent at once after a quiet period.
+	Burst int
+}
+
+// DefaultRateLimit is generous enough for interactive use, while keeping bulk operations under AppSync's throttling.
+var DefaultRateLimit = RateLimit{Rate: 10, Burst: 20}
+
+func (r RateLimit) withDefaults() RateLimit {
+	return RateLimit{
+		Rate:  cmp.Or(r.Rate, DefaultRateLimit.Rate),
+		Burst: cmp.Or(r.Burst, DefaultRateLimit.Burst),
+	}
+}
+
+// DefaultWSReadLimit is the websocket read limit used when Settings.WSReadLimit is not set.
+const DefaultWSReadLimit = 4 << 20
+
+// DefaultBodyLimit is the HTTP response body limit used when Settings.BodyLimit is not set.
+const DefaultBodyLimit = 16 << 20
+
+// Timeouts bound how long network operations may take.
+type Timeouts struct {
+	// HTTP bounds each HTTP request, including reading the response.
+	HTTP time.Duration
+	// WSRead bounds the wait for the next websocket message, keep-alives included.
+	WSRead time.Duration
+	// WSWrite bounds sending each websocket message.
+	WSWrite time.Duration
+	// Subscribe bounds a whole subscription, from dialing the websocket to receiving the last message.
+	Subscribe time.Duration
+	// Handshake bounds each step of setting up a subscription: waiting for the connection and then the
+	// subscription to be acknowledged.
+	Handshake time.Duration
+}
+
+// DefaultTimeouts are the timeouts used for the fields of Settings.Timeouts that are not set.
+var DefaultTimeouts = Timeouts{
+	HTTP:      30 * time.Second,
+	WSRead:    60 * time.Second,
+	WSWrite:   10 * time.Second,
+	Subscribe: 3 * time.Minute,
+	Handshake: 15 * time.Second,
+}
+
+func (t Timeouts) withDefaults() Timeouts {
+	return Timeouts{
+		HTTP:      cmp.Or(t.HTTP, DefaultTimeouts.HTTP),
+		WSRead:    cmp.Or(t.WSRead, DefaultTimeouts.WSRead),
+		WSWrite:   cmp.Or(t.WSWrite, DefaultTimeouts.WSWrite),
+		Subscribe: cmp.Or(t.Subscribe, DefaultTimeouts.Subscribe),
+		Handshake: cmp.Or(t.Handshake, DefaultTimeouts.Handshake),
+	}
+}
+
+type proxyFunc func(*http.Request) (*url.URL, error)
+
+var (
+	mu          sync.RWMutex
+	proxy       proxyFunc = http.ProxyFromEnvironment
+	client      *http.Client
+	dialer      *websocket.Dialer
+	timeouts    = DefaultTimeouts
+	userAgent   string
+	wsReadLimit int64 = DefaultWSReadLimit
+	bodyLimit   int64 = DefaultBodyLimit
+	rateLimit         = DefaultRateLimit
+)
+
+const handshakeTimeout = 45 * time.Second
+
+// defaultClient is used until Configure is called. Unlike http.DefaultClient it does not wait forever for a server
+// that stops responding.
+var defaultClient = &http.Client{Timeout: DefaultTimeouts.HTTP}
+
+// defaultDialer is used until Configure is called. It is websocket.DefaultDialer, offering compression as the dialers
+// built by Configure do.
+var defaultDialer = &websocket.Dialer{
+	Proxy:             http.ProxyFromEnvironment,
+	HandshakeTimeout:  handshakeTimeout,
+	EnableCompression: true,
+}
+
+// Configure applies s to the clients returned by Client and Dialer.
+func Configure(s Settings) error {
+	p, err := newProxyFunc(s.Proxy)
+	if err != nil {
+		return err
+	}
+
+	p = loggedProxy(p)
+
+	tlsConfig, err := newTLSConfig(s.CABundle, s.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+
+	t := s.Timeouts.withDefaults()
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = p
+	tr.TLSClientConfig = tlsConfig
+
+	// Servers supporting permessage-deflate compress messages, such as large policies, both ways.
+	wsDialer := &websocket.Dialer{
+		Proxy:             p,
+		TLSClientConfig:   tlsConfig,
+		HandshakeTimeout:  handshakeTimeout,
+		EnableCompression: true,
+	}
+
+	if s.Offline {
+		tr.DialContext = dialOffline
+		wsDialer.NetDialContext = dialOffline
+	}
+
+	rt := dateObserver{next: userAgentSetter{next: tr, agent: s.UserAgent}}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	proxy = p
+	client = &http.Client{Transport: rt, Timeout: t.HTTP}
+	dialer = wsDialer
+	timeouts = t
+	userAgent = s.UserAgent
+	wsReadLimit = cmp.Or(s.WSReadLimit, DefaultWSReadLimit)
+	bodyLimit = cmp.Or(s.BodyLimit, DefaultBodyLimit)
+	rateLimit = s.RateLimit.withDefaults()
+
+	return nil
+}
+
+func dialOffline(_ context.Context, _ string, addr string) (net.Conn, error) {
+	return nil, fmt.Errorf("%w: not connecting to %s", ErrOffline, addr)
+}
+
+// Client returns the HTTP client to send requests with. Until Configure is called this is defaultClient.
+func Client() *http.Client {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if client == nil {
+		return defaultClient
+	}
+
+	return client
+}
+
+// CurrentTimeouts returns the timeouts configured with Configure, or DefaultTimeouts until it is called.
+func CurrentTimeouts() Timeouts {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return timeouts
+}
+
+// UserAgent returns the User-Agent configured with Configure, to be sent in websocket handshakes. It is empty until
+// Configure is called.
+func UserAgent() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return userAgent
+}
+
+// WSReadLimit returns the websocket read limit configured with Configure, or DefaultWSReadLimit.
+func WSReadLimit() int64 {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return wsReadLimit
+}
+
+// BodyLimit returns the HTTP response body limit configured with Configure, or DefaultBodyLimit.
+func BodyLimit() int64 {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return bodyLimit
+}
+
+// CurrentRateLimit returns the rate limit configured with Configure, or DefaultRateLimit until it is called.
+func CurrentRateLimit() RateLimit {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return rateLimit
+}
+
+// Dialer returns the websocket dialer to open connections with. Until Configure is called this is defaultDialer.
+func Dialer() *websocket.Dialer {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if dialer == nil {
+		return defaultDialer
+	}
+
+	return dialer
+}
+
+// ProxyFor returns the proxy that a request to target is sent through, or nil when it connects directly.
+func ProxyFor(target string) (*url.URL, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse target: %w", err)
+	}
+
+	mu.RLock()
+	p := proxy
+	mu.RUnlock()
+
+	return p(req)
+}
+
+func newProxyFunc(raw string) (proxyFunc, error) {
+	if raw == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProxy, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("%w: %q must use http, https or socks5", ErrInvalidProxy, raw)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: %q has no host", ErrInvalidProxy, raw)
+	}
+
+	return http.ProxyURL(u), nil
+}
+
+// newTLSConfig returns the TLS settings shared by all connections. Certificates in caBundle are added to the system
+// roots, so a bundle holding only a private CA does not break connections to public endpoints.
+func newTLSConfig(caBundle string, insecure bool) (*tls.Config, error) {
+	if insecure {
+		// Only reachable through an explicit opt-out, see Settings.InsecureSkipVerify.
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+
+	if caBundle == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(caBundle)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCABundle, err)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		slog.Debug("System certificate pool unavailable", "err", err)
+
+		roots = x509.NewCertPool()
+	}
+
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w: %s: no PEM encoded certificates found", ErrInvalidCABundle, caBundle)
+	}
+
+	return &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}, nil
+}
+
+func loggedProxy(p proxyFunc) proxyFunc {
+	return func(req *http.Request) (*url.URL, error) {
+		u, err := p(req)
+		if err == nil {
+			if u != nil {
+				slog.Debug("Using proxy", "host", req.URL.Host, "proxy", u.Redacted())
+			} else {
+				slog.Debug("Connecting directly", "host", req.URL.Host)
+			}
+		}
+
+		return u, err
+	}
+}
+
+// userAgentSetter sets the User-Agent of requests that do not have one.
+type userAgentSetter struct {
+	next  http.RoundTripper
+	agent string
+}
+
+func (s userAgentSetter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if s.agent == "" || req.Header.Get("User-Agent") != "" {
+		return s.next.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request it is given.
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", s.agent)
+
+	return s.next.RoundTrip(req)
+}
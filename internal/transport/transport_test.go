@@ -0,0 +1,255 @@
+package transport_test
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// The transport settings are process wide, so these tests do not run in parallel.
+
+func TestConfigureProxy(t *testing.T) {
+	var proxied string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute URL of the target.
+		proxied = r.URL.String()
+		_, _ = io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	require.NoError(t, transport.Configure(transport.Settings{Proxy: proxy.URL}))
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	resp, err := transport.Client().Get("http://team.example.invalid/path")
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "via proxy", string(body))
+	require.Equal(t, "http://team.example.invalid/path", proxied)
+
+	u, err := transport.ProxyFor("https://team.example.invalid")
+	require.NoError(t, err)
+	require.Equal(t, proxy.URL, u.String())
+
+	require.NotNil(t, transport.Dialer().Proxy)
+	u, err = transport.Dialer().Proxy(newRequest(t, "https://appsync.example.invalid/graphql"))
+	require.NoError(t, err)
+	require.Equal(t, proxy.URL, u.String())
+}
+
+func TestConfigureInvalidProxy(t *testing.T) {
+	for _, proxy := range []string{"ftp://proxy:21", "http://", "://bad"} {
+		err := transport.Configure(transport.Settings{Proxy: proxy})
+		require.ErrorIs(t, err, transport.ErrInvalidProxy, proxy)
+	}
+}
+
+func TestConfigureCABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "trusted")
+	}))
+	defer srv.Close()
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	require.NoError(t, transport.Configure(transport.Settings{}))
+
+	_, err := transport.Client().Get(srv.URL)
+	require.Error(t, err)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, cert, 0600))
+
+	require.NoError(t, transport.Configure(transport.Settings{CABundle: bundle}))
+
+	resp, err := transport.Client().Get(srv.URL)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "trusted", string(body))
+	require.NotNil(t, transport.Dialer().TLSClientConfig)
+}
+
+func TestConfigureInsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	require.NoError(t, transport.Configure(transport.Settings{InsecureSkipVerify: true}))
+
+	resp, err := transport.Client().Get(srv.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.True(t, transport.Dialer().TLSClientConfig.InsecureSkipVerify)
+}
+
+func TestConfigureInvalidCABundle(t *testing.T) {
+	dir := t.TempDir()
+
+	invalid := filepath.Join(dir, "invalid.pem")
+	require.NoError(t, os.WriteFile(invalid, []byte("not a certificate"), 0600))
+
+	missing := filepath.Join(dir, "missing.pem")
+
+	for _, bundle := range []string{invalid, missing} {
+		err := transport.Configure(transport.Settings{CABundle: bundle})
+		require.ErrorIs(t, err, transport.ErrInvalidCABundle)
+		require.ErrorContains(t, err, bundle)
+	}
+}
+
+func newRequest(t *testing.T, raw string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, raw, nil)
+	require.NoError(t, err)
+
+	return req
+}
+
+func TestConfigureOffline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	require.NoError(t, transport.Configure(transport.Settings{Offline: true}))
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	_, err := transport.Client().Get(srv.URL)
+	require.ErrorIs(t, err, transport.ErrOffline)
+
+	_, _, err = transport.Dialer().Dial("ws"+srv.URL[len("http"):], nil)
+	require.ErrorIs(t, err, transport.ErrOffline)
+}
+
+func TestClockSkew(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Date", time.Now().Add(10*time.Minute).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	require.NoError(t, transport.Configure(transport.Settings{}))
+
+	resp, err := transport.Client().Get(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	skew, ok := transport.ClockSkew()
+	require.True(t, ok)
+	require.InDelta(t, 10*time.Minute, skew, float64(2*time.Second))
+}
+
+func TestConfigureTimeouts(t *testing.T) {
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	require.NoError(t, transport.Configure(transport.Settings{Timeouts: transport.Timeouts{HTTP: 50 * time.Millisecond}}))
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	require.Equal(t, transport.Timeouts{
+		HTTP:      50 * time.Millisecond,
+		WSRead:    transport.DefaultTimeouts.WSRead,
+		WSWrite:   transport.DefaultTimeouts.WSWrite,
+		Subscribe: transport.DefaultTimeouts.Subscribe,
+		Handshake: transport.DefaultTimeouts.Handshake,
+	}, transport.CurrentTimeouts())
+
+	_, err := transport.Client().Get(server.URL)
+	require.ErrorContains(t, err, "Client.Timeout exceeded")
+}
+
+func TestConfigureUserAgent(t *testing.T) {
+	var agents []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+	}))
+	defer server.Close()
+
+	require.NoError(t, transport.Configure(transport.Settings{UserAgent: "team-cli/v1.2.3 (linux/amd64)"}))
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	require.Equal(t, "team-cli/v1.2.3 (linux/amd64)", transport.UserAgent())
+
+	resp, err := transport.Client().Get(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	// A User-Agent set by the request is kept.
+	req := newRequest(t, server.URL)
+	req.Header.Set("User-Agent", "custom")
+
+	resp, err = transport.Client().Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	require.Equal(t, []string{"team-cli/v1.2.3 (linux/amd64)", "custom"}, agents)
+}
+
+func TestConfigureRateLimit(t *testing.T) {
+	require.Equal(t, transport.DefaultRateLimit, transport.CurrentRateLimit())
+
+	require.NoError(t, transport.Configure(transport.Settings{RateLimit: transport.RateLimit{Rate: 2}}))
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	require.Equal(t, transport.RateLimit{Rate: 2, Burst: transport.DefaultRateLimit.Burst}, transport.CurrentRateLimit())
+}
+
+func TestConfigureBodyLimit(t *testing.T) {
+	require.Equal(t, int64(transport.DefaultBodyLimit), transport.BodyLimit())
+
+	require.NoError(t, transport.Configure(transport.Settings{BodyLimit: 1024}))
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	require.Equal(t, int64(1024), transport.BodyLimit())
+}
@@ -0,0 +1,196 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	xproxy "golang.org/x/net/proxy"
+)
+
+// ErrProxy is returned when a websocket could not be opened through a proxy, before the server was reached.
+var ErrProxy = errors.New("could not connect through proxy")
+
+// DialWebsocket opens a websocket connection to target with Dialer, through the proxy that ProxyFor picks for it.
+// Unlike the websocket package on its own, it also tunnels through proxies that are reached over TLS, and through
+// socks5h proxies.
+func DialWebsocket(ctx context.Context, target string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	d := Dialer()
+
+	proxyURL, err := ProxyFor(httpURL(target))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrProxy, err)
+	}
+
+	if proxyURL != nil && proxyURL.Scheme == "https" {
+		base := d
+		tunnel := *d
+		tunnel.Proxy = nil
+		tunnel.NetDialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialTLSProxy(ctx, base, proxyURL, addr)
+		}
+
+		d = &tunnel
+	}
+
+	if proxyURL != nil && (proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h") {
+		base := d
+		tunnel := *d
+		tunnel.Proxy = nil
+		tunnel.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialSOCKSProxy(ctx, base, proxyURL, network, addr)
+		}
+
+		d = &tunnel
+	}
+
+	ws, resp, err := d.DialContext(ctx, target, header)
+	if err != nil && proxyURL != nil && resp == nil && ctx.Err() == nil && !errors.Is(err, ErrOffline) {
+		return nil, nil, fmt.Errorf("%w %s: %w", ErrProxy, proxyURL.Redacted(), err)
+	}
+
+	return ws, resp, err
+}
+
+// httpURL returns the HTTP form of a websocket URL, which is what proxies are chosen for.
+func httpURL(target string) string {
+	if rest, ok := strings.CutPrefix(target, "ws://"); ok {
+		return "http://" + rest
+	}
+
+	if rest, ok := strings.CutPrefix(target, "wss://"); ok {
+		return "https://" + rest
+	}
+
+	return target
+}
+
+// dialTLSProxy opens a tunnel to addr through the HTTP proxy at proxyURL, which is reached over TLS with the settings
+// of d.
+func dialTLSProxy(ctx context.Context, d *websocket.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	forward := d.NetDialContext
+	if forward == nil {
+		var nd net.Dialer
+		forward = nd.DialContext
+	}
+
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "443")
+	}
+
+	raw, err := forward(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if d.TLSClientConfig != nil {
+		tlsConfig = d.TLSClientConfig.Clone()
+	}
+
+	tlsConfig.ServerName = proxyURL.Hostname()
+
+	conn := tls.Client(raw, tlsConfig)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := conn.HandshakeContext(ctx); err != nil {
+		_ = raw.Close()
+
+		return nil, fmt.Errorf("TLS handshake with proxy failed: %w", err)
+	}
+
+	if err := connect(conn, proxyURL, addr); err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// dialSOCKSProxy opens a connection to addr through the SOCKS5 proxy at proxyURL, which is reached with the settings
+// of d. Host names are resolved by the proxy.
+func dialSOCKSProxy(
+	ctx context.Context,
+	d *websocket.Dialer,
+	proxyURL *url.URL,
+	network string,
+	addr string,
+) (net.Conn, error) {
+	forward := d.NetDialContext
+	if forward == nil {
+		var nd net.Dialer
+		forward = nd.DialContext
+	}
+
+	dialer, err := xproxy.FromURL(proxyURL, contextDialer(forward))
+	if err != nil {
+		return nil, err
+	}
+
+	if cd, ok := dialer.(xproxy.ContextDialer); ok {
+		return cd.DialContext(ctx, network, addr)
+	}
+
+	return dialer.Dial(network, addr)
+}
+
+// contextDialer adapts a dial function to the dialer the proxy package forwards connections through.
+type contextDialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (f contextDialer) Dial(network, addr string) (net.Conn, error) {
+	return f(context.Background(), network, addr)
+}
+
+func (f contextDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+// connect asks the proxy at the other end of conn to tunnel to addr.
+func connect(conn net.Conn, proxyURL *url.URL, addr string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := req.Write(conn); err != nil {
+		return fmt.Errorf("failed to send CONNECT to proxy: %w", err)
+	}
+
+	// The proxy sends nothing more until the tunnel is used, so the reader cannot have buffered any of the tunnel.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return fmt.Errorf("failed to read CONNECT response from proxy: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy refused to connect to %s: %s", addr, resp.Status)
+	}
+
+	return nil
+}
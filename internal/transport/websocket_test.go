@@ -0,0 +1,248 @@
+package transport_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/csnewman/team-cli/internal/transport"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// tlsConnectProxy starts a proxy reached over TLS that tunnels CONNECT requests, or refuses them with status when it is
+// not zero. The returned function reports the targets it was asked for.
+func tlsConnectProxy(t *testing.T, status int) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	targets := make(chan string, 10)
+
+	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		targets <- r.Host
+
+		if status != 0 {
+			w.WriteHeader(status)
+
+			return
+		}
+
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			_ = upstream.Close()
+
+			return
+		}
+
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+		go func() {
+			_, _ = io.Copy(upstream, buf.Reader)
+			_ = upstream.Close()
+		}()
+
+		_, _ = io.Copy(conn, upstream)
+		_ = conn.Close()
+	}))
+	t.Cleanup(proxy.Close)
+
+	return proxy, func() []string {
+		var seen []string
+
+		for {
+			select {
+			case target := <-targets:
+				seen = append(seen, target)
+			default:
+				return seen
+			}
+		}
+	}
+}
+
+// trustProxy configures the transport to go through proxy, trusting its certificate.
+func trustProxy(t *testing.T, proxy *httptest.Server) {
+	t.Helper()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: proxy.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, cert, 0600))
+
+	require.NoError(t, transport.Configure(transport.Settings{Proxy: proxy.URL, CABundle: bundle}))
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+}
+
+func echoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer ws.Close()
+
+		kind, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		_ = ws.WriteMessage(kind, msg)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestDialWebsocketTLSProxy(t *testing.T) {
+	srv := echoServer(t)
+	proxy, targets := tlsConnectProxy(t, 0)
+	trustProxy(t, proxy)
+
+	ws, _, err := transport.DialWebsocket(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+
+	defer ws.Close()
+
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte("hello")))
+
+	_, msg, err := ws.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(msg))
+	require.Equal(t, []string{srv.Listener.Addr().String()}, targets())
+}
+
+// socksProxy starts a SOCKS5 proxy without authentication that connects every host name to upstream. The returned
+// function reports the targets it was asked for.
+func socksProxy(t *testing.T, upstream string) (string, func() []string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	targets := make(chan string, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				// Greeting: version, number of methods, methods. No authentication is chosen.
+				greeting := make([]byte, 2)
+				if _, err := io.ReadFull(conn, greeting); err != nil {
+					return
+				}
+
+				if _, err := io.ReadFull(conn, make([]byte, greeting[1])); err != nil {
+					return
+				}
+
+				_, _ = conn.Write([]byte{5, 0})
+
+				// Request: version, CONNECT, reserved, address type 3 (host name), length, name, port.
+				header := make([]byte, 5)
+				if _, err := io.ReadFull(conn, header); err != nil || header[3] != 3 {
+					return
+				}
+
+				name := make([]byte, header[4]+2)
+				if _, err := io.ReadFull(conn, name); err != nil {
+					return
+				}
+
+				targets <- string(name[:header[4]])
+
+				up, err := net.Dial("tcp", upstream)
+				if err != nil {
+					return
+				}
+
+				defer up.Close()
+
+				_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+				go func() { _, _ = io.Copy(up, conn) }()
+
+				_, _ = io.Copy(conn, up)
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), func() []string {
+		var seen []string
+
+		for {
+			select {
+			case target := <-targets:
+				seen = append(seen, target)
+			default:
+				return seen
+			}
+		}
+	}
+}
+
+func TestDialWebsocketSOCKSProxy(t *testing.T) {
+	srv := echoServer(t)
+	addr, targets := socksProxy(t, srv.Listener.Addr().String())
+
+	require.NoError(t, transport.Configure(transport.Settings{Proxy: "socks5h://" + addr}))
+
+	t.Cleanup(func() {
+		require.NoError(t, transport.Configure(transport.Settings{}))
+	})
+
+	// The host name does not resolve, so only the proxy can connect to it.
+	ws, _, err := transport.DialWebsocket(context.Background(), "ws://echo.invalid/", nil)
+	require.NoError(t, err)
+
+	defer ws.Close()
+
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte("hello")))
+
+	_, msg, err := ws.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(msg))
+	require.Equal(t, []string{"echo.invalid"}, targets())
+}
+
+func TestDialWebsocketProxyRefused(t *testing.T) {
+	srv := echoServer(t)
+	proxy, _ := tlsConnectProxy(t, http.StatusForbidden)
+	trustProxy(t, proxy)
+
+	_, resp, err := transport.DialWebsocket(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.Nil(t, resp)
+	require.ErrorIs(t, err, transport.ErrProxy)
+	require.ErrorContains(t, err, proxy.URL)
+	require.ErrorContains(t, err, "403 Forbidden")
+}